@@ -64,51 +64,20 @@ func mainLogic() {
 
 	fmt.Printf("ClientID: %s, AgentID: %s\n", clientInfo.ClientID, clientInfo.AgentID)
 
-	// IPC: truyền hàm requestOTP nhận channel otp riêng cho từng kết nối
-	go agent.StartIPCListener(
-		func(otpChan chan<- string) error {
-			otpMsg := agent.Message{
-				Type: agent.TypeRequestOTP,
-				Data: agent.AgentMessageData{
-					AgentID: clientInfo.AgentID,
-					Payload: nil,
-				},
-			}
-			resp, err := a.Request(otpMsg, 10*time.Second)
-			if err != nil {
-				logutil.CoreError("Request OTP error: %v", err)
-				return err
-			}
-			logutil.CoreInfo("Received OTP response: %+v", resp)
-			// Kiểm tra kiểu dữ liệu trả về
-			if m, ok := resp.Data.(map[string]interface{}); ok {
-				if otp, ok := m["otp"]; ok {
-					switch v := otp.(type) {
-					case string:
-						logutil.CoreInfo("Parsed OTP (string): %s", v)
-						otpChan <- v
-						return nil
-					case float64:
-						logutil.CoreInfo("Parsed OTP (float64): %.0f", v)
-						otpChan <- fmt.Sprintf("%.0f", v)
-						return nil
-					default:
-						logutil.CoreError("OTP type unknown: %T, value: %+v", v, v)
-					}
-				} else {
-					logutil.CoreError("OTP field not found in response: %+v", m)
-				}
-			} else if s, ok := resp.Data.(string); ok {
-				// Nếu trả về là string (trường hợp server trả về lỗi dạng chuỗi)
-				logutil.CoreError("OTP response error string: %s", s)
-				return fmt.Errorf("OTP response error: %s", s)
-			} else {
-				logutil.CoreError("OTP response parse failed: %+v", resp.Data)
-			}
-			return fmt.Errorf("no otp in response")
-		},
-		a.Conn,
-	)
+	// IPC: handler dùng chung cho mọi nền tảng, mọi yêu cầu lên server đều đi qua a.Request
+	ipcSecret, err := agent.LoadIPCSecret(cfg.IPCSecretFile)
+	if err != nil {
+		logutil.CoreError("load IPC secret error: %v", err)
+	}
+	if ipcSecret != "" {
+		logutil.CoreInfo("IPC yêu cầu shared secret từ %s", cfg.IPCSecretFile)
+		if cfg.IPCAllowLegacyNoSecret {
+			logutil.CoreError("Cảnh báo: IPCAllowLegacyNoSecret đang bật: bản tin GET_SECRET không có secret vẫn được nhận, hãy cập nhật credential provider rồi tắt")
+		}
+	}
+	ipcHandler := agent.NewIPCHandler(agent.NewAgentIPCBackend(a, clientInfo.AgentID, cfg.ServerAddr), ipcSecret)
+	ipcHandler.AllowLegacyNoSecret = cfg.IPCAllowLegacyNoSecret
+	go agent.StartIPCListener(ipcHandler)
 
 	// Gửi hello định kỳ 10s
 	go func() {
@@ -127,58 +96,12 @@ func mainLogic() {
 		}
 	}()
 
-	// Gửi log: dùng agent chính, không tạo agent riêng, mọi log đều gửi qua a.Request
-	go func() {
-		logPath := cfg.EventLog
-		offsetPath := cfg.OffsetFile
-		if !agent.IsAbsPath(offsetPath) {
-			cwd, _ := os.Getwd()
-			offsetPath = cwd + string(os.PathSeparator) + offsetPath
-		}
-		var lastSize int64 = 0
-		if b, err := os.ReadFile(offsetPath); err == nil {
-			fmt.Sscanf(string(b), "%d", &lastSize)
-		}
-		for {
-			file, err := os.Open(logPath)
-			if err != nil {
-				logutil.CoreError("WatchLogAndSend: open log file error: %v", err)
-				time.Sleep(cfg.Interval)
-				continue
-			}
-			stat, err := file.Stat()
-			if err != nil {
-				file.Close()
-				logutil.CoreError("WatchLogAndSend: stat log file error: %v", err)
-				time.Sleep(cfg.Interval)
-				continue
-			}
-			if stat.Size() < lastSize {
-				lastSize = 0
-			}
-			if stat.Size() > lastSize {
-				file.Seek(lastSize, 0)
-				buf := make([]byte, stat.Size()-lastSize)
-				_, err := file.Read(buf)
-				if err == nil {
-					lines := agent.SplitLines(string(buf))
-					for _, line := range lines {
-						if line == "" {
-							continue
-						}
-						logMsg := agent.LogData{Message: line}
-						msgData := agent.AgentMessageData{AgentID: clientInfo.AgentID, Payload: logMsg}
-						msg := agent.Message{Type: agent.TypeLog, Data: msgData}
-						_, _ = a.Request(msg, 10*time.Second)
-					}
-				}
-				lastSize = stat.Size()
-				os.WriteFile(offsetPath, []byte(fmt.Sprintf("%d", lastSize)), 0644)
-			}
-			file.Close()
-			time.Sleep(cfg.Interval)
-		}
-	}()
+	// Gửi log: mỗi nguồn log một goroutine, dùng agent chính, mọi log đều gửi qua a.Request
+	agent.WatchLogSources(cfg, func(data agent.LogData) error {
+		msg := agent.Message{Type: agent.TypeLog, Data: agent.AgentMessageData{AgentID: clientInfo.AgentID, Payload: data}}
+		_, err := a.Request(msg, 10*time.Second)
+		return err
+	})
 
 	select {}
 }
@@ -219,6 +142,14 @@ func main() {
 	if len(os.Args) > 1 {
 		switch os.Args[1] {
 		case "install-service":
+			// install-service --ipc-secret: cấp shared secret cho IPC lúc cài đặt
+			if len(os.Args) > 2 && os.Args[2] == "--ipc-secret" {
+				if _, err := agent.ProvisionIPCSecret(config.DefaultClientConfig().IPCSecretFile); err != nil {
+					fmt.Println("Provision IPC secret failed:", err)
+					return
+				}
+				fmt.Println("IPC secret provisioned!")
+			}
 			err = s.Install()
 			if err != nil {
 				logutil.CoreError("Install service failed: %v", err)
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"crypto/ed25519"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"gou-pc/internal/agent"
+	"gou-pc/internal/alert"
 	"gou-pc/internal/api"
 	"gou-pc/internal/api/repository"
 	"gou-pc/internal/api/service"
 	"gou-pc/internal/config"
+	"gou-pc/internal/detect"
+	"gou-pc/internal/logcollector"
+	"gou-pc/internal/logforward"
 	"gou-pc/internal/logutil"
 	"gou-pc/internal/tcpserver"
 	"net/http"
@@ -66,8 +73,12 @@ func InitAgentDB(path string) (*sql.DB, error) {
 		timeCreated := time.Now().Format("2006-01-02T15:04:05Z")
 
 		fmt.Printf("[DEBUG] Creating default admin user with id: %s, username: admin, password: 1\n", adminID)
+		hash, err := service.HashPassword("1")
+		if err != nil {
+			return nil, err
+		}
 		_, err = db.Exec(`INSERT INTO users (id, username, password, email, full_name, role, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-			adminID, "admin", "1", "admin@example.com", "ADMIN", "admin", timeCreated, timeCreated)
+			adminID, "admin", hash, "admin@example.com", "ADMIN", "admin", timeCreated, timeCreated)
 		if err != nil {
 			fmt.Printf("[DEBUG] Failed to create admin user: %v\n", err)
 			return nil, err
@@ -79,6 +90,90 @@ func InitAgentDB(path string) (*sql.DB, error) {
 	return db, nil
 }
 
+// InitLogDB mở DB SQLite lưu log (WAL để API đọc song song khi tcpserver đang ghi)
+func InitLogDB(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	if err := repository.CreateLogTables(db); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// newLogRepository chọn nơi lưu log theo cấu hình LogStore
+func newLogRepository(cfg *config.ServerConfig) (repository.LogRepository, error) {
+	if cfg.LogStore == "file" {
+		return repository.NewFileLogRepository(cfg.ArchiveFile, logcollector.RotationPolicy{
+			MaxSize:    cfg.ArchiveMaxSize,
+			MaxAge:     cfg.ArchiveMaxAge,
+			RetainAge:  cfg.ArchiveRetainAge,
+			RetainSize: cfg.ArchiveRetainSize,
+		}), nil
+	}
+	logDB, err := InitLogDB(cfg.LogDBFile)
+	if err != nil {
+		return nil, err
+	}
+	return repository.NewSQLiteLogRepository(logDB, cfg.ArchiveRetainAge), nil
+}
+
+// rotateLogsLoop định kỳ xoay vòng và áp dụng retention cho log store; retention xoá log và có key thì ký lại
+// checkpoint ngay để floor đã ký theo kịp, không thì kiểm tra chuỗi báo đứt ở đầu
+func rotateLogsLoop(logRepo repository.LogRepository, key ed25519.PrivateKey, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		before, _ := logRepo.ChainFloor()
+		if err := logRepo.RotateLog(); err != nil {
+			logutil.CoreError("Rotate log error: %v", err)
+		}
+		if after, err := logRepo.ChainFloor(); key != nil && err == nil && after != before {
+			if _, err := logRepo.CheckpointLog(key); err != nil {
+				logutil.CoreError("Checkpoint log chain error: %v", err)
+			}
+		}
+		<-ticker.C
+	}
+}
+
+// loadChainKeys đọc khoá ký checkpoint của chuỗi hash log và public key dùng để kiểm tra
+// (ArchiveChainPublicKey nếu cấu hình, không thì suy ra từ khoá ký)
+func loadChainKeys(cfg *config.ServerConfig) (ed25519.PrivateKey, ed25519.PublicKey, error) {
+	var key ed25519.PrivateKey
+	var pub ed25519.PublicKey
+	if cfg.ArchiveChainKeyFile != "" {
+		k, err := logcollector.LoadOrCreateChainKey(cfg.ArchiveChainKeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, pub = k, k.Public().(ed25519.PublicKey)
+	}
+	if cfg.ArchiveChainPublicKey != "" {
+		b, err := hex.DecodeString(cfg.ArchiveChainPublicKey)
+		if err != nil || len(b) != ed25519.PublicKeySize {
+			return nil, nil, fmt.Errorf("invalid ArchiveChainPublicKey")
+		}
+		pub = b
+	}
+	return key, pub, nil
+}
+
+// checkpointLogsLoop định kỳ ký mắt xích cuối của chuỗi hash log
+func checkpointLogsLoop(logRepo repository.LogRepository, key ed25519.PrivateKey, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		cp, err := logRepo.CheckpointLog(key)
+		if err != nil {
+			logutil.CoreError("Checkpoint log chain error: %v", err)
+		} else if cp != nil {
+			logutil.CoreDebug("Log chain checkpoint seq=%d hash=%s", cp.Seq, cp.Hash)
+		}
+	}
+}
+
 func main() {
 	cfg := config.DefaultServerConfig()
 	if err := logutil.InitCoreLogger(cfg.LogFile, logutil.DEBUG); err != nil {
@@ -100,13 +195,161 @@ func main() {
 	// Khởi tạo repository với SQLite
 	userRepo := repository.NewSQLiteUserRepository(db)
 	clientRepo := repository.NewSQLiteClientRepository(db)
-	// TODO: logRepo nếu cần
+	logRepo, err := newLogRepository(cfg)
+	if err != nil {
+		fmt.Printf("Could not open log DB: %v\n", err)
+		os.Exit(1)
+	}
+
+	chainKey, chainPub, err := loadChainKeys(cfg)
+	if err != nil {
+		fmt.Printf("Could not load log chain key: %v\n", err)
+		os.Exit(1)
+	}
+
+	// verify-logs: kiểm tra chuỗi hash của log store, in kết quả, thoát mã 1 nếu chuỗi bị đứt
+	if len(os.Args) > 1 && os.Args[1] == "verify-logs" {
+		report, err := logRepo.VerifyLogChain(chainPub)
+		if err != nil {
+			fmt.Printf("Verify logs failed: %v\n", err)
+			os.Exit(1)
+		}
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+		if !report.OK {
+			fmt.Printf("Log chain broken at seq %d (id %d): %s\n", report.Break.Seq, report.Break.ID, report.Break.Reason)
+			os.Exit(1)
+		}
+		fmt.Printf("Log chain OK: %d entries, %d checkpoints verified\n", report.Entries, report.Checkpoints)
+		return
+	}
+
+	// import-logs [file]: nạp file archive JSONL cũ vào log store rồi thoát
+	if len(os.Args) > 1 && os.Args[1] == "import-logs" {
+		if cfg.LogStore == "file" {
+			fmt.Println("import-logs requires LogStore = \"sqlite\"")
+			os.Exit(1)
+		}
+		archiveFile := cfg.ArchiveFile
+		if len(os.Args) > 2 {
+			archiveFile = os.Args[2]
+		}
+		n, err := repository.ImportArchiveFile(logRepo, archiveFile)
+		if err != nil {
+			fmt.Printf("Import logs failed after %d entries: %v\n", n, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Imported %d logs from %s\n", n, archiveFile)
+		return
+	}
+
+	// Engine cảnh báo: rule/cảnh báo lưu cùng DB agent, đánh giá trên log và trạng thái agent từ tcpserver
+	if err := repository.CreateAlertTables(db); err != nil {
+		fmt.Printf("Could not create alert tables: %v\n", err)
+		os.Exit(1)
+	}
+	alertRepo := repository.NewSQLiteAlertRepository(db)
+	notifiers, errs := alert.NewNotifiers(cfg.AlertChannels)
+	for _, err := range errs {
+		logutil.CoreError("%v", err)
+	}
+	alertEngine, err := alert.NewEngine(alertRepo, notifiers)
+	if err != nil {
+		fmt.Printf("Could not start alert engine: %v\n", err)
+		os.Exit(1)
+	}
+	tcpserver.InjectAlertObserver(alertEngine)
+
+	// Sự kiện đăng nhập (login_event từ credential provider qua agent) lưu cùng DB agent
+	if err := repository.CreateLoginEventTables(db); err != nil {
+		fmt.Printf("Could not create login event tables: %v\n", err)
+		os.Exit(1)
+	}
+	loginEventRepo := repository.NewSQLiteLoginEventRepository(db)
+	tcpserver.InjectLoginEventSink(loginEventRepo)
+
+	// Phát hiện brute-force/credential stuffing trên sự kiện đăng nhập và lần sai OTP, incident/khoá OTP lưu cùng DB agent
+	if err := repository.CreateIncidentTables(db); err != nil {
+		fmt.Printf("Could not create incident tables: %v\n", err)
+		os.Exit(1)
+	}
+	incidentRepo := repository.NewSQLiteIncidentRepository(db)
+	detector, err := detect.NewDetector(incidentRepo, cfg.BruteForce)
+	if err != nil {
+		fmt.Printf("Could not start brute-force detector: %v\n", err)
+		os.Exit(1)
+	}
+	tcpserver.InjectLoginDetector(detector)
+
+	// Phiên đăng nhập API (refresh token) lưu cùng bảng users
+	if err := repository.CreateSessionTables(db); err != nil {
+		fmt.Printf("Could not create session tables: %v\n", err)
+		os.Exit(1)
+	}
+	sessionRepo := repository.NewSQLiteSessionRepository(db)
+
+	// Role tự tạo (role có sẵn admin/operator/auditor/user nằm trong code)
+	if err := repository.CreateRoleTables(db); err != nil {
+		fmt.Printf("Could not create role tables: %v\n", err)
+		os.Exit(1)
+	}
+	roleRepo := repository.NewSQLiteRoleRepository(db)
+
+	// Audit log thao tác quản trị
+	if err := repository.CreateAuditTables(db); err != nil {
+		fmt.Printf("Could not create audit tables: %v\n", err)
+		os.Exit(1)
+	}
+	auditRepo := repository.NewSQLiteAuditRepository(db)
+
+	// Service account và API key (chỉ lưu hash)
+	if err := repository.CreateServiceAccountTables(db); err != nil {
+		fmt.Printf("Could not create service account tables: %v\n", err)
+		os.Exit(1)
+	}
+	serviceAccountRepo := repository.NewSQLiteServiceAccountRepository(db)
 
 	// Khởi tạo service
-	logService := service.NewLogService(cfg.ArchiveFile)
+	logService := service.NewLogService(logRepo, chainPub)
 	userService := service.NewUserService(userRepo)
+	// Băm mật khẩu plaintext còn trong bảng users từ phiên bản trước
+	if _, err := userService.MigratePasswords(); err != nil {
+		logutil.CoreError("migrate plaintext passwords: %v", err)
+	}
+	authService := service.NewAuthService(userService, sessionRepo, cfg.JWTSecret, cfg.JWTExpire, cfg.RefreshTokenExpire)
+	roleService, err := service.NewRoleService(roleRepo, userRepo)
+	if err != nil {
+		fmt.Printf("Could not load roles: %v\n", err)
+		os.Exit(1)
+	}
 	clientService := service.NewClientService(clientRepo, userRepo)
-	// TODO: logService nếu cần
+	alertService := service.NewAlertService(alertRepo, alertEngine)
+	loginEventService := service.NewLoginEventService(loginEventRepo)
+	incidentService := service.NewIncidentService(incidentRepo, detector)
+	auditService := service.NewAuditService(auditRepo)
+	apiKeyService := service.NewAPIKeyService(serviceAccountRepo, cfg.APIKeyExpire)
+
+	// tcpserver ghi log nhận từ agent vào log store theo lô
+	tcpserver.InjectLogSink(logRepo)
+	// Hub phát log realtime cho /api/logs/tail
+	logHub := logcollector.NewHub()
+	tcpserver.InjectLogHub(logHub)
+	// Chuyển tiếp log tới SIEM qua syslog, hostname/user của thiết bị lấy từ bảng client
+	logForwarder, errs := logforward.New(cfg.SyslogOutputs, func(agentID string) logforward.Meta {
+		c, err := clientRepo.ClientFindByAgentID(agentID)
+		if err != nil || c == nil {
+			return logforward.Meta{}
+		}
+		return logforward.Meta{Hostname: c.DeviceInfo.HostName, User: c.UserName}
+	})
+	for _, err := range errs {
+		logutil.CoreError("%v", err)
+	}
+	tcpserver.InjectLogForwarder(logForwarder)
+	go rotateLogsLoop(logRepo, chainKey, time.Minute)
+	if chainKey != nil && cfg.ArchiveCheckpointInterval > 0 {
+		go checkpointLogsLoop(logRepo, chainKey, cfg.ArchiveCheckpointInterval)
+	}
 
 	var wg sync.WaitGroup
 	wg.Add(3)
@@ -120,8 +363,16 @@ func main() {
 	go func() {
 		defer wg.Done()
 		fmt.Printf("Serving API at http://localhost:%s/\n", cfg.APIPort)
-		api.Start(cfg.APIPort, userService, clientService, logService, clientRepo, cfg.JWTSecret, cfg.JWTExpire)
+		api.Start(cfg.APIPort, userService, authService, clientService, logService, alertService, loginEventService, incidentService, roleService, auditService, apiKeyService, clientRepo, detector, logHub, logForwarder, cfg.JWTSecret, cfg.JWTExpire)
 	}()
+	// Syslog từ thiết bị agentless, tuỳ chọn
+	if cfg.SyslogUDPAddr != "" || cfg.SyslogTCPAddr != "" {
+		go func() {
+			if err := tcpserver.StartSyslog(cfg); err != nil {
+				logutil.CoreError("Syslog receiver error: %v", err)
+			}
+		}()
+	}
 	// Static web server
 	go func() {
 		fmt.Println("Serving static web at http://localhost:8080/")
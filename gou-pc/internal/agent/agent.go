@@ -3,11 +3,14 @@ package agent
 import (
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"gou-pc/internal/config"
 	"gou-pc/internal/crypto"
 	"io"
 	"net"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -17,13 +20,19 @@ import (
 )
 
 const (
-	TypeRegister   = "register"
-	TypeRequestOTP = "request_otp"
-	TypeHello      = "hello"
-	TypeLog        = "log"
-	TypeError      = "error"
+	TypeRegister      = "register"
+	TypeRequestOTP    = "request_otp"
+	TypeVerifyOTP     = "verify_otp"
+	TypeHello         = "hello"
+	TypeLog           = "log"
+	TypeSecurityEvent = "security_event"
+	TypeLoginEvent    = "login_event"
+	TypeError         = "error"
 )
 
+// ErrRequestTimeout trả về khi server không phản hồi kịp trong Agent.Request
+var ErrRequestTimeout = errors.New("request timeout")
+
 type Message struct {
 	Type string      `json:"type"`
 	Data interface{} `json:"data,omitempty"`
@@ -63,7 +72,13 @@ type AgentMessageData struct {
 // LogData dùng cho bản tin log
 // (có thể dùng AgentMessageData.Payload = LogData)
 type LogData struct {
-	Message string `json:"message"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"` // field do parser phía agent tách ra
+	Source  string            `json:"source,omitempty"` // nhãn nguồn log (LogSourceConfig.Name)
+
+	Time       string `json:"time,omitempty"`        // thời điểm xảy ra sự kiện (RFC3339), rỗng = server dùng giờ nhận
+	Severity   string `json:"severity,omitempty"`    // debug, info, notice, warning, error, critical
+	SourceFile string `json:"source_file,omitempty"` // file log chứa dòng này
 }
 
 func (a *Agent) Connect(addr string, timeout time.Duration) error {
@@ -135,7 +150,7 @@ func (a *Agent) Request(msg Message, timeout time.Duration) (Message, error) {
 	case resp := <-respChan:
 		return resp.Msg, resp.Err
 	case <-time.After(timeout):
-		return Message{}, fmt.Errorf("request timeout")
+		return Message{}, ErrRequestTimeout
 	}
 }
 
@@ -268,63 +283,17 @@ func RegisterAgent(a *Agent, configPath string) (clientID, agentID string, err e
 	return "", "", fmt.Errorf("đăng ký thất bại: %v", resp.Data)
 }
 
-// WatchLogAndSend theo dõi file log, gửi dòng mới cho server
-func (a *Agent) WatchLogAndSend(logPath string, interval time.Duration, agentID string) {
-	// Lưu offset vào cùng thư mục với logPath, tên file: <logPath>.offset
-	offsetPath := logPath + ".offset"
-	if !IsAbsPath(offsetPath) {
+// WatchLogAndSend theo dõi một file log (hoặc glob), tách field bằng parsers rồi gửi dòng mới cho server.
+// Checkpoint lưu cùng thư mục với file log.
+func (a *Agent) WatchLogAndSend(logPath string, interval time.Duration, agentID string, parsers []LogParser) {
+	if !IsAbsPath(logPath) {
 		cwd, _ := os.Getwd()
-		offsetPath = cwd + string(os.PathSeparator) + offsetPath
-	}
-	var lastSize int64 = 0
-	// Đọc offset từ file nếu có
-	if b, err := os.ReadFile(offsetPath); err == nil {
-		fmt.Sscanf(string(b), "%d", &lastSize)
-	}
-	for {
-		file, err := os.Open(logPath)
-		if err != nil {
-			logutil.CoreError("WatchLogAndSend: open log file error: %v", err)
-			time.Sleep(interval)
-			continue
-		}
-		stat, err := file.Stat()
-		if err != nil {
-			file.Close()
-			logutil.CoreError("WatchLogAndSend: stat log file error: %v", err)
-			time.Sleep(interval)
-			continue
-		}
-		if stat.Size() < lastSize {
-			// Nếu file bị truncate, chỉ gửi phần mới
-			lastSize = 0
-		}
-		if stat.Size() > lastSize {
-			file.Seek(lastSize, 0)
-			buf := make([]byte, stat.Size()-lastSize)
-			_, err := file.Read(buf)
-			if err == nil {
-				lines := SplitLines(string(buf))
-				for _, line := range lines {
-					if line == "" {
-						continue
-					}
-					logMsg := LogData{Message: line}
-					msgData := AgentMessageData{AgentID: agentID, Payload: logMsg}
-					msg := Message{Type: TypeLog, Data: msgData}
-					err := a.Send(msg)
-					if err != nil {
-						logutil.CoreError("WatchLogAndSend: send log line error: %v", err)
-					}
-				}
-			}
-			lastSize = stat.Size()
-			// Lưu lại offset ra file
-			os.WriteFile(offsetPath, []byte(fmt.Sprintf("%d", lastSize)), 0644)
-		}
-		file.Close()
-		time.Sleep(interval)
+		logPath = filepath.Join(cwd, logPath)
 	}
+	src := NewLogSource(config.LogSourceConfig{Name: filepath.Base(logPath), Path: logPath}, parsers, interval, filepath.Dir(logPath))
+	src.Run(func(data LogData) error {
+		return a.Send(Message{Type: TypeLog, Data: AgentMessageData{AgentID: agentID, Payload: data}})
+	}, nil)
 }
 
 func IsAbsPath(path string) bool {
@@ -0,0 +1,157 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/unicode/norm"
+)
+
+// encodingSniffSize là số byte đầu file dùng để nhận dạng encoding
+const encodingSniffSize = 4096
+
+// logEncoding mô tả cách tách dòng và giải mã sang UTF-8 cho một file log
+type logEncoding struct {
+	name     string
+	unit     int               // số byte mỗi code unit: 1 (UTF-8, code page) hoặc 2 (UTF-16)
+	newline  []byte            // '\n' đã mã hoá
+	cr       []byte            // '\r' đã mã hoá
+	bom      int               // số byte BOM ở đầu file, bỏ qua khi đọc
+	enc      encoding.Encoding // nil = UTF-8
+	fallback encoding.Encoding // giải mã dòng UTF-8 không hợp lệ (file ANSI không khai báo), nil = thay bằng U+FFFD
+}
+
+// lookupEncoding nhận tên encoding (utf-8, utf-16le, utf-16be, windows-1258, cp1252, shift_jis, ...), nil = UTF-8
+func lookupEncoding(name string) (encoding.Encoding, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "auto", "utf-8", "utf8":
+		return nil, nil
+	case "utf-16le", "utf16le", "utf-16":
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), nil
+	case "utf-16be", "utf16be":
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), nil
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown encoding %q", name)
+	}
+	return enc, nil
+}
+
+func newLogEncoding(name string, enc encoding.Encoding, bom int, fallback encoding.Encoding) *logEncoding {
+	e := &logEncoding{name: name, unit: 1, newline: []byte("\n"), cr: []byte("\r"), bom: bom, enc: enc}
+	switch name {
+	case "utf-16le":
+		e.unit, e.newline, e.cr = 2, []byte{'\n', 0}, []byte{'\r', 0}
+	case "utf-16be":
+		e.unit, e.newline, e.cr = 2, []byte{0, '\n'}, []byte{0, '\r'}
+	case "utf-8":
+		e.fallback = fallback
+	}
+	return e
+}
+
+// detectEncoding chọn encoding cho file từ các byte đầu file.
+// declared rỗng hoặc "auto": nhận BOM UTF-8/UTF-16, không có BOM thì đoán UTF-16 theo byte 0, còn lại là UTF-8
+// (dòng không phải UTF-8 hợp lệ được giải mã bằng fallback). declared là UTF-* thì BOM vẫn được bỏ qua.
+func detectEncoding(head []byte, declared string, fallback encoding.Encoding) (*logEncoding, error) {
+	name := strings.ToLower(strings.TrimSpace(declared))
+	if name == "" || name == "auto" || strings.HasPrefix(name, "utf") {
+		switch {
+		case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+			return newLogEncoding("utf-8", nil, 3, fallback), nil
+		case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+			return newLogEncoding("utf-16le", unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM), 2, nil), nil
+		case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+			return newLogEncoding("utf-16be", unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM), 2, nil), nil
+		}
+	}
+	if name == "" || name == "auto" {
+		name = sniffUTF16(head)
+	}
+	enc, err := lookupEncoding(name)
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "utf-16le", "utf16le", "utf-16":
+		name = "utf-16le"
+	case "utf-16be", "utf16be":
+		name = "utf-16be"
+	case "utf8":
+		name = "utf-8"
+	}
+	return newLogEncoding(name, enc, 0, fallback), nil
+}
+
+// sniffUTF16 đoán UTF-16 không BOM: văn bản ASCII mã hoá UTF-16 có byte 0 ở một phía của mỗi code unit
+func sniffUTF16(head []byte) string {
+	n := len(head) &^ 1
+	if n < 4 {
+		return "utf-8"
+	}
+	var zeroEven, zeroOdd int
+	for i := 0; i < n; i += 2 {
+		if head[i] == 0 {
+			zeroEven++
+		}
+		if head[i+1] == 0 {
+			zeroOdd++
+		}
+	}
+	units := n / 2
+	switch {
+	case zeroOdd*10 >= units*4 && zeroEven*10 < units:
+		return "utf-16le"
+	case zeroEven*10 >= units*4 && zeroOdd*10 < units:
+		return "utf-16be"
+	}
+	return "utf-8"
+}
+
+// indexNewline tìm '\n' đã mã hoá, chỉ nhận vị trí thẳng hàng code unit
+func (e *logEncoding) indexNewline(b []byte) int {
+	off := 0
+	for {
+		i := bytes.Index(b[off:], e.newline)
+		if i < 0 {
+			return -1
+		}
+		if (off+i)%e.unit == 0 {
+			return off + i
+		}
+		off += i + 1
+	}
+}
+
+// decode bỏ '\r' cuối dòng và chuyển dòng sang UTF-8.
+// Code page (vd windows-1258) ghi dấu thanh bằng ký tự tổ hợp nên kết quả được chuẩn hoá NFC.
+func (e *logEncoding) decode(b []byte) string {
+	if bytes.HasSuffix(b, e.cr) && (len(b)-len(e.cr))%e.unit == 0 {
+		b = b[:len(b)-len(e.cr)]
+	}
+	if e.enc == nil {
+		if utf8.Valid(b) {
+			return string(b)
+		}
+		if e.fallback != nil {
+			if s, err := e.fallback.NewDecoder().Bytes(b); err == nil {
+				return norm.NFC.String(string(s))
+			}
+		}
+		return strings.ToValidUTF8(string(b), "�")
+	}
+	s, err := e.enc.NewDecoder().Bytes(b)
+	if err != nil {
+		return strings.ToValidUTF8(string(b), "�")
+	}
+	if e.unit == 1 {
+		return norm.NFC.String(string(s))
+	}
+	return string(s)
+}
@@ -0,0 +1,87 @@
+package agent
+
+import (
+	"gou-pc/internal/config"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var utf8FixtureLines = []string{
+	"[2024-06-01 08:00:00] Đăng nhập thành công cho user 'an'",
+	"[2024-06-01 08:00:01] Logon failed for user 'bình'.",
+}
+
+// Fixture trong testdata/encoding cùng nội dung được ghi bằng các encoding khác nhau
+func TestLogSourceEncodingFixtures(t *testing.T) {
+	cases := []struct {
+		fixture  string
+		encoding string
+		fallback string
+		want     []string
+	}{
+		{"utf8.log", "", "", utf8FixtureLines},
+		{"utf8-bom.log", "auto", "", utf8FixtureLines},
+		{"utf8-bom.log", "utf-8", "", utf8FixtureLines},
+		{"utf16le-bom.log", "auto", "", utf8FixtureLines},
+		{"utf16be-bom.log", "auto", "", utf8FixtureLines},
+		{"utf16le.log", "auto", "", utf8FixtureLines},
+		{"utf16le.log", "utf-16le", "", utf8FixtureLines},
+		{"windows-1258.log", "windows-1258", "", []string{"[2024-06-01 08:00:02] Người dùng đã đăng xuất khỏi thiết bị"}},
+		{"windows-1258.log", "auto", "windows-1258", []string{"[2024-06-01 08:00:02] Người dùng đã đăng xuất khỏi thiết bị"}},
+		{"windows-1252.log", "cp1252", "", []string{"[2024-06-01 08:00:03] Café résumé naïve"}},
+		{"windows-1252.log", "auto", "windows-1252", []string{"[2024-06-01 08:00:03] Café résumé naïve"}},
+		{"windows-1252.log", "auto", "", []string{"[2024-06-01 08:00:03] Caf� r�sum� na�ve"}},
+	}
+	for _, c := range cases {
+		data, err := os.ReadFile(filepath.Join("testdata", "encoding", c.fixture))
+		if err != nil {
+			t.Fatalf("read fixture: %v", err)
+		}
+		dir := t.TempDir()
+		path := filepath.Join(dir, c.fixture)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		src := NewLogSource(config.LogSourceConfig{Name: "enc", Path: path, Encoding: c.encoding, FallbackEncoding: c.fallback}, nil, time.Second, dir)
+		src.Poll(func(d LogData) error { got = append(got, d.Message); return nil })
+		src.Close()
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s (encoding=%q fallback=%q): got %q, want %q", c.fixture, c.encoding, c.fallback, got, c.want)
+		}
+	}
+}
+
+// Dòng UTF-16 bị ghi dở giữa code unit không được tách sai ở byte '\n' lệch
+func TestLogSourceUTF16PartialWrite(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "encoding", "utf16le-bom.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	var got []string
+	src := NewLogSource(config.LogSourceConfig{Name: "enc", Path: path}, nil, time.Second, dir)
+	defer src.Close()
+	send := func(d LogData) error { got = append(got, d.Message); return nil }
+	for _, chunk := range [][]byte{data[:7], data[7:121], data[121:]} {
+		appendFile(t, path, string(chunk))
+		src.Poll(send)
+	}
+	if !reflect.DeepEqual(got, utf8FixtureLines) {
+		t.Errorf("got %q, want %q", got, utf8FixtureLines)
+	}
+}
+
+func TestDetectEncoding(t *testing.T) {
+	if _, err := detectEncoding([]byte("abc"), "klingon", nil); err == nil {
+		t.Error("unknown encoding should fail")
+	}
+	e, err := detectEncoding([]byte{'a', 0, 'b', 0, '\n', 0}, "", nil)
+	if err != nil || e.name != "utf-16le" || e.indexNewline([]byte{0, '\n', 0, 'x', '\n', 0}) != 4 {
+		t.Errorf("utf-16le sniff/alignment wrong: %+v, %v", e, err)
+	}
+}
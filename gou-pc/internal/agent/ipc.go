@@ -0,0 +1,342 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gou-pc/internal/logutil"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IPCHandler xử lý một kết nối IPC đã được chấp nhận.
+// Dùng chung cho named pipe (Windows) và Unix domain socket (Linux) để hai nền tảng hoạt động giống nhau.
+type IPCHandler interface {
+	ServeIPC(conn net.Conn)
+	Deny(conn net.Conn, reason error)
+}
+
+// ProtocolIPCHandler xử lý giao thức IPC JSON có tiền tố độ dài,
+// đồng thời giữ tương thích với bản tin text "GET_SECRET" cũ.
+type ProtocolIPCHandler struct {
+	Backend IPCBackend
+	Secret  string // shared secret cấp lúc cài đặt, rỗng nếu không bắt buộc
+	// AllowLegacyNoSecret cho bản tin "GET_SECRET" trần qua khi đã có Secret (credential provider cũ), mặc định tắt
+	AllowLegacyNoSecret bool
+
+	// DenyReportInterval là khoảng cách tối thiểu giữa hai lần báo kết nối bị từ chối lên server,
+	// các lần từ chối trong khoảng đó được gộp thành một sự kiện; 0 = ipcDenyReportInterval
+	DenyReportInterval time.Duration
+
+	// IdleTimeout là thời gian tối đa chờ client gửi yêu cầu kế tiếp hoặc nhận phản hồi, quá thì đóng kết nối
+	// để tiến trình cục bộ không giữ kết nối (và goroutine) mãi; 0 = ipcIdleTimeout
+	IdleTimeout time.Duration
+
+	reporterOnce sync.Once
+	denials      chan IPCEventData
+	dropped      atomic.Int64 // số lần từ chối không vào được hàng đợi, cộng vào sự kiện gộp kế tiếp
+}
+
+const (
+	ipcDenyReportInterval = 10 * time.Second
+	ipcDenyQueueSize      = 16
+	ipcIdleTimeout        = 30 * time.Second
+)
+
+// NewIPCHandler tạo handler IPC dùng backend của agent, secret rỗng nghĩa là không yêu cầu secret
+func NewIPCHandler(backend IPCBackend, secret string) *ProtocolIPCHandler {
+	return &ProtocolIPCHandler{Backend: backend, Secret: secret}
+}
+
+// Deny đóng kết nối bị từ chối, ghi log và đưa sự kiện bảo mật vào hàng đợi báo lên server.
+// Hàng đợi có giới hạn, đầy thì chỉ đếm để tiến trình cục bộ không tạo được vô hạn goroutine/kết nối tới server.
+func (h *ProtocolIPCHandler) Deny(conn net.Conn, reason error) {
+	conn.Close()
+	logutil.CoreError("Từ chối kết nối IPC: %v", reason)
+	log.Printf("Từ chối kết nối IPC: %v", reason)
+	h.reporterOnce.Do(func() {
+		h.denials = make(chan IPCEventData, ipcDenyQueueSize)
+		go h.reportDenials()
+	})
+	select {
+	case h.denials <- IPCEventData{Event: IPCEventAuthDenied, Message: reason.Error()}:
+	default:
+		h.dropped.Add(1)
+	}
+}
+
+// reportDenials là goroutine duy nhất báo kết nối bị từ chối: tối đa một sự kiện mỗi DenyReportInterval,
+// các lần từ chối đến trong lúc chờ được gộp vào sự kiện kế tiếp (message của lần cuối kèm số lần còn lại)
+func (h *ProtocolIPCHandler) reportDenials() {
+	interval := h.DenyReportInterval
+	if interval <= 0 {
+		interval = ipcDenyReportInterval
+	}
+	var last time.Time
+	for ev := range h.denials {
+		if wait := interval - time.Since(last); !last.IsZero() && wait > 0 {
+			more := int64(0)
+			timeout := time.After(wait)
+		collect:
+			for {
+				select {
+				case next := <-h.denials:
+					ev.Message = next.Message
+					more++
+				case <-timeout:
+					break collect
+				}
+			}
+			if more += h.dropped.Swap(0); more > 0 {
+				ev.Message = fmt.Sprintf("%s (and %d more)", ev.Message, more)
+			}
+		}
+		last = time.Now()
+		if err := h.Backend.ReportSecurityEvent(ev); err != nil {
+			logutil.CoreError("Không thể báo sự kiện bảo mật lên server: %v", err)
+		}
+	}
+}
+
+// extendDeadline gia hạn deadline đọc/ghi của kết nối thêm IdleTimeout tính từ bây giờ
+func (h *ProtocolIPCHandler) extendDeadline(conn net.Conn) {
+	timeout := h.IdleTimeout
+	if timeout <= 0 {
+		timeout = ipcIdleTimeout
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+}
+
+// ServeIPC đọc các yêu cầu từ kết nối và ghi phản hồi cho đến khi client đóng kết nối hoặc không gửi gì trong IdleTimeout.
+// Frame JSON luôn bắt đầu bằng byte 0 (độ dài <= 64KB), bản tin text cũ thì không.
+func (h *ProtocolIPCHandler) ServeIPC(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	h.extendDeadline(conn)
+	first, err := r.Peek(1)
+	if err != nil {
+		if err != io.EOF {
+			log.Printf("Không thể đọc từ kết nối IPC: %v", err)
+		}
+		conn.Close()
+		return
+	}
+	if first[0] != 0 {
+		h.serveLegacy(conn, r)
+		return
+	}
+	defer conn.Close()
+	for {
+		var req IPCRequest
+		h.extendDeadline(conn)
+		if err := ReadIPCFrame(r, &req); err != nil {
+			var ipcErr *IPCError
+			if errors.As(err, &ipcErr) {
+				_ = WriteIPCFrame(conn, IPCResponse{Version: IPCProtocolVersion, Error: ipcErr})
+			} else if err != io.EOF {
+				log.Printf("Không thể đọc từ kết nối IPC: %v", err)
+			}
+			return
+		}
+		if !checkIPCSecret(h.Secret, req.Auth) {
+			_ = WriteIPCFrame(conn, IPCResponse{
+				Version: IPCProtocolVersion,
+				ID:      req.ID,
+				Command: req.Command,
+				Error:   NewIPCError(IPCErrUnauthorized, "invalid or missing secret"),
+			})
+			h.Deny(conn, fmt.Errorf("command '%s': %w", req.Command, ErrIPCUnauthorized))
+			return
+		}
+		resp := h.Handle(req)
+		h.extendDeadline(conn) // Handle có thể chờ server lâu
+		if err := WriteIPCFrame(conn, resp); err != nil {
+			log.Printf("Không thể ghi phản hồi IPC: %v", err)
+			return
+		}
+	}
+}
+
+// serveLegacy xử lý bản tin text cũ của credential provider, phản hồi OTP hoặc "ERROR: ..."
+// Khi agent có shared secret, bản tin phải có dạng "GET_SECRET <secret>"; "GET_SECRET" trần chỉ được nhận
+// khi bật AllowLegacyNoSecret (credential provider cũ, khi đó chỉ dựa vào danh tính tiến trình đã kiểm tra lúc accept).
+func (h *ProtocolIPCHandler) serveLegacy(conn net.Conn, r io.Reader) {
+	buf := make([]byte, 1024)
+	h.extendDeadline(conn)
+	n, err := r.Read(buf)
+	if err != nil && err != io.EOF {
+		log.Printf("Không thể đọc từ kết nối IPC: %v", err)
+		conn.Close()
+		return
+	}
+	processedRequest := strings.TrimSpace(strings.ReplaceAll(string(buf[:n]), "\x00", ""))
+	command, secret, _ := strings.Cut(processedRequest, " ")
+	if command != IPCLegacyGetSecret {
+		log.Printf("Yêu cầu không xác định: '%s'", command)
+		conn.Write([]byte("ERROR: Unknown request"))
+		conn.Close()
+		return
+	}
+	secret = strings.TrimSpace(secret)
+	if !(secret == "" && h.AllowLegacyNoSecret) && !checkIPCSecret(h.Secret, secret) {
+		conn.Write([]byte("ERROR: Unauthorized"))
+		h.Deny(conn, fmt.Errorf("legacy GET_SECRET: %w", ErrIPCUnauthorized))
+		return
+	}
+	defer conn.Close()
+	log.Println("Yêu cầu 'GET_SECRET' hợp lệ. Đang yêu cầu OTP mới từ server...")
+	otp, ipcErr := h.getOTP()
+	h.extendDeadline(conn)
+	if ipcErr != nil {
+		switch ipcErr.Code {
+		case IPCErrNotConnected:
+			conn.Write([]byte("ERROR: Not connected to server"))
+		case IPCErrTimeout:
+			conn.Write([]byte("ERROR: Timeout waiting for OTP from server"))
+		default:
+			conn.Write([]byte("ERROR: Failed to request OTP from server"))
+		}
+		return
+	}
+	log.Println("Đã nhận được OTP, đang gửi cho client IPC.")
+	conn.Write([]byte(otp))
+}
+
+// Handle xử lý một yêu cầu IPC đã giải mã
+func (h *ProtocolIPCHandler) Handle(req IPCRequest) IPCResponse {
+	resp := IPCResponse{Version: IPCProtocolVersion, ID: req.ID, Command: req.Command}
+	if req.Version != IPCProtocolVersion {
+		resp.Error = NewIPCError(IPCErrUnsupportedVersion, "unsupported version %d, expected %d", req.Version, IPCProtocolVersion)
+		return resp
+	}
+	var data interface{}
+	var ipcErr *IPCError
+	switch req.Command {
+	case IPCCmdGetOTP:
+		var otp string
+		otp, ipcErr = h.getOTP()
+		if ipcErr == nil {
+			data = map[string]string{"otp": otp}
+		}
+	case IPCCmdVerifyOTP:
+		var in IPCVerifyOTPData
+		if err := json.Unmarshal(req.Data, &in); err != nil || in.OTP == "" {
+			ipcErr = NewIPCError(IPCErrBadRequest, "otp required")
+			break
+		}
+		var valid bool
+		valid, ipcErr = h.verifyOTP(in.OTP)
+		if ipcErr == nil {
+			data = map[string]bool{"valid": valid}
+		}
+	case IPCCmdAgentStatus:
+		data = h.Backend.Status()
+	case IPCCmdDeviceInfo:
+		dev, err := h.Backend.DeviceInfo()
+		if err != nil {
+			ipcErr = NewIPCError(IPCErrServer, "%v", err)
+			break
+		}
+		data = dev
+	case IPCCmdReportEvent:
+		var in IPCEventData
+		if err := json.Unmarshal(req.Data, &in); err != nil || in.Event == "" {
+			ipcErr = NewIPCError(IPCErrBadRequest, "event required")
+			break
+		}
+		if err := h.Backend.ReportEvent(in); err != nil {
+			ipcErr = toIPCError(err)
+			break
+		}
+		data = map[string]string{"result": "event reported"}
+	case IPCCmdLoginEvent:
+		var in LoginEventData
+		if err := json.Unmarshal(req.Data, &in); err != nil {
+			ipcErr = NewIPCError(IPCErrBadRequest, "invalid login event")
+			break
+		}
+		if err := in.Validate(); err != nil {
+			ipcErr = NewIPCError(IPCErrBadRequest, "%v", err)
+			break
+		}
+		if err := h.Backend.ReportLoginEvent(in); err != nil {
+			ipcErr = toIPCError(err)
+			break
+		}
+		data = map[string]string{"result": "login event reported"}
+	default:
+		ipcErr = NewIPCError(IPCErrUnknownCommand, "unknown command '%s'", req.Command)
+	}
+	if ipcErr != nil {
+		logutil.CoreError("IPC %s error: %v", req.Command, ipcErr)
+		resp.Error = ipcErr
+		return resp
+	}
+	resp.OK = true
+	resp.Data = data
+	return resp
+}
+
+func (h *ProtocolIPCHandler) getOTP() (string, *IPCError) {
+	if !h.Backend.Status().Connected {
+		return "", NewIPCError(IPCErrNotConnected, "not connected to server")
+	}
+	otp, err := h.Backend.RequestOTP()
+	if err != nil {
+		logutil.CoreError("Lỗi khi gửi yêu cầu OTP đến server: %v", err)
+		return "", toIPCError(err)
+	}
+	return otp, nil
+}
+
+func (h *ProtocolIPCHandler) verifyOTP(otp string) (bool, *IPCError) {
+	if !h.Backend.Status().Connected {
+		return false, NewIPCError(IPCErrNotConnected, "not connected to server")
+	}
+	valid, err := h.Backend.VerifyOTP(otp)
+	if err != nil {
+		return false, toIPCError(err)
+	}
+	return valid, nil
+}
+
+// toIPCError chuyển lỗi từ backend sang lỗi IPC có mã
+func toIPCError(err error) *IPCError {
+	var ipcErr *IPCError
+	if errors.As(err, &ipcErr) {
+		return ipcErr
+	}
+	if errors.Is(err, ErrRequestTimeout) {
+		return NewIPCError(IPCErrTimeout, "timeout waiting for server")
+	}
+	return NewIPCError(IPCErrServer, "%v", err)
+}
+
+// serveIPCListener chấp nhận kết nối trên listener và giao cho handler.
+// authorize (có thể nil) kiểm tra tiến trình gọi trước khi xử lý yêu cầu.
+func serveIPCListener(ln net.Listener, h IPCHandler, authorize func(net.Conn) error) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) || err == io.ErrClosedPipe {
+				log.Println("Trình nghe IPC đã dừng.")
+				return
+			}
+			logutil.CoreError("Không thể chấp nhận kết nối IPC: %v", err)
+			log.Printf("Không thể chấp nhận kết nối IPC: %v", err)
+			continue
+		}
+		if authorize != nil {
+			if err := authorize(conn); err != nil {
+				h.Deny(conn, err)
+				continue
+			}
+		}
+		go h.ServeIPC(conn)
+	}
+}
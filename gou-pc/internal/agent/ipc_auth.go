@@ -0,0 +1,52 @@
+package agent
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+)
+
+// IPCEventAuthDenied là tên sự kiện bảo mật gửi server khi từ chối một tiến trình gọi IPC
+const IPCEventAuthDenied = "ipc_auth_denied"
+
+// ErrIPCUnauthorized trả về khi shared secret của tiến trình gọi không hợp lệ
+var ErrIPCUnauthorized = errors.New("invalid or missing ipc secret")
+
+// LoadIPCSecret đọc shared secret IPC, trả về chuỗi rỗng nếu chưa được cấp (không bắt buộc secret)
+func LoadIPCSecret(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// ProvisionIPCSecret sinh shared secret IPC lúc cài đặt nếu chưa có, file chỉ owner đọc được
+func ProvisionIPCSecret(path string) (string, error) {
+	if secret, err := LoadIPCSecret(path); err != nil || secret != "" {
+		return secret, err
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(buf)
+	if err := os.WriteFile(path, []byte(secret), 0600); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// checkIPCSecret so sánh secret theo thời gian hằng, luôn đúng nếu agent không cấu hình secret
+func checkIPCSecret(expected, got string) bool {
+	if expected == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(got)) == 1
+}
@@ -0,0 +1,139 @@
+package agent
+
+import (
+	"fmt"
+	"gou-pc/internal/logutil"
+	"time"
+)
+
+// IPCBackend cung cấp các thao tác của agent cho kênh IPC
+type IPCBackend interface {
+	RequestOTP() (string, error)
+	VerifyOTP(otp string) (bool, error)
+	Status() AgentStatus
+	DeviceInfo() (*DeviceInfo, error)
+	ReportEvent(ev IPCEventData) error
+	ReportSecurityEvent(ev IPCEventData) error
+	ReportLoginEvent(ev LoginEventData) error
+}
+
+// AgentStatus là trạng thái agent trả về cho lệnh agent_status
+type AgentStatus struct {
+	AgentID       string `json:"agent_id"`
+	Connected     bool   `json:"connected"`
+	ServerAddr    string `json:"server_addr"`
+	StartedAt     string `json:"started_at"`
+	UptimeSeconds int64  `json:"uptime_seconds"`
+}
+
+// agentIPCBackend chuyển các yêu cầu IPC thành bản tin gửi server qua Agent.Request
+type agentIPCBackend struct {
+	agent      *Agent
+	agentID    string
+	serverAddr string
+	startedAt  time.Time
+	timeout    time.Duration
+}
+
+// NewAgentIPCBackend tạo backend IPC dùng kết nối server của agent
+func NewAgentIPCBackend(a *Agent, agentID, serverAddr string) IPCBackend {
+	return &agentIPCBackend{
+		agent:      a,
+		agentID:    agentID,
+		serverAddr: serverAddr,
+		startedAt:  time.Now(),
+		timeout:    10 * time.Second,
+	}
+}
+
+func (b *agentIPCBackend) RequestOTP() (string, error) {
+	otpMsg := Message{
+		Type: TypeRequestOTP,
+		Data: AgentMessageData{AgentID: b.agentID},
+	}
+	resp, err := b.agent.Request(otpMsg, b.timeout)
+	if err != nil {
+		logutil.CoreError("Request OTP error: %v", err)
+		return "", err
+	}
+	logutil.CoreInfo("Received OTP response: %+v", resp)
+	// Kiểm tra kiểu dữ liệu trả về
+	m, ok := resp.Data.(map[string]interface{})
+	if !ok {
+		// Nếu trả về là string (trường hợp server trả về lỗi dạng chuỗi)
+		logutil.CoreError("OTP response parse failed: %+v", resp.Data)
+		return "", fmt.Errorf("OTP response error: %v", resp.Data)
+	}
+	switch v := m["otp"].(type) {
+	case string:
+		if v != "" {
+			return v, nil
+		}
+	case float64:
+		return fmt.Sprintf("%.0f", v), nil
+	}
+	logutil.CoreError("OTP field not found in response: %+v", m)
+	return "", fmt.Errorf("no otp in response")
+}
+
+func (b *agentIPCBackend) VerifyOTP(otp string) (bool, error) {
+	msg := Message{
+		Type: TypeVerifyOTP,
+		Data: AgentMessageData{AgentID: b.agentID, Payload: IPCVerifyOTPData{OTP: otp}},
+	}
+	resp, err := b.agent.Request(msg, b.timeout)
+	if err != nil {
+		return false, err
+	}
+	m, ok := resp.Data.(map[string]interface{})
+	if !ok || resp.Type != TypeVerifyOTP {
+		return false, fmt.Errorf("verify OTP response error: %v", resp.Data)
+	}
+	valid, _ := m["valid"].(bool)
+	return valid, nil
+}
+
+func (b *agentIPCBackend) Status() AgentStatus {
+	return AgentStatus{
+		AgentID:       b.agentID,
+		Connected:     b.agent != nil && b.agent.Conn != nil,
+		ServerAddr:    b.serverAddr,
+		StartedAt:     b.startedAt.Format(time.RFC3339),
+		UptimeSeconds: int64(time.Since(b.startedAt).Seconds()),
+	}
+}
+
+func (b *agentIPCBackend) DeviceInfo() (*DeviceInfo, error) {
+	return GetDeviceInfo()
+}
+
+// ReportEvent gửi sự kiện từ ứng dụng local lên server dưới dạng một dòng log
+func (b *agentIPCBackend) ReportEvent(ev IPCEventData) error {
+	logMsg := LogData{Message: fmt.Sprintf("[EVENT] %s: %s", ev.Event, ev.Message), Time: time.Now().Format(time.RFC3339)}
+	msg := Message{Type: TypeLog, Data: AgentMessageData{AgentID: b.agentID, Payload: logMsg}}
+	_, err := b.agent.Request(msg, b.timeout)
+	return err
+}
+
+// ReportSecurityEvent gửi sự kiện bảo mật (ví dụ IPC bị từ chối) lên server
+func (b *agentIPCBackend) ReportSecurityEvent(ev IPCEventData) error {
+	msg := Message{Type: TypeSecurityEvent, Data: AgentMessageData{AgentID: b.agentID, Payload: ev}}
+	_, err := b.agent.Request(msg, b.timeout)
+	return err
+}
+
+// ReportLoginEvent gửi kết quả đăng nhập từ credential provider lên server, thiếu thời gian thì lấy giờ hiện tại
+func (b *agentIPCBackend) ReportLoginEvent(ev LoginEventData) error {
+	if ev.Time == "" {
+		ev.Time = time.Now().Format(time.RFC3339)
+	}
+	msg := Message{Type: TypeLoginEvent, Data: AgentMessageData{AgentID: b.agentID, Payload: ev}}
+	resp, err := b.agent.Request(msg, b.timeout)
+	if err != nil {
+		return err
+	}
+	if resp.Type == TypeError {
+		return fmt.Errorf("login event rejected: %v", resp.Data)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+//go:build linux
+// +build linux
+
+package agent
+
+import (
+	"fmt"
+	"gou-pc/internal/logutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// IPCSocketPath là Unix domain socket cho ứng dụng local lấy OTP trên Linux
+const IPCSocketPath = "/run/gou-pc/agent.sock"
+
+// StartIPCListener mở Unix domain socket IPC cho client
+func StartIPCListener(h IPCHandler) {
+	log.Println("Bắt đầu thực thi hàm StartIPCListener.")
+	ipcListener, err := listenUnixSocket(IPCSocketPath)
+	if err != nil {
+		logutil.CoreError("Không thể lắng nghe trên unix socket: %v", err)
+		log.Printf("Không thể lắng nghe trên unix socket: %v", err)
+		return
+	}
+	defer ipcListener.Close()
+	log.Printf("Trình nghe IPC đã bắt đầu thành công tại %s", IPCSocketPath)
+	serveIPCListener(ipcListener, h, checkPeerCred)
+}
+
+// listenUnixSocket tạo socket tại path, chỉ owner và group được kết nối (0660)
+func listenUnixSocket(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+	_ = os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// checkPeerCred dùng SO_PEERCRED, chỉ chấp nhận root hoặc cùng uid với agent
+func checkPeerCred(conn net.Conn) error {
+	cred, err := peerCred(conn)
+	if err != nil {
+		return err
+	}
+	if cred.Uid != 0 && int(cred.Uid) != os.Getuid() {
+		return fmt.Errorf("peer uid=%d pid=%d không được phép", cred.Uid, cred.Pid)
+	}
+	return nil
+}
+
+// peerCred lấy thông tin tiến trình phía bên kia của unix socket
+func peerCred(conn net.Conn) (*syscall.Ucred, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, fmt.Errorf("không phải unix socket: %T", conn)
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cred, credErr
+}
@@ -0,0 +1,82 @@
+//go:build linux
+// +build linux
+
+package agent
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnixSocketIPC(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ipc", "agent.sock")
+	ln, err := listenUnixSocket(path)
+	if err != nil {
+		t.Fatalf("listenUnixSocket error: %v", err)
+	}
+	defer ln.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("socket file not found: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0660 {
+		t.Errorf("unexpected socket permission: %o", perm)
+	}
+
+	h := NewIPCHandler(&fakeIPCBackend{connected: true, otp: "654321"}, "")
+	go serveIPCListener(ln, h, checkPeerCred)
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("dial unix socket failed: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET_SECRET")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	resp, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if string(resp) != "654321" {
+		t.Errorf("unexpected response: %q", resp)
+	}
+}
+
+func TestPeerCred(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	ln, err := listenUnixSocket(path)
+	if err != nil {
+		t.Fatalf("listenUnixSocket error: %v", err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, _ := ln.Accept()
+		accepted <- c
+	}()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer conn.Close()
+	peer := <-accepted
+	if peer == nil {
+		t.Fatal("accept failed")
+	}
+	defer peer.Close()
+
+	cred, err := peerCred(peer)
+	if err != nil {
+		t.Fatalf("peerCred error: %v", err)
+	}
+	if int(cred.Uid) != os.Getuid() || int(cred.Pid) != os.Getpid() {
+		t.Errorf("unexpected peer cred: %+v", cred)
+	}
+	if err := checkPeerCred(peer); err != nil {
+		t.Errorf("checkPeerCred rejected same uid: %v", err)
+	}
+}
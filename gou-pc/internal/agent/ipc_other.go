@@ -0,0 +1,11 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package agent
+
+import "gou-pc/internal/logutil"
+
+// StartIPCListener chưa hỗ trợ trên nền tảng này
+func StartIPCListener(h IPCHandler) {
+	logutil.CoreError("StartIPCListener: IPC chưa hỗ trợ trên nền tảng này")
+}
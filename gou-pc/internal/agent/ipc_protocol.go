@@ -0,0 +1,161 @@
+package agent
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Giao thức IPC: mỗi frame gồm 4 byte độ dài (big-endian) + JSON.
+// Bản tin text "GET_SECRET" cũ vẫn được hỗ trợ cho credential provider (C++).
+const (
+	IPCProtocolVersion = 1
+	IPCMaxFrameSize    = 65536
+	IPCLegacyGetSecret = "GET_SECRET"
+)
+
+// Các lệnh IPC
+const (
+	IPCCmdGetOTP      = "get_otp"
+	IPCCmdVerifyOTP   = "verify_otp"
+	IPCCmdAgentStatus = "agent_status"
+	IPCCmdDeviceInfo  = "device_info"
+	IPCCmdReportEvent = "report_event"
+	IPCCmdLoginEvent  = "login_event"
+)
+
+// Mã lỗi IPC
+const (
+	IPCErrBadRequest         = "bad_request"
+	IPCErrUnauthorized       = "unauthorized"
+	IPCErrUnsupportedVersion = "unsupported_version"
+	IPCErrUnknownCommand     = "unknown_command"
+	IPCErrNotConnected       = "not_connected"
+	IPCErrServer             = "server_error"
+	IPCErrTimeout            = "timeout"
+)
+
+// IPCRequest là yêu cầu từ ứng dụng local
+type IPCRequest struct {
+	Version int             `json:"version"`
+	ID      string          `json:"id,omitempty"` // client tự đặt, được trả lại trong response
+	Command string          `json:"command"`
+	Auth    string          `json:"auth,omitempty"` // shared secret, bắt buộc nếu agent đã được cấp secret
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// IPCResponse là phản hồi của agent
+type IPCResponse struct {
+	Version int         `json:"version"`
+	ID      string      `json:"id,omitempty"`
+	Command string      `json:"command"`
+	OK      bool        `json:"ok"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   *IPCError   `json:"error,omitempty"`
+}
+
+// IPCError là lỗi có mã để client xử lý theo kiểu
+type IPCError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *IPCError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// NewIPCError tạo lỗi IPC với mã và thông điệp
+func NewIPCError(code, format string, v ...interface{}) *IPCError {
+	return &IPCError{Code: code, Message: fmt.Sprintf(format, v...)}
+}
+
+// IPCVerifyOTPData là dữ liệu của lệnh verify_otp
+type IPCVerifyOTPData struct {
+	OTP string `json:"otp"`
+}
+
+// IPCEventData là dữ liệu của lệnh report_event
+type IPCEventData struct {
+	Event   string `json:"event"`
+	Message string `json:"message"`
+}
+
+// Kết quả và phương thức xác thực của login_event
+const (
+	LoginResultSuccess = "success"
+	LoginResultFailed  = "failed"
+
+	LoginMethodOTP      = "otp"      // mã OTP do agent cấp
+	LoginMethodRecovery = "recovery" // mã khôi phục khi không nhận được OTP
+	LoginMethodOffline  = "offline"  // xác thực offline khi agent không kết nối được server
+)
+
+// LoginEventData là dữ liệu của lệnh login_event, agent gửi nguyên cho server (bản tin TypeLoginEvent)
+type LoginEventData struct {
+	Username string `json:"username"`
+	Result   string `json:"result"`           // LoginResultSuccess hoặc LoginResultFailed
+	Method   string `json:"method,omitempty"` // LoginMethodOTP, LoginMethodRecovery, LoginMethodOffline; rỗng = không rõ
+	Reason   string `json:"reason,omitempty"` // lý do thất bại, vd "incorrect secret code"
+	Time     string `json:"time,omitempty"`   // RFC3339, rỗng = thời điểm agent nhận
+}
+
+// Validate kiểm tra các trường bắt buộc và giá trị của Result/Method
+func (d LoginEventData) Validate() error {
+	if strings.TrimSpace(d.Username) == "" {
+		return fmt.Errorf("username required")
+	}
+	if d.Result != LoginResultSuccess && d.Result != LoginResultFailed {
+		return fmt.Errorf("result must be %s or %s", LoginResultSuccess, LoginResultFailed)
+	}
+	switch d.Method {
+	case "", LoginMethodOTP, LoginMethodRecovery, LoginMethodOffline:
+	default:
+		return fmt.Errorf("method must be %s, %s or %s", LoginMethodOTP, LoginMethodRecovery, LoginMethodOffline)
+	}
+	if d.Time != "" {
+		if _, err := time.Parse(time.RFC3339Nano, d.Time); err != nil {
+			return fmt.Errorf("time must be RFC3339")
+		}
+	}
+	return nil
+}
+
+// WriteIPCFrame ghi một frame JSON có tiền tố độ dài
+func WriteIPCFrame(w io.Writer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(b) > IPCMaxFrameSize {
+		return fmt.Errorf("ipc frame too large: %d", len(b))
+	}
+	lenBytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(lenBytes, uint32(len(b)))
+	if _, err := w.Write(append(lenBytes, b...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReadIPCFrame đọc một frame JSON có tiền tố độ dài vào v
+func ReadIPCFrame(r io.Reader, v interface{}) error {
+	lenBuf := make([]byte, 4)
+	if _, err := io.ReadFull(r, lenBuf); err != nil {
+		return err
+	}
+	length := binary.BigEndian.Uint32(lenBuf)
+	if length == 0 || length > IPCMaxFrameSize {
+		return NewIPCError(IPCErrBadRequest, "invalid frame length %d", length)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(buf, v); err != nil {
+		return NewIPCError(IPCErrBadRequest, "invalid json: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeIPCBackend là backend giả cho test, không cần kết nối server
+type fakeIPCBackend struct {
+	connected bool
+	otp       string
+	otpErr    error
+	events    []IPCEventData
+	logins    []LoginEventData
+	security  chan IPCEventData
+}
+
+func (f *fakeIPCBackend) RequestOTP() (string, error) { return f.otp, f.otpErr }
+func (f *fakeIPCBackend) VerifyOTP(otp string) (bool, error) {
+	return otp == f.otp, f.otpErr
+}
+func (f *fakeIPCBackend) Status() AgentStatus {
+	return AgentStatus{AgentID: "001", Connected: f.connected}
+}
+func (f *fakeIPCBackend) DeviceInfo() (*DeviceInfo, error) {
+	return &DeviceInfo{HostName: "host", HardwareID: "hw"}, nil
+}
+func (f *fakeIPCBackend) ReportEvent(ev IPCEventData) error {
+	f.events = append(f.events, ev)
+	return nil
+}
+func (f *fakeIPCBackend) ReportSecurityEvent(ev IPCEventData) error {
+	if f.security != nil {
+		f.security <- ev
+	}
+	return nil
+}
+
+func (f *fakeIPCBackend) ReportLoginEvent(ev LoginEventData) error {
+	f.logins = append(f.logins, ev)
+	return nil
+}
+
+// roundTripLegacy gửi bản tin text cũ qua net.Pipe tới handler và đọc toàn bộ phản hồi
+func roundTripLegacy(t *testing.T, h IPCHandler, request string) string {
+	client, server := net.Pipe()
+	go h.ServeIPC(server)
+	defer client.Close()
+	if _, err := client.Write([]byte(request)); err != nil {
+		t.Fatalf("write request failed: %v", err)
+	}
+	resp, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatalf("read response failed: %v", err)
+	}
+	return string(resp)
+}
+
+func TestIPCLegacyGetSecret(t *testing.T) {
+	cases := []struct {
+		name    string
+		backend *fakeIPCBackend
+		request string
+		want    string
+	}{
+		{"ok", &fakeIPCBackend{connected: true, otp: "123456"}, "GET_SECRET\x00\r\n", "123456"},
+		{"unknown request", &fakeIPCBackend{connected: true}, "HELLO", "ERROR: Unknown request"},
+		{"not connected", &fakeIPCBackend{}, "GET_SECRET", "ERROR: Not connected to server"},
+		{"request failed", &fakeIPCBackend{connected: true, otpErr: errors.New("boom")}, "GET_SECRET", "ERROR: Failed to request OTP from server"},
+		{"timeout", &fakeIPCBackend{connected: true, otpErr: ErrRequestTimeout}, "GET_SECRET", "ERROR: Timeout waiting for OTP from server"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := roundTripLegacy(t, NewIPCHandler(tc.backend, ""), tc.request); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestIPCProtocolCommands(t *testing.T) {
+	backend := &fakeIPCBackend{connected: true, otp: "111222"}
+	client, server := net.Pipe()
+	defer client.Close()
+	go NewIPCHandler(backend, "").ServeIPC(server)
+
+	call := func(req IPCRequest) IPCResponse {
+		t.Helper()
+		if err := WriteIPCFrame(client, req); err != nil {
+			t.Fatalf("write frame failed: %v", err)
+		}
+		var resp IPCResponse
+		if err := ReadIPCFrame(client, &resp); err != nil {
+			t.Fatalf("read frame failed: %v", err)
+		}
+		if resp.Version != IPCProtocolVersion || resp.ID != req.ID {
+			t.Errorf("unexpected envelope: %+v", resp)
+		}
+		return resp
+	}
+
+	resp := call(IPCRequest{Version: 1, ID: "1", Command: IPCCmdGetOTP})
+	if !resp.OK || resp.Data.(map[string]interface{})["otp"] != "111222" {
+		t.Errorf("get_otp: %+v", resp)
+	}
+	resp = call(IPCRequest{Version: 1, ID: "2", Command: IPCCmdVerifyOTP, Data: json.RawMessage(`{"otp":"111222"}`)})
+	if !resp.OK || resp.Data.(map[string]interface{})["valid"] != true {
+		t.Errorf("verify_otp: %+v", resp)
+	}
+	resp = call(IPCRequest{Version: 1, ID: "3", Command: IPCCmdVerifyOTP})
+	if resp.OK || resp.Error == nil || resp.Error.Code != IPCErrBadRequest {
+		t.Errorf("verify_otp without data: %+v", resp)
+	}
+	resp = call(IPCRequest{Version: 1, ID: "4", Command: IPCCmdAgentStatus})
+	if !resp.OK || resp.Data.(map[string]interface{})["agent_id"] != "001" {
+		t.Errorf("agent_status: %+v", resp)
+	}
+	resp = call(IPCRequest{Version: 1, ID: "5", Command: IPCCmdDeviceInfo})
+	if !resp.OK || resp.Data.(map[string]interface{})["hostName"] != "host" {
+		t.Errorf("device_info: %+v", resp)
+	}
+	resp = call(IPCRequest{Version: 1, ID: "6", Command: IPCCmdReportEvent, Data: json.RawMessage(`{"event":"logon","message":"ok"}`)})
+	if !resp.OK || len(backend.events) != 1 || backend.events[0].Event != "logon" {
+		t.Errorf("report_event: %+v, events=%v", resp, backend.events)
+	}
+	resp = call(IPCRequest{Version: 1, ID: "6", Command: IPCCmdLoginEvent,
+		Data: json.RawMessage(`{"username":"CORP\\bob","result":"failed","method":"otp","reason":"incorrect secret code"}`)})
+	if !resp.OK || len(backend.logins) != 1 || backend.logins[0].Username != `CORP\bob` || backend.logins[0].Method != LoginMethodOTP {
+		t.Errorf("login_event: %+v, logins=%v", resp, backend.logins)
+	}
+	for _, data := range []string{`{"result":"failed"}`, `{"username":"bob","result":"locked"}`,
+		`{"username":"bob","result":"success","method":"sms"}`, `{"username":"bob","result":"success","time":"yesterday"}`} {
+		resp = call(IPCRequest{Version: 1, ID: "6", Command: IPCCmdLoginEvent, Data: json.RawMessage(data)})
+		if resp.OK || resp.Error.Code != IPCErrBadRequest {
+			t.Errorf("invalid login_event %s should be rejected: %+v", data, resp)
+		}
+	}
+	if len(backend.logins) != 1 {
+		t.Errorf("invalid login events must not be forwarded: %v", backend.logins)
+	}
+	resp = call(IPCRequest{Version: 1, ID: "7", Command: "reboot"})
+	if resp.OK || resp.Error.Code != IPCErrUnknownCommand {
+		t.Errorf("unknown command: %+v", resp)
+	}
+	resp = call(IPCRequest{Version: 99, ID: "8", Command: IPCCmdGetOTP})
+	if resp.OK || resp.Error.Code != IPCErrUnsupportedVersion {
+		t.Errorf("bad version: %+v", resp)
+	}
+}
+
+func TestIPCProtocolErrorCodes(t *testing.T) {
+	h := NewIPCHandler(&fakeIPCBackend{}, "")
+	resp := h.Handle(IPCRequest{Version: 1, Command: IPCCmdGetOTP})
+	if resp.OK || resp.Error.Code != IPCErrNotConnected {
+		t.Errorf("expected not_connected, got %+v", resp)
+	}
+	h = NewIPCHandler(&fakeIPCBackend{connected: true, otpErr: ErrRequestTimeout}, "")
+	resp = h.Handle(IPCRequest{Version: 1, Command: IPCCmdGetOTP})
+	if resp.OK || resp.Error.Code != IPCErrTimeout {
+		t.Errorf("expected timeout, got %+v", resp)
+	}
+}
+
+func TestIPCSharedSecret(t *testing.T) {
+	backend := &fakeIPCBackend{connected: true, otp: "999000", security: make(chan IPCEventData, 4)}
+	h := NewIPCHandler(backend, "s3cret")
+	h.DenyReportInterval = time.Millisecond
+
+	if got := roundTripLegacy(t, h, "GET_SECRET s3cret"); got != "999000" {
+		t.Errorf("legacy with secret: got %q", got)
+	}
+	if got := roundTripLegacy(t, h, "GET_SECRET"); got != "ERROR: Unauthorized" {
+		t.Errorf("legacy without secret: got %q", got)
+	}
+	if ev := <-backend.security; ev.Event != IPCEventAuthDenied {
+		t.Errorf("unexpected security event: %+v", ev)
+	}
+	if got := roundTripLegacy(t, h, "GET_SECRET wrong"); got != "ERROR: Unauthorized" {
+		t.Errorf("legacy with wrong secret: got %q", got)
+	}
+	if ev := <-backend.security; ev.Event != IPCEventAuthDenied {
+		t.Errorf("unexpected security event: %+v", ev)
+	}
+	// Credential provider cũ chỉ được nhận khi bật rõ ràng, secret sai vẫn bị từ chối
+	h.AllowLegacyNoSecret = true
+	if got := roundTripLegacy(t, h, "GET_SECRET"); got != "999000" {
+		t.Errorf("legacy without secret when allowed: got %q", got)
+	}
+	if got := roundTripLegacy(t, h, "GET_SECRET wrong"); got != "ERROR: Unauthorized" {
+		t.Errorf("legacy with wrong secret when allowed: got %q", got)
+	}
+	h.AllowLegacyNoSecret = false
+	if ev := <-backend.security; ev.Event != IPCEventAuthDenied {
+		t.Errorf("unexpected security event: %+v", ev)
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go h.ServeIPC(server)
+	call := func(req IPCRequest) IPCResponse {
+		t.Helper()
+		if err := WriteIPCFrame(client, req); err != nil {
+			t.Fatalf("write frame failed: %v", err)
+		}
+		var resp IPCResponse
+		if err := ReadIPCFrame(client, &resp); err != nil {
+			t.Fatalf("read frame failed: %v", err)
+		}
+		return resp
+	}
+	if resp := call(IPCRequest{Version: 1, Command: IPCCmdGetOTP, Auth: "s3cret"}); !resp.OK {
+		t.Errorf("get_otp with secret: %+v", resp)
+	}
+	if resp := call(IPCRequest{Version: 1, Command: IPCCmdGetOTP, Auth: "wrong"}); resp.OK || resp.Error.Code != IPCErrUnauthorized {
+		t.Errorf("get_otp with wrong secret: %+v", resp)
+	}
+	if ev := <-backend.security; ev.Event != IPCEventAuthDenied {
+		t.Errorf("unexpected security event: %+v", ev)
+	}
+}
+
+func TestIPCDenyReportCoalesced(t *testing.T) {
+	backend := &fakeIPCBackend{security: make(chan IPCEventData, 100)}
+	h := NewIPCHandler(backend, "s3cret")
+	h.DenyReportInterval = 200 * time.Millisecond
+	for i := 0; i < 50; i++ {
+		client, server := net.Pipe()
+		h.Deny(server, fmt.Errorf("attempt %d: %w", i, ErrIPCUnauthorized))
+		client.Close()
+	}
+	// Lần đầu báo ngay, 49 lần còn lại gộp thành một sự kiện: message của một lần kèm "(and 48 more)"
+	var got []IPCEventData
+	timeout := time.After(time.Second)
+	for len(got) < 2 {
+		select {
+		case ev := <-backend.security:
+			got = append(got, ev)
+		case <-timeout:
+			t.Fatalf("expected 2 reports, got %+v", got)
+		}
+	}
+	if got[0].Message != "attempt 0: "+ErrIPCUnauthorized.Error() || !strings.HasSuffix(got[1].Message, "(and 48 more)") {
+		t.Errorf("repeated denials should be coalesced: %+v", got)
+	}
+	select {
+	case ev := <-backend.security:
+		t.Errorf("unexpected extra report: %+v", ev)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestIPCIdleTimeout(t *testing.T) {
+	h := NewIPCHandler(&fakeIPCBackend{connected: true, otp: "111222"}, "")
+	h.IdleTimeout = 50 * time.Millisecond
+	serve := func(conn net.Conn) <-chan struct{} {
+		done := make(chan struct{})
+		go func() {
+			h.ServeIPC(conn)
+			close(done)
+		}()
+		return done
+	}
+	wait := func(name string, done <-chan struct{}) {
+		t.Helper()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s: idle connection not closed", name)
+		}
+	}
+
+	// Không gửi byte nào
+	client, server := net.Pipe()
+	defer client.Close()
+	wait("silent client", serve(server))
+
+	// Gửi một frame rồi im lặng
+	client, server = net.Pipe()
+	defer client.Close()
+	done := serve(server)
+	if err := WriteIPCFrame(client, IPCRequest{Version: 1, ID: "1", Command: IPCCmdGetOTP}); err != nil {
+		t.Fatal(err)
+	}
+	var resp IPCResponse
+	if err := ReadIPCFrame(client, &resp); err != nil || !resp.OK {
+		t.Fatalf("first request failed: %+v, %v", resp, err)
+	}
+	wait("idle after frame", done)
+
+	// Bản tin cũ mà client không đọc phản hồi
+	client, server = net.Pipe()
+	defer client.Close()
+	done = serve(server)
+	go client.Write([]byte("G"))
+	wait("legacy", done)
+}
+
+func TestProvisionIPCSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ipc.secret")
+	if secret, err := LoadIPCSecret(path); err != nil || secret != "" {
+		t.Fatalf("missing secret file should mean no secret: %q, %v", secret, err)
+	}
+	first, err := ProvisionIPCSecret(path)
+	if err != nil || len(first) != 64 {
+		t.Fatalf("ProvisionIPCSecret: %q, %v", first, err)
+	}
+	second, err := ProvisionIPCSecret(path)
+	if err != nil || second != first {
+		t.Errorf("ProvisionIPCSecret must keep existing secret: %q != %q", second, first)
+	}
+}
@@ -4,89 +4,77 @@
 package agent
 
 import (
+	"fmt"
 	"gou-pc/internal/logutil"
-	"io"
 	"log"
 	"net"
 	"os"
-	"strings"
-	"time"
 
 	"github.com/Microsoft/go-winio"
+	"golang.org/x/sys/windows"
 )
 
-// var ipcListener net.Listener
+// IPCPipePath là named pipe mà credential provider (C++) kết nối tới
+const IPCPipePath = `\\.\pipe\MySecretServicePipe`
+
+// ipcPipeSDDL chỉ cho phép LocalSystem (agent service và LogonUI.exe) mở pipe
+const ipcPipeSDDL = "D:P(A;;GA;;;SY)"
 
 // StartIPCListener mở named pipe IPC cho client
-// requestOTP: hàm gửi yêu cầu OTP lên server, nhận channel otp để trả về
-// serverConn: kết nối TCP tới server (có thể nil nếu chưa kết nối)
-func StartIPCListener(requestOTP func(chan<- string) error, serverConn net.Conn) {
+func StartIPCListener(h IPCHandler) {
 	log.Println("Bắt đầu thực thi hàm StartIPCListener.")
-	pipePath := `\\.\pipe\MySecretServicePipe`
-	_ = os.Remove(pipePath)
+	_ = os.Remove(IPCPipePath)
 	config := &winio.PipeConfig{
-		SecurityDescriptor: "D:P(A;;GA;;;WD)",
+		SecurityDescriptor: ipcPipeSDDL,
 	}
-	ipcListener, err := winio.ListenPipe(pipePath, config)
+	ipcListener, err := winio.ListenPipe(IPCPipePath, config)
 	if err != nil {
 		logutil.CoreError("Không thể lắng nghe trên named pipe: %v", err)
 		log.Printf("Không thể lắng nghe trên named pipe: %v", err)
 		return
 	}
 	defer ipcListener.Close()
-	log.Printf("Trình nghe IPC đã bắt đầu thành công tại %s", pipePath)
-	for {
-		conn, err := ipcListener.Accept()
-		if err != nil {
-			if strings.Contains(err.Error(), "use of closed network connection") || err == io.ErrClosedPipe {
-				log.Println("Trình nghe IPC đã dừng.")
-				return
-			}
-			logutil.CoreError("Không thể chấp nhận kết nối IPC: %v", err)
-			log.Printf("Không thể chấp nhận kết nối IPC: %v", err)
-			continue
-		}
-		// Tạo channel otp riêng cho từng kết nối
-		otpChan := make(chan string, 1)
-		go handleIPCConnection(conn, func() error { return requestOTP(otpChan) }, otpChan, serverConn)
-	}
+	log.Printf("Trình nghe IPC đã bắt đầu thành công tại %s", IPCPipePath)
+	serveIPCListener(ipcListener, h, checkPipeClient)
 }
 
-// handleIPCConnection xử lý một kết nối IPC đến.
-func handleIPCConnection(conn net.Conn, requestOTP func() error, otpResponseChan <-chan string, serverConn net.Conn) {
-	defer conn.Close()
-	buf := make([]byte, 1024)
-	n, err := conn.Read(buf)
+// checkPipeClient kiểm tra tiến trình phía bên kia của named pipe đang chạy dưới LocalSystem
+func checkPipeClient(conn net.Conn) error {
+	fc, ok := conn.(interface{ Fd() uintptr })
+	if !ok {
+		return fmt.Errorf("không phải named pipe: %T", conn)
+	}
+	var pid uint32
+	if err := windows.GetNamedPipeClientProcessId(windows.Handle(fc.Fd()), &pid); err != nil {
+		return fmt.Errorf("GetNamedPipeClientProcessId: %v", err)
+	}
+	proc, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, pid)
 	if err != nil {
-		if err != io.EOF {
-			log.Printf("Không thể đọc từ kết nối IPC: %v", err)
-		}
-		return
+		return fmt.Errorf("pid=%d OpenProcess: %v", pid, err)
+	}
+	defer windows.CloseHandle(proc)
+	image := processImageName(proc)
+	var token windows.Token
+	if err := windows.OpenProcessToken(proc, windows.TOKEN_QUERY, &token); err != nil {
+		return fmt.Errorf("pid=%d image=%s OpenProcessToken: %v", pid, image, err)
 	}
-	processedRequest := strings.TrimSpace(strings.ReplaceAll(string(buf[:n]), "\x00", ""))
-	if processedRequest == "GET_SECRET" {
-		log.Println("Yêu cầu 'GET_SECRET' hợp lệ. Đang yêu cầu OTP mới từ server...")
-		if serverConn == nil {
-			log.Println("Không thể yêu cầu OTP: Không có kết nối đến server.")
-			conn.Write([]byte("ERROR: Not connected to server"))
-			return
-		}
-		if err := requestOTP(); err != nil {
-			logutil.CoreError("Lỗi khi gửi yêu cầu OTP đến server: %v", err)
-			log.Printf("Lỗi khi gửi yêu cầu OTP đến server: %v", err)
-			conn.Write([]byte("ERROR: Failed to request OTP from server"))
-			return
-		}
-		select {
-		case otp := <-otpResponseChan:
-			log.Println("Đã nhận được OTP, đang gửi cho client IPC.")
-			conn.Write([]byte(otp))
-		case <-time.After(10 * time.Second):
-			log.Println("Lỗi: Hết thời gian chờ phản hồi OTP từ server.")
-			conn.Write([]byte("ERROR: Timeout waiting for OTP from server"))
-		}
-	} else {
-		log.Printf("Yêu cầu không xác định: '%s'", processedRequest)
-		conn.Write([]byte("ERROR: Unknown request"))
+	defer token.Close()
+	user, err := token.GetTokenUser()
+	if err != nil {
+		return fmt.Errorf("pid=%d image=%s GetTokenUser: %v", pid, image, err)
+	}
+	if !user.User.Sid.IsWellKnown(windows.WinLocalSystemSid) {
+		return fmt.Errorf("pid=%d image=%s sid=%s không được phép", pid, image, user.User.Sid.String())
+	}
+	return nil
+}
+
+// processImageName trả về đường dẫn file thực thi của tiến trình, dùng cho log
+func processImageName(proc windows.Handle) string {
+	buf := make([]uint16, windows.MAX_PATH)
+	size := uint32(len(buf))
+	if err := windows.QueryFullProcessImageName(proc, 0, &buf[0], &size); err != nil {
+		return "?"
 	}
+	return windows.UTF16ToString(buf[:size])
 }
@@ -0,0 +1,318 @@
+package agent
+
+import (
+	"encoding/json"
+	"gou-pc/internal/config"
+	"gou-pc/internal/logcollector"
+	"gou-pc/internal/logutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// LogSendFunc gửi một dòng log lên server, trả lỗi thì dòng đó (và các dòng sau) được thử lại ở lần kiểm tra sau
+type LogSendFunc func(data LogData) error
+
+// fileCheckpoint là trạng thái đọc của một file thuộc nguồn log
+type fileCheckpoint struct {
+	Offset int64  `json:"offset"`
+	FileID string `json:"file_id,omitempty"` // identity (inode / file index) để nhận ra file bị xoay vòng khi agent dừng
+}
+
+// sourceCheckpoint được lưu ra <StateDir>/<tên nguồn>.checkpoint.json
+type sourceCheckpoint struct {
+	Files map[string]*fileCheckpoint `json:"files"`
+}
+
+// LogSource theo dõi một path hoặc glob, mỗi file khớp có offset riêng
+type LogSource struct {
+	Name     string
+	Pattern  string
+	Interval time.Duration
+
+	parsers   []LogParser
+	severity  string // mức độ mặc định khi parser không tách được level
+	opts      tailOptions
+	stateFile string
+	state     sourceCheckpoint
+	tailers   map[string]*fileTailer
+}
+
+// NewLogSource tạo nguồn log từ cấu hình, parser/interval rỗng thì lấy mặc định
+func NewLogSource(cfg config.LogSourceConfig, defaultParsers []LogParser, defaultInterval time.Duration, stateDir string) *LogSource {
+	s := &LogSource{
+		Name:      cfg.Name,
+		Pattern:   cfg.Path,
+		Interval:  cfg.Interval,
+		parsers:   defaultParsers,
+		opts:      tailOptions{flushAfter: cfg.MultilineTimeout, encoding: cfg.Encoding},
+		stateFile: filepath.Join(stateDir, checkpointName(cfg.Name)+".checkpoint.json"),
+		tailers:   map[string]*fileTailer{},
+	}
+	if s.Interval <= 0 {
+		s.Interval = defaultInterval
+	}
+	if cfg.Multiline != "" {
+		re, err := regexp.Compile(cfg.Multiline)
+		if err != nil {
+			logutil.CoreError("log source %s: invalid multiline pattern: %v", cfg.Name, err)
+		} else {
+			s.opts.multiline = re
+		}
+	}
+	if _, err := lookupEncoding(cfg.Encoding); err != nil {
+		logutil.CoreError("log source %s: %v, using auto", cfg.Name, err)
+		s.opts.encoding = "auto"
+	}
+	if cfg.FallbackEncoding != "" {
+		fb, err := lookupEncoding(cfg.FallbackEncoding)
+		if err != nil {
+			logutil.CoreError("log source %s: fallback %v", cfg.Name, err)
+		}
+		s.opts.fallback = fb
+	}
+	if cfg.Severity != "" {
+		s.severity = logcollector.NormalizeSeverity(cfg.Severity)
+		if s.severity == "" {
+			logutil.CoreError("log source %s: unknown severity %q, ignored", cfg.Name, cfg.Severity)
+		}
+	}
+	if cfg.Parsers != nil {
+		parsers, errs := NewLogParsers(cfg.Parsers)
+		for _, err := range errs {
+			logutil.CoreError("log source %s: parser config error: %v", cfg.Name, err)
+		}
+		s.parsers = parsers
+	}
+	s.loadState()
+	return s
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+func checkpointName(name string) string {
+	if name == "" {
+		return "default"
+	}
+	return unsafeNameChars.ReplaceAllString(name, "_")
+}
+
+func (s *LogSource) loadState() {
+	s.state = sourceCheckpoint{Files: map[string]*fileCheckpoint{}}
+	b, err := os.ReadFile(s.stateFile)
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(b, &s.state); err != nil {
+		logutil.CoreError("log source %s: invalid checkpoint %s: %v", s.Name, s.stateFile, err)
+	}
+	if s.state.Files == nil {
+		s.state.Files = map[string]*fileCheckpoint{}
+	}
+}
+
+func (s *LogSource) saveState() {
+	b, err := json.Marshal(s.state)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.stateFile), 0755); err != nil {
+		logutil.CoreError("log source %s: create state dir error: %v", s.Name, err)
+		return
+	}
+	tmp := s.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		logutil.CoreError("log source %s: write checkpoint error: %v", s.Name, err)
+		return
+	}
+	if err := os.Rename(tmp, s.stateFile); err != nil {
+		logutil.CoreError("log source %s: save checkpoint error: %v", s.Name, err)
+	}
+}
+
+// Run kiểm tra nguồn log theo chu kỳ cho tới khi stop đóng (nil = chạy mãi)
+func (s *LogSource) Run(send LogSendFunc, stop <-chan struct{}) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	defer s.Close()
+	for {
+		s.Poll(send)
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Close đóng các file đang theo dõi
+func (s *LogSource) Close() {
+	for path, t := range s.tailers {
+		t.close()
+		delete(s.tailers, path)
+	}
+}
+
+// Poll glob lại pattern (để nhận file mới), xử lý file bị xoay vòng, đọc phần mới rồi lưu checkpoint
+func (s *LogSource) Poll(send LogSendFunc) {
+	defer s.saveCheckpoint()
+	paths, err := filepath.Glob(s.Pattern)
+	if err != nil {
+		logutil.CoreError("log source %s: invalid pattern %q: %v", s.Name, s.Pattern, err)
+		return
+	}
+	// emit gửi một dòng (event) của file path; thời điểm sự kiện không có trong dòng thì lấy lúc đọc
+	emit := func(path string) func(string) error {
+		return func(line string) error {
+			data := NewLogData(s.parsers, line)
+			data.Source = s.Name
+			data.SourceFile = path
+			data.fillEventMeta(s.severity, time.Now())
+			return send(data)
+		}
+	}
+	current := make(map[string]os.FileInfo, len(paths))
+	for _, path := range paths {
+		if fi, err := os.Stat(path); err == nil && fi.Mode().IsRegular() {
+			current[path] = fi
+		}
+	}
+
+	// File đang theo dõi không còn ở path cũ: nếu tên mới vẫn khớp glob thì đi theo file,
+	// không thì đọc nốt file cũ (qua handle đang mở) trước khi chuyển sang file mới
+	for _, path := range sortedKeys(s.tailers) {
+		t := s.tailers[path]
+		if fi, ok := current[path]; ok && t.sameFile(fi) {
+			continue
+		}
+		if newPath := s.findMoved(t, current); newPath != "" {
+			logutil.CoreInfo("log source %s: %s renamed to %s", s.Name, path, newPath)
+			delete(s.tailers, path)
+			t.path = newPath
+			s.tailers[newPath] = t
+			continue
+		}
+		logutil.CoreInfo("log source %s: %s rotated, finishing old file", s.Name, path)
+		if err := t.read(emit(t.path), true); err != nil {
+			logutil.CoreError("log source %s: send log line error: %v", s.Name, err)
+			return
+		}
+		t.close()
+		delete(s.tailers, path)
+		delete(s.state.Files, path)
+	}
+
+	for _, path := range sortedKeys(current) {
+		if _, ok := s.tailers[path]; ok {
+			continue
+		}
+		t, err := openTailer(path, 0, s.opts)
+		if err != nil {
+			logutil.CoreError("log source %s: open %s error: %v", s.Name, path, err)
+			continue
+		}
+		if err := s.resume(t, emit); err != nil {
+			logutil.CoreError("log source %s: send log line error: %v", s.Name, err)
+			t.close()
+			return
+		}
+		s.tailers[path] = t
+	}
+
+	for _, path := range sortedKeys(s.tailers) {
+		t := s.tailers[path]
+		if fi, ok := current[path]; ok && t.checkTruncate(fi) {
+			logutil.CoreInfo("log source %s: %s truncated, reading from start", s.Name, path)
+		}
+		if err := t.read(emit(t.path), false); err != nil {
+			logutil.CoreError("log source %s: send log line error: %v", s.Name, err)
+			return
+		}
+	}
+}
+
+// findMoved tìm file mới khớp glob có cùng identity với file tailer đang mở (đổi tên nhưng vẫn khớp glob)
+func (s *LogSource) findMoved(t *fileTailer, current map[string]os.FileInfo) string {
+	for path, fi := range current {
+		if _, taken := s.tailers[path]; !taken && t.sameFile(fi) {
+			return path
+		}
+	}
+	return ""
+}
+
+// resume đặt vị trí đọc cho file mới mở theo checkpoint nếu cùng identity.
+// Nếu file ở path đã bị xoay vòng lúc agent dừng thì đọc nốt file cũ trước, lỗi chỉ xảy ra khi gửi log.
+func (s *LogSource) resume(t *fileTailer, emit func(path string) func(string) error) error {
+	cp, ok := s.state.Files[t.path]
+	if !ok {
+		logutil.CoreInfo("log source %s: start watching %s", s.Name, t.path)
+		return nil
+	}
+	if cp.FileID == "" || cp.FileID == t.id {
+		if cp.Offset <= t.info.Size() {
+			t.pos, t.committed = cp.Offset, cp.Offset
+		}
+		return nil
+	}
+	old := findRotated(t.path, cp.FileID)
+	if old == "" {
+		return nil
+	}
+	logutil.CoreInfo("log source %s: %s rotated while stopped, finishing %s", s.Name, t.path, old)
+	ot, err := openTailer(old, cp.Offset, s.opts)
+	if err != nil {
+		logutil.CoreError("log source %s: open %s error: %v", s.Name, old, err)
+		return nil
+	}
+	defer ot.close()
+	return ot.read(emit(old), true)
+}
+
+// saveCheckpoint lưu offset đã gửi xong của từng file đang theo dõi
+func (s *LogSource) saveCheckpoint() {
+	files := make(map[string]*fileCheckpoint, len(s.tailers))
+	for path, t := range s.tailers {
+		files[path] = &fileCheckpoint{Offset: t.committed, FileID: t.id}
+	}
+	// Giữ checkpoint của file còn tồn tại nhưng chưa mở được (lỗi quyền, chưa đọc nốt file đã xoay vòng)
+	for path, cp := range s.state.Files {
+		if _, ok := files[path]; !ok {
+			if _, err := os.Stat(path); err == nil {
+				files[path] = cp
+			}
+		}
+	}
+	if reflect.DeepEqual(files, s.state.Files) {
+		return
+	}
+	s.state.Files = files
+	s.saveState()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// WatchLogSources khởi động một goroutine cho mỗi nguồn log
+func WatchLogSources(cfg *config.ClientConfig, send LogSendFunc) []*LogSource {
+	parsers, errs := NewLogParsers(cfg.LogParsers)
+	for _, err := range errs {
+		logutil.CoreError("log parser config error: %v", err)
+	}
+	var sources []*LogSource
+	for _, sc := range cfg.LogSources {
+		src := NewLogSource(sc, parsers, cfg.Interval, cfg.StateDir)
+		sources = append(sources, src)
+		go src.Run(send, nil)
+	}
+	return sources
+}
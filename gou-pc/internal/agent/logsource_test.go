@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"errors"
+	"gou-pc/internal/config"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type sentLogs struct {
+	lines []string
+	fail  bool
+}
+
+func (s *sentLogs) send(data LogData) error {
+	if s.fail {
+		return errors.New("not connected")
+	}
+	s.lines = append(s.lines, data.Source+":"+data.Message)
+	return nil
+}
+
+func appendFile(t *testing.T, path, text string) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(text); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLogSourceGlob(t *testing.T) {
+	dir := t.TempDir()
+	stateDir := filepath.Join(dir, "state")
+	cfg := config.LogSourceConfig{Name: "app logs", Path: filepath.Join(dir, "*.log")}
+	appendFile(t, filepath.Join(dir, "a.log"), "a1\na2\n")
+	appendFile(t, filepath.Join(dir, "skip.txt"), "x\n")
+
+	sent := &sentLogs{}
+	src := NewLogSource(cfg, nil, time.Second, stateDir)
+	src.Poll(sent.send)
+	if want := []string{"app logs:a1", "app logs:a2"}; !reflect.DeepEqual(sent.lines, want) {
+		t.Fatalf("first poll sent %v, want %v", sent.lines, want)
+	}
+
+	// File mới khớp glob được nhận ở lần poll sau, không cần khởi động lại
+	appendFile(t, filepath.Join(dir, "b.log"), "b1\n")
+	appendFile(t, filepath.Join(dir, "a.log"), "a3\n")
+	sent.lines = nil
+	src.Poll(sent.send)
+	if want := []string{"app logs:a3", "app logs:b1"}; !reflect.DeepEqual(sent.lines, want) {
+		t.Fatalf("second poll sent %v, want %v", sent.lines, want)
+	}
+
+	// Gửi lỗi thì giữ nguyên offset để thử lại
+	appendFile(t, filepath.Join(dir, "b.log"), "b2\n")
+	sent.lines, sent.fail = nil, true
+	src.Poll(sent.send)
+	sent.fail = false
+
+	// Checkpoint được lưu ra file: nguồn tạo lại chỉ gửi phần chưa gửi
+	src = NewLogSource(cfg, nil, time.Second, stateDir)
+	src.Poll(sent.send)
+	if want := []string{"app logs:b2"}; !reflect.DeepEqual(sent.lines, want) {
+		t.Fatalf("after restart sent %v, want %v", sent.lines, want)
+	}
+	if _, err := os.Stat(filepath.Join(stateDir, "app_logs.checkpoint.json")); err != nil {
+		t.Errorf("checkpoint file missing: %v", err)
+	}
+}
+
+func TestLogSourceParsersAndTruncate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "kv.log")
+	appendFile(t, path, "user=alice\n")
+	var got []LogData
+	send := func(d LogData) error { got = append(got, d); return nil }
+	src := NewLogSource(config.LogSourceConfig{
+		Name:     "kv",
+		Path:     path,
+		Parsers:  []config.LogParserConfig{{Name: "kv", Type: "kv"}},
+		Severity: "warn",
+	}, nil, time.Second, dir)
+	src.Poll(send)
+	if len(got) != 1 || got[0].Fields["user"] != "alice" || got[0].Source != "kv" {
+		t.Fatalf("unexpected log data: %+v", got)
+	}
+	if got[0].SourceFile != path || got[0].Severity != "warning" || got[0].Time == "" {
+		t.Errorf("missing event metadata: %+v", got[0])
+	}
+	if err := os.WriteFile(path, []byte("u=1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	src.Poll(send)
+	if len(got) != 1 || got[0].Fields["u"] != "1" {
+		t.Errorf("truncated file should be read from start: %+v", got)
+	}
+}
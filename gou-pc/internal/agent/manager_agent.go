@@ -7,6 +7,7 @@ import (
 	"gou-pc/internal/logutil"
 	"os"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/google/uuid"
@@ -84,6 +85,57 @@ func FindClientByDevice(hardwareID string) (*ManagedClient, error) {
 	return &c, nil
 }
 
+// FindClientByAgentID tìm client theo agent_id, trả về nil nếu không có
+func FindClientByAgentID(agentID string) (*ManagedClient, error) {
+	row := db.QueryRow("SELECT client_id, agent_id, hardware_id, user_name, last_seen, online FROM managed_clients WHERE agent_id = ?", agentID)
+	var c ManagedClient
+	var onlineInt int
+	err := row.Scan(&c.ClientID, &c.AgentID, &c.DeviceInfo.HardwareID, &c.UserName, &c.LastSeen, &onlineInt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.Online = onlineInt == 1
+	return &c, nil
+}
+
+// AgentlessHardwarePrefix đánh dấu thiết bị không chạy agent (chỉ gửi syslog): hardware_id = "syslog:<ip>"
+const AgentlessHardwarePrefix = "syslog:"
+
+// IsAgentless cho biết client là thiết bị agentless (chỉ gửi syslog)
+func (c *ManagedClient) IsAgentless() bool {
+	return strings.HasPrefix(c.DeviceInfo.HardwareID, AgentlessHardwarePrefix)
+}
+
+// FindClientByAddress tìm client theo IP (ưu tiên) hoặc hostname không phân biệt hoa thường, trả về nil nếu không có.
+// Hostname do người gửi tự báo nên chỉ so với client agentless, không bao giờ trỏ tới agent thật.
+func FindClientByAddress(ip, hostName string) (*ManagedClient, error) {
+	row := db.QueryRow(`SELECT client_id, agent_id, hardware_id, host_name, ip_address, user_name FROM managed_clients
+		WHERE (ip_address = ? AND ? <> '') OR (host_name = ? COLLATE NOCASE AND ? <> '' AND hardware_id LIKE ? || '%')
+		ORDER BY ip_address = ? DESC LIMIT 1`, ip, ip, hostName, hostName, AgentlessHardwarePrefix, ip)
+	var c ManagedClient
+	var hostNameCol, ipAddress sql.NullString
+	err := row.Scan(&c.ClientID, &c.AgentID, &c.DeviceInfo.HardwareID, &hostNameCol, &ipAddress, &c.UserName)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.DeviceInfo.HostName = hostNameCol.String
+	c.DeviceInfo.IPAddress = ipAddress.String
+	return &c, nil
+}
+
+// CountAgentlessClients đếm client agentless đã tạo
+func CountAgentlessClients() (int, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM managed_clients WHERE hardware_id LIKE ? || '%'`, AgentlessHardwarePrefix).Scan(&n)
+	return n, err
+}
+
 func GenAgentID() string {
 	mu.Lock()
 	id := fmt.Sprintf("%03d", nextAgentID)
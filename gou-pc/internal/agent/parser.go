@@ -0,0 +1,219 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"gou-pc/internal/config"
+	"gou-pc/internal/logcollector"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// LogParser tách field từ một dòng log, ok = false nếu dòng không khớp parser
+type LogParser interface {
+	Parse(line string) (fields map[string]string, ok bool)
+}
+
+// NewLogParser tạo parser theo cấu hình, lỗi nếu Type không hỗ trợ hoặc Pattern sai
+func NewLogParser(cfg config.LogParserConfig) (LogParser, error) {
+	var filter *regexp.Regexp
+	if cfg.Pattern != "" {
+		re, err := regexp.Compile(cfg.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("parser %s: invalid pattern: %w", cfg.Name, err)
+		}
+		filter = re
+	}
+	switch cfg.Type {
+	case "regex":
+		if filter == nil {
+			return nil, fmt.Errorf("parser %s: regex parser requires pattern", cfg.Name)
+		}
+		return &regexParser{re: filter, set: cfg.Set}, nil
+	case "json":
+		return &jsonParser{filter: filter, set: cfg.Set}, nil
+	case "kv":
+		return &kvParser{filter: filter, set: cfg.Set}, nil
+	}
+	return nil, fmt.Errorf("parser %s: unknown type %q", cfg.Name, cfg.Type)
+}
+
+// NewLogParsers tạo danh sách parser, bỏ qua (và trả lỗi) parser cấu hình sai để agent vẫn chạy với phần còn lại
+func NewLogParsers(cfgs []config.LogParserConfig) ([]LogParser, []error) {
+	var parsers []LogParser
+	var errs []error
+	for _, c := range cfgs {
+		p, err := NewLogParser(c)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		parsers = append(parsers, p)
+	}
+	return parsers, errs
+}
+
+// NewLogData tạo payload log: message gốc và field của parser đầu tiên khớp
+func NewLogData(parsers []LogParser, line string) LogData {
+	data := LogData{Message: line}
+	for _, p := range parsers {
+		if fields, ok := p.Parse(line); ok {
+			if len(fields) > 0 {
+				data.Fields = fields
+			}
+			break
+		}
+	}
+	return data
+}
+
+// eventTimeFields là các field parser có thể tách ra chứa thời điểm sự kiện, thử lần lượt
+var eventTimeFields = []string{"time", "timestamp", "@timestamp"}
+
+// eventSeverityFields là các field chứa mức độ log, thử lần lượt
+var eventSeverityFields = []string{"severity", "level", "loglevel"}
+
+// eventTimeLayouts là các định dạng thời gian nhận dạng được, không có múi giờ thì hiểu theo giờ local
+var eventTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006/01/02 15:04:05",
+	time.Stamp,
+}
+
+// fillEventMeta đặt Time theo field thời gian của parser (không có hoặc không đọc được thì dùng now)
+// và Severity theo field level, không có thì dùng defaultSeverity
+func (d *LogData) fillEventMeta(defaultSeverity string, now time.Time) {
+	d.Time = now.Format(time.RFC3339)
+	for _, k := range eventTimeFields {
+		if t, ok := parseEventTime(d.Fields[k], now); ok {
+			d.Time = t.Format(time.RFC3339)
+			break
+		}
+	}
+	d.Severity = logcollector.NormalizeSeverity(defaultSeverity)
+	for _, k := range eventSeverityFields {
+		if sev := logcollector.NormalizeSeverity(d.Fields[k]); sev != "" {
+			d.Severity = sev
+			break
+		}
+	}
+}
+
+// parseEventTime đọc thời gian theo eventTimeLayouts. time.Stamp không có năm:
+// lấy năm của now, nếu ra thời điểm quá một ngày trong tương lai thì là năm trước.
+func parseEventTime(v string, now time.Time) (time.Time, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range eventTimeLayouts {
+		t, err := time.ParseInLocation(layout, v, time.Local)
+		if err != nil {
+			continue
+		}
+		if layout == time.Stamp {
+			t = t.AddDate(now.Year(), 0, 0)
+			if t.After(now.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+type regexParser struct {
+	re  *regexp.Regexp
+	set map[string]string
+}
+
+func (p *regexParser) Parse(line string) (map[string]string, bool) {
+	m := p.re.FindStringSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+	fields := withSet(p.set)
+	for i, name := range p.re.SubexpNames() {
+		if name != "" && i < len(m) {
+			fields[name] = m[i]
+		}
+	}
+	return fields, true
+}
+
+type jsonParser struct {
+	filter *regexp.Regexp
+	set    map[string]string
+}
+
+// Parse chỉ nhận JSON object, giá trị không phải chuỗi được giữ dạng JSON (số, bool, object lồng nhau)
+func (p *jsonParser) Parse(line string) (map[string]string, bool) {
+	if p.filter != nil && !p.filter.MatchString(line) {
+		return nil, false
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(strings.TrimSpace(line)), &obj); err != nil {
+		return nil, false
+	}
+	fields := withSet(p.set)
+	for k, raw := range obj {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			fields[k] = s
+		} else {
+			fields[k] = string(raw)
+		}
+	}
+	return fields, true
+}
+
+type kvParser struct {
+	filter *regexp.Regexp
+	set    map[string]string
+}
+
+// kvPair khớp key=value, value có thể đặt trong nháy kép hoặc nháy đơn
+var kvPair = regexp.MustCompile(`([A-Za-z_][\w.-]*)=("(?:[^"\\]|\\.)*"|'[^']*'|\S*)`)
+
+func (p *kvParser) Parse(line string) (map[string]string, bool) {
+	if p.filter != nil && !p.filter.MatchString(line) {
+		return nil, false
+	}
+	pairs := kvPair.FindAllStringSubmatch(line, -1)
+	if len(pairs) == 0 {
+		return nil, false
+	}
+	fields := withSet(p.set)
+	for _, kv := range pairs {
+		v := kv[2]
+		switch {
+		case len(v) >= 2 && v[0] == '"':
+			if u, err := unquoteJSON(v); err == nil {
+				v = u
+			} else {
+				v = v[1 : len(v)-1]
+			}
+		case len(v) >= 2 && v[0] == '\'':
+			v = v[1 : len(v)-1]
+		}
+		fields[kv[1]] = v
+	}
+	return fields, true
+}
+
+func unquoteJSON(s string) (string, error) {
+	var out string
+	err := json.Unmarshal([]byte(s), &out)
+	return out, err
+}
+
+func withSet(set map[string]string) map[string]string {
+	fields := make(map[string]string, len(set))
+	for k, v := range set {
+		fields[k] = v
+	}
+	return fields
+}
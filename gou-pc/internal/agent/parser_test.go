@@ -0,0 +1,93 @@
+package agent
+
+import (
+	"gou-pc/internal/config"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDefaultLogParsers(t *testing.T) {
+	parsers, errs := NewLogParsers(config.DefaultLogParsers())
+	if len(errs) != 0 {
+		t.Fatalf("default parsers invalid: %v", errs)
+	}
+	cases := []struct {
+		line string
+		want map[string]string
+	}{
+		{"[2024-06-01 08:00:00] Logon success for user 'PC\\alice'.",
+			map[string]string{"time": "2024-06-01 08:00:00", "result": "success", "user": "PC\\alice"}},
+		{"[2024-06-01 08:00:01] Logon attempt failed for user 'bob': Incorrect secret code.",
+			map[string]string{"time": "2024-06-01 08:00:01", "result": "failed", "user": "bob", "reason": "Incorrect secret code."}},
+		{"[2024-06-01 08:00:02] GetSerialization: Secret code validated successfully.",
+			map[string]string{"time": "2024-06-01 08:00:02", "text": "GetSerialization: Secret code validated successfully."}},
+		{"free text without timestamp", nil},
+	}
+	for _, c := range cases {
+		got := NewLogData(parsers, c.line)
+		if got.Message != c.line || !reflect.DeepEqual(got.Fields, c.want) {
+			t.Errorf("NewLogData(%q) = %+v, want fields %v", c.line, got, c.want)
+		}
+	}
+}
+
+func TestJSONAndKVParsers(t *testing.T) {
+	parsers, errs := NewLogParsers([]config.LogParserConfig{
+		{Name: "json", Type: "json"},
+		{Name: "kv", Type: "kv", Set: map[string]string{"format": "kv"}},
+	})
+	if len(errs) != 0 {
+		t.Fatalf("NewLogParsers: %v", errs)
+	}
+	got := NewLogData(parsers, `{"user":"alice","code":401,"ok":false}`).Fields
+	want := map[string]string{"user": "alice", "code": "401", "ok": "false"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("json fields = %v, want %v", got, want)
+	}
+	got = NewLogData(parsers, `user=bob result=failed msg="bad \"otp\"" host='PC 01'`).Fields
+	want = map[string]string{"format": "kv", "user": "bob", "result": "failed", "msg": `bad "otp"`, "host": "PC 01"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("kv fields = %v, want %v", got, want)
+	}
+}
+
+func TestNewLogParsersSkipsInvalid(t *testing.T) {
+	parsers, errs := NewLogParsers([]config.LogParserConfig{
+		{Name: "bad-regex", Type: "regex", Pattern: "("},
+		{Name: "no-pattern", Type: "regex"},
+		{Name: "unknown", Type: "xml"},
+		{Name: "ok", Type: "kv"},
+	})
+	if len(parsers) != 1 || len(errs) != 3 {
+		t.Errorf("expected 1 parser and 3 errors, got %d parsers, errs=%v", len(parsers), errs)
+	}
+}
+
+func TestFillEventMeta(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.Local)
+	cases := []struct {
+		fields       map[string]string
+		def          string
+		wantTime     time.Time
+		wantSeverity string
+	}{
+		{map[string]string{"time": "2024-01-01 08:00:00", "level": "WARN"}, "info",
+			time.Date(2024, 1, 1, 8, 0, 0, 0, time.Local), "warning"},
+		{map[string]string{"@timestamp": "2024-01-01T01:00:00Z", "severity": "bogus"}, "error",
+			time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC), "error"},
+		// Stamp không có năm: tháng 12 sau thời điểm hiện tại nên thuộc năm trước
+		{map[string]string{"timestamp": "Dec 31 23:59:00", "loglevel": "fatal"}, "",
+			time.Date(2023, 12, 31, 23, 59, 0, 0, time.Local), "critical"},
+		{map[string]string{"time": "yesterday"}, "Notice", now, "notice"},
+		{nil, "", now, ""},
+	}
+	for _, c := range cases {
+		d := LogData{Fields: c.fields}
+		d.fillEventMeta(c.def, now)
+		if d.Time != c.wantTime.Format(time.RFC3339) || d.Severity != c.wantSeverity {
+			t.Errorf("fillEventMeta(%v, %q) = %q/%q, want %q/%q", c.fields, c.def, d.Time, d.Severity,
+				c.wantTime.Format(time.RFC3339), c.wantSeverity)
+		}
+	}
+}
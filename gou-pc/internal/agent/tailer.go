@@ -0,0 +1,265 @@
+package agent
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding"
+)
+
+const (
+	tailReadChunk           = 64 * 1024
+	tailMaxLine             = 1 << 20 // dòng dài hơn bị cắt thành nhiều dòng để không giữ buffer vô hạn
+	defaultMultilineTimeout = 3 * time.Second
+)
+
+// tailEvent là event multi-line đang gom, chưa gửi
+type tailEvent struct {
+	lines   []string
+	start   int64 // offset đầu event trong file
+	end     int64 // offset sau dòng cuối của event
+	updated time.Time
+}
+
+// tailOptions là cấu hình đọc dùng chung cho mọi file của một nguồn log
+type tailOptions struct {
+	multiline  *regexp.Regexp    // dòng khớp là đầu event mới, nil = mỗi dòng một event
+	flushAfter time.Duration     // event multi-line không có dòng mới sau khoảng này thì gửi
+	encoding   string            // encoding khai báo, rỗng/"auto" = nhận dạng qua BOM
+	fallback   encoding.Encoding // code page cho dòng không phải UTF-8 hợp lệ khi auto
+}
+
+// fileTailer đọc một file theo handle đang mở, nên vẫn đọc nốt được khi file bị đổi tên (xoay vòng).
+// committed là vị trí mọi byte phía trước đã gửi xong, chính là offset lưu checkpoint;
+// pos có thể lớn hơn committed vì dòng chưa trọn và event multi-line đang gom.
+type fileTailer struct {
+	path      string
+	file      *os.File
+	info      os.FileInfo
+	id        string
+	pos       int64
+	committed int64
+	partial   []byte
+	event     *tailEvent
+	enc       *logEncoding // nhận dạng ở lần đọc đầu tiên có dữ liệu
+	opts      tailOptions
+}
+
+// openTailer mở file (cho phép đổi tên/xoá khi đang mở) và đặt vị trí đọc ở offset
+func openTailer(path string, offset int64, opts tailOptions) (*fileTailer, error) {
+	f, err := openShared(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	id, _ := fileID(f)
+	if offset > info.Size() {
+		offset = 0
+	}
+	if opts.flushAfter <= 0 {
+		opts.flushAfter = defaultMultilineTimeout
+	}
+	return &fileTailer{
+		path:      path,
+		file:      f,
+		info:      info,
+		id:        id,
+		pos:       offset,
+		committed: offset,
+		opts:      opts,
+	}, nil
+}
+
+func (t *fileTailer) close() {
+	t.file.Close()
+}
+
+// sameFile cho biết fi (stat theo path) có còn là file tailer đang mở không
+func (t *fileTailer) sameFile(fi os.FileInfo) bool {
+	return os.SameFile(t.info, fi)
+}
+
+// checkTruncate đọc lại từ đầu khi file cùng identity nhưng nhỏ hơn vị trí đã đọc (copytruncate)
+func (t *fileTailer) checkTruncate(fi os.FileInfo) bool {
+	if fi.Size() >= t.pos {
+		return false
+	}
+	t.pos, t.committed = 0, 0
+	t.partial, t.event, t.enc = nil, nil, nil
+	return true
+}
+
+// read đọc hết dữ liệu mới. final = true khi file đã bị xoay vòng: dòng cuối chưa có '\n'
+// và event đang gom cũng được gửi luôn vì sẽ không còn ghi thêm.
+// Gửi lỗi thì quay về committed để lần sau đọc lại, không mất và không lặp log.
+func (t *fileTailer) read(emit func(string) error, final bool) error {
+	if t.enc == nil {
+		if err := t.detectEncoding(); err != nil || t.enc == nil {
+			return err
+		}
+	}
+	buf := make([]byte, tailReadChunk)
+	for {
+		n, err := t.file.ReadAt(buf, t.pos)
+		if n > 0 {
+			t.pos += int64(n)
+			t.partial = append(t.partial, buf[:n]...)
+			if perr := t.processLines(emit); perr != nil {
+				t.rollback()
+				return perr
+			}
+		}
+		if err == io.EOF || n == 0 {
+			break
+		}
+		if err != nil {
+			t.rollback()
+			return err
+		}
+	}
+	if final && len(t.partial) > 0 {
+		start := t.pos - int64(len(t.partial))
+		line := t.enc.decode(t.partial)
+		t.partial = nil
+		if err := t.handleLine(line, start, t.pos, emit); err != nil {
+			t.rollback()
+			return err
+		}
+	}
+	if t.event != nil && (final || (len(t.partial) == 0 && time.Since(t.event.updated) >= t.opts.flushAfter)) {
+		if err := t.flushEvent(emit); err != nil {
+			t.rollback()
+			return err
+		}
+	}
+	return nil
+}
+
+// processLines tách các dòng trọn vẹn trong partial, phần sau '\n' cuối cùng được giữ lại
+func (t *fileTailer) processLines(emit func(string) error) error {
+	start := t.pos - int64(len(t.partial))
+	for {
+		i, next := t.enc.indexNewline(t.partial), 0
+		switch {
+		case i >= 0:
+			next = i + len(t.enc.newline)
+		case len(t.partial) >= tailMaxLine:
+			i, next = tailMaxLine, tailMaxLine
+		default:
+			return nil
+		}
+		line := t.enc.decode(t.partial[:i])
+		end := start + int64(next)
+		t.partial = t.partial[next:]
+		if err := t.handleLine(line, start, end, emit); err != nil {
+			return err
+		}
+		start = end
+	}
+}
+
+func (t *fileTailer) handleLine(line string, start, end int64, emit func(string) error) error {
+	if t.opts.multiline == nil {
+		if line != "" {
+			if err := emit(line); err != nil {
+				return err
+			}
+		}
+		t.committed = end
+		return nil
+	}
+	if t.event != nil && !t.opts.multiline.MatchString(line) {
+		t.event.lines = append(t.event.lines, line)
+		t.event.end = end
+		t.event.updated = time.Now()
+		return nil
+	}
+	if err := t.flushEvent(emit); err != nil {
+		return err
+	}
+	if line == "" {
+		t.committed = end
+		return nil
+	}
+	t.event = &tailEvent{lines: []string{line}, start: start, end: end, updated: time.Now()}
+	return nil
+}
+
+// detectEncoding nhận dạng encoding từ đầu file, file rỗng thì chờ lần đọc sau
+func (t *fileTailer) detectEncoding() error {
+	head := make([]byte, encodingSniffSize)
+	n, err := t.file.ReadAt(head, 0)
+	if n == 0 {
+		if err == io.EOF {
+			err = nil
+		}
+		return err
+	}
+	enc, err := detectEncoding(head[:n], t.opts.encoding, t.opts.fallback)
+	if err != nil {
+		return err
+	}
+	t.enc = enc
+	if t.pos < int64(enc.bom) {
+		t.pos, t.committed = int64(enc.bom), int64(enc.bom)
+	}
+	return nil
+}
+
+func (t *fileTailer) flushEvent(emit func(string) error) error {
+	if t.event == nil {
+		return nil
+	}
+	if err := emit(strings.Join(t.event.lines, "\n")); err != nil {
+		return err
+	}
+	t.committed = t.event.end
+	t.event = nil
+	return nil
+}
+
+func (t *fileTailer) rollback() {
+	t.pos = t.committed
+	t.partial, t.event = nil, nil
+}
+
+// findRotated tìm trong cùng thư mục file có identity id (vd app.log đã đổi tên thành app.log.1 khi agent dừng)
+func findRotated(path, id string) string {
+	if id == "" {
+		return ""
+	}
+	dir := filepath.Dir(path)
+	prefix := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		candidate := filepath.Join(dir, name)
+		if candidate == path {
+			continue
+		}
+		f, err := openShared(candidate)
+		if err != nil {
+			continue
+		}
+		cid, _ := fileID(f)
+		f.Close()
+		if cid == id {
+			return candidate
+		}
+	}
+	return ""
+}
@@ -0,0 +1,14 @@
+//go:build !unix && !windows
+
+package agent
+
+import "os"
+
+func openShared(path string) (*os.File, error) {
+	return os.Open(path)
+}
+
+// fileID không hỗ trợ: chỉ phát hiện truncate theo kích thước
+func fileID(f *os.File) (string, error) {
+	return "", nil
+}
@@ -0,0 +1,119 @@
+package agent
+
+import (
+	"gou-pc/internal/config"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTailerHoldsPartialLine(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "a\r\nb")
+	sent := &sentLogs{}
+	src := NewLogSource(config.LogSourceConfig{Name: "app", Path: path}, nil, time.Second, dir)
+	defer src.Close()
+
+	src.Poll(sent.send)
+	if want := []string{"app:a"}; !reflect.DeepEqual(sent.lines, want) {
+		t.Fatalf("sent %v, want %v", sent.lines, want)
+	}
+	if cp := src.state.Files[path]; cp == nil || cp.Offset != 3 {
+		t.Fatalf("checkpoint should stop before partial line: %+v", cp)
+	}
+	appendFile(t, path, "c\n")
+	src.Poll(sent.send)
+	if want := []string{"app:a", "app:bc"}; !reflect.DeepEqual(sent.lines, want) {
+		t.Errorf("sent %v, want %v", sent.lines, want)
+	}
+}
+
+func TestTailerFinishesRotatedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "1\n")
+	sent := &sentLogs{}
+	src := NewLogSource(config.LogSourceConfig{Name: "app", Path: path}, nil, time.Second, dir)
+	defer src.Close()
+	src.Poll(sent.send)
+
+	// Tiến trình ghi log ghi thêm rồi xoay vòng: app.log -> app.log.1, tạo app.log mới
+	appendFile(t, path, "2\n3")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "4\n")
+	src.Poll(sent.send)
+	if want := []string{"app:1", "app:2", "app:3", "app:4"}; !reflect.DeepEqual(sent.lines, want) {
+		t.Errorf("sent %v, want %v", sent.lines, want)
+	}
+}
+
+func TestTailerRotatedWhileStopped(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "1\n")
+	sent := &sentLogs{}
+	cfg := config.LogSourceConfig{Name: "app", Path: path}
+	src := NewLogSource(cfg, nil, time.Second, dir)
+	src.Poll(sent.send)
+	src.Close()
+
+	appendFile(t, path, "2\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, "3\n")
+
+	src = NewLogSource(cfg, nil, time.Second, dir)
+	defer src.Close()
+	src.Poll(sent.send)
+	if want := []string{"app:1", "app:2", "app:3"}; !reflect.DeepEqual(sent.lines, want) {
+		t.Errorf("sent %v, want %v", sent.lines, want)
+	}
+}
+
+func TestTailerMultiline(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "2024-06-01 ERROR boom\n  at main.go:10\n  at main.go:20\n2024-06-01 INFO next\n")
+	var got []string
+	fail := false
+	send := func(d LogData) error {
+		if fail {
+			return os.ErrDeadlineExceeded
+		}
+		got = append(got, d.Message)
+		return nil
+	}
+	src := NewLogSource(config.LogSourceConfig{
+		Name:             "app",
+		Path:             path,
+		Multiline:        `^\d{4}-\d{2}-\d{2} `,
+		MultilineTimeout: 20 * time.Millisecond,
+	}, nil, time.Second, dir)
+	defer src.Close()
+
+	src.Poll(send)
+	if want := []string{"2024-06-01 ERROR boom\n  at main.go:10\n  at main.go:20"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// Event cuối đang chờ dòng tiếp theo; gửi lỗi thì không mất, đọc lại rồi gửi sau timeout
+	time.Sleep(30 * time.Millisecond)
+	fail = true
+	src.Poll(send)
+	fail = false
+	src.Poll(send)
+	if len(got) != 1 {
+		t.Fatalf("event re-read after failure should wait for timeout again: %q", got)
+	}
+	time.Sleep(30 * time.Millisecond)
+	src.Poll(send)
+	if len(got) != 2 || got[1] != "2024-06-01 INFO next" {
+		t.Errorf("pending event should be flushed after timeout: %q", got)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package agent
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+func openShared(path string) (*os.File, error) {
+	return os.Open(path)
+}
+
+// fileID là device:inode, không đổi khi file bị đổi tên
+func fileID(f *os.File) (string, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", nil
+	}
+	return fmt.Sprintf("%d:%d", st.Dev, st.Ino), nil
+}
@@ -0,0 +1,421 @@
+package alert
+
+import (
+	"errors"
+	"fmt"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+	"gou-pc/internal/logcollector"
+	"gou-pc/internal/logutil"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// notifyQueueSize là số thông báo chờ gửi, đầy thì thông báo mới bị bỏ để không chặn việc nhận log
+const notifyQueueSize = 256
+
+var (
+	// ErrAlertResolved trả về khi acknowledge/resolve cảnh báo đã resolved
+	ErrAlertResolved = errors.New("alert already resolved")
+	// ErrInvalidRule trả về khi rule không hợp lệ
+	ErrInvalidRule = errors.New("invalid alert rule")
+)
+
+// compiledRule là rule đang bật kèm regex đã biên dịch
+type compiledRule struct {
+	model.AlertRule
+	re     *regexp.Regexp
+	window time.Duration
+}
+
+type delivery struct {
+	channels []string
+	n        Notification
+}
+
+// Engine đánh giá rule theo thời gian thực trên log nhận từ agent và trạng thái online của agent.
+// Mỗi (rule, thiết bị) có tối đa một cảnh báo chưa resolved; rule khớp tiếp thì chỉ tăng Count.
+type Engine struct {
+	repo      repository.AlertRepository
+	notifiers map[string]Notifier
+	now       func() time.Time
+	queue     chan delivery
+
+	mu           sync.Mutex
+	rules        []*compiledRule
+	hits         map[ruleAgent][]time.Time  // thời điểm các log khớp trong cửa sổ
+	offlineSince map[string]time.Time       // agent -> thời điểm bắt đầu offline
+	open         map[ruleAgent]*model.Alert // cảnh báo firing/acknowledged
+}
+
+// ruleAgent là khoá (rule, thiết bị) của bộ đếm và cảnh báo đang mở
+type ruleAgent struct {
+	rule, agent string
+}
+
+// NewEngine nạp rule và cảnh báo đang mở từ repository, khởi động goroutine gửi thông báo
+func NewEngine(repo repository.AlertRepository, notifiers map[string]Notifier) (*Engine, error) {
+	e := &Engine{
+		repo:         repo,
+		notifiers:    notifiers,
+		now:          time.Now,
+		queue:        make(chan delivery, notifyQueueSize),
+		hits:         map[ruleAgent][]time.Time{},
+		offlineSince: map[string]time.Time{},
+		open:         map[ruleAgent]*model.Alert{},
+	}
+	if err := e.Reload(); err != nil {
+		return nil, err
+	}
+	open, err := repo.AlertList(repository.AlertFilter{States: []string{model.AlertFiring, model.AlertAcknowledged}})
+	if err != nil {
+		return nil, err
+	}
+	for i := range open {
+		a := open[i]
+		e.open[alertKey(a.RuleID, a.AgentID)] = &a
+	}
+	go e.deliver()
+	return e, nil
+}
+
+func alertKey(ruleID, agentID string) ruleAgent {
+	return ruleAgent{rule: ruleID, agent: agentID}
+}
+
+// Reload nạp lại rule đang bật, gọi sau khi thêm/sửa/xoá rule
+func (e *Engine) Reload() error {
+	rules, err := e.repo.AlertRuleGetAll()
+	if err != nil {
+		return err
+	}
+	var compiled []*compiledRule
+	for _, r := range rules {
+		if !r.Enabled {
+			continue
+		}
+		cr, err := compileRule(r)
+		if err != nil {
+			logutil.CoreError("alert rule %s (%s): %v", r.Name, r.ID, err)
+			continue
+		}
+		compiled = append(compiled, cr)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = compiled
+	// Bỏ bộ đếm của rule đã xoá/tắt
+	active := map[string]bool{}
+	for _, r := range compiled {
+		active[r.ID] = true
+	}
+	for key := range e.hits {
+		if !active[key.rule] {
+			delete(e.hits, key)
+		}
+	}
+	return nil
+}
+
+func compileRule(r model.AlertRule) (*compiledRule, error) {
+	cr := &compiledRule{AlertRule: r, window: time.Duration(r.WindowSeconds) * time.Second}
+	if r.Pattern != "" {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %v", err)
+		}
+		cr.re = re
+	}
+	if cr.Threshold < 1 {
+		cr.Threshold = 1
+	}
+	return cr, nil
+}
+
+// ValidateRule kiểm tra rule trước khi lưu và điền giá trị mặc định (severity, threshold).
+// Lỗi luôn bọc ErrInvalidRule.
+func (e *Engine) ValidateRule(r *model.AlertRule) error {
+	if err := e.validateRule(r); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRule, err)
+	}
+	return nil
+}
+
+func (e *Engine) validateRule(r *model.AlertRule) error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	switch r.Severity {
+	case "":
+		r.Severity = "warning"
+	case "info", "warning", "critical":
+	default:
+		return errors.New("severity must be info, warning or critical")
+	}
+	switch r.Type {
+	case model.AlertRuleLog:
+		if r.Threshold < 1 {
+			r.Threshold = 1
+		}
+		if r.Threshold > 1 && r.WindowSeconds <= 0 {
+			return errors.New("window_seconds is required when threshold > 1")
+		}
+	case model.AlertRuleAgentOffline:
+		if r.OfflineSeconds <= 0 {
+			return errors.New("offline_seconds is required for agent_offline rule")
+		}
+	default:
+		return errors.New("type must be log or agent_offline")
+	}
+	if _, err := compileRule(*r); err != nil {
+		return err
+	}
+	for _, ch := range r.Channels {
+		if _, ok := e.notifiers[ch]; !ok {
+			return fmt.Errorf("unknown channel %q", ch)
+		}
+	}
+	return nil
+}
+
+func (r *compiledRule) appliesTo(agentID string) bool {
+	if len(r.AgentIDs) == 0 {
+		return true
+	}
+	for _, id := range r.AgentIDs {
+		if id == agentID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *compiledRule) matchLog(entry logcollector.ArchiveLogEntry) bool {
+	if r.Type != model.AlertRuleLog || !r.appliesTo(entry.AgentID) {
+		return false
+	}
+	if r.Source != "" && entry.Source != r.Source {
+		return false
+	}
+	for k, v := range r.Fields {
+		if entry.Fields[k] != v {
+			return false
+		}
+	}
+	return r.re == nil || r.re.MatchString(entry.Message)
+}
+
+// ObserveLog đánh giá các rule log với một log vừa nhận
+func (e *Engine) ObserveLog(entry logcollector.ArchiveLogEntry) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.now()
+	for _, r := range e.rules {
+		if !r.matchLog(entry) {
+			continue
+		}
+		key := alertKey(r.ID, entry.AgentID)
+		hits := append(e.hits[key], now)
+		if r.window > 0 {
+			i := 0
+			for i < len(hits) && now.Sub(hits[i]) > r.window {
+				i++
+			}
+			hits = hits[i:]
+		}
+		if len(hits) < r.Threshold {
+			e.hits[key] = hits
+			continue
+		}
+		delete(e.hits, key)
+		msg := "log matched: " + entry.Message
+		if r.Threshold > 1 {
+			msg = fmt.Sprintf("%d matching logs within %s, last: %s", len(hits), r.window, entry.Message)
+		}
+		e.fire(r, entry.AgentID, msg, now)
+	}
+}
+
+// ObserveAgentStatus đánh giá rule agent_offline; lastSeen là lần cuối agent gửi hello (zero = không rõ).
+// Agent online lại thì cảnh báo offline của agent đó tự resolve.
+func (e *Engine) ObserveAgentStatus(agentID string, online bool, lastSeen time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	now := e.now()
+	if online {
+		delete(e.offlineSince, agentID)
+		for _, r := range e.rules {
+			if r.Type != model.AlertRuleAgentOffline {
+				continue
+			}
+			if a, ok := e.open[alertKey(r.ID, agentID)]; ok {
+				e.resolveLocked(a, "", now)
+			}
+		}
+		return
+	}
+	since, ok := e.offlineSince[agentID]
+	if !ok {
+		since = now
+		if !lastSeen.IsZero() && lastSeen.Before(now) {
+			since = lastSeen
+		}
+		e.offlineSince[agentID] = since
+	}
+	offline := now.Sub(since)
+	for _, r := range e.rules {
+		if r.Type != model.AlertRuleAgentOffline || !r.appliesTo(agentID) {
+			continue
+		}
+		if offline < time.Duration(r.OfflineSeconds)*time.Second {
+			continue
+		}
+		if _, ok := e.open[alertKey(r.ID, agentID)]; ok {
+			continue
+		}
+		e.fire(r, agentID, fmt.Sprintf("agent offline since %s", since.Format(time.RFC3339)), now)
+	}
+}
+
+// fire tạo cảnh báo mới hoặc tăng Count của cảnh báo đang mở cho (rule, agent), gọi khi giữ mu
+func (e *Engine) fire(r *compiledRule, agentID, msg string, now time.Time) {
+	key := alertKey(r.ID, agentID)
+	ts := now.Format(time.RFC3339)
+	if a, ok := e.open[key]; ok {
+		a.Count++
+		a.Message = msg
+		a.LastSeenAt = ts
+		if err := e.repo.AlertUpdate(a); err != nil {
+			logutil.CoreError("alert %s: update error: %v", a.ID, err)
+		}
+		return
+	}
+	a := &model.Alert{
+		ID:         uuid.NewString(),
+		RuleID:     r.ID,
+		RuleName:   r.Name,
+		AgentID:    agentID,
+		Severity:   r.Severity,
+		State:      model.AlertFiring,
+		Message:    msg,
+		Count:      1,
+		FiredAt:    ts,
+		LastSeenAt: ts,
+	}
+	if err := e.repo.AlertCreate(a); err != nil {
+		logutil.CoreError("alert rule %s: create alert error: %v", r.Name, err)
+	}
+	e.open[key] = a
+	logutil.CoreInfo("Alert firing: rule=%s agent=%s: %s", r.Name, agentID, msg)
+	e.notify(r.Channels, Notification{Event: model.AlertFiring, Alert: *a})
+}
+
+// Acknowledge đánh dấu cảnh báo đã được xử lý bởi user, cảnh báo vẫn mở (không sinh cảnh báo mới)
+func (e *Engine) Acknowledge(id, by string) (*model.Alert, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	a, err := e.findLocked(id)
+	if err != nil {
+		return nil, err
+	}
+	if a.State == model.AlertResolved {
+		return nil, ErrAlertResolved
+	}
+	a.State = model.AlertAcknowledged
+	a.AcknowledgedBy = by
+	a.AcknowledgedAt = e.now().Format(time.RFC3339)
+	if err := e.repo.AlertUpdate(a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Resolve đóng cảnh báo; rule khớp lại sau đó sẽ sinh cảnh báo mới
+func (e *Engine) Resolve(id, by string) (*model.Alert, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	a, err := e.findLocked(id)
+	if err != nil {
+		return nil, err
+	}
+	if a.State == model.AlertResolved {
+		return nil, ErrAlertResolved
+	}
+	if err := e.resolveLocked(a, by, e.now()); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Forget bỏ cảnh báo khỏi danh sách đang mở (sau khi xoá khỏi repository)
+func (e *Engine) Forget(id string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for key, a := range e.open {
+		if a.ID == id {
+			delete(e.open, key)
+		}
+	}
+}
+
+// findLocked lấy cảnh báo đang mở trong bộ nhớ (cùng con trỏ engine cập nhật), không có thì đọc repository
+func (e *Engine) findLocked(id string) (*model.Alert, error) {
+	for _, a := range e.open {
+		if a.ID == id {
+			return a, nil
+		}
+	}
+	return e.repo.AlertFindByID(id)
+}
+
+func (e *Engine) resolveLocked(a *model.Alert, by string, now time.Time) error {
+	a.State = model.AlertResolved
+	a.ResolvedBy = by
+	a.ResolvedAt = now.Format(time.RFC3339)
+	key := alertKey(a.RuleID, a.AgentID)
+	delete(e.open, key)
+	delete(e.hits, key)
+	if err := e.repo.AlertUpdate(a); err != nil {
+		logutil.CoreError("alert %s: resolve error: %v", a.ID, err)
+		return err
+	}
+	logutil.CoreInfo("Alert resolved: rule=%s agent=%s by=%q", a.RuleName, a.AgentID, by)
+	var channels []string
+	for _, r := range e.rules {
+		if r.ID == a.RuleID {
+			channels = r.Channels
+		}
+	}
+	e.notify(channels, Notification{Event: model.AlertResolved, Alert: *a})
+	return nil
+}
+
+// notify đưa thông báo vào hàng đợi gửi, không chặn người gọi
+func (e *Engine) notify(channels []string, n Notification) {
+	if len(channels) == 0 {
+		return
+	}
+	select {
+	case e.queue <- delivery{channels: channels, n: n}:
+	default:
+		logutil.CoreError("alert %s: notification queue full, dropping %s notification", n.Alert.ID, n.Event)
+	}
+}
+
+func (e *Engine) deliver() {
+	for d := range e.queue {
+		for _, ch := range d.channels {
+			notifier, ok := e.notifiers[ch]
+			if !ok {
+				logutil.CoreError("alert %s: unknown channel %s", d.n.Alert.ID, ch)
+				continue
+			}
+			if err := notifier.Notify(d.n); err != nil {
+				logutil.CoreError("alert %s: notify %s error: %v", d.n.Alert.ID, ch, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package alert
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+	"gou-pc/internal/config"
+	"gou-pc/internal/logcollector"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type fakeNotifier struct {
+	ch chan Notification
+}
+
+func (f *fakeNotifier) Notify(n Notification) error {
+	f.ch <- n
+	return nil
+}
+
+func (f *fakeNotifier) next(t *testing.T) Notification {
+	t.Helper()
+	select {
+	case n := <-f.ch:
+		return n
+	case <-time.After(time.Second):
+		t.Fatal("no notification delivered")
+	}
+	return Notification{}
+}
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestEngine(t *testing.T, rules ...model.AlertRule) (*Engine, repository.AlertRepository, *fakeNotifier, *fakeClock) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "alerts.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := repository.CreateAlertTables(db); err != nil {
+		t.Fatal(err)
+	}
+	repo := repository.NewSQLiteAlertRepository(db)
+	notifier := &fakeNotifier{ch: make(chan Notification, 10)}
+	for i := range rules {
+		rules[i].ID = rules[i].Name
+		rules[i].Enabled = true
+		rules[i].Channels = []string{"test"}
+		if err := repo.AlertRuleCreate(&rules[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e, err := NewEngine(repo, map[string]Notifier{"test": notifier})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{t: time.Date(2024, 6, 1, 10, 0, 0, 0, time.Local)}
+	e.now = clock.now
+	return e, repo, notifier, clock
+}
+
+func TestEngineThresholdRule(t *testing.T) {
+	e, repo, notifier, clock := newTestEngine(t, model.AlertRule{
+		Name:          "failed-logons",
+		Type:          model.AlertRuleLog,
+		Severity:      "critical",
+		Fields:        map[string]string{"result": "failed"},
+		Threshold:     5,
+		WindowSeconds: 120,
+	})
+	failed := func(agentID string) logcollector.ArchiveLogEntry {
+		return logcollector.ArchiveLogEntry{AgentID: agentID, Message: "Logon failed", Fields: map[string]string{"result": "failed"}}
+	}
+
+	// 4 lần trong cửa sổ, lần thứ 5 sau khi 2 lần đầu đã ra khỏi cửa sổ: chưa cảnh báo
+	for i := 0; i < 4; i++ {
+		e.ObserveLog(failed("001"))
+		e.ObserveLog(failed("002"))
+		e.ObserveLog(logcollector.ArchiveLogEntry{AgentID: "001", Message: "Logon ok"})
+		clock.advance(30 * time.Second)
+	}
+	clock.advance(10 * time.Second)
+	e.ObserveLog(failed("001"))
+	if alerts, _ := repo.AlertList(repository.AlertFilter{}); len(alerts) != 0 {
+		t.Fatalf("hits outside window should not count: %+v", alerts)
+	}
+	e.ObserveLog(failed("001"))
+	e.ObserveLog(failed("001"))
+	alerts, _ := repo.AlertList(repository.AlertFilter{})
+	if len(alerts) != 1 || alerts[0].AgentID != "001" || alerts[0].State != model.AlertFiring || alerts[0].Severity != "critical" {
+		t.Fatalf("expected one firing alert for 001: %+v", alerts)
+	}
+	if n := notifier.next(t); n.Event != model.AlertFiring || n.Alert.ID != alerts[0].ID {
+		t.Errorf("unexpected notification: %+v", n)
+	}
+
+	// Vượt ngưỡng lần nữa khi cảnh báo còn mở: chỉ tăng Count, không thông báo lại
+	for i := 0; i < 5; i++ {
+		e.ObserveLog(failed("001"))
+	}
+	a, _ := repo.AlertFindByID(alerts[0].ID)
+	if a.Count != 2 {
+		t.Errorf("count should be 2, got %d", a.Count)
+	}
+	select {
+	case n := <-notifier.ch:
+		t.Errorf("open alert should not notify again: %+v", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestEnginePatternRuleAndStates(t *testing.T) {
+	e, repo, notifier, _ := newTestEngine(t, model.AlertRule{
+		Name:     "usb",
+		Type:     model.AlertRuleLog,
+		Severity: "warning",
+		Pattern:  `(?i)usb .* inserted`,
+		AgentIDs: []string{"001"},
+	})
+	e.ObserveLog(logcollector.ArchiveLogEntry{AgentID: "002", Message: "USB disk inserted"})
+	e.ObserveLog(logcollector.ArchiveLogEntry{AgentID: "001", Message: "USB disk inserted"})
+	alerts, _ := repo.AlertList(repository.AlertFilter{States: []string{model.AlertFiring}})
+	if len(alerts) != 1 || alerts[0].AgentID != "001" {
+		t.Fatalf("expected one alert for 001: %+v", alerts)
+	}
+	notifier.next(t)
+	id := alerts[0].ID
+
+	a, err := e.Acknowledge(id, "admin")
+	if err != nil || a.State != model.AlertAcknowledged || a.AcknowledgedBy != "admin" {
+		t.Fatalf("acknowledge: %+v, %v", a, err)
+	}
+	// Còn mở sau khi acknowledge: khớp tiếp chỉ tăng Count
+	e.ObserveLog(logcollector.ArchiveLogEntry{AgentID: "001", Message: "USB disk inserted"})
+	if a, _ := repo.AlertFindByID(id); a.Count != 2 || a.State != model.AlertAcknowledged {
+		t.Errorf("acknowledged alert should stay open: %+v", a)
+	}
+
+	if a, err := e.Resolve(id, "admin"); err != nil || a.State != model.AlertResolved {
+		t.Fatalf("resolve: %+v, %v", a, err)
+	}
+	if n := notifier.next(t); n.Event != model.AlertResolved {
+		t.Errorf("expected resolved notification, got %+v", n)
+	}
+	if _, err := e.Acknowledge(id, "admin"); !errors.Is(err, ErrAlertResolved) {
+		t.Errorf("acknowledging resolved alert should fail, got %v", err)
+	}
+	// Khớp lại sau khi resolve: cảnh báo mới
+	e.ObserveLog(logcollector.ArchiveLogEntry{AgentID: "001", Message: "USB disk inserted"})
+	if alerts, _ := repo.AlertList(repository.AlertFilter{}); len(alerts) != 2 {
+		t.Errorf("expected a new alert after resolve, got %+v", alerts)
+	}
+}
+
+func TestEngineAgentOfflineRule(t *testing.T) {
+	e, repo, notifier, clock := newTestEngine(t, model.AlertRule{
+		Name:           "offline",
+		Type:           model.AlertRuleAgentOffline,
+		Severity:       "warning",
+		OfflineSeconds: 600,
+	})
+	lastSeen := clock.t.Add(-5 * time.Minute)
+	e.ObserveAgentStatus("001", false, lastSeen)
+	e.ObserveAgentStatus("002", true, clock.t)
+	if alerts, _ := repo.AlertList(repository.AlertFilter{}); len(alerts) != 0 {
+		t.Fatalf("offline 5m should not fire: %+v", alerts)
+	}
+	clock.advance(6 * time.Minute)
+	e.ObserveAgentStatus("001", false, lastSeen)
+	e.ObserveAgentStatus("001", false, lastSeen)
+	alerts, _ := repo.AlertList(repository.AlertFilter{})
+	if len(alerts) != 1 || alerts[0].AgentID != "001" {
+		t.Fatalf("expected one offline alert: %+v", alerts)
+	}
+	notifier.next(t)
+
+	e.ObserveAgentStatus("001", true, clock.t)
+	a, _ := repo.AlertFindByID(alerts[0].ID)
+	if a.State != model.AlertResolved || a.ResolvedBy != "" {
+		t.Errorf("alert should auto-resolve when agent is back: %+v", a)
+	}
+	if n := notifier.next(t); n.Event != model.AlertResolved {
+		t.Errorf("expected resolved notification, got %+v", n)
+	}
+}
+
+func TestEngineValidateRule(t *testing.T) {
+	e, _, _, _ := newTestEngine(t)
+	cases := []model.AlertRule{
+		{Type: model.AlertRuleLog},
+		{Name: "x", Type: "cpu"},
+		{Name: "x", Type: model.AlertRuleLog, Pattern: "("},
+		{Name: "x", Type: model.AlertRuleLog, Threshold: 5},
+		{Name: "x", Type: model.AlertRuleAgentOffline},
+		{Name: "x", Type: model.AlertRuleLog, Channels: []string{"missing"}},
+		{Name: "x", Type: model.AlertRuleLog, Severity: "fatal"},
+	}
+	for _, r := range cases {
+		if err := e.ValidateRule(&r); !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("rule %+v should be invalid, got %v", r, err)
+		}
+	}
+	r := model.AlertRule{Name: "x", Type: model.AlertRuleLog, Channels: []string{"test"}}
+	if err := e.ValidateRule(&r); err != nil || r.Severity != "warning" || r.Threshold != 1 {
+		t.Errorf("valid rule should get defaults: %+v, %v", r, err)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	got := make(chan Notification, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n Notification
+		json.NewDecoder(r.Body).Decode(&n)
+		got <- n
+	}))
+	defer srv.Close()
+	notifiers, errs := NewNotifiers([]config.AlertChannelConfig{
+		{Name: "hook", Type: "webhook", URL: srv.URL},
+		{Name: "mail", Type: "smtp"},
+	})
+	if len(errs) != 1 || len(notifiers) != 1 {
+		t.Fatalf("invalid smtp channel should be reported: %v", errs)
+	}
+	if err := notifiers["hook"].Notify(Notification{Event: model.AlertFiring, Alert: model.Alert{ID: "a1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if n := <-got; n.Event != model.AlertFiring || n.Alert.ID != "a1" {
+		t.Errorf("unexpected webhook payload: %+v", n)
+	}
+}
@@ -0,0 +1,115 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/config"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Notification là nội dung gửi qua kênh thông báo khi cảnh báo firing hoặc resolved
+type Notification struct {
+	Event string      `json:"event"` // firing | resolved
+	Alert model.Alert `json:"alert"`
+}
+
+// Notifier gửi thông báo qua một kênh
+type Notifier interface {
+	Notify(n Notification) error
+}
+
+// NewNotifiers tạo notifier cho từng kênh trong cấu hình, kênh lỗi cấu hình được bỏ qua và trả về trong errs
+func NewNotifiers(channels []config.AlertChannelConfig) (map[string]Notifier, []error) {
+	notifiers := map[string]Notifier{}
+	var errs []error
+	for _, ch := range channels {
+		n, err := newNotifier(ch)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("alert channel %s: %v", ch.Name, err))
+			continue
+		}
+		notifiers[ch.Name] = n
+	}
+	return notifiers, errs
+}
+
+func newNotifier(ch config.AlertChannelConfig) (Notifier, error) {
+	if ch.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	switch ch.Type {
+	case "webhook":
+		if ch.URL == "" {
+			return nil, errors.New("url is required")
+		}
+		return &webhookNotifier{url: ch.URL, client: &http.Client{Timeout: 10 * time.Second}}, nil
+	case "smtp":
+		if ch.SMTPAddr == "" || ch.From == "" || len(ch.To) == 0 {
+			return nil, errors.New("smtp_addr, from and to are required")
+		}
+		return &smtpNotifier{addr: ch.SMTPAddr, from: ch.From, to: ch.To}, nil
+	}
+	return nil, fmt.Errorf("unknown type %q", ch.Type)
+}
+
+// webhookNotifier POST Notification dạng JSON tới URL, status ngoài 2xx là lỗi
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (w *webhookNotifier) Notify(n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// smtpNotifier gửi mail văn bản qua SMTP relay nội bộ (không xác thực)
+type smtpNotifier struct {
+	addr string
+	from string
+	to   []string
+}
+
+func (s *smtpNotifier) Notify(n Notification) error {
+	return smtp.SendMail(s.addr, nil, s.from, s.to, formatMail(s.from, s.to, n))
+}
+
+func notificationSubject(n Notification) string {
+	return fmt.Sprintf("[%s][%s] %s - agent %s", n.Event, n.Alert.Severity, n.Alert.RuleName, n.Alert.AgentID)
+}
+
+// formatMail tạo thư RFC 5322 đơn giản, tiêu đề có ký tự ngoài ASCII được mã hoá theo RFC 2047
+func formatMail(from string, to []string, n Notification) []byte {
+	a := n.Alert
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", notificationSubject(n)))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	fmt.Fprintf(&b, "Rule: %s\r\nAgent: %s\r\nSeverity: %s\r\nState: %s\r\nMessage: %s\r\nCount: %d\r\nFired at: %s\r\n",
+		a.RuleName, a.AgentID, a.Severity, a.State, a.Message, a.Count, a.FiredAt)
+	if a.ResolvedAt != "" {
+		fmt.Fprintf(&b, "Resolved at: %s\r\n", a.ResolvedAt)
+	}
+	fmt.Fprintf(&b, "Alert ID: %s\r\n", a.ID)
+	return []byte(b.String())
+}
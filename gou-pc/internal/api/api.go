@@ -3,8 +3,11 @@ package api
 import (
 	"gou-pc/internal/api/handler"
 	"gou-pc/internal/api/middleware"
+	"gou-pc/internal/api/model"
 	"gou-pc/internal/api/repository"
 	"gou-pc/internal/api/service"
+	"gou-pc/internal/logcollector"
+	"gou-pc/internal/logforward"
 	"gou-pc/internal/logutil"
 	"time"
 
@@ -12,53 +15,122 @@ import (
 )
 
 // Start khởi động API server với Gin, inject các service
-func Start(port string, userService service.UserService, clientService service.ClientService, logService service.LogService, clientRepo repository.ClientRepository, jwtSecret string, jwtExpire time.Duration) {
+func Start(port string, userService service.UserService, authService service.AuthService, clientService service.ClientService, logService service.LogService, alertService service.AlertService, loginEventService service.LoginEventService, incidentService service.IncidentService, roleService service.RoleService, auditService service.AuditService, apiKeyService service.APIKeyService, clientRepo repository.ClientRepository, otpGuard service.OTPGuard, logHub *logcollector.Hub, logForwarder *logforward.Forwarder, jwtSecret string, jwtExpire time.Duration) {
 	// Inject service vào handler
 	handler.InjectUserService(userService)
 	handler.InjectClientService(clientService)
 	handler.InjectLogService(logService)
-	handler.InjectOTPService(service.NewOTPService(clientRepo))
-	handler.InjectJWTConfig(jwtSecret, int64(jwtExpire.Seconds()))
-	// Inject config JWT cho middleware
+	handler.InjectLogHub(logHub)
+	handler.InjectLogForwarder(logForwarder)
+	handler.InjectAlertService(alertService)
+	handler.InjectLoginEventService(loginEventService)
+	handler.InjectIncidentService(incidentService)
+	handler.InjectOTPService(service.NewOTPService(clientRepo, otpGuard))
+	handler.InjectAuthService(authService)
+	handler.InjectRoleService(roleService)
+	handler.InjectAuditService(auditService)
+	handler.InjectAPIKeyService(apiKeyService)
+	// Inject config JWT cho middleware, mỗi request kiểm tra phiên còn hiệu lực, role hiện tại và quyền của role
 	middleware.InitJWT(jwtSecret, jwtExpire)
+	middleware.InitSessionValidator(authService)
+	middleware.InitPermissionChecker(roleService)
+	middleware.InitAuditRecorder(auditService)
+	middleware.InitAPIKeyValidator(apiKeyService)
 
 	r := gin.Default()
 
 	r.Use(middleware.LoggingMiddleware())
 	r.Use(middleware.CORSMiddleware())
 
-	// Public route: chỉ login
-	r.POST("/api/login", handler.LoginHandler)
+	// Public route: login (có ghi audit) và đổi refresh token
+	r.POST("/api/login", middleware.AuditMiddleware(), handler.LoginHandler)
+	r.POST("/api/refresh", handler.RefreshTokenHandler)
 
-	// Protected group: tất cả route còn lại đều cần JWT
-	api := r.Group("/api", middleware.JWTAuthMiddlewareFunc())
+	// Protected group: tất cả route còn lại đều cần JWT hoặc API key của service account; request thay đổi dữ liệu, bị từ chối
+	// (kể cả 401, actor rỗng) và lần đọc nhạy cảm (OTP, xuất log) được ghi audit. AuditMiddleware phải đứng trước xác thực.
+	api := r.Group("/api", middleware.AuditMiddleware(), middleware.JWTAuthMiddlewareFunc())
 	{
 		// User routes
-		api.POST("/users/create", middleware.JWTAuthMiddleware(handler.CreateUserHandler, true)) // admin only
-		api.POST("/users/change-password", handler.ChangePasswordHandler)
-		api.POST("/users/update", handler.UpdateUserHandler)
-		api.GET("/users", middleware.JWTAuthMiddleware(handler.ListUsersHandler, true)) // admin only
-		api.POST("/users/update-info", handler.UpdateUserInfoHandler)
-		api.DELETE("/users/delete", middleware.JWTAuthMiddleware(handler.DeleteUserHandler, true)) // admin only
+		api.POST("/users/create", middleware.JWTAuthMiddleware(handler.CreateUserHandler, model.PermUsersManage))
+		api.POST("/users/change-password", handler.ChangePasswordHandler) // chính mình hoặc users.manage
+		api.POST("/users/update", middleware.JWTAuthMiddleware(handler.UpdateUserHandler, model.PermUsersManage))
+		api.GET("/users", middleware.JWTAuthMiddleware(handler.ListUsersHandler, model.PermUsersManage))
+		api.POST("/users/update-info", handler.UpdateUserInfoHandler) // chính mình hoặc users.manage
+		api.DELETE("/users/delete", middleware.JWTAuthMiddleware(handler.DeleteUserHandler, model.PermUsersManage))
+		api.GET("/users/me/permissions", handler.GetMyPermissionsHandler)
+
+		// Phiên đăng nhập
+		api.POST("/logout", handler.LogoutHandler)
+		api.GET("/users/sessions", middleware.JWTAuthMiddleware(handler.ListUserSessionsHandler, model.PermUsersManage))
+		api.POST("/users/revoke-sessions", middleware.JWTAuthMiddleware(handler.RevokeUserSessionsHandler, model.PermUsersManage))
+
+		// Role và quyền
+		api.GET("/roles", middleware.JWTAuthMiddleware(handler.ListRolesHandler, model.PermRolesManage))
+		api.POST("/roles", middleware.JWTAuthMiddleware(handler.CreateRoleHandler, model.PermRolesManage))
+		api.GET("/roles/:name", middleware.JWTAuthMiddleware(handler.GetRoleHandler, model.PermRolesManage))
+		api.PUT("/roles/:name", middleware.JWTAuthMiddleware(handler.UpdateRoleHandler, model.PermRolesManage))
+		api.DELETE("/roles/:name", middleware.JWTAuthMiddleware(handler.DeleteRoleHandler, model.PermRolesManage))
+
+		// Service account và API key cho script/tích hợp
+		api.GET("/service-accounts", middleware.JWTAuthMiddleware(handler.ListServiceAccountsHandler, model.PermAPIKeysManage))
+		api.POST("/service-accounts", middleware.JWTAuthMiddleware(handler.CreateServiceAccountHandler, model.PermAPIKeysManage))
+		api.GET("/service-accounts/:name", middleware.JWTAuthMiddleware(handler.GetServiceAccountHandler, model.PermAPIKeysManage))
+		api.DELETE("/service-accounts/:name", middleware.JWTAuthMiddleware(handler.DeleteServiceAccountHandler, model.PermAPIKeysManage))
+		api.POST("/service-accounts/:name/keys", middleware.JWTAuthMiddleware(handler.CreateAPIKeyHandler, model.PermAPIKeysManage))
+		api.DELETE("/service-accounts/:name/keys/:id", middleware.JWTAuthMiddleware(handler.RevokeAPIKeyHandler, model.PermAPIKeysManage))
+
+		// Audit log
+		api.GET("/audit", middleware.JWTAuthMiddleware(handler.ListAuditHandler, model.PermAuditRead))
+		api.GET("/audit/export", middleware.JWTAuthMiddleware(handler.ExportAuditHandler, model.PermAuditRead))
 
 		// Client routes
-		api.GET("/clients", handler.HandleListClients)
+		api.GET("/clients", middleware.JWTAuthMiddleware(handler.HandleListClients, model.PermDevicesRead))
 		api.GET("/clients/my", handler.HandleListMyClients)
-		api.GET("/clients/:agent_id", handler.HandleGetClientByAgentID)
-		api.GET("/clients/by-id/:client_id", handler.HandleGetClientByID)
-		api.DELETE("/clients/delete-agentid", middleware.JWTAuthMiddleware(handler.HandleDeleteClientByAgentID, true))       // admin only
-		api.DELETE("/clients/delete-clientid", middleware.JWTAuthMiddleware(handler.HandleDeleteClientByClientID, true))     // admin only
-		api.POST("/clients/assign-agentid", middleware.JWTAuthMiddleware(handler.HandleAssignUserToClientByAgentID, true))   // admin only
-		api.POST("/clients/assign-clientid", middleware.JWTAuthMiddleware(handler.HandleAssignUserToClientByClientID, true)) // admin only
+		api.GET("/clients/:agent_id", middleware.JWTAuthMiddleware(handler.HandleGetClientByAgentID, model.PermDevicesRead))
+		api.GET("/clients/by-id/:client_id", middleware.JWTAuthMiddleware(handler.HandleGetClientByID, model.PermDevicesRead))
+		api.DELETE("/clients/delete-agentid", middleware.JWTAuthMiddleware(handler.HandleDeleteClientByAgentID, model.PermDevicesManage))
+		api.DELETE("/clients/delete-clientid", middleware.JWTAuthMiddleware(handler.HandleDeleteClientByClientID, model.PermDevicesManage))
+		api.POST("/clients/assign-agentid", middleware.JWTAuthMiddleware(handler.HandleAssignUserToClientByAgentID, model.PermDevicesManage))
+		api.POST("/clients/assign-clientid", middleware.JWTAuthMiddleware(handler.HandleAssignUserToClientByClientID, model.PermDevicesManage))
 		// OTP routes
-		api.GET("/clients/:agent_id/otp", handler.GetOTPByAgentIDHandler)
-		api.GET("/clients/my-otp", handler.GetMyOTPHandler)
+		api.GET("/clients/:agent_id/otp", middleware.JWTAuthMiddleware(handler.GetOTPByAgentIDHandler, model.PermOTPRead))
+		api.GET("/clients/my-otp", handler.GetMyOTPHandler) // thiết bị của mình, hoặc bất kỳ thiết bị nếu có otp.read
 
 		// Log routes
-		api.GET("/logs/archive", middleware.JWTAuthMiddleware(handler.GetArchiveLogHandler, true)) // admin only
+		api.GET("/logs/archive", middleware.JWTAuthMiddleware(handler.GetArchiveLogHandler, model.PermLogsRead))
 		api.GET("/logs/my-device", handler.GetMyDeviceLogHandler)
 		api.GET("/logs/my-device-paged", handler.GetMyDeviceLogPagedHandler)
-		api.GET("/logs/paged", middleware.JWTAuthMiddleware(handler.GetLogsPagedHandler, true)) // admin only
+		api.GET("/logs/paged", middleware.JWTAuthMiddleware(handler.GetLogsPagedHandler, model.PermLogsRead))
+		api.GET("/logs/search", handler.SearchLogsHandler)                                                             // không có logs.read chỉ thấy log thiết bị của mình
+		api.GET("/logs/export", handler.ExportLogsHandler)                                                             // NDJSON/CSV theo luồng, cùng quyền như search
+		api.GET("/logs/tail", handler.TailLogsHandler)                                                                 // SSE log realtime, cùng quyền như search
+		api.GET("/logs/forwarding", middleware.JWTAuthMiddleware(handler.GetLogForwardingHandler, model.PermLogsRead)) // thống kê chuyển tiếp syslog
+		api.GET("/logs/verify", middleware.JWTAuthMiddleware(handler.VerifyLogChainHandler, model.PermLogsRead))       // kiểm tra chuỗi hash chống sửa log
+		api.GET("/logs/stats/volume", middleware.JWTAuthMiddleware(handler.LogVolumeHandler, model.PermLogsRead))      // số log theo agent/khoảng thời gian
+		api.GET("/logs/stats/top-messages", middleware.JWTAuthMiddleware(handler.TopMessagesHandler, model.PermLogsRead))
+		api.GET("/logs/stats/error-rate", middleware.JWTAuthMiddleware(handler.ErrorRateHandler, model.PermLogsRead))
+
+		// Sự kiện đăng nhập từ credential provider, không có logs.read chỉ thấy thiết bị của mình
+		api.GET("/login-events", handler.ListLoginEventsHandler)
+
+		// Alert routes
+		api.GET("/alerts/rules", middleware.JWTAuthMiddleware(handler.ListAlertRulesHandler, model.PermAlertsRead))
+		api.POST("/alerts/rules", middleware.JWTAuthMiddleware(handler.CreateAlertRuleHandler, model.PermAlertsManage))
+		api.GET("/alerts/rules/:id", middleware.JWTAuthMiddleware(handler.GetAlertRuleHandler, model.PermAlertsRead))
+		api.PUT("/alerts/rules/:id", middleware.JWTAuthMiddleware(handler.UpdateAlertRuleHandler, model.PermAlertsManage))
+		api.DELETE("/alerts/rules/:id", middleware.JWTAuthMiddleware(handler.DeleteAlertRuleHandler, model.PermAlertsManage))
+		api.GET("/alerts", middleware.JWTAuthMiddleware(handler.ListAlertsHandler, model.PermAlertsRead))
+		api.GET("/alerts/:id", middleware.JWTAuthMiddleware(handler.GetAlertHandler, model.PermAlertsRead))
+		api.POST("/alerts/:id/ack", middleware.JWTAuthMiddleware(handler.AcknowledgeAlertHandler, model.PermAlertsManage))
+		api.POST("/alerts/:id/resolve", middleware.JWTAuthMiddleware(handler.ResolveAlertHandler, model.PermAlertsManage))
+		api.DELETE("/alerts/:id", middleware.JWTAuthMiddleware(handler.DeleteAlertHandler, model.PermAlertsManage))
+
+		// Incident brute-force/credential stuffing và khoá cấp OTP
+		api.GET("/incidents", middleware.JWTAuthMiddleware(handler.ListIncidentsHandler, model.PermIncidentsRead))
+		api.GET("/incidents/:id", middleware.JWTAuthMiddleware(handler.GetIncidentHandler, model.PermIncidentsRead))
+		api.POST("/incidents/:id/resolve", middleware.JWTAuthMiddleware(handler.ResolveIncidentHandler, model.PermIncidentsManage))
+		api.GET("/otp-locks", middleware.JWTAuthMiddleware(handler.ListOTPLocksHandler, model.PermIncidentsRead))
+		api.DELETE("/otp-locks", middleware.JWTAuthMiddleware(handler.UnlockOTPHandler, model.PermIncidentsManage))
 	}
 
 	logutil.APIInfo("API server (Gin) starting on port %s...", port)
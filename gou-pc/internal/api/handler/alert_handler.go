@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"errors"
+	"gou-pc/internal/alert"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+	"gou-pc/internal/api/response"
+	"gou-pc/internal/api/service"
+	"gou-pc/internal/logutil"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var alertService service.AlertService
+
+func InjectAlertService(s service.AlertService) { alertService = s }
+
+// alertErrorStatus đổi lỗi của alert service thành HTTP status
+func alertErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrAlertRuleNotFound), errors.Is(err, repository.ErrAlertNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, alert.ErrInvalidRule):
+		return http.StatusBadRequest
+	case errors.Is(err, alert.ErrAlertResolved):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func ListAlertRulesHandler(c *gin.Context) {
+	logutil.APIDebug("ListAlertRulesHandler called")
+	rules, err := alertService.RuleGetAll()
+	if err != nil {
+		logutil.APIDebug("ListAlertRulesHandler error: %v", err)
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response.Success(c, rules)
+}
+
+func GetAlertRuleHandler(c *gin.Context) {
+	rule, err := alertService.RuleGetByID(c.Param("id"))
+	if err != nil {
+		response.Error(c, alertErrorStatus(err), err.Error())
+		return
+	}
+	response.Success(c, rule)
+}
+
+func CreateAlertRuleHandler(c *gin.Context) {
+	logutil.APIDebug("CreateAlertRuleHandler called")
+	var rule model.AlertRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	a := audit(c, model.AuditAlertRuleCreate, "alert_rule", "")
+	if err := alertService.RuleCreate(&rule); err != nil {
+		logutil.APIDebug("CreateAlertRuleHandler error: %v", err)
+		response.Error(c, alertErrorStatus(err), err.Error())
+		return
+	}
+	a.Target, a.After = rule.ID, auditValue(rule)
+	logutil.APIDebug("CreateAlertRuleHandler: created rule %s (%s)", rule.Name, rule.ID)
+	response.Success(c, rule)
+}
+
+func UpdateAlertRuleHandler(c *gin.Context) {
+	logutil.APIDebug("UpdateAlertRuleHandler called")
+	var rule model.AlertRule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	rule.ID = c.Param("id")
+	a := audit(c, model.AuditAlertRuleUpdate, "alert_rule", rule.ID)
+	if before, err := alertService.RuleGetByID(rule.ID); err == nil {
+		a.Before = auditValue(before)
+	}
+	if err := alertService.RuleUpdate(&rule); err != nil {
+		logutil.APIDebug("UpdateAlertRuleHandler error: %v", err)
+		response.Error(c, alertErrorStatus(err), err.Error())
+		return
+	}
+	a.After = auditValue(rule)
+	response.Success(c, rule)
+}
+
+func DeleteAlertRuleHandler(c *gin.Context) {
+	id := c.Param("id")
+	a := audit(c, model.AuditAlertRuleDelete, "alert_rule", id)
+	if before, err := alertService.RuleGetByID(id); err == nil {
+		a.Before = auditValue(before)
+	}
+	if err := alertService.RuleDelete(id); err != nil {
+		logutil.APIDebug("DeleteAlertRuleHandler error: %v", err)
+		response.Error(c, alertErrorStatus(err), err.Error())
+		return
+	}
+	logutil.APIDebug("DeleteAlertRuleHandler: deleted rule %s", id)
+	response.Success(c, gin.H{"message": "rule deleted"})
+}
+
+// ListAlertsHandler liệt kê cảnh báo mới nhất trước: state (lặp lại hoặc cách nhau dấu phẩy), rule, agent, limit
+func ListAlertsHandler(c *gin.Context) {
+	logutil.APIDebug("ListAlertsHandler called")
+	f := repository.AlertFilter{
+		States:  queryList(c, "state"),
+		RuleID:  c.Query("rule"),
+		AgentID: c.Query("agent"),
+	}
+	for _, s := range f.States {
+		if s != model.AlertFiring && s != model.AlertAcknowledged && s != model.AlertResolved {
+			response.Error(c, http.StatusBadRequest, "state must be firing, acknowledged or resolved")
+			return
+		}
+	}
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			response.Error(c, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		f.Limit = n
+	}
+	alerts, err := alertService.AlertList(f)
+	if err != nil {
+		logutil.APIDebug("ListAlertsHandler error: %v", err)
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response.Success(c, alerts)
+}
+
+func GetAlertHandler(c *gin.Context) {
+	a, err := alertService.AlertGetByID(c.Param("id"))
+	if err != nil {
+		response.Error(c, alertErrorStatus(err), err.Error())
+		return
+	}
+	response.Success(c, a)
+}
+
+func AcknowledgeAlertHandler(c *gin.Context) {
+	username, _ := c.Get("username")
+	by, _ := username.(string)
+	entry := audit(c, model.AuditAlertAck, "alert", c.Param("id"))
+	a, err := alertService.AlertAcknowledge(c.Param("id"), by)
+	if err != nil {
+		logutil.APIDebug("AcknowledgeAlertHandler error: %v", err)
+		response.Error(c, alertErrorStatus(err), err.Error())
+		return
+	}
+	entry.After = auditValue(gin.H{"state": a.State})
+	response.Success(c, a)
+}
+
+func ResolveAlertHandler(c *gin.Context) {
+	username, _ := c.Get("username")
+	by, _ := username.(string)
+	entry := audit(c, model.AuditAlertResolve, "alert", c.Param("id"))
+	a, err := alertService.AlertResolve(c.Param("id"), by)
+	if err != nil {
+		logutil.APIDebug("ResolveAlertHandler error: %v", err)
+		response.Error(c, alertErrorStatus(err), err.Error())
+		return
+	}
+	entry.After = auditValue(gin.H{"state": a.State})
+	response.Success(c, a)
+}
+
+func DeleteAlertHandler(c *gin.Context) {
+	id := c.Param("id")
+	entry := audit(c, model.AuditAlertDelete, "alert", id)
+	if before, err := alertService.AlertGetByID(id); err == nil {
+		entry.Before = auditValue(before)
+	}
+	if err := alertService.AlertDelete(id); err != nil {
+		logutil.APIDebug("DeleteAlertHandler error: %v", err)
+		response.Error(c, alertErrorStatus(err), err.Error())
+		return
+	}
+	response.Success(c, gin.H{"message": "alert deleted"})
+}
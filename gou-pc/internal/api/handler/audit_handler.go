@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"gou-pc/internal/api/middleware"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+	"gou-pc/internal/api/response"
+	"gou-pc/internal/api/service"
+	"gou-pc/internal/logutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var auditService service.AuditService
+
+func InjectAuditService(s service.AuditService) { auditService = s }
+
+// audit điền hành động và đối tượng vào dòng audit của request (middleware.AuditMiddleware ghi sau khi handler xong)
+func audit(c *gin.Context, action, targetType, target string) *model.AuditEntry {
+	e := middleware.Audit(c)
+	e.Action, e.TargetType, e.Target = action, targetType, target
+	return e
+}
+
+// auditValue đổi giá trị trước/sau thành JSON; nil hoặc lỗi marshal thì bỏ trống
+func auditValue(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// userAuditView là thông tin user ghi vào audit, không có mật khẩu
+func userAuditView(u *model.User) gin.H {
+	if u == nil {
+		return nil
+	}
+	return gin.H{"id": u.ID, "username": u.Username, "full_name": u.FullName, "email": u.Email, "role": u.Role}
+}
+
+// parseAuditFilter đọc bộ lọc chung của /audit và /audit/export
+func parseAuditFilter(c *gin.Context) (repository.AuditFilter, bool) {
+	f := repository.AuditFilter{
+		Actors:     queryList(c, "actor"),
+		Actions:    queryList(c, "action"),
+		TargetType: c.Query("target_type"),
+		Target:     c.Query("target"),
+		Outcome:    c.Query("outcome"),
+	}
+	switch f.Outcome {
+	case "", model.AuditSuccess, model.AuditFailure, model.AuditDenied:
+	default:
+		response.Error(c, http.StatusBadRequest, "outcome must be success, failure or denied")
+		return f, false
+	}
+	var err error
+	if f.From, err = parseSearchTime(c.Query("from"), false); err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid from: "+err.Error())
+		return f, false
+	}
+	if f.To, err = parseSearchTime(c.Query("to"), true); err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid to: "+err.Error())
+		return f, false
+	}
+	return f, true
+}
+
+// ListAuditHandler liệt kê audit log mới nhất trước, lọc theo actor, action, target_type, target, outcome, from/to;
+// phân trang bằng page/pageSize
+func ListAuditHandler(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "50"))
+	if pageSize < 1 || pageSize > searchMaxLimit {
+		response.Error(c, http.StatusBadRequest, "pageSize must be between 1 and 500")
+		return
+	}
+	f, ok := parseAuditFilter(c)
+	if !ok {
+		return
+	}
+	entries, total, err := auditService.List(f, page, pageSize)
+	if err != nil {
+		logutil.APIDebug("ListAuditHandler error: %v", err)
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response.Success(c, gin.H{"entries": entries, "total": total})
+}
+
+// ExportAuditHandler xuất audit log khớp bộ lọc theo thứ tự thời gian dạng NDJSON (mặc định) hoặc CSV.
+// Bản thân lần xuất cũng được ghi vào audit log.
+func ExportAuditHandler(c *gin.Context) {
+	format := c.DefaultQuery("format", "ndjson")
+	if format != "ndjson" && format != "csv" {
+		response.Error(c, http.StatusBadRequest, "format must be ndjson or csv")
+		return
+	}
+	f, ok := parseAuditFilter(c)
+	if !ok {
+		return
+	}
+	a := audit(c, model.AuditExport, "", "")
+	a.After = auditValue(gin.H{"format": format, "query": c.Request.URL.RawQuery})
+
+	ctx := c.Request.Context()
+	buf := bufio.NewWriterSize(c.Writer, 32*1024)
+	var write func(model.AuditEntry) error
+	var flush func() error
+	var header func()
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(buf)
+		header = func() {
+			cw.Write([]string{"id", "time", "actor", "actor_role", "action", "target_type", "target", "before", "after", "method", "path", "source_ip", "status", "outcome", "error"})
+		}
+		write = func(e model.AuditEntry) error {
+			return cw.Write([]string{strconv.FormatInt(e.ID, 10), e.Time, e.Actor, e.ActorRole, e.Action, e.TargetType, e.Target,
+				string(e.Before), string(e.After), e.Method, e.Path, e.SourceIP, strconv.Itoa(e.Status), e.Outcome, e.Error})
+		}
+		flush = func() error {
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				return err
+			}
+			return buf.Flush()
+		}
+	default:
+		enc := json.NewEncoder(buf)
+		write = func(e model.AuditEntry) error { return enc.Encode(e) }
+		flush = buf.Flush
+	}
+
+	// Header chỉ gửi khi có dòng đầu tiên hoặc khi xuất xong, lỗi trước đó vẫn trả được JSON lỗi
+	started := false
+	start := func() {
+		started = true
+		ext, contentType := "ndjson", "application/x-ndjson"
+		if format == "csv" {
+			ext, contentType = "csv", "text/csv; charset=utf-8"
+		}
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="audit-%s.%s"`, time.Now().Format("20060102-150405"), ext))
+		c.Status(http.StatusOK)
+		if header != nil {
+			header()
+		}
+	}
+	count := 0
+	err := auditService.Export(f, func(e model.AuditEntry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !started {
+			start()
+		}
+		if err := write(e); err != nil {
+			return err
+		}
+		count++
+		if count%exportFlushEvery == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		logutil.APIDebug("ExportAuditHandler error after %d entries: %v", count, err)
+		if !started {
+			response.Error(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if conn, _, herr := c.Writer.Hijack(); herr == nil {
+			conn.Close()
+		}
+		return
+	}
+	if !started {
+		start()
+	}
+	if err := flush(); err != nil {
+		logutil.APIDebug("ExportAuditHandler flush error: %v", err)
+		return
+	}
+	c.Writer.Flush()
+}
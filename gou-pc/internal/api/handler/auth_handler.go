@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"errors"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+	"gou-pc/internal/api/response"
+	"gou-pc/internal/api/service"
+	"gou-pc/internal/logutil"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+var authService service.AuthService
+
+func InjectAuthService(s service.AuthService) { authService = s }
+
+// RefreshTokenHandler đổi refresh token lấy access token và refresh token mới (public, không cần JWT)
+func RefreshTokenHandler(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+		response.Error(c, http.StatusBadRequest, "refresh_token required")
+		return
+	}
+	pair, err := authService.Refresh(req.RefreshToken)
+	if err != nil {
+		logutil.APIDebug("RefreshTokenHandler error: %v", err)
+		if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+			response.Error(c, http.StatusUnauthorized, err.Error())
+		} else {
+			response.Error(c, http.StatusInternalServerError, "could not refresh token")
+		}
+		return
+	}
+	response.Success(c, pair)
+}
+
+// LogoutHandler thu hồi phiên của access token hiện tại, refresh token của phiên hết hiệu lực
+func LogoutHandler(c *gin.Context) {
+	audit(c, model.AuditLogout, "session", c.GetString("session_id"))
+	if c.GetString("session_id") == "" {
+		response.Error(c, http.StatusBadRequest, "request is not authenticated by a session (api key)")
+		return
+	}
+	if err := authService.Logout(c.GetString("session_id")); err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+		logutil.APIDebug("LogoutHandler error: %v", err)
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response.Success(c, gin.H{"message": "logged out"})
+}
+
+// ListUserSessionsHandler liệt kê phiên còn hiệu lực của user (?username=)
+func ListUserSessionsHandler(c *gin.Context) {
+	user, err := userService.UserGetByUsername(c.Query("username"))
+	if err != nil || user == nil {
+		response.Error(c, http.StatusNotFound, "user not found")
+		return
+	}
+	sessions, err := authService.ListUserSessions(user.ID)
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response.Success(c, sessions)
+}
+
+// RevokeUserSessionsHandler thu hồi mọi phiên của user, user phải đăng nhập lại
+func RevokeUserSessionsHandler(c *gin.Context) {
+	var req struct {
+		Username string `json:"username"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Username == "" {
+		response.Error(c, http.StatusBadRequest, "username required")
+		return
+	}
+	a := audit(c, model.AuditSessionsRevoke, "user", req.Username)
+	user, err := userService.UserGetByUsername(req.Username)
+	if err != nil || user == nil {
+		response.Error(c, http.StatusNotFound, "user not found")
+		return
+	}
+	if !checkManageableTarget(c, user) {
+		return
+	}
+	n, err := authService.RevokeUserSessions(user.ID, "")
+	if err != nil {
+		logutil.APIDebug("RevokeUserSessionsHandler error: %v", err)
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	a.After = auditValue(gin.H{"revoked": n})
+	logutil.APIInfo("Sessions of user %s revoked by %s: %d", user.Username, c.GetString("username"), n)
+	response.Success(c, gin.H{"message": "sessions revoked", "revoked": n})
+}
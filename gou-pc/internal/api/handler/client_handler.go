@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"errors"
+	"gou-pc/internal/api/model"
 	"gou-pc/internal/api/response"
 	"gou-pc/internal/api/service"
 	"gou-pc/internal/logutil"
@@ -78,6 +80,10 @@ func HandleDeleteClientByAgentID(c *gin.Context) {
 		response.Error(c, http.StatusBadRequest, "agent_id required")
 		return
 	}
+	a := audit(c, model.AuditClientDelete, "agent", req.AgentID)
+	if before, err := clientService.GetClientByAgentID(req.AgentID); err == nil {
+		a.Before = auditValue(before)
+	}
 	if err := clientService.DeleteClientByAgentID(req.AgentID); err != nil {
 		response.Error(c, http.StatusBadRequest, err.Error())
 		return
@@ -97,6 +103,10 @@ func HandleDeleteClientByClientID(c *gin.Context) {
 		response.Error(c, http.StatusBadRequest, "client_id required")
 		return
 	}
+	a := audit(c, model.AuditClientDelete, "client", req.ClientID)
+	if before, err := clientService.GetClientByID(req.ClientID); err == nil {
+		a.Before = auditValue(before)
+	}
 	if err := clientService.DeleteClientByClientID(req.ClientID); err != nil {
 		response.Error(c, http.StatusBadRequest, err.Error())
 		return
@@ -117,10 +127,15 @@ func HandleAssignUserToClientByAgentID(c *gin.Context) {
 		response.Error(c, http.StatusBadRequest, "agent_id and username required")
 		return
 	}
+	a := audit(c, model.AuditClientAssign, "agent", req.AgentID)
+	if before, err := clientService.GetClientByAgentID(req.AgentID); err == nil && before != nil {
+		a.Before = auditValue(gin.H{"username": before.Username})
+	}
 	if err := clientService.AssignUserToClientByAgentID(req.AgentID, req.Username); err != nil {
 		response.Error(c, http.StatusBadRequest, err.Error())
 		return
 	}
+	a.After = auditValue(gin.H{"username": req.Username})
 	response.Success(c, gin.H{"message": "user assigned to client successfully"})
 }
 
@@ -137,36 +152,64 @@ func HandleAssignUserToClientByClientID(c *gin.Context) {
 		response.Error(c, http.StatusBadRequest, "client_id and username required")
 		return
 	}
+	a := audit(c, model.AuditClientAssign, "client", req.ClientID)
+	if before, err := clientService.GetClientByID(req.ClientID); err == nil && before != nil {
+		a.Before = auditValue(gin.H{"username": before.Username})
+	}
 	if err := clientService.AssignUserToClientByClientID(req.ClientID, req.Username); err != nil {
 		response.Error(c, http.StatusBadRequest, err.Error())
 		return
 	}
+	a.After = auditValue(gin.H{"username": req.Username})
 	response.Success(c, gin.H{"message": "user assigned to client successfully"})
 }
 
+// otpErrorStatus: thiết bị/user đang bị khoá cấp OTP trả 423 Locked
+func otpErrorStatus(err error) int {
+	if errors.Is(err, service.ErrOTPLocked) {
+		return http.StatusLocked
+	}
+	return http.StatusInternalServerError
+}
+
 func GetOTPByAgentIDHandler(c *gin.Context) {
 	agentID := c.Param("agent_id")
 	if agentID == "" {
 		response.Error(c, http.StatusBadRequest, "agent_id required")
 		return
 	}
+	audit(c, model.AuditOTPView, "agent", agentID)
 	otp, secondsLeft, err := otpService.GetOTPByAgentIDWithExpire(agentID)
 	if err != nil {
-		response.Error(c, http.StatusInternalServerError, err.Error())
+		response.Error(c, otpErrorStatus(err), err.Error())
 		return
 	}
 	response.Success(c, gin.H{"agent_id": agentID, "otp": otp, "expire_in": secondsLeft})
 }
 
+// GetMyOTPHandler trả OTP của thiết bị được gán cho user; user có quyền otp.read xem được mọi thiết bị
 func GetMyOTPHandler(c *gin.Context) {
 	agentID := c.Query("agent_id")
 	if agentID == "" {
 		response.Error(c, http.StatusBadRequest, "agent_id required")
 		return
 	}
+	if !hasPermission(c, model.PermOTPRead) {
+		agentIDs, ok := myAgentIDs(c)
+		if !ok {
+			return
+		}
+		if !containsString(agentIDs, agentID) {
+			response.Error(c, http.StatusForbidden, "agent_id not assigned to user")
+			return
+		}
+	} else {
+		// Lấy OTP bằng quyền otp.read (không cần là thiết bị của mình): ghi audit như GET /clients/:agent_id/otp
+		audit(c, model.AuditOTPView, "agent", agentID)
+	}
 	otp, secondsLeft, err := otpService.GetOTPByAgentIDWithExpire(agentID)
 	if err != nil {
-		response.Error(c, http.StatusInternalServerError, err.Error())
+		response.Error(c, otpErrorStatus(err), err.Error())
 		return
 	}
 	response.Success(c, gin.H{"agent_id": agentID, "otp": otp, "expire_in": secondsLeft})
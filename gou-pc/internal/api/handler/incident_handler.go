@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"errors"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+	"gou-pc/internal/api/response"
+	"gou-pc/internal/api/service"
+	"gou-pc/internal/detect"
+	"gou-pc/internal/logutil"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var incidentService service.IncidentService
+
+func InjectIncidentService(s service.IncidentService) { incidentService = s }
+
+// incidentErrorStatus đổi lỗi của incident service thành HTTP status
+func incidentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrIncidentNotFound), errors.Is(err, detect.ErrLockNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, detect.ErrIncidentResolved):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func ListIncidentsHandler(c *gin.Context) {
+	logutil.APIDebug("ListIncidentsHandler called")
+	f := repository.IncidentFilter{
+		States:  queryList(c, "state"),
+		Types:   queryList(c, "type"),
+		Subject: c.Query("subject"),
+	}
+	for _, s := range f.States {
+		if s != model.IncidentOpen && s != model.IncidentResolved {
+			response.Error(c, http.StatusBadRequest, "state must be open or resolved")
+			return
+		}
+	}
+	for _, t := range f.Types {
+		if t != model.IncidentUserSpray && t != model.IncidentDeviceSpray && t != model.IncidentOTPBurst {
+			response.Error(c, http.StatusBadRequest, "type must be user_many_devices, device_many_users or otp_burst")
+			return
+		}
+	}
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			response.Error(c, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		f.Limit = n
+	}
+	incidents, err := incidentService.IncidentList(f)
+	if err != nil {
+		logutil.APIDebug("ListIncidentsHandler error: %v", err)
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response.Success(c, incidents)
+}
+
+func GetIncidentHandler(c *gin.Context) {
+	inc, err := incidentService.IncidentGetByID(c.Param("id"))
+	if err != nil {
+		response.Error(c, incidentErrorStatus(err), err.Error())
+		return
+	}
+	response.Success(c, inc)
+}
+
+func ResolveIncidentHandler(c *gin.Context) {
+	username, _ := c.Get("username")
+	by, _ := username.(string)
+	a := audit(c, model.AuditIncidentResolve, "incident", c.Param("id"))
+	inc, err := incidentService.IncidentResolve(c.Param("id"), by)
+	if err != nil {
+		logutil.APIDebug("ResolveIncidentHandler error: %v", err)
+		response.Error(c, incidentErrorStatus(err), err.Error())
+		return
+	}
+	a.After = auditValue(gin.H{"state": inc.State})
+	response.Success(c, inc)
+}
+
+func ListOTPLocksHandler(c *gin.Context) {
+	response.Success(c, incidentService.OTPLockList())
+}
+
+// UnlockOTPHandler mở khoá cấp OTP trước hạn: ?type=device&subject=<agent_id> hoặc ?type=user&subject=<username>
+func UnlockOTPHandler(c *gin.Context) {
+	subjectType, subject := c.Query("type"), c.Query("subject")
+	audit(c, model.AuditOTPUnlock, subjectType, subject)
+	if subjectType != model.SubjectDevice && subjectType != model.SubjectUser {
+		response.Error(c, http.StatusBadRequest, "type must be device or user")
+		return
+	}
+	if subject == "" {
+		response.Error(c, http.StatusBadRequest, "subject required")
+		return
+	}
+	if err := incidentService.OTPUnlock(subjectType, subject); err != nil {
+		logutil.APIDebug("UnlockOTPHandler error: %v", err)
+		response.Error(c, incidentErrorStatus(err), err.Error())
+		return
+	}
+	username, _ := c.Get("username")
+	logutil.APIInfo("OTP unlocked by %v: %s=%s", username, subjectType, subject)
+	response.Success(c, gin.H{"message": "otp lock removed"})
+}
@@ -1,11 +1,23 @@
 package handler
 
 import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gou-pc/internal/api/middleware"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
 	"gou-pc/internal/api/response"
 	"gou-pc/internal/api/service"
+	"gou-pc/internal/logcollector"
+	"gou-pc/internal/logforward"
 	"gou-pc/internal/logutil"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,87 +26,111 @@ var logService service.LogService
 
 func InjectLogService(s service.LogService) { logService = s }
 
+var logHub *logcollector.Hub
+
+func InjectLogHub(h *logcollector.Hub) { logHub = h }
+
+var logForwarder *logforward.Forwarder
+
+func InjectLogForwarder(f *logforward.Forwarder) { logForwarder = f }
+
+// GetLogForwardingHandler trả về thống kê gửi của từng đích syslog
+func GetLogForwardingHandler(c *gin.Context) {
+	stats := []logforward.OutputStats{}
+	if logForwarder != nil {
+		stats = logForwarder.Stats()
+	}
+	response.Success(c, stats)
+}
+
+// VerifyLogChainHandler kiểm tra chuỗi hash của log store, data.ok = false và data.break là chỗ đứt đầu tiên
+func VerifyLogChainHandler(c *gin.Context) {
+	report, err := logService.VerifyLogChain()
+	if err != nil {
+		logutil.APIDebug("VerifyLogChainHandler: verify error: %v", err)
+		response.Error(c, http.StatusInternalServerError, "Failed to verify log chain")
+		return
+	}
+	if !report.OK {
+		logutil.APIError("VerifyLogChainHandler: log chain broken at seq=%d: %s", report.Break.Seq, report.Break.Reason)
+	}
+	response.Success(c, report)
+}
+
+// GetArchiveLogHandler trả về toàn bộ log khớp bộ lọc chung (xem parseLogFilter, parseLogSort), mới nhất lên đầu
 func GetArchiveLogHandler(c *gin.Context) {
 	logutil.APIDebug("GetArchiveLogHandler called")
-	agentID := c.Query("agent")
-	if agentID != "" {
-		logutil.APIDebug("GetArchiveLogHandler: filter by agent_id=%s", agentID)
-		logs, err := logService.GetLogsByAgentID(agentID)
-		if err != nil {
-			logutil.APIDebug("GetArchiveLogHandler error: %v", err)
-			response.Error(c, http.StatusInternalServerError, err.Error())
-			return
-		}
-		response.Success(c, logs)
-
-	} else {
-		logs, err := logService.GetAllLogs()
-		if err != nil {
-			logutil.APIDebug("GetArchiveLogHandler error: %v", err)
-			response.Error(c, http.StatusInternalServerError, err.Error())
-			return
-		}
-		logutil.APIDebug("GetArchiveLogHandler success, %d logs", len(logs))
-		response.Success(c, logs)
+	q, ok := parseLogFilter(c)
+	if !ok || !parseLogSort(c, &q, false) {
+		return
 	}
+	logs, _, err := logService.ListLogs(q, 0, 0)
+	if err != nil {
+		logutil.APIDebug("GetArchiveLogHandler error: %v", err)
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	logutil.APIDebug("GetArchiveLogHandler success, %d logs", len(logs))
+	response.Success(c, logs)
 }
 
-func GetMyDeviceLogHandler(c *gin.Context) {
-	logutil.APIDebug("GetMyDeviceLogHandler called")
-	username, ok := c.Get("username")
-	if !ok {
-		logutil.APIDebug("GetMyDeviceLogHandler missing username in context")
+// myAgentIDs trả về agent_id các thiết bị được gán cho user đang đăng nhập, lỗi thì đã trả response và ok = false
+func myAgentIDs(c *gin.Context) (agentIDs []string, ok bool) {
+	username, exists := c.Get("username")
+	if !exists {
+		logutil.APIDebug("myAgentIDs: missing username in context")
 		response.Error(c, http.StatusUnauthorized, "username not found in context")
-		return
+		return nil, false
 	}
-	clients, err := clientService.GetAllClients()
+	clients, err := clientService.GetClientsByUsername(username.(string))
 	if err != nil {
-		logutil.APIDebug("GetMyDeviceLogHandler: error getting all clients: %v", err)
+		logutil.APIDebug("myAgentIDs: error getting clients of %v: %v", username, err)
 		response.Error(c, http.StatusInternalServerError, "Không lấy được danh sách thiết bị")
-		return
+		return nil, false
 	}
-	var agentIDs []string
+	agentIDs = []string{}
 	for _, cl := range clients {
-		if cl.Username == username {
-			agentIDs = append(agentIDs, cl.AgentID)
-		}
+		agentIDs = append(agentIDs, cl.AgentID)
+	}
+	return agentIDs, true
+}
+
+func GetMyDeviceLogHandler(c *gin.Context) {
+	logutil.APIDebug("GetMyDeviceLogHandler called")
+	agentIDs, ok := myAgentIDs(c)
+	if !ok {
+		return
 	}
 	if len(agentIDs) == 0 {
-		logutil.APIDebug("GetMyDeviceLogHandler: user %v has no agentIDs", username)
 		response.Error(c, http.StatusNotFound, "User chưa được gán thiết bị hoặc không tìm thấy agent_id")
 		return
 	}
-	var allLogs []interface{}
-	for _, agentID := range agentIDs {
-		logs, err := logService.GetLogsByAgentID(agentID)
-		if err == nil && logs != nil {
-			logutil.APIDebug("GetMyDeviceLogHandler: found %d logs for agentID=%s", len(logs), agentID)
-			for _, l := range logs {
-				allLogs = append(allLogs, l)
-			}
-		}
+	q, ok := parseLogFilter(c)
+	if !ok || !parseLogSort(c, &q, false) {
+		return
 	}
-	logutil.APIDebug("GetMyDeviceLogHandler: total logs returned: %d", len(allLogs))
-	response.Success(c, allLogs)
+	q.AgentIDs = intersectIDs(q.AgentIDs, agentIDs)
+	logs, _, err := logService.ListLogs(q, 0, 0)
+	if err != nil {
+		logutil.APIDebug("GetMyDeviceLogHandler error: %v", err)
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	logutil.APIDebug("GetMyDeviceLogHandler: total logs returned: %d", len(logs))
+	response.Success(c, logs)
 }
 
 func GetLogsPagedHandler(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
-	agentID := c.Query("agent")
-	if agentID != "" {
-		logs, total, err := logService.GetLogsPagedByAgentID(agentID, page, pageSize)
-		if err != nil {
-			response.Error(c, http.StatusInternalServerError, err.Error())
-			return
-		}
-		c.JSON(http.StatusOK, gin.H{
-			"logs":  logs,
-			"total": total,
-		})
+	q, ok := parseLogFilter(c)
+	if !ok || !parseLogSort(c, &q, false) {
 		return
 	}
-	logs, total, err := logService.GetLogsPaged(page, pageSize)
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	logs, total, err := logService.ListLogs(q, page, pageSize)
 	if err != nil {
 		response.Error(c, http.StatusInternalServerError, err.Error())
 		return
@@ -106,11 +142,6 @@ func GetLogsPagedHandler(c *gin.Context) {
 }
 
 func GetMyDeviceLogPagedHandler(c *gin.Context) {
-	username, ok := c.Get("username")
-	if !ok {
-		response.Error(c, http.StatusUnauthorized, "username not found in context")
-		return
-	}
 	agentID := c.Query("agent")
 	if agentID == "" {
 		response.Error(c, http.StatusBadRequest, "agent param required")
@@ -119,23 +150,23 @@ func GetMyDeviceLogPagedHandler(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
 	// Kiểm tra agentID có thuộc user không
-	clients, err := clientService.GetClientsByUsername(username.(string))
-	if err != nil {
-		response.Error(c, http.StatusInternalServerError, err.Error())
+	agentIDs, ok := myAgentIDs(c)
+	if !ok {
 		return
 	}
-	found := false
-	for _, cl := range clients {
-		if cl.AgentID == agentID {
-			found = true
-			break
-		}
-	}
-	if !found {
+	if !containsString(agentIDs, agentID) {
 		response.Error(c, http.StatusForbidden, "agent_id not assigned to user")
 		return
 	}
-	logs, total, err := logService.GetLogsPagedByAgentID(agentID, page, pageSize)
+	q, ok := parseLogFilter(c)
+	if !ok || !parseLogSort(c, &q, false) {
+		return
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	q.AgentIDs = intersectIDs(q.AgentIDs, []string{agentID})
+	logs, total, err := logService.ListLogs(q, page, pageSize)
 	if err != nil {
 		response.Error(c, http.StatusInternalServerError, err.Error())
 		return
@@ -145,3 +176,518 @@ func GetMyDeviceLogPagedHandler(c *gin.Context) {
 		"total": total,
 	})
 }
+
+const (
+	searchDefaultLimit = 50
+	searchMaxLimit     = 500
+)
+
+// SearchLogsHandler tìm log: bộ lọc chung (parseLogFilter), sort_by/sort (parseLogSort), cursor, limit.
+// User không có quyền logs.read chỉ thấy log của thiết bị được gán cho mình.
+func SearchLogsHandler(c *gin.Context) {
+	logutil.APIDebug("SearchLogsHandler called")
+	q, ok := parseLogFilter(c)
+	if !ok {
+		return
+	}
+	if !parseLogSort(c, &q, false) {
+		return
+	}
+	q.Cursor = c.Query("cursor")
+	q.Limit = searchDefaultLimit
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			response.Error(c, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		if n > searchMaxLimit {
+			n = searchMaxLimit
+		}
+		q.Limit = n
+	}
+	logs, next, err := logService.SearchLogs(q)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCursor) {
+			response.Error(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		logutil.APIDebug("SearchLogsHandler error: %v", err)
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	logutil.APIDebug("SearchLogsHandler success, %d logs", len(logs))
+	response.Success(c, gin.H{
+		"logs":        logs,
+		"next_cursor": next,
+	})
+}
+
+// exportFlushEvery là số log giữa hai lần đẩy dữ liệu xuống client khi xuất log
+const exportFlushEvery = 500
+
+// ExportLogsHandler xuất log theo luồng (chunked) dạng NDJSON (mặc định) hoặc CSV: format=ndjson|csv,
+// cùng bộ lọc và sort_by với SearchLogsHandler, mặc định cũ nhất trước. Bộ nhớ không phụ thuộc số log (SQLite).
+func ExportLogsHandler(c *gin.Context) {
+	logutil.APIDebug("ExportLogsHandler called")
+	format := c.DefaultQuery("format", "ndjson")
+	if format != "ndjson" && format != "csv" {
+		response.Error(c, http.StatusBadRequest, "format must be ndjson or csv")
+		return
+	}
+	q, ok := parseLogFilter(c)
+	if !ok || !parseLogSort(c, &q, true) {
+		return
+	}
+	audit(c, model.AuditLogExport, "", "").After = auditValue(gin.H{"format": format, "query": c.Request.URL.RawQuery})
+	ctx := c.Request.Context()
+	buf := bufio.NewWriterSize(c.Writer, 32*1024)
+	var header func()
+	var write func(logcollector.ArchiveLogEntry) error
+	var flush func() error
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(buf)
+		header = func() {
+			cw.Write([]string{"id", "time", "received_at", "agent_id", "severity", "source", "source_file", "message", "fields"})
+		}
+		write = func(l logcollector.ArchiveLogEntry) error {
+			var fields string
+			if len(l.Fields) > 0 {
+				b, _ := json.Marshal(l.Fields)
+				fields = string(b)
+			}
+			return cw.Write([]string{strconv.FormatInt(l.ID, 10), l.Time, l.Received(), l.AgentID, l.Severity, l.Source, l.SourceFile, l.Message, fields})
+		}
+		flush = func() error {
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				return err
+			}
+			return buf.Flush()
+		}
+	default:
+		enc := json.NewEncoder(buf)
+		write = func(l logcollector.ArchiveLogEntry) error { return enc.Encode(l) }
+		flush = buf.Flush
+	}
+
+	// Header chỉ gửi khi có log đầu tiên hoặc khi xuất xong, lỗi trước đó vẫn trả được JSON lỗi
+	started := false
+	start := func() {
+		started = true
+		ext := "ndjson"
+		contentType := "application/x-ndjson"
+		if format == "csv" {
+			ext, contentType = "csv", "text/csv; charset=utf-8"
+		}
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="logs-%s.%s"`, time.Now().Format("20060102-150405"), ext))
+		c.Status(http.StatusOK)
+		if header != nil {
+			header() // lỗi ghi (nếu có) được trả ở lần flush
+		}
+	}
+	count := 0
+	err := logService.ExportLogs(q, func(l logcollector.ArchiveLogEntry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !started {
+			start()
+		}
+		if err := write(l); err != nil {
+			return err
+		}
+		count++
+		if count%exportFlushEvery == 0 {
+			if err := flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		logutil.APIDebug("ExportLogsHandler error after %d logs: %v", count, err)
+		if errors.Is(err, repository.ErrExportSortUnsupported) {
+			response.Error(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !started {
+			response.Error(c, http.StatusInternalServerError, err.Error())
+			return
+		}
+		// Đã gửi một phần: không đổi được status, đóng kết nối khi chưa gửi chunk cuối để client biết file xuất không trọn
+		if conn, _, herr := c.Writer.Hijack(); herr == nil {
+			conn.Close()
+		}
+		return
+	}
+	if !started {
+		start()
+	}
+	if err := flush(); err != nil {
+		logutil.APIDebug("ExportLogsHandler flush error: %v", err)
+		return
+	}
+	c.Writer.Flush()
+	logutil.APIDebug("ExportLogsHandler success, %d logs", count)
+}
+
+// tailPingEvery là chu kỳ gửi event ping giữ kết nối SSE khi không có log mới, cũng là chu kỳ kiểm tra lại quyền
+var tailPingEvery = 15 * time.Second
+
+// TailLogsHandler đẩy log mới nhận từ agent theo thời gian thực qua Server-Sent Events.
+// Bộ lọc giống SearchLogsHandler; user thường chỉ nhận log của thiết bị được gán cho mình.
+// Mỗi lần ping kiểm tra lại phiên và tập thiết bị được xem, logout/thu hồi phiên/hạ quyền/bỏ gán thiết bị thì đóng luồng.
+// Event: "log" (JSON log), "dropped" (số log bị bỏ vì client đọc chậm), "ping", "close" (lý do đóng luồng).
+func TailLogsHandler(c *gin.Context) {
+	logutil.APIDebug("TailLogsHandler called")
+	if logHub == nil {
+		response.Error(c, http.StatusServiceUnavailable, "log tail not available")
+		return
+	}
+	q, ok := parseLogFilter(c)
+	if !ok {
+		return
+	}
+	sub := logHub.Subscribe(q.Match, 0)
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.SSEvent("ping", time.Now().Format(time.RFC3339))
+	c.Writer.Flush()
+
+	ctx := c.Request.Context()
+	ticker := time.NewTicker(tailPingEvery)
+	defer ticker.Stop()
+	var reported int64
+	for {
+		select {
+		case <-ctx.Done():
+			logutil.APIDebug("TailLogsHandler: client disconnected, dropped %d logs", sub.Dropped())
+			return
+		case entry, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			c.SSEvent("log", entry)
+		case <-ticker.C:
+			if reason := tailRevoked(c, q.AgentIDs); reason != "" {
+				logutil.APIDebug("TailLogsHandler: closing stream of %s: %s", c.GetString("username"), reason)
+				c.SSEvent("close", reason)
+				c.Writer.Flush()
+				return
+			}
+			c.SSEvent("ping", time.Now().Format(time.RFC3339))
+		}
+		if d := sub.Dropped(); d > reported {
+			c.SSEvent("dropped", gin.H{"count": d - reported})
+			reported = d
+		}
+		c.Writer.Flush()
+	}
+}
+
+// tailRevoked kiểm tra lại xác thực và tập thiết bị được xem của luồng tail (allowed = tập lúc mở, nil = tất cả),
+// trả lý do cần đóng luồng hoặc rỗng nếu vẫn hợp lệ. Tập thiết bị chỉ được phép giữ nguyên hoặc rộng hơn.
+func tailRevoked(c *gin.Context, allowed []string) string {
+	if err := middleware.Revalidate(c); err != nil {
+		return err.Error()
+	}
+	ids, err := resolveSearchAgents(c, queryList(c, "agent"), queryList(c, "user"), queryList(c, "host"))
+	if err != nil {
+		return err.Error()
+	}
+	if ids == nil {
+		return ""
+	}
+	if allowed == nil {
+		return "allowed devices changed"
+	}
+	for _, id := range allowed {
+		if !containsString(ids, id) {
+			return "allowed devices changed"
+		}
+	}
+	return ""
+}
+
+// statsWindow là khoảng thời gian mặc định (tính tới hiện tại) của API thống kê khi không truyền from/to
+var statsWindow = map[string]time.Duration{
+	repository.LogBucketMinute: time.Hour,
+	repository.LogBucketHour:   24 * time.Hour,
+	repository.LogBucketDay:    30 * 24 * time.Hour,
+}
+
+// parseStatsQuery đọc bộ lọc chung và bucket (minute, hour, day; mặc định hour) của API thống kê,
+// không có from/to thì lấy statsWindow gần nhất. Lỗi thì đã trả response và ok = false.
+func parseStatsQuery(c *gin.Context) (q repository.LogQuery, bucket string, ok bool) {
+	bucket = c.DefaultQuery("bucket", repository.LogBucketHour)
+	window, valid := statsWindow[bucket]
+	if !valid {
+		response.Error(c, http.StatusBadRequest, "bucket must be minute, hour or day")
+		return q, "", false
+	}
+	if q, ok = parseLogFilter(c); !ok {
+		return q, "", false
+	}
+	if q.From == "" && q.To == "" {
+		q.From = time.Now().Add(-window).Format(time.RFC3339)
+	}
+	return q, bucket, true
+}
+
+// LogVolumeHandler trả về số log theo agent và khoảng thời gian: data.series[] gồm time (đầu khoảng), agent_id, count
+func LogVolumeHandler(c *gin.Context) {
+	q, bucket, ok := parseStatsQuery(c)
+	if !ok {
+		return
+	}
+	series, err := logService.LogVolume(q, bucket)
+	if err != nil {
+		logutil.APIDebug("LogVolumeHandler error: %v", err)
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response.Success(c, gin.H{"bucket": bucket, "from": q.From, "to": q.To, "series": series})
+}
+
+// TopMessagesHandler trả về n (mặc định 10, tối đa 1000) message xuất hiện nhiều nhất,
+// mode=template (mặc định) gom theo mẫu message, mode=exact đếm message giống hệt
+func TopMessagesHandler(c *gin.Context) {
+	n := 10
+	if s := c.Query("n"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 1 || v > 1000 {
+			response.Error(c, http.StatusBadRequest, "n must be between 1 and 1000")
+			return
+		}
+		n = v
+	}
+	mode := c.DefaultQuery("mode", "template")
+	if mode != "template" && mode != "exact" {
+		response.Error(c, http.StatusBadRequest, "mode must be template or exact")
+		return
+	}
+	q, _, ok := parseStatsQuery(c)
+	if !ok {
+		return
+	}
+	top, err := logService.TopMessages(q, n, mode == "template")
+	if err != nil {
+		logutil.APIDebug("TopMessagesHandler error: %v", err)
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response.Success(c, gin.H{"mode": mode, "from": q.From, "to": q.To, "messages": top})
+}
+
+// ErrorRateHandler trả về tỉ lệ log lỗi (mức threshold trở lên, mặc định error) theo khoảng thời gian
+func ErrorRateHandler(c *gin.Context) {
+	threshold := "error"
+	if s := c.Query("threshold"); s != "" {
+		if threshold = logcollector.NormalizeSeverity(s); threshold == "" {
+			response.Error(c, http.StatusBadRequest, "invalid threshold: "+s)
+			return
+		}
+	}
+	q, bucket, ok := parseStatsQuery(c)
+	if !ok {
+		return
+	}
+	series, err := logService.ErrorRate(q, bucket, threshold)
+	if err != nil {
+		logutil.APIDebug("ErrorRateHandler error: %v", err)
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response.Success(c, gin.H{"bucket": bucket, "threshold": threshold, "from": q.From, "to": q.To, "series": series})
+}
+
+// parseLogFilter đọc bộ lọc chung của các API log: q, from/to, time_field, agent/user/host, source, source_file,
+// severity, min_severity, field.<tên>. Lỗi thì đã trả response và ok = false.
+func parseLogFilter(c *gin.Context) (q repository.LogQuery, ok bool) {
+	q = repository.LogQuery{
+		Text:        c.Query("q"),
+		Fields:      queryFields(c),
+		Sources:     queryList(c, "source"),
+		SourceFiles: queryList(c, "source_file"),
+		TimeField:   c.Query("time_field"),
+	}
+	if q.TimeField != "" && q.TimeField != repository.LogSortTime && q.TimeField != repository.LogSortReceived {
+		response.Error(c, http.StatusBadRequest, "time_field must be time or received_at")
+		return q, false
+	}
+	for _, s := range queryList(c, "severity") {
+		sev := logcollector.NormalizeSeverity(s)
+		if sev == "" {
+			response.Error(c, http.StatusBadRequest, "invalid severity: "+s)
+			return q, false
+		}
+		q.Severities = append(q.Severities, sev)
+	}
+	if s := c.Query("min_severity"); s != "" {
+		if q.MinSeverity = logcollector.NormalizeSeverity(s); q.MinSeverity == "" {
+			response.Error(c, http.StatusBadRequest, "invalid min_severity: "+s)
+			return q, false
+		}
+	}
+	var err error
+	if q.From, err = parseSearchTime(c.Query("from"), false); err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid from: "+err.Error())
+		return q, false
+	}
+	if q.To, err = parseSearchTime(c.Query("to"), true); err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid to: "+err.Error())
+		return q, false
+	}
+	q.AgentIDs, err = resolveSearchAgents(c, queryList(c, "agent"), queryList(c, "user"), queryList(c, "host"))
+	if err != nil {
+		logutil.APIDebug("parseLogFilter: resolve agents error: %v", err)
+		response.Error(c, http.StatusInternalServerError, "Không lấy được danh sách thiết bị")
+		return q, false
+	}
+	return q, true
+}
+
+// parseLogSort đọc sort_by (time, received_at, severity) và sort (asc, desc; rỗng theo defaultAsc).
+// Lỗi thì đã trả response và trả về false.
+func parseLogSort(c *gin.Context, q *repository.LogQuery, defaultAsc bool) bool {
+	switch q.SortBy = c.Query("sort_by"); q.SortBy {
+	case "", repository.LogSortTime, repository.LogSortReceived, repository.LogSortSeverity:
+	default:
+		response.Error(c, http.StatusBadRequest, "sort_by must be time, received_at or severity")
+		return false
+	}
+	switch c.Query("sort") {
+	case "":
+		q.SortAsc = defaultAsc
+	case "asc":
+		q.SortAsc = true
+	case "desc":
+		q.SortAsc = false
+	default:
+		response.Error(c, http.StatusBadRequest, "sort must be asc or desc")
+		return false
+	}
+	return true
+}
+
+// resolveSearchAgents đổi bộ lọc agent/user/host thành danh sách agentID; nil nghĩa là không giới hạn.
+// Với user không có quyền logs.read, kết quả luôn bị giới hạn trong thiết bị của user đó.
+func resolveSearchAgents(c *gin.Context, agents, users, hosts []string) ([]string, error) {
+	var ids []string
+	if len(agents) > 0 {
+		ids = agents
+	}
+	readAll := hasPermission(c, model.PermLogsRead)
+	if len(users) == 0 && len(hosts) == 0 && readAll {
+		return ids, nil
+	}
+	clients, err := clientService.GetAllClients()
+	if err != nil {
+		return nil, err
+	}
+	if len(users) > 0 || len(hosts) > 0 {
+		matched := []string{}
+		for _, cl := range clients {
+			if len(users) > 0 && !containsString(users, cl.Username) {
+				continue
+			}
+			if len(hosts) > 0 && !containsString(hosts, cl.DeviceInfo.HostName) {
+				continue
+			}
+			matched = append(matched, cl.AgentID)
+		}
+		ids = intersectIDs(ids, matched)
+	}
+	if !readAll {
+		username, _ := c.Get("username")
+		owned := []string{}
+		for _, cl := range clients {
+			if cl.Username == username {
+				owned = append(owned, cl.AgentID)
+			}
+		}
+		ids = intersectIDs(ids, owned)
+	}
+	return ids, nil
+}
+
+// intersectIDs giao hai danh sách, a = nil được coi là "tất cả"
+func intersectIDs(a, b []string) []string {
+	if a == nil {
+		return b
+	}
+	out := []string{}
+	for _, id := range a {
+		if containsString(b, id) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// queryFields lấy các tham số field.<tên>=<giá trị>
+func queryFields(c *gin.Context) map[string]string {
+	var fields map[string]string
+	for key, values := range c.Request.URL.Query() {
+		name := strings.TrimPrefix(key, "field.")
+		if name == key || name == "" || len(values) == 0 {
+			continue
+		}
+		if fields == nil {
+			fields = map[string]string{}
+		}
+		fields[name] = values[0]
+	}
+	return fields
+}
+
+// queryList lấy tham số lặp lại (?agent=1&agent=2) hoặc cách nhau dấu phẩy (?agent=1,2)
+func queryList(c *gin.Context, key string) []string {
+	var out []string
+	for _, v := range c.QueryArray(key) {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				out = append(out, s)
+			}
+		}
+	}
+	return out
+}
+
+// parseSearchTime nhận RFC3339 hoặc YYYY-MM-DD, đổi về RFC3339 giờ local như trong log store.
+// Với "to" dạng ngày thì lấy hết ngày đó.
+func parseSearchTime(s string, endOfDay bool) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		d, derr := time.ParseInLocation("2006-01-02", s, time.Local)
+		if derr != nil {
+			return "", err
+		}
+		t = d
+		if endOfDay {
+			t = d.Add(24*time.Hour - time.Second)
+		}
+	}
+	return t.In(time.Local).Format(time.RFC3339), nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"bufio"
+	"errors"
+	"gou-pc/internal/api/middleware"
+	"gou-pc/internal/logcollector"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeSessions là SessionValidator có thể thu hồi phiên giữa chừng
+type fakeSessions struct{ revoked atomic.Bool }
+
+func (f *fakeSessions) ValidateSession(sessionID, userID string) (string, string, error) {
+	if f.revoked.Load() {
+		return "", "", errors.New("session revoked")
+	}
+	return "alice", "admin", nil
+}
+
+func TestTailLogsClosesRevokedSession(t *testing.T) {
+	middleware.InitJWT("test-secret", time.Minute)
+	sessions := &fakeSessions{}
+	middleware.InitSessionValidator(sessions)
+	t.Cleanup(func() { middleware.InitSessionValidator(nil) })
+	InjectLogHub(logcollector.NewHub())
+	t.Cleanup(func() { InjectLogHub(nil) })
+	old := tailPingEvery
+	tailPingEvery = 20 * time.Millisecond
+	t.Cleanup(func() { tailPingEvery = old })
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": "u1", "sid": "s1", "exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/logs/tail", middleware.JWTAuthMiddlewareFunc(), TailLogsHandler)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/logs/tail", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+
+	done := make(chan []string)
+	go func() {
+		var events []string
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			if ev, ok := strings.CutPrefix(sc.Text(), "event:"); ok {
+				events = append(events, ev)
+				if ev == "ping" && !sessions.revoked.Load() {
+					sessions.revoked.Store(true)
+				}
+			}
+		}
+		done <- events
+	}()
+	select {
+	case events := <-done:
+		if len(events) == 0 || events[len(events)-1] != "close" {
+			t.Fatalf("events = %v, want stream ending with close", events)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("tail stream not closed after session revoked")
+	}
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"gou-pc/internal/agent"
+	"gou-pc/internal/api/repository"
+	"gou-pc/internal/api/response"
+	"gou-pc/internal/api/service"
+	"gou-pc/internal/logutil"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+var loginEventService service.LoginEventService
+
+func InjectLoginEventService(s service.LoginEventService) { loginEventService = s }
+
+// ListLoginEventsHandler liệt kê sự kiện đăng nhập mới nhất trước, lọc theo thiết bị (agent/user/host như /logs/search),
+// tài khoản Windows (username), result, method, from/to; phân trang bằng page/pageSize.
+// User không có quyền logs.read chỉ thấy sự kiện trên thiết bị được gán cho mình.
+func ListLoginEventsHandler(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("pageSize", "50"))
+	if pageSize < 1 || pageSize > searchMaxLimit {
+		response.Error(c, http.StatusBadRequest, "pageSize must be between 1 and 500")
+		return
+	}
+	f := repository.LoginEventFilter{
+		Usernames: queryList(c, "username"),
+		Result:    c.Query("result"),
+		Method:    c.Query("method"),
+	}
+	switch f.Result {
+	case "", agent.LoginResultSuccess, agent.LoginResultFailed:
+	default:
+		response.Error(c, http.StatusBadRequest, "result must be success or failed")
+		return
+	}
+	switch f.Method {
+	case "", agent.LoginMethodOTP, agent.LoginMethodRecovery, agent.LoginMethodOffline:
+	default:
+		response.Error(c, http.StatusBadRequest, "method must be otp, recovery or offline")
+		return
+	}
+	var err error
+	if f.From, err = parseSearchTime(c.Query("from"), false); err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid from: "+err.Error())
+		return
+	}
+	if f.To, err = parseSearchTime(c.Query("to"), true); err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid to: "+err.Error())
+		return
+	}
+	f.AgentIDs, err = resolveSearchAgents(c, queryList(c, "agent"), queryList(c, "user"), queryList(c, "host"))
+	if err != nil {
+		logutil.APIDebug("ListLoginEventsHandler: resolve agents error: %v", err)
+		response.Error(c, http.StatusInternalServerError, "Không lấy được danh sách thiết bị")
+		return
+	}
+	events, total, err := loginEventService.List(f, page, pageSize)
+	if err != nil {
+		logutil.APIDebug("ListLoginEventsHandler error: %v", err)
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response.Success(c, gin.H{"events": events, "total": total})
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"errors"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+	"gou-pc/internal/api/response"
+	"gou-pc/internal/api/service"
+	"gou-pc/internal/logutil"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+var roleService service.RoleService
+
+func InjectRoleService(s service.RoleService) { roleService = s }
+
+// hasPermission cho biết user của request có quyền perm không (quyền do middleware đặt theo role)
+func hasPermission(c *gin.Context, perm string) bool {
+	return model.HasPermission(c.GetStringSlice("permissions"), perm)
+}
+
+// checkGrantable trả 403 cho quyền đầu tiên người gọi không có; không ai cấp được quyền mình không có
+func checkGrantable(c *gin.Context, perms []string) bool {
+	for _, p := range perms {
+		if !hasPermission(c, p) {
+			response.Error(c, http.StatusForbidden, "cannot grant permission "+p)
+			return false
+		}
+	}
+	return true
+}
+
+// roleErrorStatus đổi lỗi của role service thành HTTP status
+func roleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrRoleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidRole):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrBuiltInRole), errors.Is(err, service.ErrRoleExists), errors.Is(err, service.ErrRoleInUse):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func ListRolesHandler(c *gin.Context) {
+	roles, err := roleService.RoleGetAll()
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response.Success(c, gin.H{"roles": roles, "permissions": model.Permissions})
+}
+
+func GetRoleHandler(c *gin.Context) {
+	role, err := roleService.RoleGetByName(c.Param("name"))
+	if err != nil {
+		response.Error(c, roleErrorStatus(err), err.Error())
+		return
+	}
+	response.Success(c, role)
+}
+
+func CreateRoleHandler(c *gin.Context) {
+	var role model.Role
+	if err := c.ShouldBindJSON(&role); err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	a := audit(c, model.AuditRoleCreate, "role", role.Name)
+	if !checkGrantable(c, role.Permissions) {
+		return
+	}
+	if err := roleService.RoleCreate(&role); err != nil {
+		logutil.APIDebug("CreateRoleHandler error: %v", err)
+		response.Error(c, roleErrorStatus(err), err.Error())
+		return
+	}
+	a.After = auditValue(role)
+	logutil.APIInfo("Role %s created by %s: %v", role.Name, c.GetString("username"), role.Permissions)
+	response.Success(c, role)
+}
+
+// UpdateRoleHandler thay mô tả và toàn bộ quyền của role tự tạo, user đang đăng nhập nhận quyền mới ở request kế tiếp.
+// Người sửa phải có mọi quyền cũ và mới của role.
+func UpdateRoleHandler(c *gin.Context) {
+	var role model.Role
+	if err := c.ShouldBindJSON(&role); err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	role.Name = c.Param("name")
+	a := audit(c, model.AuditRoleUpdate, "role", role.Name)
+	if before, err := roleService.RoleGetByName(role.Name); err == nil {
+		a.Before = auditValue(before)
+		if !checkGrantable(c, before.Permissions) {
+			return
+		}
+	}
+	if !checkGrantable(c, role.Permissions) {
+		return
+	}
+	if err := roleService.RoleUpdate(&role); err != nil {
+		logutil.APIDebug("UpdateRoleHandler error: %v", err)
+		response.Error(c, roleErrorStatus(err), err.Error())
+		return
+	}
+	a.After = auditValue(role)
+	logutil.APIInfo("Role %s updated by %s: %v", role.Name, c.GetString("username"), role.Permissions)
+	response.Success(c, role)
+}
+
+func DeleteRoleHandler(c *gin.Context) {
+	name := c.Param("name")
+	a := audit(c, model.AuditRoleDelete, "role", name)
+	if before, err := roleService.RoleGetByName(name); err == nil {
+		a.Before = auditValue(before)
+	}
+	if err := roleService.RoleDelete(name); err != nil {
+		logutil.APIDebug("DeleteRoleHandler error: %v", err)
+		response.Error(c, roleErrorStatus(err), err.Error())
+		return
+	}
+	logutil.APIInfo("Role %s deleted by %s", name, c.GetString("username"))
+	response.Success(c, gin.H{"message": "role deleted"})
+}
+
+// GetMyPermissionsHandler trả về role và quyền của user đang đăng nhập (để UI ẩn/hiện chức năng)
+func GetMyPermissionsHandler(c *gin.Context) {
+	perms := c.GetStringSlice("permissions")
+	if perms == nil {
+		perms = []string{}
+	}
+	response.Success(c, gin.H{"username": c.GetString("username"), "role": c.GetString("role"), "permissions": perms})
+}
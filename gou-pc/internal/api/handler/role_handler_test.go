@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"database/sql"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+	"gou-pc/internal/api/service"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newTestDB mở DB tạm có bảng users và roles như server
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "clients.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec(`CREATE TABLE users (id TEXT PRIMARY KEY, username TEXT UNIQUE, password TEXT, email TEXT,
+		full_name TEXT, role TEXT, created_at TEXT, updated_at TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.CreateRoleTables(db); err != nil {
+		t.Fatal(err)
+	}
+	rs, err := service.NewRoleService(repository.NewSQLiteRoleRepository(db), repository.NewSQLiteUserRepository(db))
+	if err != nil {
+		t.Fatal(err)
+	}
+	InjectRoleService(rs)
+	InjectUserService(service.NewUserService(repository.NewSQLiteUserRepository(db)))
+	return db
+}
+
+// testRouter giả lập request đã xác thực của username với quyền perms
+func testRouter(username string, perms []string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("username", username)
+		c.Set("permissions", perms)
+		c.Next()
+	})
+	return r
+}
+
+func doJSON(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRoleHandlersRejectPrivilegeEscalation(t *testing.T) {
+	newTestDB(t)
+	if err := roleService.RoleCreate(&model.Role{Name: "rolemgr", Permissions: []string{model.PermRolesManage, model.PermLogsRead}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := roleService.RoleCreate(&model.Role{Name: "secops", Permissions: []string{model.PermAuditRead}}); err != nil {
+		t.Fatal(err)
+	}
+	r := testRouter("mgr", roleService.RolePermissions("rolemgr"))
+	r.POST("/roles", CreateRoleHandler)
+	r.PUT("/roles/:name", UpdateRoleHandler)
+
+	cases := []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodPost, "/roles", `{"name":"root","permissions":["*"]}`, http.StatusForbidden},
+		{http.MethodPost, "/roles", `{"name":"um","permissions":["logs.read","users.manage"]}`, http.StatusForbidden},
+		{http.MethodPut, "/roles/rolemgr", `{"permissions":["roles.manage","logs.read","*"]}`, http.StatusForbidden},
+		{http.MethodPut, "/roles/secops", `{"permissions":["logs.read"]}`, http.StatusForbidden}, // quyền cũ audit.read người sửa không có
+		{http.MethodPost, "/roles", `{"name":"reader","permissions":["logs.read"]}`, http.StatusOK},
+		{http.MethodPut, "/roles/reader", `{"permissions":["logs.read","roles.manage"]}`, http.StatusOK},
+	}
+	for _, tc := range cases {
+		if w := doJSON(r, tc.method, tc.path, tc.body); w.Code != tc.want {
+			t.Errorf("%s %s %s: status %d, want %d (%s)", tc.method, tc.path, tc.body, w.Code, tc.want, w.Body.String())
+		}
+	}
+	if model.HasPermission(roleService.RolePermissions("rolemgr"), model.PermAll) {
+		t.Fatal("rolemgr escalated itself to *")
+	}
+	if !model.HasPermission(roleService.RolePermissions("secops"), model.PermAuditRead) {
+		t.Fatal("secops was modified by a caller without audit.read")
+	}
+}
@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"errors"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+	"gou-pc/internal/api/response"
+	"gou-pc/internal/api/service"
+	"gou-pc/internal/logutil"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+var apiKeyService service.APIKeyService
+
+func InjectAPIKeyService(s service.APIKeyService) { apiKeyService = s }
+
+// apiKeyErrorStatus đổi lỗi của API key service thành HTTP status
+func apiKeyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrServiceAccountNotFound), errors.Is(err, repository.ErrAPIKeyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrInvalidServiceAccount):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrServiceAccountExists):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func ListServiceAccountsHandler(c *gin.Context) {
+	accounts, err := apiKeyService.ServiceAccountList()
+	if err != nil {
+		response.Error(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response.Success(c, accounts)
+}
+
+func GetServiceAccountHandler(c *gin.Context) {
+	account, err := apiKeyService.ServiceAccountGet(c.Param("name"))
+	if err != nil {
+		response.Error(c, apiKeyErrorStatus(err), err.Error())
+		return
+	}
+	response.Success(c, account)
+}
+
+func CreateServiceAccountHandler(c *gin.Context) {
+	var account model.ServiceAccount
+	if err := c.ShouldBindJSON(&account); err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	a := audit(c, model.AuditSvcAccountCreate, "service_account", account.Name)
+	account.CreatedBy = c.GetString("username")
+	if err := apiKeyService.ServiceAccountCreate(&account); err != nil {
+		logutil.APIDebug("CreateServiceAccountHandler error: %v", err)
+		response.Error(c, apiKeyErrorStatus(err), err.Error())
+		return
+	}
+	a.After = auditValue(account)
+	logutil.APIInfo("Service account %s created by %s", account.Name, account.CreatedBy)
+	response.Success(c, account)
+}
+
+// DeleteServiceAccountHandler xoá service account, mọi API key của nó hết hiệu lực ngay
+func DeleteServiceAccountHandler(c *gin.Context) {
+	name := c.Param("name")
+	a := audit(c, model.AuditSvcAccountDelete, "service_account", name)
+	if before, err := apiKeyService.ServiceAccountGet(name); err == nil {
+		a.Before = auditValue(before)
+	}
+	if err := apiKeyService.ServiceAccountDelete(name); err != nil {
+		logutil.APIDebug("DeleteServiceAccountHandler error: %v", err)
+		response.Error(c, apiKeyErrorStatus(err), err.Error())
+		return
+	}
+	logutil.APIInfo("Service account %s deleted by %s", name, c.GetString("username"))
+	response.Success(c, gin.H{"message": "service account deleted"})
+}
+
+// CreateAPIKeyHandler tạo API key cho service account; key đầy đủ chỉ trả về một lần trong response này.
+// Người tạo phải có mọi quyền cấp cho key.
+func CreateAPIKeyHandler(c *gin.Context) {
+	var req struct {
+		Name        string   `json:"name"`
+		Permissions []string `json:"permissions"`
+		ExpiresAt   string   `json:"expires_at"` // RFC3339, bỏ trống = APIKeyExpire
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	name := c.Param("name")
+	a := audit(c, model.AuditAPIKeyCreate, "service_account", name)
+	for _, p := range req.Permissions {
+		if !hasPermission(c, p) {
+			response.Error(c, http.StatusForbidden, "cannot grant permission "+p)
+			return
+		}
+	}
+	k := model.APIKey{Name: req.Name, Permissions: req.Permissions, ExpiresAt: req.ExpiresAt, CreatedBy: c.GetString("username")}
+	key, err := apiKeyService.APIKeyCreate(name, &k)
+	if err != nil {
+		logutil.APIDebug("CreateAPIKeyHandler error: %v", err)
+		response.Error(c, apiKeyErrorStatus(err), err.Error())
+		return
+	}
+	a.After = auditValue(k) // không có key/hash
+	logutil.APIInfo("API key %s for service account %s created by %s: %v", k.ID, name, k.CreatedBy, k.Permissions)
+	response.Success(c, gin.H{"key": key, "api_key": k})
+}
+
+func RevokeAPIKeyHandler(c *gin.Context) {
+	name, id := c.Param("name"), c.Param("id")
+	audit(c, model.AuditAPIKeyRevoke, "api_key", id)
+	if err := apiKeyService.APIKeyRevoke(name, id); err != nil {
+		logutil.APIDebug("RevokeAPIKeyHandler error: %v", err)
+		response.Error(c, apiKeyErrorStatus(err), err.Error())
+		return
+	}
+	logutil.APIInfo("API key %s of service account %s revoked by %s", id, name, c.GetString("username"))
+	response.Success(c, gin.H{"message": "api key revoked"})
+}
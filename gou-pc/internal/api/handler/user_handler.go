@@ -1,31 +1,57 @@
 package handler
 
 import (
-	"encoding/json"
-	"fmt"
+	"errors"
 	"gou-pc/internal/api/model"
 	"gou-pc/internal/api/response"
 	"gou-pc/internal/api/service"
 	"gou-pc/internal/logutil"
 	"net/http"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
-var (
-	userService service.UserService
-	jwtSecret   []byte
-	jwtExpire   int64 // seconds
-)
+var userService service.UserService
 
 func InjectUserService(s service.UserService) { userService = s }
-func InjectJWTConfig(secret string, expireSeconds int64) {
-	jwtSecret = []byte(secret)
-	jwtExpire = expireSeconds
+
+// canManageUser: user tự sửa thông tin/mật khẩu của mình, sửa user khác cần quyền users.manage
+func canManageUser(c *gin.Context, username string) bool {
+	return username == c.GetString("username") || hasPermission(c, model.PermUsersManage)
+}
+
+// checkAssignableRole kiểm tra role tồn tại và người gán có đủ mọi quyền của role đó (không tự nâng quyền)
+func checkAssignableRole(c *gin.Context, role string) bool {
+	if !roleService.RoleExists(role) {
+		response.Error(c, http.StatusBadRequest, "unknown role: "+role)
+		return false
+	}
+	for _, p := range roleService.RolePermissions(role) {
+		if !hasPermission(c, p) {
+			response.Error(c, http.StatusForbidden, "cannot assign role with permission "+p)
+			return false
+		}
+	}
+	return true
+}
+
+// checkManageableTarget: sửa user khác thì người gọi phải có mọi quyền của role hiện tại của user đó,
+// để người giữ users.manage không chiếm được tài khoản có quyền cao hơn (vd admin)
+func checkManageableTarget(c *gin.Context, target *model.User) bool {
+	if target.Username == c.GetString("username") {
+		return true
+	}
+	for _, p := range roleService.RolePermissions(target.Role) {
+		if !hasPermission(c, p) {
+			response.Error(c, http.StatusForbidden, "cannot manage user with permission "+p)
+			return false
+		}
+	}
+	return true
 }
 
 func LoginHandler(c *gin.Context) {
@@ -34,46 +60,29 @@ func LoginHandler(c *gin.Context) {
 		Username string `json:"username"`
 		Password string `json:"password"`
 	}
-	// Đọc body ra chuỗi để debug
-	bodyBytes, _ := c.GetRawData()
-	fmt.Printf("[DEBUG] LoginHandler: raw request body: %s\n", string(bodyBytes))
-	if err := json.Unmarshal(bodyBytes, &req); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil {
 		logutil.APIDebug("LoginHandler: invalid request body (unmarshal)")
 		response.Error(c, http.StatusBadRequest, "invalid request body")
 		return
 	}
-	fmt.Printf("[DEBUG] LoginHandler: parsed username: %s, password: %s\n", req.Username, req.Password)
 	if req.Username == "" || req.Password == "" {
 		logutil.APIDebug("LoginHandler: missing username or password")
 		response.Error(c, http.StatusBadRequest, "username and password required")
 		return
 	}
-	user, err := userService.UserGetByUsername(req.Username)
-	fmt.Printf("[DEBUG] userService.GetByUsername(%s) => user: %+v, err: %v\n", req.Username, user, err)
-	if err != nil || user == nil {
-		logutil.APIDebug("LoginHandler: invalid username or password")
-		response.Error(c, http.StatusUnauthorized, "invalid username or password")
-		return
-	}
-	fmt.Printf("[DEBUG] LoginHandler: user in DB: username=%s, password=%s\n", user.Username, user.Password)
-	if user.Password != req.Password {
-		logutil.APIDebug("LoginHandler: password mismatch for user %s", req.Username)
-		response.Error(c, http.StatusUnauthorized, "invalid username or password")
-		return
-	}
-	// Sinh JWT thực tế
-	claims := jwt.MapClaims{
-		"user_id":  user.ID,
-		"username": user.Username,
-		"role":     user.Role,
-		"exp":      time.Now().Add(time.Duration(jwtExpire) * time.Second).Unix(),
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtSecret)
+	a := audit(c, model.AuditLogin, "user", req.Username)
+	a.Actor = req.Username
+	pair, user, err := authService.Login(req.Username, req.Password, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
-		response.Error(c, http.StatusInternalServerError, "could not generate token")
+		logutil.APIDebug("LoginHandler: authentication failed for user %s: %v", req.Username, err)
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			response.Error(c, http.StatusUnauthorized, "invalid username or password")
+		} else {
+			response.Error(c, http.StatusInternalServerError, "could not generate token")
+		}
 		return
 	}
+	a.ActorRole = user.Role
 	// Ẩn trường password trước khi trả về user
 	safeUser := gin.H{
 		"id":         user.ID,
@@ -84,7 +93,14 @@ func LoginHandler(c *gin.Context) {
 		"created_at": user.CreatedAt,
 		"updated_at": user.UpdatedAt,
 	}
-	response.Success(c, gin.H{"token": tokenString, "user": safeUser})
+	response.Success(c, gin.H{
+		"token":              pair.AccessToken,
+		"expires_in":         pair.ExpiresIn,
+		"refresh_token":      pair.RefreshToken,
+		"refresh_expires_at": pair.RefreshExpiresAt,
+		"user":               safeUser,
+		"permissions":        roleService.RolePermissions(user.Role),
+	})
 }
 
 func CreateUserHandler(c *gin.Context) {
@@ -94,6 +110,7 @@ func CreateUserHandler(c *gin.Context) {
 		Password string `json:"password"`
 		FullName string `json:"full_name"`
 		Email    string `json:"email"`
+		Role     string `json:"role"` // bỏ trống = user
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		logutil.APIDebug("CreateUserHandler: invalid request body")
@@ -105,13 +122,25 @@ func CreateUserHandler(c *gin.Context) {
 		response.Error(c, http.StatusBadRequest, "username and password required")
 		return
 	}
+	if strings.Contains(req.Username, ":") {
+		logutil.APIDebug("CreateUserHandler: reserved username %s", req.Username)
+		response.Error(c, http.StatusBadRequest, service.ErrReservedUsername.Error())
+		return
+	}
+	if req.Role == "" {
+		req.Role = model.RoleUser
+	}
+	a := audit(c, model.AuditUserCreate, "user", req.Username)
+	if !checkAssignableRole(c, req.Role) {
+		return
+	}
 	now := time.Now().UTC().Format(time.RFC3339)
 	user := &model.User{
 		Username:  req.Username,
-		Password:  req.Password, // Đã dùng Password, không phải PasswordHash
+		Password:  req.Password, // UserService băm trước khi lưu
 		FullName:  req.FullName,
 		Email:     req.Email,
-		Role:      "user",
+		Role:      req.Role,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
@@ -119,7 +148,7 @@ func CreateUserHandler(c *gin.Context) {
 	if user.ID == "" {
 		user.ID = generateUUID()
 	}
-	logutil.APIDebug("CreateUserHandler: creating user %+v", user)
+	logutil.APIDebug("CreateUserHandler: creating user %s", user.Username)
 	if err := userService.UserCreate(user); err != nil {
 		logutil.APIDebug("CreateUserHandler: failed to create user: %v", err)
 		response.Error(c, http.StatusBadRequest, err.Error())
@@ -132,7 +161,8 @@ func CreateUserHandler(c *gin.Context) {
 		response.Error(c, http.StatusInternalServerError, "failed to fetch created user")
 		return
 	}
-	logutil.APIDebug("CreateUserHandler: user created successfully: %+v", createdUser)
+	logutil.APIDebug("CreateUserHandler: user created successfully: %s", createdUser.Username)
+	a.After = auditValue(userAuditView(createdUser))
 	safeUser := gin.H{
 		"id":         createdUser.ID,
 		"username":   createdUser.Username,
@@ -163,22 +193,39 @@ func ChangePasswordHandler(c *gin.Context) {
 		response.Error(c, http.StatusBadRequest, "username and new_password required")
 		return
 	}
-	// TODO: hash password trước khi lưu
+	audit(c, model.AuditUserChangePassword, "user", req.UserID)
+	if !canManageUser(c, req.UserID) {
+		response.Error(c, http.StatusForbidden, "access denied: "+model.PermUsersManage+" required")
+		return
+	}
 	user, err := userService.UserGetByUsername(req.UserID)
 	if err != nil || user == nil {
 		response.Error(c, http.StatusBadRequest, "user not found")
 		return
 	}
-	user.Password = req.NewPassword
+	if !checkManageableTarget(c, user) {
+		return
+	}
+	user.Password = req.NewPassword // UserService băm trước khi lưu
 	if err := userService.UserUpdate(user); err != nil {
 		response.Error(c, http.StatusBadRequest, err.Error())
 		return
 	}
+	// Mật khẩu đổi thì các phiên khác của user phải đăng nhập lại, giữ phiên đang gọi nếu là của chính user
+	if _, err := authService.RevokeUserSessions(user.ID, c.GetString("session_id")); err != nil {
+		logutil.APIDebug("ChangePasswordHandler: revoke sessions of %s failed: %v", user.Username, err)
+	}
 	response.Success(c, gin.H{"message": "password changed successfully"})
 }
 
 func UpdateUserHandler(c *gin.Context) {
-	var req model.User
+	// Không nhận password: đổi mật khẩu chỉ qua ChangePasswordHandler
+	var req struct {
+		Username string `json:"username"`
+		FullName string `json:"full_name"`
+		Email    string `json:"email"`
+		Role     string `json:"role"`
+	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		response.Error(c, http.StatusBadRequest, "invalid request body")
 		return
@@ -191,10 +238,27 @@ func UpdateUserHandler(c *gin.Context) {
 		response.Error(c, http.StatusBadRequest, "full_name required")
 		return
 	}
-	if err := userService.UserUpdate(&req); err != nil {
+	a := audit(c, model.AuditUserUpdate, "user", req.Username)
+	before, err := userService.UserGetByUsername(req.Username)
+	if err != nil || before == nil {
+		response.Error(c, http.StatusBadRequest, "user not found")
+		return
+	}
+	if !checkManageableTarget(c, before) {
+		return
+	}
+	if req.Role != "" && !checkAssignableRole(c, req.Role) {
+		return
+	}
+	a.Before = auditValue(userAuditView(before))
+	user := &model.User{Username: req.Username, FullName: req.FullName, Email: req.Email, Role: req.Role}
+	if err := userService.UserUpdate(user); err != nil {
 		response.Error(c, http.StatusBadRequest, err.Error())
 		return
 	}
+	if after, err := userService.UserGetByUsername(req.Username); err == nil {
+		a.After = auditValue(userAuditView(after))
+	}
 	response.Success(c, gin.H{"message": "user updated successfully"})
 }
 
@@ -250,12 +314,21 @@ func UpdateUserInfoHandler(c *gin.Context) {
 		response.Error(c, http.StatusBadRequest, "username required")
 		return
 	}
+	a := audit(c, model.AuditUserUpdateInfo, "user", req.Username)
+	if !canManageUser(c, req.Username) {
+		response.Error(c, http.StatusForbidden, "access denied: "+model.PermUsersManage+" required")
+		return
+	}
 	user, err := userService.UserGetByUsername(req.Username)
 	if err != nil || user == nil {
 		logutil.APIDebug("UpdateUserInfoHandler: user not found: %v", err)
 		response.Error(c, http.StatusBadRequest, "user not found")
 		return
 	}
+	if !checkManageableTarget(c, user) {
+		return
+	}
+	a.Before = auditValue(userAuditView(user))
 	updated := false
 	if req.FullName != "" && req.FullName != user.FullName {
 		user.FullName = req.FullName
@@ -270,11 +343,13 @@ func UpdateUserInfoHandler(c *gin.Context) {
 		response.Success(c, gin.H{"message": "no changes"})
 		return
 	}
+	user.Password = "" // giữ mật khẩu (hash) đang lưu
 	if err := userService.UserUpdate(user); err != nil {
 		logutil.APIDebug("UpdateUserInfoHandler: failed to update user: %v", err)
 		response.Error(c, http.StatusBadRequest, err.Error())
 		return
 	}
+	a.After = auditValue(userAuditView(user))
 	logutil.APIDebug("UpdateUserInfoHandler: user info updated successfully: %s", req.Username)
 	response.Success(c, gin.H{"message": "user info updated successfully"})
 }
@@ -294,11 +369,21 @@ func DeleteUserHandler(c *gin.Context) {
 		response.Error(c, http.StatusBadRequest, "username required")
 		return
 	}
+	user, _ := userService.UserGetByUsername(req.UserID)
+	audit(c, model.AuditUserDelete, "user", req.UserID).Before = auditValue(userAuditView(user))
+	if user != nil && !checkManageableTarget(c, user) {
+		return
+	}
 	if err := userService.UserDeleteByUsername(req.UserID); err != nil {
 		logutil.APIDebug("DeleteUserHandler: failed to delete user: %v", err)
 		response.Error(c, http.StatusBadRequest, err.Error())
 		return
 	}
+	if user != nil {
+		if _, err := authService.RevokeUserSessions(user.ID, ""); err != nil {
+			logutil.APIDebug("DeleteUserHandler: revoke sessions of %s failed: %v", user.Username, err)
+		}
+	}
 	logutil.APIDebug("DeleteUserHandler: user deleted successfully: %s", req.UserID)
 	response.Success(c, gin.H{"message": "user deleted successfully"})
 }
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"gou-pc/internal/api/model"
+	"net/http"
+	"testing"
+)
+
+func TestUserHandlersRejectAccountTakeover(t *testing.T) {
+	newTestDB(t)
+	if err := roleService.RoleCreate(&model.Role{Name: "usermgr", Permissions: []string{model.PermUsersManage}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []*model.User{
+		{Username: "root", Password: "rootpass", Email: "root@x", FullName: "Root", Role: model.RoleAdmin, CreatedAt: "2024-01-01T00:00:00Z", UpdatedAt: "2024-01-01T00:00:00Z"},
+		{Username: "bob", Password: "bobpass", Email: "bob@x", FullName: "Bob", Role: model.RoleUser, CreatedAt: "2024-01-01T00:00:00Z", UpdatedAt: "2024-01-01T00:00:00Z"},
+	} {
+		if err := userService.UserCreate(u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := testRouter("mgr", roleService.RolePermissions("usermgr"))
+	r.POST("/users/change-password", ChangePasswordHandler)
+	r.POST("/users/update", UpdateUserHandler)
+	r.POST("/users/update-info", UpdateUserInfoHandler)
+	r.POST("/users/delete", DeleteUserHandler)
+
+	cases := []struct {
+		path, body string
+		want       int
+	}{
+		{"/users/change-password", `{"username":"root","new_password":"owned"}`, http.StatusForbidden},
+		{"/users/update", `{"username":"root","full_name":"Root","email":"mgr@x"}`, http.StatusForbidden},
+		{"/users/update-info", `{"username":"root","email":"mgr@x"}`, http.StatusForbidden},
+		{"/users/delete", `{"username":"root"}`, http.StatusForbidden},
+		{"/users/update", `{"username":"bob","full_name":"Bobby","email":"bob@x","password":"owned"}`, http.StatusOK},
+	}
+	for _, tc := range cases {
+		if w := doJSON(r, http.MethodPost, tc.path, tc.body); w.Code != tc.want {
+			t.Errorf("%s %s: status %d, want %d (%s)", tc.path, tc.body, w.Code, tc.want, w.Body.String())
+		}
+	}
+	if _, err := userService.UserAuthenticate("root", "rootpass"); err != nil {
+		t.Fatalf("admin password changed: %v", err)
+	}
+	if root, _ := userService.UserGetByUsername("root"); root == nil || root.Email != "root@x" {
+		t.Fatalf("admin account modified: %+v", root)
+	}
+	if _, err := userService.UserAuthenticate("bob", "bobpass"); err != nil {
+		t.Fatalf("update accepted password field: %v", err)
+	}
+	if bob, _ := userService.UserGetByUsername("bob"); bob == nil || bob.FullName != "Bobby" {
+		t.Fatalf("bob not updated: %+v", bob)
+	}
+}
+
+func TestCreateUserRejectsServiceAccountUsername(t *testing.T) {
+	newTestDB(t)
+	r := testRouter("root", []string{model.PermAll})
+	r.POST("/users", CreateUserHandler)
+
+	for _, name := range []string{model.ServiceAccountUsernamePrefix + "backup", "a:b"} {
+		body := `{"username":"` + name + `","password":"pw","full_name":"X","email":"x@x"}`
+		if w := doJSON(r, http.MethodPost, "/users", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400 (%s)", name, w.Code, w.Body.String())
+		}
+		if u, _ := userService.UserGetByUsername(name); u != nil {
+			t.Errorf("%s was created", name)
+		}
+	}
+	if err := userService.UserCreate(&model.User{Username: "svc:backup", Password: "pw", Email: "x@x", FullName: "X"}); err == nil {
+		t.Error("UserService.UserCreate accepted a reserved username")
+	}
+	if w := doJSON(r, http.MethodPost, "/users", `{"username":"svc-backup","password":"pw","full_name":"X","email":"x@x"}`); w.Code != http.StatusOK {
+		t.Errorf("plain username rejected: %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/response"
+	"gou-pc/internal/logutil"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditRecorder ghi một dòng audit (service.AuditService thoả interface này)
+type AuditRecorder interface {
+	Record(e *model.AuditEntry) error
+}
+
+var auditRecorder AuditRecorder
+
+// InitAuditRecorder đặt nơi ghi audit, nil = không ghi
+func InitAuditRecorder(r AuditRecorder) { auditRecorder = r }
+
+const auditKey = "audit"
+
+// Audit trả về dòng audit của request để handler điền hành động, đối tượng và giá trị trước/sau.
+// Request GET có gọi Audit được coi là lần đọc dữ liệu nhạy cảm và cũng được ghi lại.
+func Audit(c *gin.Context) *model.AuditEntry {
+	if v, ok := c.Get(auditKey); ok {
+		if e, ok := v.(*model.AuditEntry); ok {
+			return e
+		}
+	}
+	e := &model.AuditEntry{}
+	c.Set(auditKey, e)
+	return e
+}
+
+// AuditMiddleware ghi audit sau khi handler chạy xong cho mọi request thay đổi dữ liệu,
+// request bị từ chối (401/403) và request đọc mà handler đã gọi Audit
+func AuditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if auditRecorder == nil {
+			return
+		}
+		status := c.Writer.Status()
+		_, annotated := c.Get(auditKey)
+		denied := status == http.StatusUnauthorized || status == http.StatusForbidden
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			if !annotated && !denied {
+				return
+			}
+		}
+		e := Audit(c)
+		if e.Actor == "" {
+			e.Actor = c.GetString("username")
+		}
+		if e.ActorRole == "" {
+			e.ActorRole = c.GetString("role")
+		}
+		if e.Action == "" {
+			e.Action = c.Request.Method + " " + c.FullPath()
+		}
+		e.Method = c.Request.Method
+		e.Path = c.Request.URL.Path
+		e.SourceIP = c.ClientIP()
+		e.Status = status
+		switch {
+		case denied:
+			e.Outcome = model.AuditDenied
+		case status >= http.StatusBadRequest:
+			e.Outcome = model.AuditFailure
+		default:
+			e.Outcome = model.AuditSuccess
+		}
+		e.Error = c.GetString(response.ErrorKey)
+		if err := auditRecorder.Record(e); err != nil {
+			logutil.APIError("record audit %s by %s failed: %v", e.Action, e.Actor, err)
+		}
+	}
+}
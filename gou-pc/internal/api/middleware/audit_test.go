@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/response"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type memAuditRecorder struct {
+	entries []model.AuditEntry
+}
+
+func (r *memAuditRecorder) Record(e *model.AuditEntry) error {
+	r.entries = append(r.entries, *e)
+	return nil
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := &memAuditRecorder{}
+	InitAuditRecorder(rec)
+	defer InitAuditRecorder(nil)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("session_id", "s1") // như đã qua JWTAuthMiddlewareFunc
+		c.Set("username", "op1")
+		c.Set("role", model.RoleOperator)
+		c.Set("permissions", []string{model.PermOTPRead})
+		c.Next()
+	}, AuditMiddleware())
+	r.GET("/clients", func(c *gin.Context) { response.Success(c, nil) })
+	r.GET("/clients/:agent_id/otp", func(c *gin.Context) {
+		e := Audit(c)
+		e.Action, e.TargetType, e.Target = model.AuditOTPView, "agent", c.Param("agent_id")
+		response.Success(c, nil)
+	})
+	r.POST("/clients/assign", func(c *gin.Context) { response.Error(c, http.StatusBadRequest, "client not found") })
+	r.DELETE("/users/delete", JWTAuthMiddleware(func(c *gin.Context) { response.Success(c, nil) }, model.PermUsersManage))
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/clients"},
+		{http.MethodGet, "/clients/001/otp"},
+		{http.MethodPost, "/clients/assign"},
+		{http.MethodDelete, "/users/delete"},
+	} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, nil))
+	}
+
+	if len(rec.entries) != 3 {
+		t.Fatalf("plain GET must not be audited, got %d entries: %+v", len(rec.entries), rec.entries)
+	}
+	otp, failed, denied := rec.entries[0], rec.entries[1], rec.entries[2]
+	if otp.Action != model.AuditOTPView || otp.Target != "001" || otp.Actor != "op1" || otp.ActorRole != model.RoleOperator || otp.Outcome != model.AuditSuccess {
+		t.Errorf("annotated read: %+v", otp)
+	}
+	if failed.Action != "POST /clients/assign" || failed.Outcome != model.AuditFailure || failed.Error != "client not found" || failed.Status != http.StatusBadRequest {
+		t.Errorf("failed write: %+v", failed)
+	}
+	if denied.Outcome != model.AuditDenied || denied.Error != "access denied: users.manage required" {
+		t.Errorf("denied write: %+v", denied)
+	}
+}
+
+// TestAuditMiddlewareUnauthenticated: AuditMiddleware đứng trước xác thực như group /api nên 401 cũng được ghi, actor rỗng
+func TestAuditMiddlewareUnauthenticated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rec := &memAuditRecorder{}
+	InitAuditRecorder(rec)
+	defer InitAuditRecorder(nil)
+
+	r := gin.New()
+	r.Use(AuditMiddleware(), JWTAuthMiddlewareFunc())
+	r.GET("/clients", func(c *gin.Context) { response.Success(c, nil) })
+	r.DELETE("/users/delete", func(c *gin.Context) { response.Success(c, nil) })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/clients", nil))
+	req := httptest.NewRequest(http.MethodDelete, "/users/delete", nil)
+	req.Header.Set("Authorization", "Bearer not-a-jwt")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if w.Code != http.StatusUnauthorized || len(rec.entries) != 2 {
+		t.Fatalf("unauthenticated requests must be audited: status %d, entries %+v", w.Code, rec.entries)
+	}
+	missing, invalid := rec.entries[0], rec.entries[1]
+	if missing.Actor != "" || missing.Action != "GET /clients" || missing.Status != http.StatusUnauthorized ||
+		missing.Outcome != model.AuditDenied || missing.Error != "missing token" {
+		t.Errorf("missing token: %+v", missing)
+	}
+	if invalid.Actor != "" || invalid.Action != "DELETE /users/delete" || invalid.Outcome != model.AuditDenied || invalid.Error != "invalid token" {
+		t.Errorf("invalid token: %+v", invalid)
+	}
+}
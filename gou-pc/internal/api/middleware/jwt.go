@@ -1,6 +1,9 @@
 package middleware
 
 import (
+	"errors"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/response"
 	"net/http"
 	"strings"
 	"time"
@@ -20,64 +23,185 @@ func InitJWT(secret string, expire time.Duration) {
 	jwtExpire = expire
 }
 
-func JWTAuthMiddleware(handler gin.HandlerFunc, requireAdmin bool) gin.HandlerFunc {
+// SessionValidator kiểm tra phiên (claim sid) của access token còn hiệu lực và trả về username/role hiện tại
+// của user, để logout, thu hồi phiên, xoá user hay đổi role có hiệu lực ngay (service.AuthService thoả interface này)
+type SessionValidator interface {
+	ValidateSession(sessionID, userID string) (username, role string, err error)
+}
+
+var sessionValidator SessionValidator
+
+// InitSessionValidator đặt bộ kiểm tra phiên, nil = tin claim trong token
+func InitSessionValidator(v SessionValidator) { sessionValidator = v }
+
+// PermissionChecker trả về quyền của role (service.RoleService thoả interface này)
+type PermissionChecker interface {
+	RolePermissions(role string) []string
+}
+
+var permissionChecker PermissionChecker
+
+// InitPermissionChecker đặt nguồn quyền của role, nil = chỉ role admin có quyền
+func InitPermissionChecker(p PermissionChecker) { permissionChecker = p }
+
+// APIKeyValidator kiểm tra API key của service account (service.APIKeyService thoả interface này)
+type APIKeyValidator interface {
+	ValidateAPIKey(key, clientIP string) (*model.ServiceAccount, *model.APIKey, error)
+}
+
+var apiKeyValidator APIKeyValidator
+
+// InitAPIKeyValidator đặt bộ kiểm tra API key, nil = không nhận API key
+func InitAPIKeyValidator(v APIKeyValidator) { apiKeyValidator = v }
+
+// JWTAuthMiddleware kiểm tra JWT và quyền permission (model.Perm*) của role user, permission rỗng = mọi user đã đăng nhập
+func JWTAuthMiddleware(handler gin.HandlerFunc, permission string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenStr := extractToken(c)
-		if tokenStr == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
+		if !authenticate(c) {
 			return
 		}
-		claims := jwt.MapClaims{}
-		_, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		if permission != "" && !model.HasPermission(c.GetStringSlice("permissions"), permission) {
+			msg := "access denied: " + permission + " required"
+			c.Set(response.ErrorKey, msg) // audit ghi lý do từ chối
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": msg})
 			return
 		}
-		if requireAdmin {
-			role, _ := claims["role"].(string)
-			if role != "admin" {
-				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "access denied"})
-				return
-			}
-		}
-		userID, _ := claims["user_id"].(string)
-		username, _ := claims["username"].(string)
-		role, _ := claims["role"].(string)
-		// logutil.APIDebug("JWTAuthMiddleware: user_id = %v, username = %v, role = %v", userID, username, role)
-		c.Set("user_id", userID)    // user_id (string) dùng cho mọi truy vấn
-		c.Set("username", username) // username chỉ để hiển thị
-		c.Set("role", role)
 		handler(c)
 	}
 }
 
+// rolePermissions là quyền của role, chưa có PermissionChecker thì admin có mọi quyền
+func rolePermissions(role string) []string {
+	if permissionChecker != nil {
+		return permissionChecker.RolePermissions(role)
+	}
+	if role == model.RoleAdmin {
+		return []string{model.PermAll}
+	}
+	return nil
+}
+
 // Middleware cho group: chỉ kiểm tra JWT, không cần handler
 func JWTAuthMiddlewareFunc() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		tokenStr := extractToken(c)
-		if tokenStr == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
+		if !authenticate(c) {
 			return
 		}
-		claims := jwt.MapClaims{}
-		_, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtSecret, nil
-		})
+		c.Next()
+	}
+}
+
+// authenticate kiểm tra access token và phiên (hoặc API key), đặt user_id/username/role/session_id/permissions vào context;
+// request đã qua middleware group thì không kiểm tra lại
+func authenticate(c *gin.Context) bool {
+	if _, ok := c.Get("session_id"); ok {
+		return true
+	}
+	if _, ok := c.Get("api_key_id"); ok {
+		return true
+	}
+	if key := extractAPIKey(c); key != "" {
+		return authenticateAPIKey(c, key)
+	}
+	tokenStr := extractToken(c)
+	if tokenStr == "" {
+		unauthorized(c, "missing token")
+		return false
+	}
+	userID, username, role, sessionID, err := verifyAccessToken(tokenStr)
+	if err != nil {
+		unauthorized(c, err.Error())
+		return false
+	}
+	// logutil.APIDebug("authenticate: user_id = %v, username = %v, role = %v", userID, username, role)
+	c.Set("user_id", userID)    // user_id (string) dùng cho mọi truy vấn
+	c.Set("username", username) // username chỉ để hiển thị
+	c.Set("role", role)
+	c.Set("session_id", sessionID)
+	c.Set("permissions", rolePermissions(role))
+	return true
+}
+
+// verifyAccessToken kiểm tra chữ ký, hạn của access token và phiên của nó, trả về user/role hiện tại
+func verifyAccessToken(tokenStr string) (userID, username, role, sessionID string, err error) {
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name})); err != nil {
+		return "", "", "", "", errors.New("invalid token")
+	}
+	userID, _ = claims["user_id"].(string)
+	username, _ = claims["username"].(string)
+	role, _ = claims["role"].(string)
+	sessionID, _ = claims["sid"].(string)
+	if sessionValidator != nil {
+		// Role/username lấy từ DB chứ không tin claim, user bị hạ quyền mất quyền admin ngay
+		username, role, err = sessionValidator.ValidateSession(sessionID, userID)
+		if err != nil {
+			return "", "", "", "", err
+		}
+	}
+	return userID, username, role, sessionID, nil
+}
+
+// Revalidate kiểm tra lại token/phiên hoặc API key của request chạy lâu (vd SSE) và cập nhật username/role/quyền
+// trong context; lỗi nghĩa là token hết hạn, đã logout, phiên bị thu hồi hoặc API key không còn hiệu lực
+func Revalidate(c *gin.Context) error {
+	if _, ok := c.Get("api_key_id"); ok {
+		if apiKeyValidator == nil {
+			return errors.New("api keys are not enabled")
+		}
+		_, apiKey, err := apiKeyValidator.ValidateAPIKey(extractAPIKey(c), c.ClientIP())
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-			return
+			return err
 		}
-		userID, _ := claims["user_id"].(string)
-		username, _ := claims["username"].(string)
-		role, _ := claims["role"].(string)
-		// logutil.APIDebug("JWTAuthMiddlewareFunc: user_id = %v, username = %v, role = %v", userID, username, role)
-		c.Set("user_id", userID)    // user_id (string) dùng cho mọi truy vấn
-		c.Set("username", username) // username chỉ để hiển thị
-		c.Set("role", role)
-		c.Next()
+		c.Set("permissions", apiKey.Permissions)
+		return nil
 	}
+	_, username, role, _, err := verifyAccessToken(extractToken(c))
+	if err != nil {
+		return err
+	}
+	c.Set("username", username)
+	c.Set("role", role)
+	c.Set("permissions", rolePermissions(role))
+	return nil
+}
+
+// unauthorized trả 401 và lưu lý do để audit ghi lại request bị từ chối
+func unauthorized(c *gin.Context, msg string) {
+	c.Set(response.ErrorKey, msg)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": msg})
+}
+
+// authenticateAPIKey xác thực bằng API key: username là "svc:<tên service account>", quyền là quyền của key
+func authenticateAPIKey(c *gin.Context, key string) bool {
+	if apiKeyValidator == nil {
+		unauthorized(c, "api keys are not enabled")
+		return false
+	}
+	account, apiKey, err := apiKeyValidator.ValidateAPIKey(key, c.ClientIP())
+	if err != nil {
+		unauthorized(c, err.Error())
+		return false
+	}
+	c.Set("user_id", account.ID)
+	c.Set("username", model.ServiceAccountUsernamePrefix+account.Name)
+	c.Set("role", model.RoleServiceAccount)
+	c.Set("api_key_id", apiKey.ID)
+	c.Set("permissions", apiKey.Permissions)
+	return true
+}
+
+// extractAPIKey lấy API key từ header X-API-Key hoặc Authorization: Bearer gpk_...
+func extractAPIKey(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if token := extractToken(c); strings.HasPrefix(token, model.APIKeyPrefix) {
+		return token
+	}
+	return ""
 }
 
 func extractToken(c *gin.Context) string {
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"errors"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/response"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type fakeAPIKeyValidator struct{}
+
+func (fakeAPIKeyValidator) ValidateAPIKey(key, clientIP string) (*model.ServiceAccount, *model.APIKey, error) {
+	if key != model.APIKeyPrefix+"k1_secret" {
+		return nil, nil, errors.New("invalid api key")
+	}
+	return &model.ServiceAccount{ID: "a1", Name: "backup"}, &model.APIKey{ID: "k1", Permissions: []string{model.PermLogsRead}}, nil
+}
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	InitAPIKeyValidator(fakeAPIKeyValidator{})
+	defer InitAPIKeyValidator(nil)
+
+	r := gin.New()
+	r.GET("/logs", JWTAuthMiddleware(func(c *gin.Context) {
+		response.Success(c, gin.H{"username": c.GetString("username"), "role": c.GetString("role")})
+	}, model.PermLogsRead))
+	r.GET("/users", JWTAuthMiddleware(func(c *gin.Context) { response.Success(c, nil) }, model.PermUsersManage))
+
+	cases := []struct {
+		path, header, value string
+		want                int
+	}{
+		{"/logs", "X-API-Key", model.APIKeyPrefix + "k1_secret", http.StatusOK},
+		{"/logs", "Authorization", "Bearer " + model.APIKeyPrefix + "k1_secret", http.StatusOK},
+		{"/logs", "X-API-Key", model.APIKeyPrefix + "k1_wrong", http.StatusUnauthorized},
+		{"/users", "X-API-Key", model.APIKeyPrefix + "k1_secret", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Header.Set(tc.header, tc.value)
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s %s=%s: status %d, want %d", tc.path, tc.header, tc.value, w.Code, tc.want)
+		}
+		if w.Code == http.StatusOK && !strings.Contains(w.Body.String(), `"username":"svc:backup"`) {
+			t.Errorf("service account identity not set: %s", w.Body.String())
+		}
+	}
+}
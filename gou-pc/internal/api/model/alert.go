@@ -0,0 +1,56 @@
+package model
+
+// Loại rule cảnh báo
+const (
+	AlertRuleLog          = "log"           // đếm log khớp điều kiện trên một thiết bị trong cửa sổ thời gian
+	AlertRuleAgentOffline = "agent_offline" // agent không gửi hello quá OfflineSeconds
+)
+
+// Trạng thái cảnh báo
+const (
+	AlertFiring       = "firing"
+	AlertAcknowledged = "acknowledged"
+	AlertResolved     = "resolved"
+)
+
+// AlertRule là điều kiện sinh cảnh báo, vd "5 lần đăng nhập lỗi trên một thiết bị trong 2 phút"
+type AlertRule struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Type     string `json:"type"` // log | agent_offline
+	Enabled  bool   `json:"enabled"`
+	Severity string `json:"severity"` // info | warning | critical
+
+	// Điều kiện cho rule log, trường rỗng thì bỏ qua
+	Pattern       string            `json:"pattern,omitempty"` // regex trên message
+	Source        string            `json:"source,omitempty"`
+	Fields        map[string]string `json:"fields,omitempty"`    // field parser phải bằng đúng giá trị
+	Threshold     int               `json:"threshold,omitempty"` // số log tối thiểu, mặc định 1
+	WindowSeconds int               `json:"window_seconds,omitempty"`
+
+	// Điều kiện cho rule agent_offline
+	OfflineSeconds int `json:"offline_seconds,omitempty"`
+
+	AgentIDs  []string `json:"agent_ids,omitempty"` // rỗng: mọi thiết bị
+	Channels  []string `json:"channels,omitempty"`  // tên kênh thông báo trong cấu hình server
+	CreatedAt string   `json:"created_at"`
+	UpdatedAt string   `json:"updated_at"`
+}
+
+// Alert là một lần rule bị vi phạm trên một thiết bị; mỗi (rule, thiết bị) chỉ có một cảnh báo chưa resolved
+type Alert struct {
+	ID             string `json:"id"`
+	RuleID         string `json:"rule_id"`
+	RuleName       string `json:"rule_name"`
+	AgentID        string `json:"agent_id"`
+	Severity       string `json:"severity"`
+	State          string `json:"state"` // firing | acknowledged | resolved
+	Message        string `json:"message"`
+	Count          int    `json:"count"` // số lần rule khớp kể từ khi firing
+	FiredAt        string `json:"fired_at"`
+	LastSeenAt     string `json:"last_seen_at"`
+	AcknowledgedBy string `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt string `json:"acknowledged_at,omitempty"`
+	ResolvedBy     string `json:"resolved_by,omitempty"` // rỗng khi tự resolve (agent online lại)
+	ResolvedAt     string `json:"resolved_at,omitempty"`
+}
@@ -0,0 +1,61 @@
+package model
+
+import "encoding/json"
+
+// Hành động ghi vào audit log
+const (
+	AuditLogin              = "session.login"
+	AuditLogout             = "session.logout"
+	AuditSessionsRevoke     = "session.revoke"
+	AuditUserCreate         = "user.create"
+	AuditUserUpdate         = "user.update"
+	AuditUserUpdateInfo     = "user.update_info"
+	AuditUserChangePassword = "user.change_password"
+	AuditUserDelete         = "user.delete"
+	AuditRoleCreate         = "role.create"
+	AuditRoleUpdate         = "role.update"
+	AuditRoleDelete         = "role.delete"
+	AuditClientDelete       = "client.delete"
+	AuditClientAssign       = "client.assign"
+	AuditOTPView            = "otp.view"
+	AuditLogExport          = "logs.export"
+	AuditAlertRuleCreate    = "alert_rule.create"
+	AuditAlertRuleUpdate    = "alert_rule.update"
+	AuditAlertRuleDelete    = "alert_rule.delete"
+	AuditAlertAck           = "alert.ack"
+	AuditAlertResolve       = "alert.resolve"
+	AuditAlertDelete        = "alert.delete"
+	AuditIncidentResolve    = "incident.resolve"
+	AuditOTPUnlock          = "otp_lock.delete"
+	AuditExport             = "audit.export"
+	AuditSvcAccountCreate   = "service_account.create"
+	AuditSvcAccountDelete   = "service_account.delete"
+	AuditAPIKeyCreate       = "api_key.create"
+	AuditAPIKeyRevoke       = "api_key.revoke"
+)
+
+// Kết quả của hành động
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+	AuditDenied  = "denied" // thiếu quyền (401/403)
+)
+
+// AuditEntry là một dòng audit: ai làm gì với đối tượng nào, giá trị trước/sau và kết quả
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	Time       string          `json:"time"`
+	Actor      string          `json:"actor"` // username, với đăng nhập là tên đăng nhập được gửi lên
+	ActorRole  string          `json:"actor_role,omitempty"`
+	Action     string          `json:"action"` // Audit*, không có thì là "<METHOD> <route>"
+	TargetType string          `json:"target_type,omitempty"`
+	Target     string          `json:"target,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"` // không bao giờ chứa mật khẩu, OTP hay token
+	After      json.RawMessage `json:"after,omitempty"`
+	Method     string          `json:"method"`
+	Path       string          `json:"path"`
+	SourceIP   string          `json:"source_ip"`
+	Status     int             `json:"status"`
+	Outcome    string          `json:"outcome"` // success | failure | denied
+	Error      string          `json:"error,omitempty"`
+}
@@ -0,0 +1,49 @@
+package model
+
+// Loại incident do bộ phát hiện brute-force sinh ra
+const (
+	IncidentUserSpray   = "user_many_devices" // một tài khoản đăng nhập lỗi trên nhiều thiết bị (credential stuffing)
+	IncidentDeviceSpray = "device_many_users" // nhiều tài khoản đăng nhập lỗi trên một thiết bị (brute-force/password spraying)
+	IncidentOTPBurst    = "otp_burst"         // nhiều lần nhập sai OTP trên một thiết bị trong thời gian ngắn
+)
+
+// Đối tượng của incident và khoá OTP
+const (
+	SubjectUser   = "user"
+	SubjectDevice = "device"
+)
+
+// Trạng thái incident
+const (
+	IncidentOpen     = "open"
+	IncidentResolved = "resolved"
+)
+
+// Incident là một lần phát hiện tấn công đăng nhập; mỗi (loại, đối tượng) có tối đa một incident đang mở,
+// phát hiện tiếp thì cập nhật Count, AgentIDs, Usernames
+type Incident struct {
+	ID          string   `json:"id"`
+	Type        string   `json:"type"`         // user_many_devices | device_many_users | otp_burst
+	SubjectType string   `json:"subject_type"` // user | device
+	Subject     string   `json:"subject"`      // tài khoản (đã chuẩn hoá) hoặc agent_id
+	State       string   `json:"state"`        // open | resolved
+	Message     string   `json:"message"`
+	Count       int      `json:"count"`                  // số lần đăng nhập lỗi trong cửa sổ ở lần phát hiện gần nhất
+	AgentIDs    []string `json:"agent_ids,omitempty"`    // thiết bị liên quan
+	Usernames   []string `json:"usernames,omitempty"`    // tài khoản liên quan
+	LockedUntil string   `json:"locked_until,omitempty"` // OTP của đối tượng bị khoá tới thời điểm này
+	DetectedAt  string   `json:"detected_at"`
+	LastSeenAt  string   `json:"last_seen_at"`
+	ResolvedBy  string   `json:"resolved_by,omitempty"`
+	ResolvedAt  string   `json:"resolved_at,omitempty"`
+}
+
+// OTPLock tạm khoá cấp OTP cho một thiết bị hoặc tài khoản
+type OTPLock struct {
+	SubjectType string `json:"subject_type"` // user | device
+	Subject     string `json:"subject"`
+	Until       string `json:"until"` // RFC3339
+	IncidentID  string `json:"incident_id,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+	CreatedAt   string `json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package model
+
+// LoginEvent là một lần đăng nhập tại màn hình Windows, credential provider báo qua IPC login_event của agent
+type LoginEvent struct {
+	ID         int64  `json:"id"`
+	AgentID    string `json:"agent_id"`
+	Username   string `json:"username"`         // tài khoản Windows (có thể kèm domain)
+	Result     string `json:"result"`           // success | failed
+	Method     string `json:"method,omitempty"` // otp | recovery | offline, rỗng = không rõ
+	Reason     string `json:"reason,omitempty"`
+	Time       string `json:"time"`        // thời điểm đăng nhập (RFC3339)
+	ReceivedAt string `json:"received_at"` // thời điểm server nhận
+}
@@ -0,0 +1,62 @@
+package model
+
+// Quyền (permission) mà route API yêu cầu; role là một tập quyền
+const (
+	PermAll             = "*"                // mọi quyền
+	PermUsersManage     = "users.manage"     // tạo/sửa/xoá user, xem và thu hồi phiên
+	PermRolesManage     = "roles.manage"     // xem/tạo/sửa/xoá role
+	PermDevicesRead     = "devices.read"     // xem mọi thiết bị
+	PermDevicesManage   = "devices.manage"   // xoá thiết bị, gán user cho thiết bị
+	PermOTPRead         = "otp.read"         // xem OTP của mọi thiết bị
+	PermLogsRead        = "logs.read"        // đọc log, sự kiện đăng nhập của mọi thiết bị, thống kê, kiểm tra chuỗi hash
+	PermAlertsRead      = "alerts.read"      // xem rule và cảnh báo
+	PermAlertsManage    = "alerts.manage"    // sửa rule, ack/resolve/xoá cảnh báo
+	PermIncidentsRead   = "incidents.read"   // xem incident brute-force và khoá OTP
+	PermIncidentsManage = "incidents.manage" // resolve incident, mở khoá OTP
+	PermAuditRead       = "audit.read"       // xem nhật ký audit
+	PermAPIKeysManage   = "api_keys.manage"  // quản lý service account và API key
+)
+
+// Permissions là mọi quyền hợp lệ khi tạo role
+var Permissions = []string{
+	PermUsersManage, PermRolesManage, PermDevicesRead, PermDevicesManage, PermOTPRead, PermLogsRead,
+	PermAlertsRead, PermAlertsManage, PermIncidentsRead, PermIncidentsManage, PermAuditRead, PermAPIKeysManage,
+}
+
+// Role có sẵn, không sửa/xoá được qua API
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleAuditor  = "auditor"
+	RoleUser     = "user"
+)
+
+// Role là tập quyền gán cho user qua users.role
+type Role struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+	BuiltIn     bool     `json:"built_in"`
+	CreatedAt   string   `json:"created_at,omitempty"`
+	UpdatedAt   string   `json:"updated_at,omitempty"`
+}
+
+// BuiltInRoles là các role có sẵn. User thường (role user) không có quyền nào ngoài dữ liệu thiết bị của mình.
+func BuiltInRoles() []Role {
+	return []Role{
+		{Name: RoleAdmin, Description: "Full access", Permissions: []string{PermAll}, BuiltIn: true},
+		{Name: RoleOperator, Description: "Manage devices and view OTPs", Permissions: []string{PermDevicesRead, PermDevicesManage, PermOTPRead}, BuiltIn: true},
+		{Name: RoleAuditor, Description: "Read-only access to logs, alerts, incidents and audit", Permissions: []string{PermLogsRead, PermAlertsRead, PermIncidentsRead, PermAuditRead}, BuiltIn: true},
+		{Name: RoleUser, Description: "Own devices only", Permissions: []string{}, BuiltIn: true},
+	}
+}
+
+// HasPermission cho biết tập quyền perms có chứa perm không ("*" chứa mọi quyền)
+func HasPermission(perms []string, perm string) bool {
+	for _, p := range perms {
+		if p == perm || p == PermAll {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package model
+
+// APIKeyPrefix là tiền tố của API key, key đầy đủ có dạng gpk_<key_id>_<secret>
+const APIKeyPrefix = "gpk_"
+
+// RoleServiceAccount là role đặt vào context khi request xác thực bằng API key, không gán được cho user
+const RoleServiceAccount = "service_account"
+
+// ServiceAccountUsernamePrefix đứng trước tên service account trong context/audit để không trùng username người dùng
+const ServiceAccountUsernamePrefix = "svc:"
+
+// ServiceAccount là danh tính cho script/tích hợp, đăng nhập bằng API key thay vì mật khẩu
+type ServiceAccount struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	CreatedBy   string   `json:"created_by"`
+	CreatedAt   string   `json:"created_at"`
+	Keys        []APIKey `json:"keys,omitempty"`
+}
+
+// APIKey là khoá dài hạn của service account với tập quyền riêng. Server chỉ lưu hash, key đầy đủ chỉ trả một lần khi tạo.
+type APIKey struct {
+	ID          string   `json:"id"`
+	AccountID   string   `json:"account_id"`
+	Name        string   `json:"name,omitempty"`
+	Hash        string   `json:"-"` // sha256 của phần bí mật
+	Permissions []string `json:"permissions"`
+	CreatedBy   string   `json:"created_by"`
+	CreatedAt   string   `json:"created_at"`
+	ExpiresAt   string   `json:"expires_at"`
+	LastUsedAt  string   `json:"last_used_at,omitempty"`
+	LastUsedIP  string   `json:"last_used_ip,omitempty"`
+	RevokedAt   string   `json:"revoked_at,omitempty"`
+}
@@ -0,0 +1,17 @@
+package model
+
+// Session là một phiên đăng nhập API: access token (JWT) mang id phiên, refresh token được xoay vòng mỗi lần dùng.
+// Server chỉ lưu hash của refresh token.
+type Session struct {
+	ID           string `json:"id"`
+	UserID       string `json:"user_id"`
+	Username     string `json:"username"`
+	RefreshHash  string `json:"-"` // sha256 của refresh token hiện tại
+	PreviousHash string `json:"-"` // sha256 của refresh token vừa bị thay, dùng lại = token bị lộ
+	UserAgent    string `json:"user_agent,omitempty"`
+	ClientIP     string `json:"client_ip,omitempty"`
+	CreatedAt    string `json:"created_at"`
+	LastUsedAt   string `json:"last_used_at"`
+	ExpiresAt    string `json:"expires_at"` // hết hạn refresh token, tính từ lúc đăng nhập
+	RevokedAt    string `json:"revoked_at,omitempty"`
+}
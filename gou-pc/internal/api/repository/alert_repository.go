@@ -0,0 +1,290 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/logutil"
+	"strings"
+)
+
+var (
+	ErrAlertRuleNotFound = errors.New("alert rule not found")
+	ErrAlertNotFound     = errors.New("alert not found")
+)
+
+// AlertFilter lọc danh sách cảnh báo, trường rỗng thì bỏ qua
+type AlertFilter struct {
+	States  []string
+	RuleID  string
+	AgentID string
+	Limit   int // 0 = không giới hạn
+}
+
+type AlertRepository interface {
+	AlertRuleGetAll() ([]model.AlertRule, error)
+	AlertRuleFindByID(id string) (*model.AlertRule, error)
+	AlertRuleCreate(rule *model.AlertRule) error
+	AlertRuleUpdate(rule *model.AlertRule) error
+	AlertRuleDelete(id string) error
+	AlertList(f AlertFilter) ([]model.Alert, error)
+	AlertFindByID(id string) (*model.Alert, error)
+	AlertCreate(alert *model.Alert) error
+	AlertUpdate(alert *model.Alert) error
+	AlertDelete(id string) error
+}
+
+type sqliteAlertRepository struct {
+	db *sql.DB
+}
+
+// CreateAlertTables tạo bảng alert_rules và alerts nếu chưa có
+func CreateAlertTables(db *sql.DB) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS alert_rules (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			type TEXT NOT NULL,
+			enabled INTEGER NOT NULL,
+			severity TEXT NOT NULL,
+			pattern TEXT,
+			source TEXT,
+			fields TEXT,
+			threshold INTEGER,
+			window_seconds INTEGER,
+			offline_seconds INTEGER,
+			agent_ids TEXT,
+			channels TEXT,
+			created_at TEXT,
+			updated_at TEXT
+		)`,
+		`CREATE TABLE IF NOT EXISTS alerts (
+			id TEXT PRIMARY KEY,
+			rule_id TEXT NOT NULL,
+			rule_name TEXT,
+			agent_id TEXT,
+			severity TEXT,
+			state TEXT NOT NULL,
+			message TEXT,
+			count INTEGER,
+			fired_at TEXT,
+			last_seen_at TEXT,
+			acknowledged_by TEXT,
+			acknowledged_at TEXT,
+			resolved_by TEXT,
+			resolved_at TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_alerts_state ON alerts(state, fired_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_alerts_rule_agent ON alerts(rule_id, agent_id)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func NewSQLiteAlertRepository(db *sql.DB) AlertRepository {
+	return &sqliteAlertRepository{db: db}
+}
+
+const alertRuleColumns = `id, name, type, enabled, severity, pattern, source, fields, threshold, window_seconds, offline_seconds, agent_ids, channels, created_at, updated_at`
+
+func scanAlertRule(scan func(dest ...interface{}) error) (*model.AlertRule, error) {
+	var r model.AlertRule
+	var enabled int
+	var fields, agentIDs, channels string
+	err := scan(&r.ID, &r.Name, &r.Type, &enabled, &r.Severity, &r.Pattern, &r.Source, &fields,
+		&r.Threshold, &r.WindowSeconds, &r.OfflineSeconds, &agentIDs, &channels, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	r.Enabled = enabled == 1
+	unmarshalColumn(fields, &r.Fields)
+	unmarshalColumn(agentIDs, &r.AgentIDs)
+	unmarshalColumn(channels, &r.Channels)
+	return &r, nil
+}
+
+// unmarshalColumn đọc cột JSON (map/slice), rỗng thì giữ nguyên giá trị zero
+func unmarshalColumn(s string, v interface{}) {
+	if s == "" {
+		return
+	}
+	if err := json.Unmarshal([]byte(s), v); err != nil {
+		logutil.APIDebug("AlertRepository: invalid JSON column %q: %v", s, err)
+	}
+}
+
+func marshalColumn(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil || string(b) == "null" {
+		return ""
+	}
+	return string(b)
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (r *sqliteAlertRepository) AlertRuleGetAll() ([]model.AlertRule, error) {
+	rows, err := r.db.Query(`SELECT ` + alertRuleColumns + ` FROM alert_rules ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rules := []model.AlertRule{}
+	for rows.Next() {
+		rule, err := scanAlertRule(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *rule)
+	}
+	return rules, rows.Err()
+}
+
+func (r *sqliteAlertRepository) AlertRuleFindByID(id string) (*model.AlertRule, error) {
+	rule, err := scanAlertRule(r.db.QueryRow(`SELECT `+alertRuleColumns+` FROM alert_rules WHERE id = ?`, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrAlertRuleNotFound
+	}
+	return rule, err
+}
+
+func (r *sqliteAlertRepository) AlertRuleCreate(rule *model.AlertRule) error {
+	_, err := r.db.Exec(`INSERT INTO alert_rules (`+alertRuleColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rule.ID, rule.Name, rule.Type, boolInt(rule.Enabled), rule.Severity, rule.Pattern, rule.Source, marshalColumn(rule.Fields),
+		rule.Threshold, rule.WindowSeconds, rule.OfflineSeconds, marshalColumn(rule.AgentIDs), marshalColumn(rule.Channels),
+		rule.CreatedAt, rule.UpdatedAt)
+	if err != nil {
+		logutil.APIDebug("AlertRepository.AlertRuleCreate: failed to create rule %s: %v", rule.Name, err)
+	}
+	return err
+}
+
+func (r *sqliteAlertRepository) AlertRuleUpdate(rule *model.AlertRule) error {
+	res, err := r.db.Exec(`UPDATE alert_rules SET name=?, type=?, enabled=?, severity=?, pattern=?, source=?, fields=?, threshold=?,
+		window_seconds=?, offline_seconds=?, agent_ids=?, channels=?, updated_at=? WHERE id=?`,
+		rule.Name, rule.Type, boolInt(rule.Enabled), rule.Severity, rule.Pattern, rule.Source, marshalColumn(rule.Fields), rule.Threshold,
+		rule.WindowSeconds, rule.OfflineSeconds, marshalColumn(rule.AgentIDs), marshalColumn(rule.Channels), rule.UpdatedAt, rule.ID)
+	if err != nil {
+		logutil.APIDebug("AlertRepository.AlertRuleUpdate: failed to update rule %s: %v", rule.ID, err)
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAlertRuleNotFound
+	}
+	return nil
+}
+
+func (r *sqliteAlertRepository) AlertRuleDelete(id string) error {
+	res, err := r.db.Exec(`DELETE FROM alert_rules WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAlertRuleNotFound
+	}
+	return nil
+}
+
+const alertColumns = `id, rule_id, rule_name, agent_id, severity, state, message, count, fired_at, last_seen_at, acknowledged_by, acknowledged_at, resolved_by, resolved_at`
+
+func scanAlert(scan func(dest ...interface{}) error) (*model.Alert, error) {
+	var a model.Alert
+	err := scan(&a.ID, &a.RuleID, &a.RuleName, &a.AgentID, &a.Severity, &a.State, &a.Message, &a.Count,
+		&a.FiredAt, &a.LastSeenAt, &a.AcknowledgedBy, &a.AcknowledgedAt, &a.ResolvedBy, &a.ResolvedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// AlertList trả về cảnh báo mới nhất trước
+func (r *sqliteAlertRepository) AlertList(f AlertFilter) ([]model.Alert, error) {
+	var where []string
+	var args []interface{}
+	if len(f.States) > 0 {
+		where = append(where, `state IN (?`+strings.Repeat(", ?", len(f.States)-1)+`)`)
+		for _, s := range f.States {
+			args = append(args, s)
+		}
+	}
+	if f.RuleID != "" {
+		where = append(where, `rule_id = ?`)
+		args = append(args, f.RuleID)
+	}
+	if f.AgentID != "" {
+		where = append(where, `agent_id = ?`)
+		args = append(args, f.AgentID)
+	}
+	query := `SELECT ` + alertColumns + ` FROM alerts`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY fired_at DESC, id DESC`
+	if f.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, f.Limit)
+	}
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	alerts := []model.Alert{}
+	for rows.Next() {
+		a, err := scanAlert(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, *a)
+	}
+	return alerts, rows.Err()
+}
+
+func (r *sqliteAlertRepository) AlertFindByID(id string) (*model.Alert, error) {
+	a, err := scanAlert(r.db.QueryRow(`SELECT `+alertColumns+` FROM alerts WHERE id = ?`, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrAlertNotFound
+	}
+	return a, err
+}
+
+func (r *sqliteAlertRepository) AlertCreate(a *model.Alert) error {
+	_, err := r.db.Exec(`INSERT INTO alerts (`+alertColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.ID, a.RuleID, a.RuleName, a.AgentID, a.Severity, a.State, a.Message, a.Count,
+		a.FiredAt, a.LastSeenAt, a.AcknowledgedBy, a.AcknowledgedAt, a.ResolvedBy, a.ResolvedAt)
+	return err
+}
+
+func (r *sqliteAlertRepository) AlertUpdate(a *model.Alert) error {
+	res, err := r.db.Exec(`UPDATE alerts SET state=?, message=?, count=?, last_seen_at=?, acknowledged_by=?, acknowledged_at=?,
+		resolved_by=?, resolved_at=? WHERE id=?`,
+		a.State, a.Message, a.Count, a.LastSeenAt, a.AcknowledgedBy, a.AcknowledgedAt, a.ResolvedBy, a.ResolvedAt, a.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAlertNotFound
+	}
+	return nil
+}
+
+func (r *sqliteAlertRepository) AlertDelete(id string) error {
+	res, err := r.db.Exec(`DELETE FROM alerts WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAlertNotFound
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"gou-pc/internal/api/model"
+	"strings"
+)
+
+// AuditFilter lọc audit log, trường rỗng thì bỏ qua
+type AuditFilter struct {
+	Actors     []string
+	Actions    []string
+	TargetType string
+	Target     string
+	Outcome    string
+	From       string // RFC3339, bao gồm
+	To         string // RFC3339, bao gồm
+}
+
+// AuditRepository chỉ thêm và đọc, không có sửa/xoá từng dòng
+type AuditRepository interface {
+	AuditCreate(e *model.AuditEntry) error
+	// AuditList trả về một trang (page bắt đầu từ 1) mới nhất trước cùng tổng số dòng khớp, pageSize <= 0 thì trả về tất cả
+	AuditList(f AuditFilter, page, pageSize int) ([]model.AuditEntry, int, error)
+	// AuditExport gọi fn cho từng dòng khớp theo thứ tự thời gian, fn trả lỗi thì dừng
+	AuditExport(f AuditFilter, fn func(model.AuditEntry) error) error
+}
+
+type sqliteAuditRepository struct {
+	db *sql.DB
+}
+
+// CreateAuditTables tạo bảng audit_log nếu chưa có
+func CreateAuditTables(db *sql.DB) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			time TEXT NOT NULL,
+			actor TEXT NOT NULL DEFAULT '',
+			actor_role TEXT NOT NULL DEFAULT '',
+			action TEXT NOT NULL,
+			target_type TEXT NOT NULL DEFAULT '',
+			target TEXT NOT NULL DEFAULT '',
+			before TEXT NOT NULL DEFAULT '',
+			after TEXT NOT NULL DEFAULT '',
+			method TEXT NOT NULL DEFAULT '',
+			path TEXT NOT NULL DEFAULT '',
+			source_ip TEXT NOT NULL DEFAULT '',
+			status INTEGER NOT NULL DEFAULT 0,
+			outcome TEXT NOT NULL,
+			error TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_time ON audit_log(time)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_actor ON audit_log(actor, time)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target, time)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func NewSQLiteAuditRepository(db *sql.DB) AuditRepository {
+	return &sqliteAuditRepository{db: db}
+}
+
+const auditColumns = `id, time, actor, actor_role, action, target_type, target, before, after, method, path, source_ip, status, outcome, error`
+
+func (r *sqliteAuditRepository) AuditCreate(e *model.AuditEntry) error {
+	res, err := r.db.Exec(`INSERT INTO audit_log (time, actor, actor_role, action, target_type, target, before, after, method, path, source_ip, status, outcome, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.Time, e.Actor, e.ActorRole, e.Action, e.TargetType, e.Target, string(e.Before), string(e.After),
+		e.Method, e.Path, e.SourceIP, e.Status, e.Outcome, e.Error)
+	if err != nil {
+		return err
+	}
+	e.ID, err = res.LastInsertId()
+	return err
+}
+
+func auditWhere(f AuditFilter) ([]string, []interface{}) {
+	var where []string
+	var args []interface{}
+	in := func(col string, values []string) {
+		where = append(where, col+` IN (?`+strings.Repeat(", ?", len(values)-1)+`)`)
+		for _, v := range values {
+			args = append(args, v)
+		}
+	}
+	if len(f.Actors) > 0 {
+		in(`actor`, f.Actors)
+	}
+	if len(f.Actions) > 0 {
+		in(`action`, f.Actions)
+	}
+	eq := map[string]string{`target_type`: f.TargetType, `target`: f.Target, `outcome`: f.Outcome}
+	for _, col := range []string{`target_type`, `target`, `outcome`} {
+		if eq[col] != "" {
+			where = append(where, col+` = ?`)
+			args = append(args, eq[col])
+		}
+	}
+	if f.From != "" {
+		where = append(where, `time >= ?`)
+		args = append(args, f.From)
+	}
+	if f.To != "" {
+		where = append(where, `time <= ?`)
+		args = append(args, f.To)
+	}
+	return where, args
+}
+
+func scanAuditEntry(scan func(dest ...interface{}) error) (model.AuditEntry, error) {
+	var e model.AuditEntry
+	var before, after string
+	err := scan(&e.ID, &e.Time, &e.Actor, &e.ActorRole, &e.Action, &e.TargetType, &e.Target, &before, &after,
+		&e.Method, &e.Path, &e.SourceIP, &e.Status, &e.Outcome, &e.Error)
+	if before != "" {
+		e.Before = json.RawMessage(before)
+	}
+	if after != "" {
+		e.After = json.RawMessage(after)
+	}
+	return e, err
+}
+
+func (r *sqliteAuditRepository) AuditList(f AuditFilter, page, pageSize int) ([]model.AuditEntry, int, error) {
+	where, args := auditWhere(f)
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM audit_log`+whereClause(where), args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	query := `SELECT ` + auditColumns + ` FROM audit_log` + whereClause(where) + ` ORDER BY time DESC, id DESC`
+	if pageSize > 0 {
+		limit, offset := pageBounds(page, pageSize)
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, limit, offset)
+	}
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	entries := []model.AuditEntry{}
+	for rows.Next() {
+		e, err := scanAuditEntry(rows.Scan)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
+
+func (r *sqliteAuditRepository) AuditExport(f AuditFilter, fn func(model.AuditEntry) error) error {
+	where, args := auditWhere(f)
+	rows, err := r.db.Query(`SELECT `+auditColumns+` FROM audit_log`+whereClause(where)+` ORDER BY time, id`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e, err := scanAuditEntry(rows.Scan)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
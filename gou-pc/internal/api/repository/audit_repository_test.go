@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"gou-pc/internal/api/model"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuditListAndExport(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "clients.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := CreateAuditTables(db); err != nil {
+		t.Fatal(err)
+	}
+	repo := NewSQLiteAuditRepository(db)
+	for _, e := range []model.AuditEntry{
+		{Time: "2024-06-01T08:00:00+07:00", Actor: "admin", Action: model.AuditUserCreate, TargetType: "user", Target: "bob",
+			After: json.RawMessage(`{"role":"user"}`), Status: 200, Outcome: model.AuditSuccess},
+		{Time: "2024-06-01T09:00:00+07:00", Actor: "op1", Action: model.AuditOTPView, TargetType: "agent", Target: "001", Status: 200, Outcome: model.AuditSuccess},
+		{Time: "2024-06-02T10:00:00+07:00", Actor: "bob", Action: "DELETE /api/users/delete", Status: 403, Outcome: model.AuditDenied, Error: "access denied"},
+	} {
+		if err := repo.AuditCreate(&e); err != nil || e.ID == 0 {
+			t.Fatalf("create: %v, id=%d", err, e.ID)
+		}
+	}
+
+	entries, total, err := repo.AuditList(AuditFilter{}, 1, 2)
+	if err != nil || total != 3 || len(entries) != 2 || entries[0].Actor != "bob" {
+		t.Fatalf("newest first with paging: %d, %v, %+v", total, err, entries)
+	}
+	if entries[0].Before != nil || entries[0].After != nil {
+		t.Errorf("empty before/after should stay nil: %+v", entries[0])
+	}
+	entries, _, _ = repo.AuditList(AuditFilter{Actors: []string{"admin", "op1"}, To: "2024-06-01T08:30:00+07:00"}, 0, 0)
+	if len(entries) != 1 || string(entries[0].After) != `{"role":"user"}` {
+		t.Errorf("actor + to filter: %+v", entries)
+	}
+	entries, _, _ = repo.AuditList(AuditFilter{TargetType: "agent", Target: "001", Actions: []string{model.AuditOTPView}}, 0, 0)
+	if len(entries) != 1 || entries[0].Actor != "op1" {
+		t.Errorf("target filter: %+v", entries)
+	}
+	entries, _, _ = repo.AuditList(AuditFilter{Outcome: model.AuditDenied}, 0, 0)
+	if len(entries) != 1 || entries[0].Error != "access denied" {
+		t.Errorf("outcome filter: %+v", entries)
+	}
+
+	var order []string
+	if err := repo.AuditExport(AuditFilter{Outcome: model.AuditSuccess}, func(e model.AuditEntry) error {
+		order = append(order, e.Actor)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 2 || order[0] != "admin" || order[1] != "op1" {
+		t.Errorf("export should be oldest first: %v", order)
+	}
+}
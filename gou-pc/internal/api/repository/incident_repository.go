@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"gou-pc/internal/api/model"
+	"strings"
+)
+
+var ErrIncidentNotFound = errors.New("incident not found")
+
+// IncidentFilter lọc danh sách incident, trường rỗng thì bỏ qua
+type IncidentFilter struct {
+	States  []string
+	Types   []string
+	Subject string
+	Limit   int // 0 = không giới hạn
+}
+
+type IncidentRepository interface {
+	IncidentList(f IncidentFilter) ([]model.Incident, error)
+	IncidentFindByID(id string) (*model.Incident, error)
+	IncidentCreate(i *model.Incident) error
+	IncidentUpdate(i *model.Incident) error
+	// OTPLockList trả về mọi khoá OTP đã lưu (kể cả đã hết hạn chưa được dọn)
+	OTPLockList() ([]model.OTPLock, error)
+	// OTPLockSave thêm hoặc thay khoá của (SubjectType, Subject)
+	OTPLockSave(l *model.OTPLock) error
+	OTPLockDelete(subjectType, subject string) error
+}
+
+type sqliteIncidentRepository struct {
+	db *sql.DB
+}
+
+// CreateIncidentTables tạo bảng incidents và otp_locks nếu chưa có
+func CreateIncidentTables(db *sql.DB) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS incidents (
+			id TEXT PRIMARY KEY,
+			type TEXT NOT NULL,
+			subject_type TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			state TEXT NOT NULL,
+			message TEXT,
+			count INTEGER,
+			agent_ids TEXT,
+			usernames TEXT,
+			locked_until TEXT,
+			detected_at TEXT,
+			last_seen_at TEXT,
+			resolved_by TEXT,
+			resolved_at TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_incidents_state ON incidents(state, detected_at)`,
+		`CREATE TABLE IF NOT EXISTS otp_locks (
+			subject_type TEXT NOT NULL,
+			subject TEXT NOT NULL,
+			until TEXT NOT NULL,
+			incident_id TEXT,
+			reason TEXT,
+			created_at TEXT,
+			PRIMARY KEY (subject_type, subject)
+		)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func NewSQLiteIncidentRepository(db *sql.DB) IncidentRepository {
+	return &sqliteIncidentRepository{db: db}
+}
+
+const incidentColumns = `id, type, subject_type, subject, state, message, count, agent_ids, usernames, locked_until, detected_at, last_seen_at, resolved_by, resolved_at`
+
+func scanIncident(scan func(dest ...interface{}) error) (*model.Incident, error) {
+	var i model.Incident
+	var agentIDs, usernames string
+	err := scan(&i.ID, &i.Type, &i.SubjectType, &i.Subject, &i.State, &i.Message, &i.Count, &agentIDs, &usernames,
+		&i.LockedUntil, &i.DetectedAt, &i.LastSeenAt, &i.ResolvedBy, &i.ResolvedAt)
+	if err != nil {
+		return nil, err
+	}
+	unmarshalColumn(agentIDs, &i.AgentIDs)
+	unmarshalColumn(usernames, &i.Usernames)
+	return &i, nil
+}
+
+// IncidentList trả về incident mới nhất trước
+func (r *sqliteIncidentRepository) IncidentList(f IncidentFilter) ([]model.Incident, error) {
+	var where []string
+	var args []interface{}
+	in := func(col string, values []string) {
+		where = append(where, col+` IN (?`+strings.Repeat(", ?", len(values)-1)+`)`)
+		for _, v := range values {
+			args = append(args, v)
+		}
+	}
+	if len(f.States) > 0 {
+		in(`state`, f.States)
+	}
+	if len(f.Types) > 0 {
+		in(`type`, f.Types)
+	}
+	if f.Subject != "" {
+		where = append(where, `subject = ?`)
+		args = append(args, f.Subject)
+	}
+	query := `SELECT ` + incidentColumns + ` FROM incidents` + whereClause(where) + ` ORDER BY detected_at DESC, id DESC`
+	if f.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, f.Limit)
+	}
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	incidents := []model.Incident{}
+	for rows.Next() {
+		i, err := scanIncident(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		incidents = append(incidents, *i)
+	}
+	return incidents, rows.Err()
+}
+
+func (r *sqliteIncidentRepository) IncidentFindByID(id string) (*model.Incident, error) {
+	i, err := scanIncident(r.db.QueryRow(`SELECT `+incidentColumns+` FROM incidents WHERE id = ?`, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrIncidentNotFound
+	}
+	return i, err
+}
+
+func (r *sqliteIncidentRepository) IncidentCreate(i *model.Incident) error {
+	_, err := r.db.Exec(`INSERT INTO incidents (`+incidentColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		i.ID, i.Type, i.SubjectType, i.Subject, i.State, i.Message, i.Count, marshalColumn(i.AgentIDs), marshalColumn(i.Usernames),
+		i.LockedUntil, i.DetectedAt, i.LastSeenAt, i.ResolvedBy, i.ResolvedAt)
+	return err
+}
+
+func (r *sqliteIncidentRepository) IncidentUpdate(i *model.Incident) error {
+	res, err := r.db.Exec(`UPDATE incidents SET state=?, message=?, count=?, agent_ids=?, usernames=?, locked_until=?, last_seen_at=?,
+		resolved_by=?, resolved_at=? WHERE id=?`,
+		i.State, i.Message, i.Count, marshalColumn(i.AgentIDs), marshalColumn(i.Usernames), i.LockedUntil, i.LastSeenAt,
+		i.ResolvedBy, i.ResolvedAt, i.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrIncidentNotFound
+	}
+	return nil
+}
+
+func (r *sqliteIncidentRepository) OTPLockList() ([]model.OTPLock, error) {
+	rows, err := r.db.Query(`SELECT subject_type, subject, until, incident_id, reason, created_at FROM otp_locks ORDER BY until DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	locks := []model.OTPLock{}
+	for rows.Next() {
+		var l model.OTPLock
+		if err := rows.Scan(&l.SubjectType, &l.Subject, &l.Until, &l.IncidentID, &l.Reason, &l.CreatedAt); err != nil {
+			return nil, err
+		}
+		locks = append(locks, l)
+	}
+	return locks, rows.Err()
+}
+
+func (r *sqliteIncidentRepository) OTPLockSave(l *model.OTPLock) error {
+	_, err := r.db.Exec(`INSERT OR REPLACE INTO otp_locks (subject_type, subject, until, incident_id, reason, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		l.SubjectType, l.Subject, l.Until, l.IncidentID, l.Reason, l.CreatedAt)
+	return err
+}
+
+func (r *sqliteIncidentRepository) OTPLockDelete(subjectType, subject string) error {
+	_, err := r.db.Exec(`DELETE FROM otp_locks WHERE subject_type = ? AND subject = ?`, subjectType, subject)
+	return err
+}
@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"gou-pc/internal/logcollector"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Trường thời gian/sắp xếp của log
+const (
+	LogSortTime     = "time"        // thời điểm xảy ra (agent gửi)
+	LogSortReceived = "received_at" // thời điểm server nhận
+	LogSortSeverity = "severity"    // mức độ, cùng mức thì theo id
+)
+
+// LogQuery là điều kiện tìm kiếm log, các trường rỗng thì bỏ qua
+type LogQuery struct {
+	Text        string            // tìm toàn văn trong message
+	From        string            // RFC3339 (offset bất kỳ), bao gồm; so theo thời điểm thực, không so chuỗi
+	To          string            // RFC3339 (offset bất kỳ), bao gồm
+	TimeField   string            // From/To áp dụng cho LogSortTime (mặc định) hoặc LogSortReceived
+	AgentIDs    []string          // nil: mọi agent; slice rỗng (không nil): không agent nào
+	Fields      map[string]string // field parser phải bằng đúng giá trị, vd user=alice
+	Sources     []string          // nhãn nguồn log phía agent, rỗng: mọi nguồn
+	SourceFiles []string          // file log phía agent, rỗng: mọi file
+	Severities  []string          // mức độ chuẩn (logcollector.Severities), rỗng: mọi mức
+	MinSeverity string            // chỉ lấy log từ mức này trở lên (log không rõ mức bị loại)
+	SortBy      string            // LogSortTime (mặc định), LogSortReceived hoặc LogSortSeverity
+	SortAsc     bool              // mặc định mới nhất (hoặc nặng nhất) lên đầu
+	Cursor      string            // next_cursor của trang trước
+	Limit       int
+}
+
+// ErrInvalidCursor trả về khi cursor không giải mã được hoặc không cùng kiểu sắp xếp với query
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrExportSortUnsupported trả về khi log store không xuất được theo thứ tự yêu cầu mà không nạp hết kết quả vào bộ nhớ
+var ErrExportSortUnsupported = errors.New("export from the file log store only supports sort_by=received_at, sort=asc")
+
+// logCursor là vị trí (khoá sắp xếp, id) của bản ghi cuối trang trước
+type logCursor struct {
+	Key int64
+	ID  int64
+}
+
+func (q LogQuery) sortBy() string {
+	if q.SortBy == "" {
+		return LogSortTime
+	}
+	return q.SortBy
+}
+
+// logInstant đổi thời điểm RFC3339 của log sang unix giây để so sánh theo thời điểm thực
+// (log có thể mang offset khác nhau nên so chuỗi sai thứ tự); không parse được thì trả 0
+func logInstant(s string) int64 {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return 0
+	}
+	return t.Unix()
+}
+
+// sortKey là giá trị của entry theo trường sắp xếp: unix giây với time/received_at, thứ hạng với severity
+func sortKey(e logcollector.ArchiveLogEntry, sortBy string) int64 {
+	switch sortBy {
+	case LogSortReceived:
+		return logInstant(e.Received())
+	case LogSortSeverity:
+		return int64(logcollector.SeverityRank(e.Severity))
+	}
+	return logInstant(e.Time)
+}
+
+func encodeLogCursor(e logcollector.ArchiveLogEntry, sortBy string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(sortBy + "|" + strconv.FormatInt(sortKey(e, sortBy), 10) + "|" + strconv.FormatInt(e.ID, 10)))
+}
+
+func decodeLogCursor(s, sortBy string) (*logCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.Split(string(b), "|")
+	if len(parts) != 3 || parts[0] != sortBy {
+		return nil, ErrInvalidCursor
+	}
+	key, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	id, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &logCursor{Key: key, ID: id}, nil
+}
+
+// less so sánh hai entry theo (khoá sắp xếp, id) tăng dần
+func less(a, b logcollector.ArchiveLogEntry, sortBy string) bool {
+	ka, kb := sortKey(a, sortBy), sortKey(b, sortBy)
+	if ka != kb {
+		return ka < kb
+	}
+	return a.ID < b.ID
+}
+
+// after cho biết entry có nằm sau cursor theo thứ tự sắp xếp của query không
+func (c *logCursor) after(e logcollector.ArchiveLogEntry, sortBy string, asc bool) bool {
+	if c == nil {
+		return true
+	}
+	k := sortKey(e, sortBy)
+	if asc {
+		return k > c.Key || (k == c.Key && e.ID > c.ID)
+	}
+	return k < c.Key || (k == c.Key && e.ID < c.ID)
+}
+
+// Match kiểm tra entry thoả các điều kiện lọc (trừ cursor), dùng cho log store dạng file và tail realtime
+func (q LogQuery) Match(e logcollector.ArchiveLogEntry) bool {
+	if q.AgentIDs != nil && !containsString(q.AgentIDs, e.AgentID) {
+		return false
+	}
+	if len(q.Sources) > 0 && !containsString(q.Sources, e.Source) {
+		return false
+	}
+	if len(q.SourceFiles) > 0 && !containsString(q.SourceFiles, e.SourceFile) {
+		return false
+	}
+	if len(q.Severities) > 0 && !containsString(q.Severities, e.Severity) {
+		return false
+	}
+	if q.MinSeverity != "" && logcollector.SeverityRank(e.Severity) < logcollector.SeverityRank(q.MinSeverity) {
+		return false
+	}
+	for k, v := range q.Fields {
+		if e.Fields[k] != v {
+			return false
+		}
+	}
+	if q.From != "" || q.To != "" {
+		t := logInstant(q.timeOf(e))
+		if q.From != "" && t < logInstant(q.From) {
+			return false
+		}
+		if q.To != "" && t > logInstant(q.To) {
+			return false
+		}
+	}
+	if q.Text != "" {
+		msg := strings.ToLower(e.Message)
+		for _, term := range strings.Fields(strings.ToLower(q.Text)) {
+			if !strings.Contains(msg, term) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (q LogQuery) limit() int {
+	if q.Limit < 1 {
+		return 50
+	}
+	return q.Limit
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,7 +1,10 @@
 package repository
 
 import (
+	"crypto/ed25519"
 	"gou-pc/internal/logcollector"
+	"sort"
+	"time"
 )
 
 // LogRepository interface cho thao tác log
@@ -12,15 +15,42 @@ type LogRepository interface {
 	GetLogsByAgentID(agentID string) ([]logcollector.ArchiveLogEntry, error)
 	GetLogsPaged(page, pageSize int) ([]logcollector.ArchiveLogEntry, int, error)
 	GetLogsPagedByAgentID(agentID string, page, pageSize int) ([]logcollector.ArchiveLogEntry, int, error)
+	SearchLogs(q LogQuery) ([]logcollector.ArchiveLogEntry, string, error)
+	// ListLogs trả về một trang (page bắt đầu từ 1) log khớp bộ lọc của q theo SortBy/SortAsc (bỏ qua Cursor, Limit)
+	// cùng tổng số log khớp; pageSize <= 0 thì trả về tất cả
+	ListLogs(q LogQuery, page, pageSize int) ([]logcollector.ArchiveLogEntry, int, error)
+	// ExportLogs gọi fn cho từng log khớp bộ lọc của q (bỏ qua Cursor, Limit) theo SortBy/SortAsc,
+	// không giữ toàn bộ kết quả trong bộ nhớ; fn trả lỗi thì dừng. Log store file chỉ xuất theo thứ tự ghi
+	// (SortBy rỗng hoặc received_at, tăng dần), thứ tự khác trả ErrExportSortUnsupported
+	ExportLogs(q LogQuery, fn func(logcollector.ArchiveLogEntry) error) error
+	// LogVolume đếm log khớp bộ lọc của q (bỏ qua Cursor, Limit, sắp xếp) theo agent và khoảng thời gian bucket
+	// (LogBucketMinute/Hour/Day) của TimeField, khoảng không có log thì không trả về
+	LogVolume(q LogQuery, bucket string) ([]LogVolumePoint, error)
+	// TopMessages trả về n message khớp bộ lọc của q xuất hiện nhiều nhất; templates thì gom theo MessageTemplate
+	TopMessages(q LogQuery, n int, templates bool) ([]MessageCount, error)
+	// ErrorRate trả về tỉ lệ log từ mức threshold trở lên (rỗng = "error") theo khoảng thời gian bucket
+	ErrorRate(q LogQuery, bucket, threshold string) ([]ErrorRatePoint, error)
+	// AppendLogs ghi log theo thứ tự, mỗi log được nối vào chuỗi hash chống sửa (logcollector.Link)
+	AppendLogs(entries []logcollector.ArchiveLogEntry) error
 	RotateLog() error
+	// ChainFloor trả seq sớm nhất của chuỗi hash còn trong log store (tăng lên khi retention xoá log), 0 nếu chưa có
+	ChainFloor() (int64, error)
+	// CheckpointLog ký mắt xích cuối của chuỗi hash cùng ChainFloor bằng key, trả nil nếu chưa có log mới
+	// và floor không đổi kể từ checkpoint trước
+	CheckpointLog(key ed25519.PrivateKey) (*logcollector.ChainCheckpoint, error)
+	// VerifyLogChain kiểm tra toàn bộ chuỗi hash theo thứ tự ghi và đối chiếu checkpoint bằng pub (nil = bỏ qua checkpoint),
+	// báo chỗ đứt đầu tiên trong ChainReport.Break
+	VerifyLogChain(pub ed25519.PublicKey) (*logcollector.ChainReport, error)
 }
 
 type fileLogRepository struct {
 	archiveFile string
+	policy      logcollector.RotationPolicy
 }
 
-func NewFileLogRepository(archiveFile string) LogRepository {
-	return &fileLogRepository{archiveFile: archiveFile}
+// NewFileLogRepository lưu log trong file archive JSONL, xoay vòng/retention theo policy khi gọi RotateLog
+func NewFileLogRepository(archiveFile string, policy logcollector.RotationPolicy) LogRepository {
+	return &fileLogRepository{archiveFile: archiveFile, policy: policy}
 }
 
 func (r *fileLogRepository) GetAllLogs() ([]logcollector.ArchiveLogEntry, error) {
@@ -81,7 +111,156 @@ func (r *fileLogRepository) GetLogsPagedByAgentID(agentID string, page, pageSize
 	return filtered[start:end], total, nil
 }
 
-// Rotate log: đổi tên file log hiện tại sang <log>.old, tạo file mới
+// matchLogs đọc toàn bộ archive, trả về log khớp q và nằm sau cursor, đã sắp xếp; ID là số dòng trong file
+func (r *fileLogRepository) matchLogs(q LogQuery, cursor *logCursor) ([]logcollector.ArchiveLogEntry, error) {
+	logs, err := logcollector.LoadArchiveLogs(r.archiveFile)
+	if err != nil {
+		return nil, err
+	}
+	sortBy := q.sortBy()
+	matched := []logcollector.ArchiveLogEntry{}
+	for i, l := range logs {
+		l.ID = int64(i + 1)
+		if q.Match(l) && cursor.after(l, sortBy, q.SortAsc) {
+			matched = append(matched, l)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if q.SortAsc {
+			return less(matched[i], matched[j], sortBy)
+		}
+		return less(matched[j], matched[i], sortBy)
+	})
+	return matched, nil
+}
+
+// SearchLogs lọc log trong file archive, ID là số dòng trong file; trả về log và cursor trang sau
+func (r *fileLogRepository) SearchLogs(q LogQuery) ([]logcollector.ArchiveLogEntry, string, error) {
+	cursor, err := decodeLogCursor(q.Cursor, q.sortBy())
+	if err != nil {
+		return nil, "", err
+	}
+	matched, err := r.matchLogs(q, cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	limit := q.limit()
+	if len(matched) <= limit {
+		return matched, "", nil
+	}
+	return matched[:limit], encodeLogCursor(matched[limit-1], q.sortBy()), nil
+}
+
+func (r *fileLogRepository) ListLogs(q LogQuery, page, pageSize int) ([]logcollector.ArchiveLogEntry, int, error) {
+	matched, err := r.matchLogs(q, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	total := len(matched)
+	if pageSize <= 0 {
+		return matched, total, nil
+	}
+	limit, offset := pageBounds(page, pageSize)
+	if offset >= total {
+		return []logcollector.ArchiveLogEntry{}, total, nil
+	}
+	if offset+limit > total {
+		limit = total - offset
+	}
+	return matched[offset : offset+limit], total, nil
+}
+
+// ExportLogs đọc archive theo luồng (segment rồi file hiện tại) theo thứ tự ghi, tức received_at tăng dần.
+// Log store file không sắp xếp được mà không nạp hết vào bộ nhớ, nên SortBy khác rỗng/received_at hoặc giảm dần
+// trả ErrExportSortUnsupported
+func (r *fileLogRepository) ExportLogs(q LogQuery, fn func(logcollector.ArchiveLogEntry) error) error {
+	if (q.SortBy != "" && q.SortBy != LogSortReceived) || !q.SortAsc {
+		return ErrExportSortUnsupported
+	}
+	var line int64
+	return logcollector.ScanArchive(r.archiveFile, func(l logcollector.ArchiveLogEntry) error {
+		line++
+		l.ID = line
+		if !q.Match(l) {
+			return nil
+		}
+		return fn(l)
+	})
+}
+
+// scanMatched đọc archive theo luồng và gọi fn cho từng log khớp bộ lọc của q
+func (r *fileLogRepository) scanMatched(q LogQuery, fn func(logcollector.ArchiveLogEntry)) error {
+	if q.AgentIDs != nil && len(q.AgentIDs) == 0 {
+		return nil
+	}
+	return logcollector.ScanArchive(r.archiveFile, func(l logcollector.ArchiveLogEntry) error {
+		if q.Match(l) {
+			fn(l)
+		}
+		return nil
+	})
+}
+
+// LogVolume đọc archive theo luồng, chỉ giữ bộ đếm của từng (khoảng, agent)
+func (r *fileLogRepository) LogVolume(q LogQuery, bucket string) ([]LogVolumePoint, error) {
+	n, err := bucketPrefixLen(bucket)
+	if err != nil {
+		return nil, err
+	}
+	agg := newStatsAggregator()
+	if err := r.scanMatched(q, func(l logcollector.ArchiveLogEntry) {
+		agg.addVolume(q.timeOf(l), l.AgentID, n)
+	}); err != nil {
+		return nil, err
+	}
+	return agg.volumePoints(), nil
+}
+
+func (r *fileLogRepository) TopMessages(q LogQuery, n int, templates bool) ([]MessageCount, error) {
+	agg := newStatsAggregator()
+	if err := r.scanMatched(q, func(l logcollector.ArchiveLogEntry) {
+		agg.addMessage(l.Message, templates)
+	}); err != nil {
+		return nil, err
+	}
+	return agg.topMessages(n), nil
+}
+
+func (r *fileLogRepository) ErrorRate(q LogQuery, bucket, threshold string) ([]ErrorRatePoint, error) {
+	n, err := bucketPrefixLen(bucket)
+	if err != nil {
+		return nil, err
+	}
+	rank := errorThreshold(threshold)
+	agg := newStatsAggregator()
+	if err := r.scanMatched(q, func(l logcollector.ArchiveLogEntry) {
+		agg.addRate(q.timeOf(l), n, logcollector.SeverityRank(l.Severity) >= rank)
+	}); err != nil {
+		return nil, err
+	}
+	return agg.ratePoints(), nil
+}
+
+// AppendLogs ghi thêm các log mới vào cuối file archive (JSONL)
+func (r *fileLogRepository) AppendLogs(entries []logcollector.ArchiveLogEntry) error {
+	return logcollector.AppendArchive(r.archiveFile, entries)
+}
+
+func (r *fileLogRepository) ChainFloor() (int64, error) {
+	return logcollector.ArchiveFloor(r.archiveFile)
+}
+
+func (r *fileLogRepository) CheckpointLog(key ed25519.PrivateKey) (*logcollector.ChainCheckpoint, error) {
+	return logcollector.AppendCheckpoint(r.archiveFile, key, time.Now())
+}
+
+func (r *fileLogRepository) VerifyLogChain(pub ed25519.PublicKey) (*logcollector.ChainReport, error) {
+	return logcollector.VerifyArchive(r.archiveFile, pub)
+}
+
+// RotateLog nén file archive thành segment .gz khi vượt MaxSize/MaxAge và xoá segment quá hạn,
+// các hàm đọc vẫn thấy log trong segment
 func (r *fileLogRepository) RotateLog() error {
-	return logcollector.RotateLog(r.archiveFile)
+	_, err := logcollector.RotateIfNeeded(r.archiveFile, r.policy, time.Now())
+	return err
 }
@@ -0,0 +1,772 @@
+package repository
+
+import (
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/json"
+	"gou-pc/internal/logcollector"
+	"gou-pc/internal/logutil"
+	"io"
+	"strings"
+	"time"
+)
+
+// importBatchSize là số log ghi trong một transaction khi import file archive
+const importBatchSize = 1000
+
+type sqliteLogRepository struct {
+	db        *sql.DB
+	retainAge time.Duration
+}
+
+// NewSQLiteLogRepository tạo LogRepository lưu log trong bảng archive_logs, retainAge > 0 thì RotateLog xoá log cũ hơn
+func NewSQLiteLogRepository(db *sql.DB, retainAge time.Duration) LogRepository {
+	return &sqliteLogRepository{db: db, retainAge: retainAge}
+}
+
+// CreateLogTables tạo bảng archive_logs, index theo agent_id, time và bảng FTS archive_logs_fts cho tìm kiếm message
+func CreateLogTables(db *sql.DB) error {
+	var ftsExists int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'archive_logs_fts'`).Scan(&ftsExists); err != nil {
+		return err
+	}
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS archive_logs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			time TEXT NOT NULL,
+			agent_id TEXT NOT NULL,
+			message TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_archive_logs_agent_id ON archive_logs(agent_id, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_archive_logs_time ON archive_logs(time)`,
+		// FTS4 external content: chỉ lưu index, nội dung đọc từ archive_logs, trigger giữ đồng bộ
+		`CREATE VIRTUAL TABLE IF NOT EXISTS archive_logs_fts USING fts4(content="archive_logs", message, tokenize=unicode61)`,
+		`CREATE TRIGGER IF NOT EXISTS archive_logs_ai AFTER INSERT ON archive_logs BEGIN
+			INSERT INTO archive_logs_fts(docid, message) VALUES (new.id, new.message);
+		END`,
+		`CREATE TRIGGER IF NOT EXISTS archive_logs_bd BEFORE DELETE ON archive_logs BEGIN
+			DELETE FROM archive_logs_fts WHERE docid = old.id;
+		END`,
+		// Field do parser phía agent tách ra: JSON trong cột fields để trả về, bảng archive_log_fields để lọc theo index
+		`CREATE TABLE IF NOT EXISTS archive_log_fields (
+			log_id INTEGER NOT NULL,
+			key TEXT NOT NULL,
+			value TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_archive_log_fields_kv ON archive_log_fields(key, value, log_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_archive_log_fields_log_id ON archive_log_fields(log_id)`,
+		`CREATE TRIGGER IF NOT EXISTS archive_logs_fields_bd BEFORE DELETE ON archive_logs BEGIN
+			DELETE FROM archive_log_fields WHERE log_id = old.id;
+		END`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if err := addColumnIfMissing(db, "archive_logs", "fields", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "archive_logs", "source", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	// Thời điểm nhận, mức độ (thứ hạng 1..6, 0 = không rõ) và file nguồn; log cũ có received_at = time
+	if err := addColumnIfMissing(db, "archive_logs", "received_at", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "archive_logs", "severity", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "archive_logs", "source_file", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	// Chuỗi hash chống sửa (logcollector.Link), log cũ có seq = 0 và hash rỗng
+	if err := addColumnIfMissing(db, "archive_logs", "seq", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "archive_logs", "prev_hash", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "archive_logs", "hash", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS archive_log_checkpoints (
+			seq INTEGER PRIMARY KEY,
+			hash TEXT NOT NULL,
+			floor INTEGER NOT NULL DEFAULT 0,
+			time TEXT NOT NULL,
+			signature TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_archive_logs_source ON archive_logs(source, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_archive_logs_received_at ON archive_logs(received_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_archive_logs_severity ON archive_logs(severity, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_archive_logs_source_file ON archive_logs(source_file, id)`,
+		`UPDATE archive_logs SET received_at = time WHERE received_at = ''`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	// Thời điểm dạng unix giây để lọc/sắp xếp theo thời điểm thực (chuỗi RFC3339 có thể mang offset khác nhau),
+	// NULL = log cũ chưa tính, được điền bởi backfillLogInstants
+	if err := addColumnIfMissing(db, "archive_logs", "time_unix", "INTEGER"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "archive_logs", "received_unix", "INTEGER"); err != nil {
+		return err
+	}
+	if err := backfillLogInstants(db); err != nil {
+		return err
+	}
+	for _, stmt := range []string{
+		`CREATE INDEX IF NOT EXISTS idx_archive_logs_time_unix ON archive_logs(time_unix, id)`,
+		`CREATE INDEX IF NOT EXISTS idx_archive_logs_received_unix ON archive_logs(received_unix, id)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	// Checkpoint ghi trước khi có floor giữ floor = 0 (không kiểm tra điểm bắt đầu của chuỗi)
+	if err := addColumnIfMissing(db, "archive_log_checkpoints", "floor", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	// DB cũ đã có log trước khi có bảng FTS: dựng lại index một lần
+	if ftsExists == 0 {
+		if _, err := db.Exec(`INSERT INTO archive_logs_fts(archive_logs_fts) VALUES ('rebuild')`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillLogInstants điền time_unix/received_unix cho log ghi trước khi có hai cột này, theo từng lô importBatchSize
+func backfillLogInstants(db *sql.DB) error {
+	type instant struct{ id, t, received int64 }
+	for {
+		rows, err := db.Query(`SELECT id, time, received_at FROM archive_logs WHERE time_unix IS NULL OR received_unix IS NULL LIMIT ?`, importBatchSize)
+		if err != nil {
+			return err
+		}
+		var batch []instant
+		for rows.Next() {
+			var id int64
+			var t, received string
+			if err := rows.Scan(&id, &t, &received); err != nil {
+				rows.Close()
+				return err
+			}
+			if received == "" {
+				received = t
+			}
+			batch = append(batch, instant{id, logInstant(t), logInstant(received)})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, b := range batch {
+			if _, err := tx.Exec(`UPDATE archive_logs SET time_unix = ?, received_unix = ? WHERE id = ?`, b.t, b.received, b.id); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+}
+
+// addColumnIfMissing thêm cột cho DB tạo từ phiên bản cũ (SQLite không có ADD COLUMN IF NOT EXISTS)
+func addColumnIfMissing(db *sql.DB, table, column, decl string) error {
+	rows, err := db.Query(`PRAGMA table_info(` + table + `)`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid     int
+			name    string
+			typ     string
+			notNull int
+			dflt    sql.NullString
+			pk      int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	_, err = db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + decl)
+	return err
+}
+
+func (r *sqliteLogRepository) queryLogs(query string, args ...interface{}) ([]logcollector.ArchiveLogEntry, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	logs := []logcollector.ArchiveLogEntry{}
+	for rows.Next() {
+		l, err := scanLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, l)
+	}
+	return logs, rows.Err()
+}
+
+// logColumns là các cột scanLog đọc, theo đúng thứ tự
+const logColumns = `id, time, received_at, agent_id, message, fields, source, severity, source_file, seq, prev_hash, hash`
+
+// scanLog đọc một dòng logColumns
+func scanLog(rows *sql.Rows) (logcollector.ArchiveLogEntry, error) {
+	var l logcollector.ArchiveLogEntry
+	var fields sql.NullString
+	var severity int
+	if err := rows.Scan(&l.ID, &l.Time, &l.ReceivedAt, &l.AgentID, &l.Message, &fields, &l.Source, &severity, &l.SourceFile,
+		&l.Seq, &l.PrevHash, &l.Hash); err != nil {
+		return l, err
+	}
+	l.Severity = logcollector.SeverityName(severity)
+	if fields.Valid && fields.String != "" {
+		if err := json.Unmarshal([]byte(fields.String), &l.Fields); err != nil {
+			logutil.CoreError("LogRepository: invalid fields in log %d: %v", l.ID, err)
+		}
+	}
+	return l, nil
+}
+
+// GetAllLogs trả về toàn bộ log, mới nhất lên đầu
+func (r *sqliteLogRepository) GetAllLogs() ([]logcollector.ArchiveLogEntry, error) {
+	return r.queryLogs(`SELECT ` + logColumns + ` FROM archive_logs ORDER BY id DESC`)
+}
+
+func (r *sqliteLogRepository) GetLogsByAgentID(agentID string) ([]logcollector.ArchiveLogEntry, error) {
+	return r.queryLogs(`SELECT `+logColumns+` FROM archive_logs WHERE agent_id = ? ORDER BY id DESC`, agentID)
+}
+
+func (r *sqliteLogRepository) GetLogsPaged(page, pageSize int) ([]logcollector.ArchiveLogEntry, int, error) {
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM archive_logs`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	limit, offset := pageBounds(page, pageSize)
+	logs, err := r.queryLogs(`SELECT `+logColumns+` FROM archive_logs ORDER BY id DESC LIMIT ? OFFSET ?`, limit, offset)
+	return logs, total, err
+}
+
+func (r *sqliteLogRepository) GetLogsPagedByAgentID(agentID string, page, pageSize int) ([]logcollector.ArchiveLogEntry, int, error) {
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM archive_logs WHERE agent_id = ?`, agentID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	limit, offset := pageBounds(page, pageSize)
+	logs, err := r.queryLogs(`SELECT `+logColumns+` FROM archive_logs WHERE agent_id = ? ORDER BY id DESC LIMIT ? OFFSET ?`, agentID, limit, offset)
+	return logs, total, err
+}
+
+// SearchLogs tìm log theo FTS, khoảng thời gian, danh sách agent, nguồn, mức độ, field; phân trang keyset theo (khoá sắp xếp, id)
+func (r *sqliteLogRepository) SearchLogs(q LogQuery) ([]logcollector.ArchiveLogEntry, string, error) {
+	cursor, err := decodeLogCursor(q.Cursor, q.sortBy())
+	if err != nil {
+		return nil, "", err
+	}
+	if q.AgentIDs != nil && len(q.AgentIDs) == 0 {
+		return []logcollector.ArchiveLogEntry{}, "", nil
+	}
+	where, args := searchConditions(q)
+	col := sortColumn(q.sortBy())
+	if cursor != nil {
+		cmp := "<"
+		if q.SortAsc {
+			cmp = ">"
+		}
+		where = append(where, `(`+col+` `+cmp+` ? OR (`+col+` = ? AND id `+cmp+` ?))`)
+		args = append(args, cursor.Key, cursor.Key, cursor.ID)
+	}
+	query := `SELECT ` + logColumns + ` FROM archive_logs` + whereClause(where) + orderClause(q)
+	limit := q.limit()
+	query += ` LIMIT ?`
+	args = append(args, limit+1)
+	logs, err := r.queryLogs(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(logs) <= limit {
+		return logs, "", nil
+	}
+	return logs[:limit], encodeLogCursor(logs[limit-1], q.sortBy()), nil
+}
+
+func (r *sqliteLogRepository) ListLogs(q LogQuery, page, pageSize int) ([]logcollector.ArchiveLogEntry, int, error) {
+	if q.AgentIDs != nil && len(q.AgentIDs) == 0 {
+		return []logcollector.ArchiveLogEntry{}, 0, nil
+	}
+	where, args := searchConditions(q)
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM archive_logs`+whereClause(where), args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	query := `SELECT ` + logColumns + ` FROM archive_logs` + whereClause(where) + orderClause(q)
+	if pageSize > 0 {
+		limit, offset := pageBounds(page, pageSize)
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, limit, offset)
+	}
+	logs, err := r.queryLogs(query, args...)
+	return logs, total, err
+}
+
+func whereClause(where []string) string {
+	if len(where) == 0 {
+		return ""
+	}
+	return ` WHERE ` + strings.Join(where, " AND ")
+}
+
+// orderClause sắp xếp theo cột của SortBy (sortColumn) rồi id, cùng chiều SortAsc
+func orderClause(q LogQuery) string {
+	order := "DESC"
+	if q.SortAsc {
+		order = "ASC"
+	}
+	return ` ORDER BY ` + sortColumn(q.sortBy()) + ` ` + order + `, id ` + order
+}
+
+// searchConditions đổi bộ lọc của query (trừ cursor) thành điều kiện WHERE
+func searchConditions(q LogQuery) ([]string, []interface{}) {
+	var where []string
+	var args []interface{}
+	if match := ftsMatchExpr(q.Text); match != "" {
+		where = append(where, `id IN (SELECT docid FROM archive_logs_fts WHERE archive_logs_fts MATCH ?)`)
+		args = append(args, match)
+	}
+	timeCol := q.instantColumn()
+	if q.From != "" {
+		where = append(where, timeCol+` >= ?`)
+		args = append(args, logInstant(q.From))
+	}
+	if q.To != "" {
+		where = append(where, timeCol+` <= ?`)
+		args = append(args, logInstant(q.To))
+	}
+	if len(q.SourceFiles) > 0 {
+		where = append(where, `source_file IN (?`+strings.Repeat(", ?", len(q.SourceFiles)-1)+`)`)
+		for _, f := range q.SourceFiles {
+			args = append(args, f)
+		}
+	}
+	if len(q.Severities) > 0 {
+		where = append(where, `severity IN (?`+strings.Repeat(", ?", len(q.Severities)-1)+`)`)
+		for _, sev := range q.Severities {
+			args = append(args, logcollector.SeverityRank(sev))
+		}
+	}
+	if q.MinSeverity != "" {
+		where = append(where, `severity >= ?`)
+		args = append(args, logcollector.SeverityRank(q.MinSeverity))
+	}
+	if len(q.Sources) > 0 {
+		where = append(where, `source IN (?`+strings.Repeat(", ?", len(q.Sources)-1)+`)`)
+		for _, src := range q.Sources {
+			args = append(args, src)
+		}
+	}
+	for k, v := range q.Fields {
+		where = append(where, `id IN (SELECT log_id FROM archive_log_fields WHERE key = ? AND value = ?)`)
+		args = append(args, k, v)
+	}
+	if len(q.AgentIDs) > 0 {
+		where = append(where, `agent_id IN (?`+strings.Repeat(", ?", len(q.AgentIDs)-1)+`)`)
+		for _, id := range q.AgentIDs {
+			args = append(args, id)
+		}
+	}
+	return where, args
+}
+
+// ExportLogs duyệt mọi log khớp bộ lọc theo thứ tự của query qua con trỏ SQLite, không nạp hết vào bộ nhớ
+func (r *sqliteLogRepository) ExportLogs(q LogQuery, fn func(logcollector.ArchiveLogEntry) error) error {
+	if q.AgentIDs != nil && len(q.AgentIDs) == 0 {
+		return nil
+	}
+	where, args := searchConditions(q)
+	query := `SELECT ` + logColumns + ` FROM archive_logs` + whereClause(where) + orderClause(q)
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		l, err := scanLog(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// LogVolume đếm bằng GROUP BY theo tiền tố của cột thời gian (RFC3339) và agent, không đọc từng log ra
+func (r *sqliteLogRepository) LogVolume(q LogQuery, bucket string) ([]LogVolumePoint, error) {
+	n, err := bucketPrefixLen(bucket)
+	if err != nil {
+		return nil, err
+	}
+	if q.AgentIDs != nil && len(q.AgentIDs) == 0 {
+		return []LogVolumePoint{}, nil
+	}
+	col := q.timeColumn()
+	where, args := searchConditions(q)
+	rows, err := r.db.Query(`SELECT MIN(`+col+`), agent_id, COUNT(*) FROM archive_logs`+whereClause(where)+
+		` GROUP BY substr(`+col+`, 1, ?), agent_id`, append(args, n)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	points := []LogVolumePoint{}
+	for rows.Next() {
+		var p LogVolumePoint
+		var t string
+		if err := rows.Scan(&t, &p.AgentID, &p.Count); err != nil {
+			return nil, err
+		}
+		if p.Time = bucketStart(t, n); p.Time != "" {
+			points = append(points, p)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sortVolumePoints(points)
+	return points, nil
+}
+
+// TopMessages đếm message giống hệt bằng GROUP BY; gom theo mẫu thì duyệt message qua con trỏ và đếm trong bộ nhớ
+// (regex không chạy được trong SQLite)
+func (r *sqliteLogRepository) TopMessages(q LogQuery, n int, templates bool) ([]MessageCount, error) {
+	if q.AgentIDs != nil && len(q.AgentIDs) == 0 {
+		return []MessageCount{}, nil
+	}
+	where, args := searchConditions(q)
+	if templates {
+		rows, err := r.db.Query(`SELECT message FROM archive_logs`+whereClause(where), args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		agg := newStatsAggregator()
+		for rows.Next() {
+			var msg string
+			if err := rows.Scan(&msg); err != nil {
+				return nil, err
+			}
+			agg.addMessage(msg, true)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return agg.topMessages(n), nil
+	}
+	query := `SELECT message, COUNT(*) AS c FROM archive_logs` + whereClause(where) + ` GROUP BY message ORDER BY c DESC, message`
+	if n > 0 {
+		query += ` LIMIT ?`
+		args = append(args, n)
+	}
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	top := []MessageCount{}
+	for rows.Next() {
+		var m MessageCount
+		if err := rows.Scan(&m.Message, &m.Count); err != nil {
+			return nil, err
+		}
+		top = append(top, m)
+	}
+	return top, rows.Err()
+}
+
+// ErrorRate đếm tổng số log và số log lỗi của từng khoảng bằng một câu GROUP BY
+func (r *sqliteLogRepository) ErrorRate(q LogQuery, bucket, threshold string) ([]ErrorRatePoint, error) {
+	n, err := bucketPrefixLen(bucket)
+	if err != nil {
+		return nil, err
+	}
+	if q.AgentIDs != nil && len(q.AgentIDs) == 0 {
+		return []ErrorRatePoint{}, nil
+	}
+	col := q.timeColumn()
+	where, args := searchConditions(q)
+	args = append([]interface{}{errorThreshold(threshold)}, args...)
+	rows, err := r.db.Query(`SELECT MIN(`+col+`), COUNT(*), SUM(CASE WHEN severity >= ? THEN 1 ELSE 0 END) FROM archive_logs`+
+		whereClause(where)+` GROUP BY substr(`+col+`, 1, ?) ORDER BY 1`, append(args, n)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	points := []ErrorRatePoint{}
+	for rows.Next() {
+		var p ErrorRatePoint
+		var t string
+		if err := rows.Scan(&t, &p.Total, &p.Errors); err != nil {
+			return nil, err
+		}
+		if p.Time = bucketStart(t, n); p.Time != "" {
+			p.Rate = float64(p.Errors) / float64(p.Total)
+			points = append(points, p)
+		}
+	}
+	return points, rows.Err()
+}
+
+// ftsMatchExpr đổi chuỗi tìm kiếm của user thành biểu thức MATCH: mỗi từ là một phrase, các từ AND với nhau
+func ftsMatchExpr(text string) string {
+	var terms []string
+	for _, t := range strings.Fields(text) {
+		t = strings.ReplaceAll(t, `"`, ``)
+		if t != "" {
+			terms = append(terms, `"`+t+`"`)
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// chainHead đọc mắt xích cuối (log ghi sau cùng), log cuối chưa có hash thì chuỗi bắt đầu từ đầu
+func chainHead(q interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}) (logcollector.ChainLink, error) {
+	var head logcollector.ChainLink
+	err := q.QueryRow(`SELECT seq, hash FROM archive_logs ORDER BY id DESC LIMIT 1`).Scan(&head.Seq, &head.Hash)
+	if err == sql.ErrNoRows || head.Hash == "" {
+		return logcollector.ChainLink{}, nil
+	}
+	return head, err
+}
+
+// AppendLogs ghi nhiều log trong một transaction, mỗi log được nối vào chuỗi hash theo thứ tự id
+func (r *sqliteLogRepository) AppendLogs(entries []logcollector.ArchiveLogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	head, err := chainHead(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO archive_logs (time, received_at, agent_id, message, fields, source, severity, source_file, seq, prev_hash, hash,
+		time_unix, received_unix) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	fieldStmt, err := tx.Prepare(`INSERT INTO archive_log_fields (log_id, key, value) VALUES (?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer fieldStmt.Close()
+	for _, e := range entries {
+		var fields interface{}
+		if len(e.Fields) > 0 {
+			b, _ := json.Marshal(e.Fields)
+			fields = string(b)
+		}
+		// Hash tính trên đúng dạng sẽ đọc lại (scanLog) để kiểm tra được
+		e.ID, e.ReceivedAt = 0, e.Received()
+		e.Severity = logcollector.SeverityName(logcollector.SeverityRank(e.Severity))
+		head = logcollector.Link(head, &e)
+		res, err := stmt.Exec(e.Time, e.ReceivedAt, e.AgentID, e.Message, fields, e.Source, logcollector.SeverityRank(e.Severity), e.SourceFile,
+			e.Seq, e.PrevHash, e.Hash, logInstant(e.Time), logInstant(e.ReceivedAt))
+		if err != nil {
+			tx.Rollback()
+			logutil.CoreError("LogRepository.AppendLogs: insert failed: %v", err)
+			return err
+		}
+		if len(e.Fields) == 0 {
+			continue
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		for k, v := range e.Fields {
+			if _, err := fieldStmt.Exec(id, k, v); err != nil {
+				tx.Rollback()
+				logutil.CoreError("LogRepository.AppendLogs: insert field failed: %v", err)
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// RotateLog với SQLite không cần xoay vòng file, chỉ xoá log server nhận trước retainAge (trigger dọn FTS và field).
+// Floor của checkpoint cuối không còn khớp cho tới khi CheckpointLog ký lại.
+func (r *sqliteLogRepository) RotateLog() error {
+	if r.retainAge <= 0 {
+		return nil
+	}
+	cutoff := time.Now().Add(-r.retainAge)
+	res, err := r.db.Exec(`DELETE FROM archive_logs WHERE received_unix < ?`, cutoff.Unix())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		logutil.CoreInfo("LogRepository.RotateLog: removed %d logs older than %s", n, cutoff.Format(time.RFC3339))
+		// Checkpoint trước log còn lại sớm nhất không còn gì để đối chiếu; xoá hết log thì chuỗi bắt đầu lại từ seq 1
+		if _, err := r.db.Exec(`DELETE FROM archive_log_checkpoints
+			WHERE seq < COALESCE((SELECT MIN(seq) FROM archive_logs WHERE seq > 0), 9223372036854775807)`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChainFloor đọc seq của log có hash ghi sớm nhất còn lại (log cũ chưa có hash nằm trước chuỗi)
+func (r *sqliteLogRepository) ChainFloor() (int64, error) {
+	var floor int64
+	err := r.db.QueryRow(`SELECT seq FROM archive_logs WHERE hash != '' ORDER BY id LIMIT 1`).Scan(&floor)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return floor, err
+}
+
+// CheckpointLog ký mắt xích cuối cùng floor (seq sớm nhất còn lại) và lưu vào archive_log_checkpoints,
+// trả nil nếu chưa có log mới và retention chưa xoá gì kể từ checkpoint trước
+func (r *sqliteLogRepository) CheckpointLog(key ed25519.PrivateKey) (*logcollector.ChainCheckpoint, error) {
+	head, err := chainHead(r.db)
+	if err != nil || head.Seq == 0 {
+		return nil, err
+	}
+	floor, err := r.ChainFloor()
+	if err != nil {
+		return nil, err
+	}
+	var lastSeq, lastFloor int64
+	err = r.db.QueryRow(`SELECT seq, floor FROM archive_log_checkpoints ORDER BY seq DESC LIMIT 1`).Scan(&lastSeq, &lastFloor)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if err == nil && lastSeq == head.Seq && lastFloor == floor {
+		return nil, nil
+	}
+	cp := logcollector.SignCheckpoint(head, floor, key, time.Now())
+	if _, err := r.db.Exec(`INSERT OR REPLACE INTO archive_log_checkpoints (seq, hash, floor, time, signature) VALUES (?, ?, ?, ?, ?)`,
+		cp.Seq, cp.Hash, cp.Floor, cp.Time, cp.Signature); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// VerifyLogChain duyệt log theo thứ tự id, kiểm tra chuỗi hash và đối chiếu checkpoint
+func (r *sqliteLogRepository) VerifyLogChain(pub ed25519.PublicKey) (*logcollector.ChainReport, error) {
+	rows, err := r.db.Query(`SELECT seq, hash, floor, time, signature FROM archive_log_checkpoints`)
+	if err != nil {
+		return nil, err
+	}
+	var cps []logcollector.ChainCheckpoint
+	for rows.Next() {
+		var c logcollector.ChainCheckpoint
+		if err := rows.Scan(&c.Seq, &c.Hash, &c.Floor, &c.Time, &c.Signature); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		cps = append(cps, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	v := logcollector.NewChainVerifier(cps, pub)
+	rows, err = r.db.Query(`SELECT ` + logColumns + ` FROM archive_logs ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		l, err := scanLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		if v.Add(l) != nil {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return v.Report(), nil
+}
+
+// pageBounds đổi page/pageSize (bắt đầu từ 1) sang LIMIT/OFFSET
+func pageBounds(page, pageSize int) (limit, offset int) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	return pageSize, (page - 1) * pageSize
+}
+
+// ImportArchiveFile đọc file archive JSONL (hoặc segment .gz) theo luồng và ghi vào repo theo từng lô, trả về số log đã import
+func ImportArchiveFile(repo LogRepository, archiveFile string) (int, error) {
+	f, err := logcollector.OpenArchive(archiveFile)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	batch := make([]logcollector.ArchiveLogEntry, 0, importBatchSize)
+	imported := 0
+	for {
+		var entry logcollector.ArchiveLogEntry
+		if err := dec.Decode(&entry); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return imported, err
+		}
+		batch = append(batch, entry)
+		if len(batch) == importBatchSize {
+			if err := repo.AppendLogs(batch); err != nil {
+				return imported, err
+			}
+			imported += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if err := repo.AppendLogs(batch); err != nil {
+		return imported, err
+	}
+	return imported + len(batch), nil
+}
@@ -0,0 +1,635 @@
+package repository
+
+import (
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gou-pc/internal/logcollector"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestLogRepo(t *testing.T) LogRepository {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "logs.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := CreateLogTables(db); err != nil {
+		t.Fatalf("CreateLogTables: %v", err)
+	}
+	return NewSQLiteLogRepository(db, 0)
+}
+
+func TestSQLiteLogRepository(t *testing.T) {
+	repo := newTestLogRepo(t)
+	var entries []logcollector.ArchiveLogEntry
+	for i := 1; i <= 5; i++ {
+		agentID := "001"
+		if i%2 == 0 {
+			agentID = "002"
+		}
+		entries = append(entries, logcollector.ArchiveLogEntry{Time: fmt.Sprint(i), AgentID: agentID, Message: fmt.Sprintf("msg%d", i)})
+	}
+	if err := repo.AppendLogs(entries); err != nil {
+		t.Fatalf("AppendLogs: %v", err)
+	}
+
+	all, err := repo.GetAllLogs()
+	if err != nil || len(all) != 5 || all[0].Message != "msg5" {
+		t.Errorf("GetAllLogs: %v, %+v", err, all)
+	}
+	byAgent, err := repo.GetLogsByAgentID("002")
+	if err != nil || len(byAgent) != 2 || byAgent[0].Message != "msg4" {
+		t.Errorf("GetLogsByAgentID: %v, %+v", err, byAgent)
+	}
+	page, total, err := repo.GetLogsPaged(2, 2)
+	if err != nil || total != 5 || len(page) != 2 || page[0].Message != "msg3" {
+		t.Errorf("GetLogsPaged: %v, total=%d, %+v", err, total, page)
+	}
+	page, total, err = repo.GetLogsPagedByAgentID("001", 1, 2)
+	if err != nil || total != 3 || len(page) != 2 || page[0].Message != "msg5" {
+		t.Errorf("GetLogsPagedByAgentID: %v, total=%d, %+v", err, total, page)
+	}
+	page, _, err = repo.GetLogsPaged(10, 2)
+	if err != nil || len(page) != 0 {
+		t.Errorf("page out of range should be empty: %v, %+v", err, page)
+	}
+}
+
+func TestImportArchiveFile(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "archive.log")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatalf("create archive: %v", err)
+	}
+	enc := json.NewEncoder(f)
+	for i := 0; i < importBatchSize+10; i++ {
+		enc.Encode(logcollector.ArchiveLogEntry{Time: fmt.Sprint(i), AgentID: "001", Message: "m"})
+	}
+	f.Close()
+
+	repo := newTestLogRepo(t)
+	n, err := ImportArchiveFile(repo, archive)
+	if err != nil || n != importBatchSize+10 {
+		t.Fatalf("ImportArchiveFile: n=%d, err=%v", n, err)
+	}
+	_, total, _ := repo.GetLogsPaged(1, 1)
+	if total != n {
+		t.Errorf("expected %d logs in store, got %d", n, total)
+	}
+}
+
+func TestSQLiteSearchLogs(t *testing.T) {
+	repo := newTestLogRepo(t)
+	entries := []logcollector.ArchiveLogEntry{
+		{Time: "2024-06-01T08:00:00+07:00", AgentID: "001", Message: "Login failed for admin"},
+		{Time: "2024-06-01T09:00:00+07:00", AgentID: "002", Message: "login failed for bob"},
+		{Time: "2024-06-02T08:00:00+07:00", AgentID: "001", Message: "Login success"},
+		{Time: "2024-06-02T08:00:00+07:00", AgentID: "003", Message: "disk \"full\" failed"},
+		{Time: "2024-06-03T08:00:00+07:00", AgentID: "001", Message: "login FAILED again"},
+	}
+	if err := repo.AppendLogs(entries); err != nil {
+		t.Fatalf("AppendLogs: %v", err)
+	}
+
+	logs, next, err := repo.SearchLogs(LogQuery{Text: "login failed"})
+	if err != nil || len(logs) != 3 || next != "" || logs[0].Message != "login FAILED again" {
+		t.Errorf("full-text search: %v, next=%q, %+v", err, next, logs)
+	}
+	logs, _, err = repo.SearchLogs(LogQuery{Text: `"full`, AgentIDs: []string{"003"}})
+	if err != nil || len(logs) != 1 {
+		t.Errorf("quoted term should be escaped: %v, %+v", err, logs)
+	}
+	logs, _, err = repo.SearchLogs(LogQuery{From: "2024-06-01T08:30:00+07:00", To: "2024-06-02T23:59:59+07:00", AgentIDs: []string{"001", "002"}})
+	if err != nil || len(logs) != 2 || logs[0].AgentID != "001" || logs[1].AgentID != "002" {
+		t.Errorf("time range + agents: %v, %+v", err, logs)
+	}
+	logs, _, err = repo.SearchLogs(LogQuery{AgentIDs: []string{}})
+	if err != nil || len(logs) != 0 {
+		t.Errorf("empty agent list should match nothing: %v, %+v", err, logs)
+	}
+
+	// Duyệt hết bằng cursor, hai bản ghi cùng time phải được tách bằng id
+	for _, asc := range []bool{false, true} {
+		var got []string
+		q := LogQuery{SortAsc: asc, Limit: 2}
+		for {
+			page, next, err := repo.SearchLogs(q)
+			if err != nil {
+				t.Fatalf("SearchLogs asc=%v: %v", asc, err)
+			}
+			for _, l := range page {
+				got = append(got, l.Message)
+			}
+			if next == "" {
+				break
+			}
+			q.Cursor = next
+		}
+		if len(got) != len(entries) {
+			t.Fatalf("cursor paging asc=%v returned %d logs: %v", asc, len(got), got)
+		}
+		first := entries[len(entries)-1].Message
+		if asc {
+			first = entries[0].Message
+		}
+		if got[0] != first || got[2] == got[3] {
+			t.Errorf("cursor paging asc=%v wrong order: %v", asc, got)
+		}
+	}
+
+	if _, _, err := repo.SearchLogs(LogQuery{Cursor: "%%%"}); err != ErrInvalidCursor {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestCreateLogTablesRebuildsFTS(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "logs.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	// DB cũ chưa có bảng FTS
+	if _, err := db.Exec(`CREATE TABLE archive_logs (id INTEGER PRIMARY KEY AUTOINCREMENT, time TEXT NOT NULL, agent_id TEXT NOT NULL, message TEXT NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO archive_logs (time, agent_id, message) VALUES ('1', '001', 'old usb event')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateLogTables(db); err != nil {
+		t.Fatalf("CreateLogTables: %v", err)
+	}
+	logs, _, err := NewSQLiteLogRepository(db, 0).SearchLogs(LogQuery{Text: "usb"})
+	if err != nil || len(logs) != 1 {
+		t.Errorf("existing logs should be indexed: %v, %+v", err, logs)
+	}
+}
+
+func TestSQLiteLogFieldsAndSource(t *testing.T) {
+	repo := newTestLogRepo(t)
+	entries := []logcollector.ArchiveLogEntry{
+		{Time: "1", AgentID: "001", Message: "Logon failed for user 'alice'.", Fields: map[string]string{"user": "alice", "result": "failed"}},
+		{Time: "2", AgentID: "001", Message: "Logon success for user 'alice'.", Fields: map[string]string{"user": "alice", "result": "success"}},
+		{Time: "3", AgentID: "002", Message: "no fields", Source: "event"},
+	}
+	if err := repo.AppendLogs(entries); err != nil {
+		t.Fatalf("AppendLogs: %v", err)
+	}
+	logs, _, err := repo.SearchLogs(LogQuery{Fields: map[string]string{"user": "alice", "result": "failed"}})
+	if err != nil || len(logs) != 1 || logs[0].Time != "1" || logs[0].Fields["result"] != "failed" {
+		t.Errorf("filter by fields: %v, %+v", err, logs)
+	}
+	logs, _, err = repo.SearchLogs(LogQuery{Sources: []string{"event"}})
+	if err != nil || len(logs) != 1 || logs[0].Source != "event" {
+		t.Errorf("filter by source: %v, %+v", err, logs)
+	}
+	all, err := repo.GetAllLogs()
+	if err != nil || len(all) != 3 || all[0].Fields != nil || all[1].Fields["user"] != "alice" {
+		t.Errorf("GetAllLogs should return fields: %v, %+v", err, all)
+	}
+}
+
+func TestSQLiteRotateLogRetention(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "logs.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := CreateLogTables(db); err != nil {
+		t.Fatalf("CreateLogTables: %v", err)
+	}
+	repo := NewSQLiteLogRepository(db, 24*time.Hour)
+	now := time.Now()
+	entries := []logcollector.ArchiveLogEntry{
+		{Time: now.Add(-48 * time.Hour).Format(time.RFC3339), AgentID: "001", Message: "old usb event", Fields: map[string]string{"user": "alice"}},
+		{Time: now.Format(time.RFC3339), AgentID: "001", Message: "new usb event"},
+	}
+	if err := repo.AppendLogs(entries); err != nil {
+		t.Fatalf("AppendLogs: %v", err)
+	}
+	if err := repo.RotateLog(); err != nil {
+		t.Fatalf("RotateLog: %v", err)
+	}
+	logs, _, err := repo.SearchLogs(LogQuery{Text: "usb"})
+	if err != nil || len(logs) != 1 || logs[0].Message != "new usb event" {
+		t.Errorf("logs older than retainAge should be removed: %v, %+v", err, logs)
+	}
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM archive_log_fields`).Scan(&n)
+	if n != 0 {
+		t.Errorf("fields of removed logs should be removed, got %d", n)
+	}
+}
+
+func TestExportLogs(t *testing.T) {
+	entries := []logcollector.ArchiveLogEntry{
+		{Time: "2024-06-01T10:00:00+07:00", AgentID: "001", Message: "login failed alice"},
+		{Time: "2024-06-01T09:00:00+07:00", AgentID: "002", Message: "login failed bob"},
+		{Time: "2024-06-02T09:00:00+07:00", AgentID: "001", Message: "login failed carol"},
+		{Time: "2024-06-03T09:00:00+07:00", AgentID: "001", Message: "usb inserted"},
+	}
+	archive := filepath.Join(t.TempDir(), "archive.log")
+	fileRepo := NewFileLogRepository(archive, logcollector.RotationPolicy{MaxSize: 1})
+	for name, repo := range map[string]LogRepository{"sqlite": newTestLogRepo(t), "file": fileRepo} {
+		t.Run(name, func(t *testing.T) {
+			if err := repo.AppendLogs(entries[:2]); err != nil {
+				t.Fatal(err)
+			}
+			// File store: hai log đầu nằm trong segment .gz
+			if err := repo.RotateLog(); err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.AppendLogs(entries[2:]); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			q := LogQuery{Text: "failed", AgentIDs: []string{"001"}, To: "2024-06-02T23:59:59+07:00", SortAsc: true, Limit: 1}
+			err := repo.ExportLogs(q, func(l logcollector.ArchiveLogEntry) error {
+				got = append(got, l.Message)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("ExportLogs: %v", err)
+			}
+			if len(got) != 2 || got[0] != "login failed alice" || got[1] != "login failed carol" {
+				t.Errorf("unexpected export: %v", got)
+			}
+			if name == "file" {
+				if segs, _ := logcollector.Segments(archive); len(segs) != 1 {
+					t.Errorf("expected one segment, got %v", segs)
+				}
+				// File store chỉ xuất theo thứ tự ghi, thứ tự khác phải nạp hết vào bộ nhớ nên bị từ chối
+				for _, bad := range []LogQuery{{SortBy: LogSortTime, SortAsc: true}, {SortBy: LogSortSeverity, SortAsc: true}, {SortBy: LogSortReceived}} {
+					if err := repo.ExportLogs(bad, func(logcollector.ArchiveLogEntry) error { return nil }); !errors.Is(err, ErrExportSortUnsupported) {
+						t.Errorf("ExportLogs(%s asc=%v) = %v, want ErrExportSortUnsupported", bad.SortBy, bad.SortAsc, err)
+					}
+				}
+			}
+
+			stop := fmt.Errorf("stop")
+			n := 0
+			err = repo.ExportLogs(LogQuery{SortAsc: true}, func(logcollector.ArchiveLogEntry) error {
+				n++
+				return stop
+			})
+			if err != stop || n != 1 {
+				t.Errorf("callback error should stop export: err=%v n=%d", err, n)
+			}
+		})
+	}
+}
+
+func TestLogEventMetadata(t *testing.T) {
+	entries := []logcollector.ArchiveLogEntry{
+		{Time: "2024-06-01T08:00:00+07:00", ReceivedAt: "2024-06-02T08:00:00+07:00", AgentID: "001", Message: "late upload", Severity: "error", SourceFile: "/var/log/app.log"},
+		{Time: "2024-06-01T09:00:00+07:00", ReceivedAt: "2024-06-01T09:00:01+07:00", AgentID: "001", Message: "debug noise", Severity: "debug", SourceFile: "/var/log/app.log"},
+		{Time: "2024-06-01T10:00:00+07:00", ReceivedAt: "2024-06-01T10:00:01+07:00", AgentID: "002", Message: "disk full", Severity: "critical", SourceFile: "/var/log/sys.log"},
+		{Time: "2024-06-01T11:00:00+07:00", AgentID: "002", Message: "old entry without severity"},
+		{Time: "2024-06-01T12:00:00+07:00", ReceivedAt: "2024-06-01T12:00:01+07:00", AgentID: "001", Message: "retry failed", Severity: "error"},
+	}
+	archive := filepath.Join(t.TempDir(), "archive.log")
+	for name, repo := range map[string]LogRepository{"sqlite": newTestLogRepo(t), "file": NewFileLogRepository(archive, logcollector.RotationPolicy{})} {
+		t.Run(name, func(t *testing.T) {
+			if err := repo.AppendLogs(entries); err != nil {
+				t.Fatal(err)
+			}
+			logs, _, err := repo.SearchLogs(LogQuery{SourceFiles: []string{"/var/log/app.log"}})
+			if err != nil || len(logs) != 2 || logs[0].Message != "debug noise" || logs[1].ReceivedAt != entries[0].ReceivedAt {
+				t.Errorf("filter by source_file: %v, %+v", err, logs)
+			}
+			logs, _, err = repo.SearchLogs(LogQuery{MinSeverity: "error"})
+			if err != nil || len(logs) != 3 {
+				t.Errorf("min severity should skip lower and unknown levels: %v, %+v", err, logs)
+			}
+			logs, _, err = repo.SearchLogs(LogQuery{Severities: []string{"debug", "critical"}})
+			if err != nil || len(logs) != 2 || logs[0].Severity != "critical" {
+				t.Errorf("filter by severities: %v, %+v", err, logs)
+			}
+			// Log nhận trễ: theo time thì nằm trong khoảng, theo received_at thì không
+			q := LogQuery{From: "2024-06-01T07:00:00+07:00", To: "2024-06-01T08:30:00+07:00"}
+			if logs, _, _ := repo.SearchLogs(q); len(logs) != 1 {
+				t.Errorf("time range on event time: %+v", logs)
+			}
+			q.TimeField = LogSortReceived
+			if logs, _, _ := repo.SearchLogs(q); len(logs) != 0 {
+				t.Errorf("time range on received_at: %+v", logs)
+			}
+			logs, _, _ = repo.SearchLogs(LogQuery{AgentIDs: []string{"002"}, TimeField: LogSortReceived, To: "2024-06-01T11:00:00+07:00"})
+			if len(logs) != 2 || logs[0].Received() != entries[3].Time {
+				t.Errorf("received_at should fall back to time: %+v", logs)
+			}
+
+			// Sắp xếp theo severity nặng nhất trước, duyệt bằng cursor; cùng mức thì id lớn trước
+			var got []string
+			q = LogQuery{SortBy: LogSortSeverity, Limit: 2}
+			for {
+				page, next, err := repo.SearchLogs(q)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, l := range page {
+					got = append(got, l.Message)
+				}
+				if next == "" {
+					break
+				}
+				q.Cursor = next
+			}
+			want := []string{"disk full", "retry failed", "late upload", "debug noise", "old entry without severity"}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("severity order = %v, want %v", got, want)
+			}
+			if _, _, err := repo.SearchLogs(LogQuery{Cursor: q.Cursor}); q.Cursor != "" && err != ErrInvalidCursor {
+				t.Errorf("cursor of another sort should be rejected, got %v", err)
+			}
+
+			page, total, err := repo.ListLogs(LogQuery{SortBy: LogSortReceived, SortAsc: true}, 2, 2)
+			if err != nil || total != 5 || len(page) != 2 || page[0].Message != "old entry without severity" || page[1].Message != "retry failed" {
+				t.Errorf("ListLogs by received_at: %v, total=%d, %+v", err, total, page)
+			}
+			all, total, err := repo.ListLogs(LogQuery{AgentIDs: []string{"001"}}, 1, 0)
+			if err != nil || total != 3 || len(all) != 3 || all[0].Message != "retry failed" {
+				t.Errorf("ListLogs without page size: %v, total=%d, %+v", err, total, all)
+			}
+		})
+	}
+}
+
+func TestCreateLogTablesBackfillsReceivedAt(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "logs.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE archive_logs (id INTEGER PRIMARY KEY AUTOINCREMENT, time TEXT NOT NULL, agent_id TEXT NOT NULL, message TEXT NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO archive_logs (time, agent_id, message) VALUES ('2024-06-01T08:00:00+07:00', '001', 'old')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateLogTables(db); err != nil {
+		t.Fatalf("CreateLogTables: %v", err)
+	}
+	logs, _, err := NewSQLiteLogRepository(db, 0).SearchLogs(LogQuery{TimeField: LogSortReceived, From: "2024-06-01T00:00:00+07:00"})
+	if err != nil || len(logs) != 1 || logs[0].ReceivedAt != "2024-06-01T08:00:00+07:00" || logs[0].Severity != "" {
+		t.Errorf("old logs should get received_at = time: %v, %+v", err, logs)
+	}
+}
+
+func TestSQLiteLogChain(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "logs.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	// Log cũ ghi trước khi có chuỗi hash
+	if _, err := db.Exec(`CREATE TABLE archive_logs (id INTEGER PRIMARY KEY AUTOINCREMENT, time TEXT NOT NULL, agent_id TEXT NOT NULL, message TEXT NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	db.Exec(`INSERT INTO archive_logs (time, agent_id, message) VALUES ('2024-06-01T08:00:00+07:00', '001', 'legacy')`)
+	if err := CreateLogTables(db); err != nil {
+		t.Fatal(err)
+	}
+	repo := NewSQLiteLogRepository(db, 0)
+	_, key, _ := ed25519.GenerateKey(nil)
+	pub := key.Public().(ed25519.PublicKey)
+	if r, err := repo.VerifyLogChain(pub); err != nil || !r.OK || r.Unchained != 1 {
+		t.Fatalf("legacy rows without checkpoints should verify: %+v, %v", r, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := repo.AppendLogs([]logcollector.ArchiveLogEntry{
+			{Time: "2024-06-01T09:00:00+07:00", AgentID: "001", Message: fmt.Sprintf("a%d", i), Severity: "warn", Fields: map[string]string{"k": "v"}},
+			{Time: "2024-06-01T09:00:01+07:00", AgentID: "002", Message: fmt.Sprintf("b%d", i), Fields: map[string]string{}},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if cp, err := repo.CheckpointLog(key); err != nil || cp == nil || cp.Seq != int64(2*i+2) {
+			t.Fatalf("CheckpointLog: %+v, %v", cp, err)
+		}
+	}
+	if cp, _ := repo.CheckpointLog(key); cp != nil {
+		t.Errorf("no new log, checkpoint should be skipped: %+v", cp)
+	}
+	// Đã có checkpoint thì log chưa có hash bị coi là đứt (có thể là log đã bị bỏ hash)
+	r, err := repo.VerifyLogChain(pub)
+	if err != nil || r.OK || r.Break.ID != 1 || !strings.Contains(r.Break.Reason, "entry without hash") {
+		t.Fatalf("legacy row with checkpoints should break chain: %+v, %v", r, err)
+	}
+	db.Exec(`DELETE FROM archive_logs WHERE hash = ''`)
+	r, err = repo.VerifyLogChain(pub)
+	if err != nil || !r.OK || r.Entries != 4 || r.Unchained != 0 || r.LastSeq != 4 || r.Checkpoints != 2 {
+		t.Fatalf("untouched store should verify: %+v, %v", r, err)
+	}
+
+	db.Exec(`UPDATE archive_logs SET message = 'edited' WHERE seq = 2`)
+	r, _ = repo.VerifyLogChain(pub)
+	if r.OK || r.Break.Seq != 2 || r.Break.ID != 3 || !strings.Contains(r.Break.Reason, "hash mismatch") {
+		t.Errorf("modified row should break chain: %+v", r.Break)
+	}
+	db.Exec(`UPDATE archive_logs SET message = 'b0' WHERE seq = 2`)
+	db.Exec(`DELETE FROM archive_logs WHERE seq = 4`)
+	r, _ = repo.VerifyLogChain(pub)
+	if r.OK || !strings.Contains(r.Break.Reason, "entries missing") {
+		t.Errorf("removed tail should be reported: %+v", r.Break)
+	}
+	db.Exec(`DELETE FROM archive_logs WHERE seq = 2`)
+	r, _ = repo.VerifyLogChain(pub)
+	if r.OK || r.Break.Seq != 3 || !strings.Contains(r.Break.Reason, "sequence gap") {
+		t.Errorf("removed row should break chain: %+v", r.Break)
+	}
+}
+
+func TestSQLiteLogChainFloor(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "logs.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if err := CreateLogTables(db); err != nil {
+		t.Fatal(err)
+	}
+	repo := NewSQLiteLogRepository(db, 0)
+	_, key, _ := ed25519.GenerateKey(nil)
+	pub := key.Public().(ed25519.PublicKey)
+	for i := 0; i < 4; i++ {
+		if err := repo.AppendLogs([]logcollector.ArchiveLogEntry{{Time: "2024-06-01T09:00:00+07:00", AgentID: "001", Message: fmt.Sprint(i)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if cp, err := repo.CheckpointLog(key); err != nil || cp == nil || cp.Seq != 4 || cp.Floor != 1 {
+		t.Fatalf("CheckpointLog: %+v, %v", cp, err)
+	}
+
+	// Bỏ hash phần đầu: log có hash đầu tiên không khớp floor đã ký
+	db.Exec(`UPDATE archive_logs SET seq = 0, prev_hash = '', hash = '' WHERE seq = 1`)
+	r, _ := repo.VerifyLogChain(pub)
+	if r.OK || r.Break.ID != 1 || !strings.Contains(r.Break.Reason, "entry without hash") {
+		t.Errorf("stripped prefix should break chain: %+v", r.Break)
+	}
+	// Xoá phần đầu mà không ký lại floor
+	db.Exec(`DELETE FROM archive_logs WHERE id = 1`)
+	r, _ = repo.VerifyLogChain(pub)
+	if r.OK || r.Break.Seq != 2 || !strings.Contains(r.Break.Reason, "retention floor") {
+		t.Errorf("deleted prefix should break chain: %+v", r.Break)
+	}
+	// Retention ký lại checkpoint với floor mới thì chuỗi hợp lệ trở lại
+	if floor, err := repo.ChainFloor(); err != nil || floor != 2 {
+		t.Fatalf("ChainFloor: %d, %v", floor, err)
+	}
+	if cp, err := repo.CheckpointLog(key); err != nil || cp == nil || cp.Seq != 4 || cp.Floor != 2 {
+		t.Fatalf("floor changed, checkpoint should be signed again: %+v, %v", cp, err)
+	}
+	if r, _ := repo.VerifyLogChain(pub); !r.OK || r.FirstSeq != 2 || r.Entries != 3 {
+		t.Errorf("pruned head with signed floor should verify: %+v", r)
+	}
+}
+
+func TestLogStats(t *testing.T) {
+	entries := []logcollector.ArchiveLogEntry{
+		{Time: "2024-06-01T10:01:10+07:00", AgentID: "001", Message: "Logon failed for user 'bob' from 10.0.0.5", Severity: "error"},
+		{Time: "2024-06-01T10:01:50+07:00", AgentID: "001", Message: "Logon failed for user 'alice' from 10.0.0.9", Severity: "error"},
+		{Time: "2024-06-01T10:02:00+07:00", AgentID: "002", Message: "disk usage 91%", Severity: "warning"},
+		{Time: "2024-06-01T11:30:00+07:00", AgentID: "001", Message: "disk usage 95%", Severity: "critical"},
+		{Time: "2024-06-02T09:00:00+07:00", AgentID: "002", Message: "service started"},
+	}
+	archive := filepath.Join(t.TempDir(), "archive.log")
+	for name, repo := range map[string]LogRepository{"sqlite": newTestLogRepo(t), "file": NewFileLogRepository(archive, logcollector.RotationPolicy{})} {
+		t.Run(name, func(t *testing.T) {
+			if err := repo.AppendLogs(entries); err != nil {
+				t.Fatal(err)
+			}
+			vol, err := repo.LogVolume(LogQuery{}, LogBucketMinute)
+			want := []LogVolumePoint{
+				{Time: "2024-06-01T10:01:00+07:00", AgentID: "001", Count: 2},
+				{Time: "2024-06-01T10:02:00+07:00", AgentID: "002", Count: 1},
+				{Time: "2024-06-01T11:30:00+07:00", AgentID: "001", Count: 1},
+				{Time: "2024-06-02T09:00:00+07:00", AgentID: "002", Count: 1},
+			}
+			if err != nil || fmt.Sprint(vol) != fmt.Sprint(want) {
+				t.Errorf("volume per minute: %v, %+v", err, vol)
+			}
+			vol, _ = repo.LogVolume(LogQuery{To: "2024-06-01T23:59:59+07:00"}, LogBucketDay)
+			if len(vol) != 2 || vol[0] != (LogVolumePoint{Time: "2024-06-01T00:00:00+07:00", AgentID: "001", Count: 3}) {
+				t.Errorf("volume per day: %+v", vol)
+			}
+			if _, err := repo.LogVolume(LogQuery{}, "week"); err != ErrInvalidBucket {
+				t.Errorf("invalid bucket: %v", err)
+			}
+
+			top, err := repo.TopMessages(LogQuery{}, 2, true)
+			if err != nil || len(top) != 2 || top[0].Message != "Logon failed for user <str> from <ip>" || top[0].Count != 2 ||
+				top[0].Example == "" || top[1].Message != "disk usage <num>%" {
+				t.Errorf("top templates: %v, %+v", err, top)
+			}
+			top, _ = repo.TopMessages(LogQuery{AgentIDs: []string{"002"}}, 10, false)
+			if len(top) != 2 || top[0] != (MessageCount{Message: "disk usage 91%", Count: 1}) {
+				t.Errorf("top exact messages: %+v", top)
+			}
+
+			rate, err := repo.ErrorRate(LogQuery{}, LogBucketHour, "")
+			if err != nil || len(rate) != 3 || rate[0] != (ErrorRatePoint{Time: "2024-06-01T10:00:00+07:00", Total: 3, Errors: 2, Rate: 2.0 / 3}) ||
+				rate[1].Rate != 1 || rate[2].Errors != 0 {
+				t.Errorf("error rate: %v, %+v", err, rate)
+			}
+			rate, _ = repo.ErrorRate(LogQuery{}, LogBucketDay, "warning")
+			if len(rate) != 2 || rate[0].Errors != 4 {
+				t.Errorf("error rate with warning threshold: %+v", rate)
+			}
+		})
+	}
+}
+
+func TestMessageTemplate(t *testing.T) {
+	for msg, want := range map[string]string{
+		"Logon failed for user 'bob' from 10.0.0.5:3389":          "Logon failed for user <str> from <ip>",
+		"can't open file \"C:\\data\\a.txt\"":                     "can't open file <str>",
+		"request 6f1c2a9e-1b2c-4d5e-8f90-a1b2c3d4e5f6 took 120ms": "request <uuid> took <num>ms",
+		"crash at 0x7ffe12 hash deadbeef01 in module facade":      "crash at <hex> hash <hex> in module facade",
+		"adapter 00:1a:2b:3c:4d:5e link up after 3 retries":       "adapter <mac> link up after <num> retries",
+	} {
+		if got := MessageTemplate(msg); got != want {
+			t.Errorf("MessageTemplate(%q) = %q, want %q", msg, got, want)
+		}
+	}
+}
+
+func TestLogTimeMixedOffsets(t *testing.T) {
+	// Cùng một ngày nhưng khác offset: so chuỗi sẽ xếp "04:00Z" trước "10:00+07:00" (03:00Z)
+	entries := []logcollector.ArchiveLogEntry{
+		{Time: "2024-06-01T10:00:00+07:00", ReceivedAt: "2024-06-01T10:00:05+07:00", AgentID: "001", Message: "first"},
+		{Time: "2024-06-01T04:00:00Z", ReceivedAt: "2024-06-01T04:00:05Z", AgentID: "001", Message: "second"},
+		{Time: "2024-06-01T06:30:00+02:00", ReceivedAt: "2024-06-01T06:30:05+02:00", AgentID: "001", Message: "third"},
+	}
+	fileRepo := NewFileLogRepository(filepath.Join(t.TempDir(), "archive.log"), logcollector.RotationPolicy{})
+	for name, repo := range map[string]LogRepository{"sqlite": newTestLogRepo(t), "file": fileRepo} {
+		t.Run(name, func(t *testing.T) {
+			if err := repo.AppendLogs(entries); err != nil {
+				t.Fatal(err)
+			}
+			messages := func(q LogQuery) string {
+				t.Helper()
+				var got []string
+				for {
+					page, next, err := repo.SearchLogs(q)
+					if err != nil {
+						t.Fatalf("SearchLogs(%+v): %v", q, err)
+					}
+					for _, l := range page {
+						got = append(got, l.Message)
+					}
+					if next == "" {
+						return strings.Join(got, ",")
+					}
+					q.Cursor = next
+				}
+			}
+			for _, tc := range []struct {
+				q    LogQuery
+				want string
+			}{
+				{LogQuery{SortAsc: true, Limit: 1}, "first,second,third"},
+				{LogQuery{SortBy: LogSortReceived, Limit: 2}, "third,second,first"},
+				{LogQuery{From: "2024-06-01T03:30:00Z", SortAsc: true}, "second,third"},
+				{LogQuery{To: "2024-06-01T11:00:00+07:00", SortAsc: true}, "first,second"},
+				{LogQuery{TimeField: LogSortReceived, From: "2024-06-01T11:00:05+07:00", To: "2024-06-01T04:30:05Z", SortAsc: true}, "second,third"},
+			} {
+				if got := messages(tc.q); got != tc.want {
+					t.Errorf("%+v: got %s, want %s", tc.q, got, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateLogTablesBackfillsLogInstants(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "logs.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE archive_logs (id INTEGER PRIMARY KEY AUTOINCREMENT, time TEXT NOT NULL, agent_id TEXT NOT NULL, message TEXT NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO archive_logs (time, agent_id, message) VALUES
+		('2024-06-01T10:00:00+07:00', '001', 'first'), ('2024-06-01T04:00:00Z', '001', 'second')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateLogTables(db); err != nil {
+		t.Fatalf("CreateLogTables: %v", err)
+	}
+	logs, _, err := NewSQLiteLogRepository(db, 0).SearchLogs(LogQuery{From: "2024-06-01T03:30:00Z", SortAsc: true})
+	if err != nil || len(logs) != 1 || logs[0].Message != "second" {
+		t.Errorf("old logs should be filtered by instant after backfill: %v, %+v", err, logs)
+	}
+	if err := CreateLogTables(db); err != nil {
+		t.Fatalf("CreateLogTables twice: %v", err)
+	}
+}
@@ -0,0 +1,238 @@
+package repository
+
+import (
+	"errors"
+	"gou-pc/internal/logcollector"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Độ rộng khoảng thời gian khi thống kê log
+const (
+	LogBucketMinute = "minute"
+	LogBucketHour   = "hour"
+	LogBucketDay    = "day"
+)
+
+// ErrInvalidBucket trả về khi bucket không phải LogBucketMinute/Hour/Day
+var ErrInvalidBucket = errors.New("invalid bucket")
+
+// LogVolumePoint là số log của một agent trong một khoảng thời gian
+type LogVolumePoint struct {
+	Time    string `json:"time"` // đầu khoảng, RFC3339
+	AgentID string `json:"agent_id"`
+	Count   int    `json:"count"`
+}
+
+// MessageCount là số lần một message (hoặc mẫu message) xuất hiện
+type MessageCount struct {
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+	Example string `json:"example,omitempty"` // một message thực tế khớp mẫu, chỉ có khi gom theo mẫu
+}
+
+// ErrorRatePoint là tỉ lệ log lỗi trong một khoảng thời gian
+type ErrorRatePoint struct {
+	Time   string  `json:"time"` // đầu khoảng, RFC3339
+	Total  int     `json:"total"`
+	Errors int     `json:"errors"`
+	Rate   float64 `json:"rate"` // Errors / Total
+}
+
+// bucketPrefixLen là số ký tự đầu của thời gian RFC3339 giống nhau trong cùng khoảng
+// (2006-01-02T15:04 / 2006-01-02T15 / 2006-01-02)
+func bucketPrefixLen(bucket string) (int, error) {
+	switch bucket {
+	case LogBucketMinute:
+		return 16, nil
+	case LogBucketHour:
+		return 13, nil
+	case LogBucketDay:
+		return 10, nil
+	}
+	return 0, ErrInvalidBucket
+}
+
+// bucketStart trả về đầu khoảng chứa thời điểm t (RFC3339), giữ nguyên múi giờ của t; rỗng nếu t không đúng định dạng
+func bucketStart(t string, n int) string {
+	if len(t) < 20 || t[10] != 'T' {
+		return ""
+	}
+	zone := t[19:]
+	if zone[0] == '.' {
+		zone = strings.TrimLeft(zone[1:], "0123456789")
+	}
+	return t[:n] + "T00:00:00"[n-10:] + zone
+}
+
+// errorThreshold là mức độ thấp nhất được tính là lỗi, rỗng = "error"
+func errorThreshold(minSeverity string) int {
+	if minSeverity == "" {
+		minSeverity = "error"
+	}
+	return logcollector.SeverityRank(minSeverity)
+}
+
+// Các phần biến đổi trong message được thay bằng placeholder để gom message cùng mẫu, theo thứ tự áp dụng
+var messageTemplateRules = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`(^|[^\pL\d])('[^']*'|"[^"]*")`), "${1}<str>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}(:\d+)?\b`), "<ip>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{2}([:-][0-9a-f]{2}){5}\b`), "<mac>"},
+	{regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b`), "<hex>"},
+}
+
+// hexWord là chuỗi hex dài (hash, địa chỉ, id), chỉ thay khi có cả chữ và số để không nuốt từ thường
+var hexWord = regexp.MustCompile(`(?i)\b[0-9a-f]{6,}\b`)
+
+var number = regexp.MustCompile(`\d+`)
+
+// MessageTemplate đổi message về mẫu: chuỗi trong nháy, UUID, IP, MAC, số hex và số được thay bằng placeholder,
+// vd "Logon failed for user 'bob' from 10.0.0.5" -> "Logon failed for user <str> from <ip>"
+func MessageTemplate(msg string) string {
+	for _, r := range messageTemplateRules {
+		msg = r.re.ReplaceAllString(msg, r.repl)
+	}
+	msg = hexWord.ReplaceAllStringFunc(msg, func(w string) string {
+		if strings.IndexAny(w, "0123456789") < 0 || strings.Trim(w, "0123456789") == "" {
+			return w
+		}
+		return "<hex>"
+	})
+	return number.ReplaceAllString(msg, "<num>")
+}
+
+// statsAggregator gom số liệu thống kê từ luồng log (log store file, mẫu message của SQLite),
+// bộ nhớ tỉ lệ với số khoảng/message khác nhau chứ không với số log
+type statsAggregator struct {
+	volume   map[[2]string]int
+	rate     map[string]*ErrorRatePoint
+	messages map[string]*MessageCount
+}
+
+func newStatsAggregator() *statsAggregator {
+	return &statsAggregator{volume: map[[2]string]int{}, rate: map[string]*ErrorRatePoint{}, messages: map[string]*MessageCount{}}
+}
+
+func (a *statsAggregator) addVolume(t, agentID string, n int) {
+	if b := bucketStart(t, n); b != "" {
+		a.volume[[2]string{b, agentID}]++
+	}
+}
+
+func (a *statsAggregator) addRate(t string, n int, isError bool) {
+	b := bucketStart(t, n)
+	if b == "" {
+		return
+	}
+	p := a.rate[b]
+	if p == nil {
+		p = &ErrorRatePoint{Time: b}
+		a.rate[b] = p
+	}
+	p.Total++
+	if isError {
+		p.Errors++
+	}
+}
+
+func (a *statsAggregator) addMessage(msg string, templates bool) {
+	key := msg
+	if templates {
+		key = MessageTemplate(msg)
+	}
+	m := a.messages[key]
+	if m == nil {
+		m = &MessageCount{Message: key}
+		if templates {
+			m.Example = msg
+		}
+		a.messages[key] = m
+	}
+	m.Count++
+}
+
+// volumePoints trả về số log theo (khoảng, agent) tăng dần
+func (a *statsAggregator) volumePoints() []LogVolumePoint {
+	points := make([]LogVolumePoint, 0, len(a.volume))
+	for k, c := range a.volume {
+		points = append(points, LogVolumePoint{Time: k[0], AgentID: k[1], Count: c})
+	}
+	sortVolumePoints(points)
+	return points
+}
+
+// ratePoints trả về tỉ lệ lỗi theo khoảng tăng dần
+func (a *statsAggregator) ratePoints() []ErrorRatePoint {
+	points := make([]ErrorRatePoint, 0, len(a.rate))
+	for _, p := range a.rate {
+		p.Rate = float64(p.Errors) / float64(p.Total)
+		points = append(points, *p)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Time < points[j].Time })
+	return points
+}
+
+// topMessages trả về n message xuất hiện nhiều nhất, cùng số lần thì theo thứ tự chữ cái
+func (a *statsAggregator) topMessages(n int) []MessageCount {
+	top := make([]MessageCount, 0, len(a.messages))
+	for _, m := range a.messages {
+		top = append(top, *m)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Message < top[j].Message
+	})
+	if n > 0 && len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+func sortVolumePoints(points []LogVolumePoint) {
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].Time != points[j].Time {
+			return points[i].Time < points[j].Time
+		}
+		return points[i].AgentID < points[j].AgentID
+	})
+}
+
+// timeOf là thời gian của entry theo TimeField của query
+func (q LogQuery) timeOf(e logcollector.ArchiveLogEntry) string {
+	if q.TimeField == LogSortReceived {
+		return e.Received()
+	}
+	return e.Time
+}
+
+// timeColumn là cột thời gian SQLite theo TimeField của query
+func (q LogQuery) timeColumn() string {
+	if q.TimeField == LogSortReceived {
+		return LogSortReceived
+	}
+	return LogSortTime
+}
+
+// instantColumn là cột unix giây SQLite theo TimeField của query, dùng lọc From/To
+func (q LogQuery) instantColumn() string {
+	return sortColumn(q.TimeField)
+}
+
+// sortColumn là cột SQLite so sánh được của trường sắp xếp/thời gian: thời gian lưu dạng unix giây
+// (time_unix, received_unix), severity là thứ hạng
+func sortColumn(field string) string {
+	switch field {
+	case LogSortReceived:
+		return "received_unix"
+	case LogSortSeverity:
+		return "severity"
+	}
+	return "time_unix"
+}
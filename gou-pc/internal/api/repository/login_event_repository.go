@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"database/sql"
+	"gou-pc/internal/api/model"
+	"strings"
+)
+
+// LoginEventFilter lọc sự kiện đăng nhập, trường rỗng thì bỏ qua
+type LoginEventFilter struct {
+	AgentIDs  []string // nil: mọi thiết bị; slice rỗng (không nil): không thiết bị nào
+	Usernames []string // tài khoản Windows, không phân biệt hoa thường
+	Result    string
+	Method    string
+	From      string // RFC3339, bao gồm
+	To        string // RFC3339, bao gồm
+}
+
+type LoginEventRepository interface {
+	LoginEventCreate(e *model.LoginEvent) error
+	// LoginEventList trả về một trang (page bắt đầu từ 1) sự kiện mới nhất trước cùng tổng số sự kiện khớp,
+	// pageSize <= 0 thì trả về tất cả
+	LoginEventList(f LoginEventFilter, page, pageSize int) ([]model.LoginEvent, int, error)
+}
+
+type sqliteLoginEventRepository struct {
+	db *sql.DB
+}
+
+// CreateLoginEventTables tạo bảng login_events nếu chưa có
+func CreateLoginEventTables(db *sql.DB) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS login_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			agent_id TEXT NOT NULL,
+			username TEXT NOT NULL COLLATE NOCASE,
+			result TEXT NOT NULL,
+			method TEXT NOT NULL DEFAULT '',
+			reason TEXT NOT NULL DEFAULT '',
+			time TEXT NOT NULL,
+			received_at TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_login_events_time ON login_events(time)`,
+		`CREATE INDEX IF NOT EXISTS idx_login_events_agent ON login_events(agent_id, time)`,
+		`CREATE INDEX IF NOT EXISTS idx_login_events_username ON login_events(username, time)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func NewSQLiteLoginEventRepository(db *sql.DB) LoginEventRepository {
+	return &sqliteLoginEventRepository{db: db}
+}
+
+const loginEventColumns = `id, agent_id, username, result, method, reason, time, received_at`
+
+func (r *sqliteLoginEventRepository) LoginEventCreate(e *model.LoginEvent) error {
+	res, err := r.db.Exec(`INSERT INTO login_events (agent_id, username, result, method, reason, time, received_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		e.AgentID, e.Username, e.Result, e.Method, e.Reason, e.Time, e.ReceivedAt)
+	if err != nil {
+		return err
+	}
+	e.ID, err = res.LastInsertId()
+	return err
+}
+
+func (r *sqliteLoginEventRepository) LoginEventList(f LoginEventFilter, page, pageSize int) ([]model.LoginEvent, int, error) {
+	events := []model.LoginEvent{}
+	if f.AgentIDs != nil && len(f.AgentIDs) == 0 {
+		return events, 0, nil
+	}
+	var where []string
+	var args []interface{}
+	in := func(col string, values []string) {
+		where = append(where, col+` IN (?`+strings.Repeat(", ?", len(values)-1)+`)`)
+		for _, v := range values {
+			args = append(args, v)
+		}
+	}
+	if len(f.AgentIDs) > 0 {
+		in(`agent_id`, f.AgentIDs)
+	}
+	if len(f.Usernames) > 0 {
+		in(`username`, f.Usernames)
+	}
+	if f.Result != "" {
+		where = append(where, `result = ?`)
+		args = append(args, f.Result)
+	}
+	if f.Method != "" {
+		where = append(where, `method = ?`)
+		args = append(args, f.Method)
+	}
+	if f.From != "" {
+		where = append(where, `time >= ?`)
+		args = append(args, f.From)
+	}
+	if f.To != "" {
+		where = append(where, `time <= ?`)
+		args = append(args, f.To)
+	}
+	var total int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM login_events`+whereClause(where), args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	query := `SELECT ` + loginEventColumns + ` FROM login_events` + whereClause(where) + ` ORDER BY time DESC, id DESC`
+	if pageSize > 0 {
+		limit, offset := pageBounds(page, pageSize)
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, limit, offset)
+	}
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e model.LoginEvent
+		if err := rows.Scan(&e.ID, &e.AgentID, &e.Username, &e.Result, &e.Method, &e.Reason, &e.Time, &e.ReceivedAt); err != nil {
+			return nil, 0, err
+		}
+		events = append(events, e)
+	}
+	return events, total, rows.Err()
+}
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"database/sql"
+	"gou-pc/internal/api/model"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoginEventList(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "clients.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := CreateLoginEventTables(db); err != nil {
+		t.Fatal(err)
+	}
+	repo := NewSQLiteLoginEventRepository(db)
+	for _, e := range []model.LoginEvent{
+		{AgentID: "001", Username: "bob", Result: "failed", Method: "otp", Reason: "incorrect secret code", Time: "2024-06-01T08:00:00+07:00"},
+		{AgentID: "001", Username: "bob", Result: "success", Method: "otp", Time: "2024-06-01T08:01:00+07:00"},
+		{AgentID: "002", Username: "alice", Result: "success", Method: "offline", Time: "2024-06-02T09:00:00+07:00"},
+		{AgentID: "002", Username: "Bob", Result: "failed", Method: "recovery", Time: "2024-06-03T09:00:00+07:00"},
+	} {
+		if err := repo.LoginEventCreate(&e); err != nil || e.ID == 0 {
+			t.Fatalf("create: %v, id=%d", err, e.ID)
+		}
+	}
+
+	events, total, err := repo.LoginEventList(LoginEventFilter{}, 1, 3)
+	if err != nil || total != 4 || len(events) != 3 || events[0].Method != "recovery" {
+		t.Errorf("newest first with paging: %d, %v, %+v", total, err, events)
+	}
+	events, total, _ = repo.LoginEventList(LoginEventFilter{Usernames: []string{"BOB"}, Result: "failed"}, 0, 0)
+	if total != 2 || len(events) != 2 {
+		t.Errorf("username is case-insensitive: %+v", events)
+	}
+	events, _, _ = repo.LoginEventList(LoginEventFilter{AgentIDs: []string{"001"}, To: "2024-06-01T08:00:30+07:00"}, 0, 0)
+	if len(events) != 1 || events[0].Reason != "incorrect secret code" {
+		t.Errorf("filter by device and time: %+v", events)
+	}
+	events, total, _ = repo.LoginEventList(LoginEventFilter{AgentIDs: []string{}}, 0, 0)
+	if total != 0 || events == nil || len(events) != 0 {
+		t.Errorf("empty device list should match nothing: %+v", events)
+	}
+}
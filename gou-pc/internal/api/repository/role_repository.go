@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"gou-pc/internal/api/model"
+)
+
+var ErrRoleNotFound = errors.New("role not found")
+
+// RoleRepository lưu role tự tạo, role có sẵn (model.BuiltInRoles) không nằm trong DB
+type RoleRepository interface {
+	RoleGetAll() ([]model.Role, error)
+	RoleFindByName(name string) (*model.Role, error)
+	RoleCreate(r *model.Role) error
+	RoleUpdate(r *model.Role) error
+	RoleDelete(name string) error
+}
+
+type sqliteRoleRepository struct {
+	db *sql.DB
+}
+
+// CreateRoleTables tạo bảng roles nếu chưa có
+func CreateRoleTables(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS roles (
+		name TEXT PRIMARY KEY,
+		description TEXT,
+		permissions TEXT,
+		created_at TEXT,
+		updated_at TEXT
+	)`)
+	return err
+}
+
+func NewSQLiteRoleRepository(db *sql.DB) RoleRepository {
+	return &sqliteRoleRepository{db: db}
+}
+
+func scanRole(scan func(dest ...interface{}) error) (*model.Role, error) {
+	var r model.Role
+	var perms string
+	if err := scan(&r.Name, &r.Description, &perms, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		return nil, err
+	}
+	unmarshalColumn(perms, &r.Permissions)
+	if r.Permissions == nil {
+		r.Permissions = []string{}
+	}
+	return &r, nil
+}
+
+func (r *sqliteRoleRepository) RoleGetAll() ([]model.Role, error) {
+	rows, err := r.db.Query(`SELECT name, description, permissions, created_at, updated_at FROM roles ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	roles := []model.Role{}
+	for rows.Next() {
+		role, err := scanRole(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, *role)
+	}
+	return roles, rows.Err()
+}
+
+func (r *sqliteRoleRepository) RoleFindByName(name string) (*model.Role, error) {
+	role, err := scanRole(r.db.QueryRow(`SELECT name, description, permissions, created_at, updated_at FROM roles WHERE name = ?`, name).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrRoleNotFound
+	}
+	return role, err
+}
+
+func (r *sqliteRoleRepository) RoleCreate(role *model.Role) error {
+	_, err := r.db.Exec(`INSERT INTO roles (name, description, permissions, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`,
+		role.Name, role.Description, marshalColumn(role.Permissions), role.CreatedAt, role.UpdatedAt)
+	return err
+}
+
+func (r *sqliteRoleRepository) RoleUpdate(role *model.Role) error {
+	res, err := r.db.Exec(`UPDATE roles SET description = ?, permissions = ?, updated_at = ? WHERE name = ?`,
+		role.Description, marshalColumn(role.Permissions), role.UpdatedAt, role.Name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
+
+func (r *sqliteRoleRepository) RoleDelete(name string) error {
+	res, err := r.db.Exec(`DELETE FROM roles WHERE name = ?`, name)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrRoleNotFound
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"gou-pc/internal/api/model"
+)
+
+var (
+	ErrServiceAccountNotFound = errors.New("service account not found")
+	ErrAPIKeyNotFound         = errors.New("api key not found")
+)
+
+type ServiceAccountRepository interface {
+	ServiceAccountGetAll() ([]model.ServiceAccount, error)
+	ServiceAccountFindByName(name string) (*model.ServiceAccount, error)
+	ServiceAccountFindByID(id string) (*model.ServiceAccount, error)
+	ServiceAccountCreate(a *model.ServiceAccount) error
+	// ServiceAccountDelete xoá service account cùng mọi API key của nó
+	ServiceAccountDelete(id string) error
+
+	// APIKeyListByAccount trả về mọi key (kể cả đã thu hồi/hết hạn) của service account, mới nhất trước
+	APIKeyListByAccount(accountID string) ([]model.APIKey, error)
+	APIKeyFindByID(id string) (*model.APIKey, error)
+	APIKeyCreate(k *model.APIKey) error
+	APIKeyRevoke(id, now string) error
+	// APIKeyTouch ghi lần dùng gần nhất
+	APIKeyTouch(id, at, ip string) error
+}
+
+type sqliteServiceAccountRepository struct {
+	db *sql.DB
+}
+
+// CreateServiceAccountTables tạo bảng service_accounts và api_keys nếu chưa có
+func CreateServiceAccountTables(db *sql.DB) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS service_accounts (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE,
+			description TEXT,
+			created_by TEXT,
+			created_at TEXT
+		)`,
+		`CREATE TABLE IF NOT EXISTS api_keys (
+			id TEXT PRIMARY KEY,
+			account_id TEXT NOT NULL,
+			name TEXT,
+			hash TEXT NOT NULL,
+			permissions TEXT,
+			created_by TEXT,
+			created_at TEXT,
+			expires_at TEXT,
+			last_used_at TEXT,
+			last_used_ip TEXT,
+			revoked_at TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_api_keys_account ON api_keys(account_id)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func NewSQLiteServiceAccountRepository(db *sql.DB) ServiceAccountRepository {
+	return &sqliteServiceAccountRepository{db: db}
+}
+
+const serviceAccountColumns = `id, name, description, created_by, created_at`
+
+func scanServiceAccount(scan func(dest ...interface{}) error) (*model.ServiceAccount, error) {
+	var a model.ServiceAccount
+	if err := scan(&a.ID, &a.Name, &a.Description, &a.CreatedBy, &a.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (r *sqliteServiceAccountRepository) ServiceAccountGetAll() ([]model.ServiceAccount, error) {
+	rows, err := r.db.Query(`SELECT ` + serviceAccountColumns + ` FROM service_accounts ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	accounts := []model.ServiceAccount{}
+	for rows.Next() {
+		a, err := scanServiceAccount(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, *a)
+	}
+	return accounts, rows.Err()
+}
+
+func (r *sqliteServiceAccountRepository) ServiceAccountFindByName(name string) (*model.ServiceAccount, error) {
+	a, err := scanServiceAccount(r.db.QueryRow(`SELECT `+serviceAccountColumns+` FROM service_accounts WHERE name = ?`, name).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrServiceAccountNotFound
+	}
+	return a, err
+}
+
+func (r *sqliteServiceAccountRepository) ServiceAccountFindByID(id string) (*model.ServiceAccount, error) {
+	a, err := scanServiceAccount(r.db.QueryRow(`SELECT `+serviceAccountColumns+` FROM service_accounts WHERE id = ?`, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrServiceAccountNotFound
+	}
+	return a, err
+}
+
+func (r *sqliteServiceAccountRepository) ServiceAccountCreate(a *model.ServiceAccount) error {
+	_, err := r.db.Exec(`INSERT INTO service_accounts (`+serviceAccountColumns+`) VALUES (?, ?, ?, ?, ?)`,
+		a.ID, a.Name, a.Description, a.CreatedBy, a.CreatedAt)
+	return err
+}
+
+func (r *sqliteServiceAccountRepository) ServiceAccountDelete(id string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`DELETE FROM service_accounts WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrServiceAccountNotFound
+	}
+	if _, err := tx.Exec(`DELETE FROM api_keys WHERE account_id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const apiKeyColumns = `id, account_id, name, hash, permissions, created_by, created_at, expires_at, last_used_at, last_used_ip, revoked_at`
+
+func scanAPIKey(scan func(dest ...interface{}) error) (*model.APIKey, error) {
+	var k model.APIKey
+	var perms string
+	if err := scan(&k.ID, &k.AccountID, &k.Name, &k.Hash, &perms, &k.CreatedBy, &k.CreatedAt, &k.ExpiresAt,
+		&k.LastUsedAt, &k.LastUsedIP, &k.RevokedAt); err != nil {
+		return nil, err
+	}
+	unmarshalColumn(perms, &k.Permissions)
+	if k.Permissions == nil {
+		k.Permissions = []string{}
+	}
+	return &k, nil
+}
+
+func (r *sqliteServiceAccountRepository) APIKeyListByAccount(accountID string) ([]model.APIKey, error) {
+	rows, err := r.db.Query(`SELECT `+apiKeyColumns+` FROM api_keys WHERE account_id = ? ORDER BY created_at DESC, id`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []model.APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+func (r *sqliteServiceAccountRepository) APIKeyFindByID(id string) (*model.APIKey, error) {
+	k, err := scanAPIKey(r.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrAPIKeyNotFound
+	}
+	return k, err
+}
+
+func (r *sqliteServiceAccountRepository) APIKeyCreate(k *model.APIKey) error {
+	_, err := r.db.Exec(`INSERT INTO api_keys (`+apiKeyColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		k.ID, k.AccountID, k.Name, k.Hash, marshalColumn(k.Permissions), k.CreatedBy, k.CreatedAt, k.ExpiresAt,
+		k.LastUsedAt, k.LastUsedIP, k.RevokedAt)
+	return err
+}
+
+func (r *sqliteServiceAccountRepository) APIKeyRevoke(id, now string) error {
+	res, err := r.db.Exec(`UPDATE api_keys SET revoked_at = ? WHERE id = ? AND (revoked_at IS NULL OR revoked_at = '')`, now, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if _, err := r.APIKeyFindByID(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *sqliteServiceAccountRepository) APIKeyTouch(id, at, ip string) error {
+	_, err := r.db.Exec(`UPDATE api_keys SET last_used_at = ?, last_used_ip = ? WHERE id = ?`, at, ip, id)
+	return err
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"gou-pc/internal/api/model"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrSessionConflict trả về khi refresh token đã được xoay bởi request khác hoặc phiên đã bị thu hồi
+	ErrSessionConflict = errors.New("session changed concurrently")
+)
+
+type SessionRepository interface {
+	SessionCreate(s *model.Session) error
+	SessionFindByID(id string) (*model.Session, error)
+	// SessionListByUser trả về phiên chưa thu hồi của user, mới nhất trước
+	SessionListByUser(userID string) ([]model.Session, error)
+	// SessionRotate thay refresh token nếu hash hiện tại vẫn là oldHash (compare-and-swap)
+	SessionRotate(id, oldHash, newHash, now string) error
+	SessionRevoke(id, now string) error
+	// SessionRevokeByUser thu hồi mọi phiên của user trừ exceptID, trả về số phiên bị thu hồi
+	SessionRevokeByUser(userID, exceptID, now string) (int, error)
+	// SessionDeleteExpired xoá phiên hết hạn hoặc đã thu hồi trước before
+	SessionDeleteExpired(before string) (int, error)
+}
+
+type sqliteSessionRepository struct {
+	db *sql.DB
+}
+
+// CreateSessionTables tạo bảng sessions nếu chưa có
+func CreateSessionTables(db *sql.DB) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS sessions (
+			id TEXT PRIMARY KEY,
+			user_id TEXT NOT NULL,
+			username TEXT,
+			refresh_hash TEXT NOT NULL,
+			previous_hash TEXT,
+			user_agent TEXT,
+			client_ip TEXT,
+			created_at TEXT,
+			last_used_at TEXT,
+			expires_at TEXT,
+			revoked_at TEXT
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_sessions_user ON sessions(user_id)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func NewSQLiteSessionRepository(db *sql.DB) SessionRepository {
+	return &sqliteSessionRepository{db: db}
+}
+
+const sessionColumns = `id, user_id, username, refresh_hash, previous_hash, user_agent, client_ip, created_at, last_used_at, expires_at, revoked_at`
+
+func scanSession(scan func(dest ...interface{}) error) (*model.Session, error) {
+	var s model.Session
+	err := scan(&s.ID, &s.UserID, &s.Username, &s.RefreshHash, &s.PreviousHash, &s.UserAgent, &s.ClientIP,
+		&s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt, &s.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *sqliteSessionRepository) SessionCreate(s *model.Session) error {
+	_, err := r.db.Exec(`INSERT INTO sessions (`+sessionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		s.ID, s.UserID, s.Username, s.RefreshHash, s.PreviousHash, s.UserAgent, s.ClientIP, s.CreatedAt, s.LastUsedAt, s.ExpiresAt, s.RevokedAt)
+	return err
+}
+
+func (r *sqliteSessionRepository) SessionFindByID(id string) (*model.Session, error) {
+	s, err := scanSession(r.db.QueryRow(`SELECT `+sessionColumns+` FROM sessions WHERE id = ?`, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionNotFound
+	}
+	return s, err
+}
+
+func (r *sqliteSessionRepository) SessionListByUser(userID string) ([]model.Session, error) {
+	rows, err := r.db.Query(`SELECT `+sessionColumns+` FROM sessions WHERE user_id = ? AND revoked_at = '' ORDER BY created_at DESC, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	sessions := []model.Session{}
+	for rows.Next() {
+		s, err := scanSession(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *s)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *sqliteSessionRepository) SessionRotate(id, oldHash, newHash, now string) error {
+	res, err := r.db.Exec(`UPDATE sessions SET previous_hash = refresh_hash, refresh_hash = ?, last_used_at = ?
+		WHERE id = ? AND refresh_hash = ? AND revoked_at = ''`, newHash, now, id, oldHash)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSessionConflict
+	}
+	return nil
+}
+
+func (r *sqliteSessionRepository) SessionRevoke(id, now string) error {
+	res, err := r.db.Exec(`UPDATE sessions SET revoked_at = ? WHERE id = ? AND revoked_at = ''`, now, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (r *sqliteSessionRepository) SessionRevokeByUser(userID, exceptID, now string) (int, error) {
+	res, err := r.db.Exec(`UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND id != ? AND revoked_at = ''`, now, userID, exceptID)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+func (r *sqliteSessionRepository) SessionDeleteExpired(before string) (int, error) {
+	res, err := r.db.Exec(`DELETE FROM sessions WHERE expires_at < ? OR (revoked_at != '' AND revoked_at < ?)`, before, before)
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
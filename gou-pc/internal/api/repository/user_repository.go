@@ -14,6 +14,8 @@ type UserRepository interface {
 	UserFindByID(id string) (*model.User, error)
 	UserCreate(user *model.User) error
 	UserUpdate(user *model.User) error
+	// UserSetPassword chỉ thay cột password (đã băm), không đổi updated_at
+	UserSetPassword(id, password string) error
 	UserDeleteByUsername(username string) error
 	UserDeleteByID(id string) error
 }
@@ -148,6 +150,18 @@ func (r *sqliteUserRepository) UserUpdate(user *model.User) error {
 	return nil
 }
 
+func (r *sqliteUserRepository) UserSetPassword(id, password string) error {
+	res, err := r.db.Exec(`UPDATE users SET password=? WHERE id=?`, password, id)
+	if err != nil {
+		logutil.APIDebug("UserRepository.SetPassword: failed to set password for user id=%s: %v", id, err)
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errors.New("user not found")
+	}
+	return nil
+}
+
 func joinFields(fields []string) string {
 	if len(fields) == 0 {
 		return ""
@@ -2,6 +2,9 @@ package response
 
 import "github.com/gin-gonic/gin"
 
+// ErrorKey là key trong gin.Context chứa thông báo lỗi đã trả về (audit log đọc lại)
+const ErrorKey = "response_error"
+
 // Chuẩn hóa response thành công
 func Success(c *gin.Context, data interface{}) {
 	c.JSON(200, gin.H{"success": true, "data": data})
@@ -9,5 +12,6 @@ func Success(c *gin.Context, data interface{}) {
 
 // Chuẩn hóa response lỗi
 func Error(c *gin.Context, code int, msg string) {
+	c.Set(ErrorKey, msg)
 	c.JSON(code, gin.H{"success": false, "error": msg})
 }
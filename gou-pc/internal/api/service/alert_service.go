@@ -0,0 +1,111 @@
+package service
+
+import (
+	"gou-pc/internal/alert"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+	"gou-pc/internal/logutil"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AlertService interface {
+	RuleGetAll() ([]model.AlertRule, error)
+	RuleGetByID(id string) (*model.AlertRule, error)
+	RuleCreate(rule *model.AlertRule) error
+	RuleUpdate(rule *model.AlertRule) error
+	RuleDelete(id string) error
+	AlertList(f repository.AlertFilter) ([]model.Alert, error)
+	AlertGetByID(id string) (*model.Alert, error)
+	AlertAcknowledge(id, by string) (*model.Alert, error)
+	AlertResolve(id, by string) (*model.Alert, error)
+	AlertDelete(id string) error
+}
+
+type alertServiceImpl struct {
+	repo   repository.AlertRepository
+	engine *alert.Engine
+}
+
+// NewAlertService quản lý rule/cảnh báo, mọi thay đổi rule được nạp lại vào engine ngay
+func NewAlertService(repo repository.AlertRepository, engine *alert.Engine) AlertService {
+	return &alertServiceImpl{repo: repo, engine: engine}
+}
+
+func (s *alertServiceImpl) RuleGetAll() ([]model.AlertRule, error) {
+	return s.repo.AlertRuleGetAll()
+}
+
+func (s *alertServiceImpl) RuleGetByID(id string) (*model.AlertRule, error) {
+	return s.repo.AlertRuleFindByID(id)
+}
+
+func (s *alertServiceImpl) RuleCreate(rule *model.AlertRule) error {
+	if err := s.engine.ValidateRule(rule); err != nil {
+		return err
+	}
+	now := time.Now().Format(time.RFC3339)
+	rule.ID = uuid.NewString()
+	rule.CreatedAt, rule.UpdatedAt = now, now
+	if err := s.repo.AlertRuleCreate(rule); err != nil {
+		return err
+	}
+	s.reload()
+	return nil
+}
+
+func (s *alertServiceImpl) RuleUpdate(rule *model.AlertRule) error {
+	old, err := s.repo.AlertRuleFindByID(rule.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.engine.ValidateRule(rule); err != nil {
+		return err
+	}
+	rule.CreatedAt = old.CreatedAt
+	rule.UpdatedAt = time.Now().Format(time.RFC3339)
+	if err := s.repo.AlertRuleUpdate(rule); err != nil {
+		return err
+	}
+	s.reload()
+	return nil
+}
+
+func (s *alertServiceImpl) RuleDelete(id string) error {
+	if err := s.repo.AlertRuleDelete(id); err != nil {
+		return err
+	}
+	s.reload()
+	return nil
+}
+
+func (s *alertServiceImpl) reload() {
+	if err := s.engine.Reload(); err != nil {
+		logutil.APIDebug("AlertService: reload rules error: %v", err)
+	}
+}
+
+func (s *alertServiceImpl) AlertList(f repository.AlertFilter) ([]model.Alert, error) {
+	return s.repo.AlertList(f)
+}
+
+func (s *alertServiceImpl) AlertGetByID(id string) (*model.Alert, error) {
+	return s.repo.AlertFindByID(id)
+}
+
+func (s *alertServiceImpl) AlertAcknowledge(id, by string) (*model.Alert, error) {
+	return s.engine.Acknowledge(id, by)
+}
+
+func (s *alertServiceImpl) AlertResolve(id, by string) (*model.Alert, error) {
+	return s.engine.Resolve(id, by)
+}
+
+func (s *alertServiceImpl) AlertDelete(id string) error {
+	if err := s.repo.AlertDelete(id); err != nil {
+		return err
+	}
+	s.engine.Forget(id)
+	return nil
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+	"gou-pc/internal/logutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidAPIKey trả về khi API key sai, hết hạn, đã thu hồi hoặc service account đã bị xoá
+	ErrInvalidAPIKey = errors.New("invalid, expired or revoked api key")
+	// ErrInvalidServiceAccount trả về khi tên service account, quyền hoặc hạn của key không hợp lệ
+	ErrInvalidServiceAccount = errors.New("invalid service account")
+	// ErrServiceAccountExists trả về khi tạo service account trùng tên
+	ErrServiceAccountExists = errors.New("service account already exists")
+)
+
+// apiKeyTouchEvery: lần dùng gần nhất chỉ ghi lại DB khi đã cũ hơn khoảng này hoặc IP đổi
+const apiKeyTouchEvery = time.Minute
+
+type APIKeyService interface {
+	// ServiceAccountList trả về mọi service account kèm danh sách key (không có hash)
+	ServiceAccountList() ([]model.ServiceAccount, error)
+	ServiceAccountGet(name string) (*model.ServiceAccount, error)
+	ServiceAccountCreate(a *model.ServiceAccount) error
+	// ServiceAccountDelete xoá service account, mọi key của nó hết hiệu lực ngay
+	ServiceAccountDelete(name string) error
+	// APIKeyCreate tạo key cho service account, trả về key đầy đủ (chỉ có lúc này, server chỉ lưu hash).
+	// ExpiresAt rỗng thì key sống theo thời hạn mặc định.
+	APIKeyCreate(accountName string, k *model.APIKey) (string, error)
+	APIKeyRevoke(accountName, keyID string) error
+	// ValidateAPIKey kiểm tra key, ghi lần dùng và trả về service account cùng key
+	ValidateAPIKey(key, clientIP string) (*model.ServiceAccount, *model.APIKey, error)
+}
+
+type apiKeyServiceImpl struct {
+	repo          repository.ServiceAccountRepository
+	defaultExpire time.Duration
+	now           func() time.Time
+}
+
+// NewAPIKeyService tạo service quản lý service account, key không ghi hạn thì sống defaultExpire
+func NewAPIKeyService(repo repository.ServiceAccountRepository, defaultExpire time.Duration) APIKeyService {
+	return &apiKeyServiceImpl{repo: repo, defaultExpire: defaultExpire, now: time.Now}
+}
+
+func (s *apiKeyServiceImpl) withKeys(a *model.ServiceAccount) error {
+	keys, err := s.repo.APIKeyListByAccount(a.ID)
+	if err != nil {
+		return err
+	}
+	a.Keys = keys
+	return nil
+}
+
+func (s *apiKeyServiceImpl) ServiceAccountList() ([]model.ServiceAccount, error) {
+	accounts, err := s.repo.ServiceAccountGetAll()
+	if err != nil {
+		return nil, err
+	}
+	for i := range accounts {
+		if err := s.withKeys(&accounts[i]); err != nil {
+			return nil, err
+		}
+	}
+	return accounts, nil
+}
+
+func (s *apiKeyServiceImpl) ServiceAccountGet(name string) (*model.ServiceAccount, error) {
+	a, err := s.repo.ServiceAccountFindByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return a, s.withKeys(a)
+}
+
+func (s *apiKeyServiceImpl) ServiceAccountCreate(a *model.ServiceAccount) error {
+	if !roleNamePattern.MatchString(a.Name) {
+		return fmt.Errorf("%w: name must be 2-32 lowercase letters, digits, '-' or '_'", ErrInvalidServiceAccount)
+	}
+	if _, err := s.repo.ServiceAccountFindByName(a.Name); err == nil {
+		return ErrServiceAccountExists
+	}
+	a.ID = uuid.NewString()
+	a.CreatedAt = s.now().Format(time.RFC3339)
+	a.Keys = nil
+	return s.repo.ServiceAccountCreate(a)
+}
+
+func (s *apiKeyServiceImpl) ServiceAccountDelete(name string) error {
+	a, err := s.repo.ServiceAccountFindByName(name)
+	if err != nil {
+		return err
+	}
+	return s.repo.ServiceAccountDelete(a.ID)
+}
+
+// validateKeyPermissions kiểm tra quyền của key, bỏ quyền trùng; key phải có ít nhất một quyền
+func validateKeyPermissions(perms []string) ([]string, error) {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, p := range perms {
+		if p != model.PermAll && !containsPermission(model.Permissions, p) {
+			return nil, fmt.Errorf("%w: unknown permission %q", ErrInvalidServiceAccount, p)
+		}
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%w: api key needs at least one permission", ErrInvalidServiceAccount)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// newAPIKeySecret sinh id (dùng tra cứu, hiện cho admin) và phần bí mật của key
+func newAPIKeySecret() (id, secret string, err error) {
+	b := make([]byte, 40)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(b[:8]), hex.EncodeToString(b[8:]), nil
+}
+
+func (s *apiKeyServiceImpl) APIKeyCreate(accountName string, k *model.APIKey) (string, error) {
+	a, err := s.repo.ServiceAccountFindByName(accountName)
+	if err != nil {
+		return "", err
+	}
+	perms, err := validateKeyPermissions(k.Permissions)
+	if err != nil {
+		return "", err
+	}
+	now := s.now()
+	expires := now.Add(s.defaultExpire)
+	if k.ExpiresAt != "" {
+		if expires, err = time.Parse(time.RFC3339, k.ExpiresAt); err != nil {
+			return "", fmt.Errorf("%w: expires_at must be RFC3339", ErrInvalidServiceAccount)
+		}
+		if !expires.After(now) {
+			return "", fmt.Errorf("%w: expires_at must be in the future", ErrInvalidServiceAccount)
+		}
+	}
+	id, secret, err := newAPIKeySecret()
+	if err != nil {
+		return "", err
+	}
+	k.ID = id
+	k.AccountID = a.ID
+	k.Hash = hashSecret(secret)
+	k.Permissions = perms
+	k.CreatedAt = now.Format(time.RFC3339)
+	k.ExpiresAt = expires.In(time.Local).Format(time.RFC3339)
+	k.LastUsedAt, k.LastUsedIP, k.RevokedAt = "", "", ""
+	if err := s.repo.APIKeyCreate(k); err != nil {
+		return "", err
+	}
+	return model.APIKeyPrefix + id + "_" + secret, nil
+}
+
+func (s *apiKeyServiceImpl) APIKeyRevoke(accountName, keyID string) error {
+	a, err := s.repo.ServiceAccountFindByName(accountName)
+	if err != nil {
+		return err
+	}
+	k, err := s.repo.APIKeyFindByID(keyID)
+	if err != nil {
+		return err
+	}
+	if k.AccountID != a.ID {
+		return repository.ErrAPIKeyNotFound
+	}
+	return s.repo.APIKeyRevoke(k.ID, s.now().Format(time.RFC3339))
+}
+
+func (s *apiKeyServiceImpl) ValidateAPIKey(key, clientIP string) (*model.ServiceAccount, *model.APIKey, error) {
+	rest, ok := strings.CutPrefix(key, model.APIKeyPrefix)
+	if !ok {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok || id == "" || secret == "" {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	k, err := s.repo.APIKeyFindByID(id)
+	if err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	if subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hashSecret(secret))) != 1 || k.RevokedAt != "" {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	now := s.now()
+	if exp, err := time.Parse(time.RFC3339, k.ExpiresAt); err != nil || !now.Before(exp) {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	a, err := s.repo.ServiceAccountFindByID(k.AccountID)
+	if err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+	last, err := time.Parse(time.RFC3339, k.LastUsedAt)
+	if err != nil || now.Sub(last) >= apiKeyTouchEvery || k.LastUsedIP != clientIP {
+		k.LastUsedAt, k.LastUsedIP = now.Format(time.RFC3339), clientIP
+		if err := s.repo.APIKeyTouch(k.ID, k.LastUsedAt, k.LastUsedIP); err != nil {
+			logutil.APIDebug("APIKeyService: touch key %s failed: %v", k.ID, err)
+		}
+	}
+	return a, k, nil
+}
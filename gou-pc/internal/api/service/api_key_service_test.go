@@ -0,0 +1,113 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestAPIKeyService(t *testing.T) (*apiKeyServiceImpl, repository.ServiceAccountRepository, *time.Time) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "apikeys.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := repository.CreateServiceAccountTables(db); err != nil {
+		t.Fatal(err)
+	}
+	repo := repository.NewSQLiteServiceAccountRepository(db)
+	s := NewAPIKeyService(repo, 24*time.Hour).(*apiKeyServiceImpl)
+	now := time.Date(2024, 6, 1, 10, 0, 0, 0, time.Local)
+	s.now = func() time.Time { return now }
+	return s, repo, &now
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	s, repo, now := newTestAPIKeyService(t)
+	if err := s.ServiceAccountCreate(&model.ServiceAccount{Name: "Backup Script"}); !errors.Is(err, ErrInvalidServiceAccount) {
+		t.Fatalf("invalid name: got %v", err)
+	}
+	if err := s.ServiceAccountCreate(&model.ServiceAccount{Name: "backup", CreatedBy: "admin"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ServiceAccountCreate(&model.ServiceAccount{Name: "backup"}); !errors.Is(err, ErrServiceAccountExists) {
+		t.Fatalf("duplicate: got %v", err)
+	}
+	for _, perms := range [][]string{nil, {"logs.write"}} {
+		if _, err := s.APIKeyCreate("backup", &model.APIKey{Permissions: perms}); !errors.Is(err, ErrInvalidServiceAccount) {
+			t.Fatalf("permissions %v: got %v", perms, err)
+		}
+	}
+	if _, err := s.APIKeyCreate("backup", &model.APIKey{Permissions: []string{model.PermLogsRead}, ExpiresAt: "2024-05-01T00:00:00+07:00"}); !errors.Is(err, ErrInvalidServiceAccount) {
+		t.Fatalf("expiry in the past: got %v", err)
+	}
+
+	k := model.APIKey{Name: "nightly", Permissions: []string{model.PermLogsRead, model.PermDevicesRead, model.PermLogsRead}}
+	key, err := s.APIKeyCreate("backup", &k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, model.APIKeyPrefix+k.ID+"_") || len(k.Permissions) != 2 {
+		t.Fatalf("key %q, api key %+v", key, k)
+	}
+	stored, _ := repo.APIKeyFindByID(k.ID)
+	if stored.Hash == "" || strings.Contains(key, stored.Hash) {
+		t.Fatal("only the hash of the secret must be stored")
+	}
+	if exp, _ := time.Parse(time.RFC3339, k.ExpiresAt); !exp.Equal(now.Add(24 * time.Hour)) {
+		t.Fatalf("default expiry = %s", k.ExpiresAt)
+	}
+
+	for _, bad := range []string{"", "gpk_", key + "x", strings.Replace(key, model.APIKeyPrefix, "xyz_", 1), model.APIKeyPrefix + "nope_" + strings.Repeat("a", 64)} {
+		if _, _, err := s.ValidateAPIKey(bad, "10.0.0.1"); !errors.Is(err, ErrInvalidAPIKey) {
+			t.Fatalf("key %q: got %v", bad, err)
+		}
+	}
+	account, got, err := s.ValidateAPIKey(key, "10.0.0.1")
+	if err != nil || account.Name != "backup" || got.ID != k.ID {
+		t.Fatalf("valid key: %v, %+v, %+v", err, account, got)
+	}
+	stored, _ = repo.APIKeyFindByID(k.ID)
+	if stored.LastUsedIP != "10.0.0.1" || stored.LastUsedAt != now.Format(time.RFC3339) {
+		t.Fatalf("last used not tracked: %+v", stored)
+	}
+
+	*now = now.Add(25 * time.Hour)
+	if _, _, err := s.ValidateAPIKey(key, "10.0.0.1"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("expired key: got %v", err)
+	}
+
+	key2, err := s.APIKeyCreate("backup", &model.APIKey{Permissions: []string{model.PermLogsRead}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id2 := strings.SplitN(strings.TrimPrefix(key2, model.APIKeyPrefix), "_", 2)[0]
+	if err := s.ServiceAccountCreate(&model.ServiceAccount{Name: "other"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.APIKeyRevoke("other", id2); !errors.Is(err, repository.ErrAPIKeyNotFound) {
+		t.Fatalf("revoke through another account: got %v", err)
+	}
+	if err := s.APIKeyRevoke("backup", id2); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.ValidateAPIKey(key2, ""); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("revoked key: got %v", err)
+	}
+
+	key3, _ := s.APIKeyCreate("backup", &model.APIKey{Permissions: []string{model.PermLogsRead}})
+	if err := s.ServiceAccountDelete("backup"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.ValidateAPIKey(key3, ""); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Fatalf("key of deleted account: got %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+	"time"
+)
+
+type AuditService interface {
+	// Record ghi một dòng audit, Time rỗng thì lấy thời điểm hiện tại
+	Record(e *model.AuditEntry) error
+	List(f repository.AuditFilter, page, pageSize int) ([]model.AuditEntry, int, error)
+	Export(f repository.AuditFilter, fn func(model.AuditEntry) error) error
+}
+
+type auditServiceImpl struct {
+	repo repository.AuditRepository
+	now  func() time.Time
+}
+
+func NewAuditService(repo repository.AuditRepository) AuditService {
+	return &auditServiceImpl{repo: repo, now: time.Now}
+}
+
+func (s *auditServiceImpl) Record(e *model.AuditEntry) error {
+	if e.Time == "" {
+		e.Time = s.now().Format(time.RFC3339)
+	}
+	return s.repo.AuditCreate(e)
+}
+
+func (s *auditServiceImpl) List(f repository.AuditFilter, page, pageSize int) ([]model.AuditEntry, int, error) {
+	return s.repo.AuditList(f, page, pageSize)
+}
+
+func (s *auditServiceImpl) Export(f repository.AuditFilter, fn func(model.AuditEntry) error) error {
+	return s.repo.AuditExport(f, fn)
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+	"gou-pc/internal/logutil"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidRefreshToken trả về khi refresh token sai, hết hạn hoặc phiên đã bị thu hồi
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused trả về khi refresh token đã xoay bị dùng lại; cả phiên bị thu hồi
+	ErrRefreshTokenReused = errors.New("refresh token reused, session revoked")
+	// ErrSessionRevoked trả về khi access token thuộc phiên đã logout/thu hồi/hết hạn hoặc user không còn tồn tại
+	ErrSessionRevoked = errors.New("session revoked or expired")
+)
+
+// sessionRetention là thời gian giữ phiên đã thu hồi/hết hạn trước khi xoá
+const sessionRetention = 24 * time.Hour
+
+// TokenPair là access token (JWT ngắn hạn) và refresh token (chuỗi ngẫu nhiên, dùng một lần) trả cho client
+type TokenPair struct {
+	AccessToken      string `json:"token"`
+	ExpiresIn        int64  `json:"expires_in"` // giây
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresAt string `json:"refresh_expires_at"`
+}
+
+type AuthService interface {
+	Login(username, password, userAgent, clientIP string) (*TokenPair, *model.User, error)
+	// Refresh đổi refresh token lấy cặp token mới, refresh token cũ hết hiệu lực
+	Refresh(refreshToken string) (*TokenPair, error)
+	Logout(sessionID string) error
+	// ValidateSession kiểm tra phiên của access token còn hiệu lực, trả về username/role hiện tại của user
+	ValidateSession(sessionID, userID string) (username, role string, err error)
+	ListUserSessions(userID string) ([]model.Session, error)
+	// RevokeUserSessions thu hồi mọi phiên của user trừ exceptSessionID (rỗng = tất cả)
+	RevokeUserSessions(userID, exceptSessionID string) (int, error)
+}
+
+type authServiceImpl struct {
+	users         UserService
+	sessions      repository.SessionRepository
+	secret        []byte
+	accessExpire  time.Duration
+	refreshExpire time.Duration
+	now           func() time.Time
+}
+
+// NewAuthService cấp access token sống accessExpire và refresh token sống refreshExpire tính từ lúc đăng nhập
+func NewAuthService(users UserService, sessions repository.SessionRepository, secret string, accessExpire, refreshExpire time.Duration) AuthService {
+	return &authServiceImpl{
+		users:         users,
+		sessions:      sessions,
+		secret:        []byte(secret),
+		accessExpire:  accessExpire,
+		refreshExpire: refreshExpire,
+		now:           time.Now,
+	}
+}
+
+// hashSecret là sha256 (hex) của phần bí mật refresh token/API key, DB chỉ lưu giá trị này
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRefreshSecret sinh phần bí mật của refresh token; token gửi client có dạng <session_id>.<secret>
+func newRefreshSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (s *authServiceImpl) issue(user *model.User, sess *model.Session, refreshSecret string, now time.Time) (*TokenPair, error) {
+	claims := jwt.MapClaims{
+		"user_id":  user.ID,
+		"username": user.Username,
+		"role":     user.Role,
+		"sid":      sess.ID,
+		"iat":      now.Unix(),
+		"exp":      now.Add(s.accessExpire).Unix(),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:      token,
+		ExpiresIn:        int64(s.accessExpire.Seconds()),
+		RefreshToken:     sess.ID + "." + refreshSecret,
+		RefreshExpiresAt: sess.ExpiresAt,
+	}, nil
+}
+
+func (s *authServiceImpl) Login(username, password, userAgent, clientIP string) (*TokenPair, *model.User, error) {
+	user, err := s.users.UserAuthenticate(username, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	secret, err := newRefreshSecret()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := s.now()
+	ts := now.Format(time.RFC3339)
+	sess := &model.Session{
+		ID:          uuid.NewString(),
+		UserID:      user.ID,
+		Username:    user.Username,
+		RefreshHash: hashSecret(secret),
+		UserAgent:   userAgent,
+		ClientIP:    clientIP,
+		CreatedAt:   ts,
+		LastUsedAt:  ts,
+		ExpiresAt:   now.Add(s.refreshExpire).Format(time.RFC3339),
+	}
+	if n, err := s.sessions.SessionDeleteExpired(now.Add(-sessionRetention).Format(time.RFC3339)); err != nil {
+		logutil.APIDebug("AuthService.Login: cleanup sessions error: %v", err)
+	} else if n > 0 {
+		logutil.APIDebug("AuthService.Login: removed %d old sessions", n)
+	}
+	if err := s.sessions.SessionCreate(sess); err != nil {
+		return nil, nil, err
+	}
+	pair, err := s.issue(user, sess, secret, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, user, nil
+}
+
+func (s *authServiceImpl) Refresh(refreshToken string) (*TokenPair, error) {
+	id, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok || id == "" || secret == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	sess, err := s.sessions.SessionFindByID(id)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	now := s.now()
+	ts := now.Format(time.RFC3339)
+	hash := hashSecret(secret)
+	if sess.RevokedAt != "" || !sessionActive(sess, now) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if hash == sess.PreviousHash {
+		// Token đã xoay bị dùng lại: một trong hai bên (client thật hoặc kẻ lấy được token) không còn tin được
+		s.sessions.SessionRevoke(sess.ID, ts)
+		logutil.APIInfo("AuthService.Refresh: reused refresh token for user %s, session %s revoked", sess.Username, sess.ID)
+		return nil, ErrRefreshTokenReused
+	}
+	if hash != sess.RefreshHash {
+		return nil, ErrInvalidRefreshToken
+	}
+	user, err := s.users.UserGetByID(sess.UserID)
+	if err != nil || user == nil {
+		s.sessions.SessionRevoke(sess.ID, ts)
+		return nil, ErrInvalidRefreshToken
+	}
+	newSecret, err := newRefreshSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.sessions.SessionRotate(sess.ID, hash, hashSecret(newSecret), ts); err != nil {
+		if errors.Is(err, repository.ErrSessionConflict) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+	return s.issue(user, sess, newSecret, now)
+}
+
+// sessionActive: refresh token của phiên chưa hết hạn
+func sessionActive(sess *model.Session, now time.Time) bool {
+	exp, err := time.Parse(time.RFC3339, sess.ExpiresAt)
+	return err == nil && now.Before(exp)
+}
+
+func (s *authServiceImpl) Logout(sessionID string) error {
+	return s.sessions.SessionRevoke(sessionID, s.now().Format(time.RFC3339))
+}
+
+func (s *authServiceImpl) ValidateSession(sessionID, userID string) (string, string, error) {
+	if sessionID == "" {
+		return "", "", ErrSessionRevoked
+	}
+	sess, err := s.sessions.SessionFindByID(sessionID)
+	if err != nil || sess.UserID != userID || sess.RevokedAt != "" || !sessionActive(sess, s.now()) {
+		return "", "", ErrSessionRevoked
+	}
+	user, err := s.users.UserGetByID(userID)
+	if err != nil || user == nil {
+		return "", "", ErrSessionRevoked
+	}
+	return user.Username, user.Role, nil
+}
+
+func (s *authServiceImpl) ListUserSessions(userID string) ([]model.Session, error) {
+	sessions, err := s.sessions.SessionListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	active := sessions[:0]
+	for _, sess := range sessions {
+		if sessionActive(&sess, now) {
+			active = append(active, sess)
+		}
+	}
+	return active, nil
+}
+
+func (s *authServiceImpl) RevokeUserSessions(userID, exceptSessionID string) (int, error) {
+	n, err := s.sessions.SessionRevokeByUser(userID, exceptSessionID, s.now().Format(time.RFC3339))
+	if err == nil && n > 0 {
+		logutil.APIInfo("AuthService: revoked %d sessions of user id=%s", n, userID)
+	}
+	return n, err
+}
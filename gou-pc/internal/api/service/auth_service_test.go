@@ -0,0 +1,145 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestAuthService(t *testing.T) (*authServiceImpl, *memUserRepository, *time.Time) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "sessions.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := repository.CreateSessionTables(db); err != nil {
+		t.Fatal(err)
+	}
+	users := &memUserRepository{users: map[string]*model.User{}}
+	userService := NewUserService(users)
+	for _, u := range []model.User{
+		{Username: "admin", Password: "pw-admin", Email: "a@x", FullName: "Admin", Role: "admin"},
+		{Username: "bob", Password: "pw-bob", Email: "b@x", FullName: "Bob", Role: "user"},
+	} {
+		if err := userService.UserCreate(&u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewAuthService(userService, repository.NewSQLiteSessionRepository(db), "secret", 10*time.Minute, time.Hour).(*authServiceImpl)
+	now := time.Date(2024, 6, 1, 10, 0, 0, 0, time.Local)
+	s.now = func() time.Time { return now }
+	return s, users, &now
+}
+
+func tokenClaims(t *testing.T, token string) jwt.MapClaims {
+	t.Helper()
+	claims := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(token, claims); err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+func TestAuthRefreshRotation(t *testing.T) {
+	s, _, now := newTestAuthService(t)
+	if _, _, err := s.Login("bob", "wrong", "", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("wrong password should fail, got %v", err)
+	}
+	pair, user, err := s.Login("bob", "pw-bob", "curl", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sid, _ := tokenClaims(t, pair.AccessToken)["sid"].(string)
+	if sid == "" || pair.ExpiresIn != 600 || pair.RefreshToken == "" {
+		t.Fatalf("unexpected token pair: %+v", pair)
+	}
+	if _, role, err := s.ValidateSession(sid, user.ID); err != nil || role != "user" {
+		t.Fatalf("fresh session should be valid: %s, %v", role, err)
+	}
+
+	// Xoay vòng: token mới dùng được, token cũ dùng lại thì cả phiên bị thu hồi
+	pair2, err := s.Refresh(pair.RefreshToken)
+	if err != nil || pair2.RefreshToken == pair.RefreshToken {
+		t.Fatalf("refresh should rotate: %+v, %v", pair2, err)
+	}
+	pair3, err := s.Refresh(pair2.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Refresh(pair2.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reusing rotated token should be detected, got %v", err)
+	}
+	if _, err := s.Refresh(pair3.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("session should be revoked after reuse, got %v", err)
+	}
+	if _, _, err := s.ValidateSession(sid, user.ID); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("access token of revoked session should be rejected, got %v", err)
+	}
+	for _, bad := range []string{"", "nodot", sid + ".garbage", "missing.abc"} {
+		if _, err := s.Refresh(bad); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("%q should be invalid, got %v", bad, err)
+		}
+	}
+
+	// Refresh token hết hạn theo thời điểm đăng nhập
+	pair, _, _ = s.Login("bob", "pw-bob", "", "")
+	*now = now.Add(2 * time.Hour)
+	if _, err := s.Refresh(pair.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expired refresh token should fail, got %v", err)
+	}
+}
+
+func TestAuthRevocationAndRoleReload(t *testing.T) {
+	s, users, _ := newTestAuthService(t)
+	p1, bob, _ := s.Login("bob", "pw-bob", "", "")
+	p2, _, _ := s.Login("bob", "pw-bob", "", "")
+	sid1, _ := tokenClaims(t, p1.AccessToken)["sid"].(string)
+	sid2, _ := tokenClaims(t, p2.AccessToken)["sid"].(string)
+	if sessions, _ := s.ListUserSessions(bob.ID); len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %+v", sessions)
+	}
+
+	// Role đổi trong DB có hiệu lực ngay với token đang dùng
+	users.users["bob"].Role = "admin"
+	if _, role, _ := s.ValidateSession(sid1, bob.ID); role != "admin" {
+		t.Errorf("role should be reloaded, got %q", role)
+	}
+	if _, _, err := s.ValidateSession(sid1, "other-user"); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("session of another user should be rejected, got %v", err)
+	}
+
+	if err := s.Logout(sid1); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.ValidateSession(sid1, bob.ID); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("logged out session should be rejected, got %v", err)
+	}
+	if _, _, err := s.ValidateSession(sid2, bob.ID); err != nil {
+		t.Errorf("other session should stay valid: %v", err)
+	}
+	if n, err := s.RevokeUserSessions(bob.ID, ""); err != nil || n != 1 {
+		t.Fatalf("expected 1 revoked session, got %d, %v", n, err)
+	}
+	if _, err := s.Refresh(p2.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("revoked session should not refresh, got %v", err)
+	}
+
+	// User bị xoá: phiên không còn hiệu lực
+	p3, _, _ := s.Login("bob", "pw-bob", "", "")
+	sid3, _ := tokenClaims(t, p3.AccessToken)["sid"].(string)
+	delete(users.users, "bob")
+	if _, _, err := s.ValidateSession(sid3, bob.ID); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("deleted user should be rejected, got %v", err)
+	}
+	if _, _, err := s.ValidateSession("", bob.ID); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("token without sid should be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+	"gou-pc/internal/detect"
+)
+
+type IncidentService interface {
+	IncidentList(f repository.IncidentFilter) ([]model.Incident, error)
+	IncidentGetByID(id string) (*model.Incident, error)
+	IncidentResolve(id, by string) (*model.Incident, error)
+	OTPLockList() []model.OTPLock
+	OTPUnlock(subjectType, subject string) error
+}
+
+type incidentServiceImpl struct {
+	repo     repository.IncidentRepository
+	detector *detect.Detector
+}
+
+// NewIncidentService xem/đóng incident brute-force và quản lý khoá OTP của detector
+func NewIncidentService(repo repository.IncidentRepository, detector *detect.Detector) IncidentService {
+	return &incidentServiceImpl{repo: repo, detector: detector}
+}
+
+func (s *incidentServiceImpl) IncidentList(f repository.IncidentFilter) ([]model.Incident, error) {
+	return s.repo.IncidentList(f)
+}
+
+func (s *incidentServiceImpl) IncidentGetByID(id string) (*model.Incident, error) {
+	return s.repo.IncidentFindByID(id)
+}
+
+func (s *incidentServiceImpl) IncidentResolve(id, by string) (*model.Incident, error) {
+	return s.detector.Resolve(id, by)
+}
+
+func (s *incidentServiceImpl) OTPLockList() []model.OTPLock {
+	return s.detector.Locks()
+}
+
+func (s *incidentServiceImpl) OTPUnlock(subjectType, subject string) error {
+	return s.detector.Unlock(subjectType, subject)
+}
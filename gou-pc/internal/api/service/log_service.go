@@ -1,6 +1,7 @@
 package service
 
 import (
+	"crypto/ed25519"
 	"gou-pc/internal/api/repository"
 	"gou-pc/internal/logcollector"
 )
@@ -13,40 +14,65 @@ type LogService interface {
 	GetLogsByAgentID(agentID string) ([]logcollector.ArchiveLogEntry, error)
 	GetLogsPaged(page, pageSize int) ([]logcollector.ArchiveLogEntry, int, error)
 	GetLogsPagedByAgentID(agentID string, page, pageSize int) ([]logcollector.ArchiveLogEntry, int, error)
+	SearchLogs(q repository.LogQuery) ([]logcollector.ArchiveLogEntry, string, error)
+	ListLogs(q repository.LogQuery, page, pageSize int) ([]logcollector.ArchiveLogEntry, int, error)
+	ExportLogs(q repository.LogQuery, fn func(logcollector.ArchiveLogEntry) error) error
+	VerifyLogChain() (*logcollector.ChainReport, error)
+	LogVolume(q repository.LogQuery, bucket string) ([]repository.LogVolumePoint, error)
+	TopMessages(q repository.LogQuery, n int, templates bool) ([]repository.MessageCount, error)
+	ErrorRate(q repository.LogQuery, bucket, threshold string) ([]repository.ErrorRatePoint, error)
 }
 
 type logServiceImpl struct {
-	archiveFile string
+	repo     repository.LogRepository
+	chainPub ed25519.PublicKey
 }
 
-func NewLogService(archiveFile string) LogService {
-	return &logServiceImpl{archiveFile: archiveFile}
+// NewLogService tạo service log, chainPub là khoá kiểm tra chữ ký checkpoint của chuỗi hash (nil = bỏ qua checkpoint)
+func NewLogService(repo repository.LogRepository, chainPub ed25519.PublicKey) LogService {
+	return &logServiceImpl{repo: repo, chainPub: chainPub}
 }
 
 func (s *logServiceImpl) GetAllLogs() ([]logcollector.ArchiveLogEntry, error) {
-	return logcollector.LoadArchiveLogs(s.archiveFile)
+	return s.repo.GetAllLogs()
 }
 
 func (s *logServiceImpl) GetLogsByAgentID(agentID string) ([]logcollector.ArchiveLogEntry, error) {
-	logs, err := logcollector.LoadArchiveLogs(s.archiveFile)
-	if err != nil {
-		return nil, err
-	}
-	var result []logcollector.ArchiveLogEntry
-	for _, l := range logs {
-		if l.AgentID == agentID {
-			result = append(result, l)
-		}
-	}
-	return result, nil
+	return s.repo.GetLogsByAgentID(agentID)
 }
 
 func (s *logServiceImpl) GetLogsPaged(page, pageSize int) ([]logcollector.ArchiveLogEntry, int, error) {
-	repo := repository.NewFileLogRepository(s.archiveFile)
-	return repo.GetLogsPaged(page, pageSize)
+	return s.repo.GetLogsPaged(page, pageSize)
 }
 
 func (s *logServiceImpl) GetLogsPagedByAgentID(agentID string, page, pageSize int) ([]logcollector.ArchiveLogEntry, int, error) {
-	repo := repository.NewFileLogRepository(s.archiveFile)
-	return repo.GetLogsPagedByAgentID(agentID, page, pageSize)
+	return s.repo.GetLogsPagedByAgentID(agentID, page, pageSize)
+}
+
+func (s *logServiceImpl) SearchLogs(q repository.LogQuery) ([]logcollector.ArchiveLogEntry, string, error) {
+	return s.repo.SearchLogs(q)
+}
+
+func (s *logServiceImpl) ListLogs(q repository.LogQuery, page, pageSize int) ([]logcollector.ArchiveLogEntry, int, error) {
+	return s.repo.ListLogs(q, page, pageSize)
+}
+
+func (s *logServiceImpl) ExportLogs(q repository.LogQuery, fn func(logcollector.ArchiveLogEntry) error) error {
+	return s.repo.ExportLogs(q, fn)
+}
+
+func (s *logServiceImpl) VerifyLogChain() (*logcollector.ChainReport, error) {
+	return s.repo.VerifyLogChain(s.chainPub)
+}
+
+func (s *logServiceImpl) LogVolume(q repository.LogQuery, bucket string) ([]repository.LogVolumePoint, error) {
+	return s.repo.LogVolume(q, bucket)
+}
+
+func (s *logServiceImpl) TopMessages(q repository.LogQuery, n int, templates bool) ([]repository.MessageCount, error) {
+	return s.repo.TopMessages(q, n, templates)
+}
+
+func (s *logServiceImpl) ErrorRate(q repository.LogQuery, bucket, threshold string) ([]repository.ErrorRatePoint, error) {
+	return s.repo.ErrorRate(q, bucket, threshold)
 }
@@ -0,0 +1,22 @@
+package service
+
+import (
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+)
+
+type LoginEventService interface {
+	List(f repository.LoginEventFilter, page, pageSize int) ([]model.LoginEvent, int, error)
+}
+
+type loginEventServiceImpl struct {
+	repo repository.LoginEventRepository
+}
+
+func NewLoginEventService(repo repository.LoginEventRepository) LoginEventService {
+	return &loginEventServiceImpl{repo: repo}
+}
+
+func (s *loginEventServiceImpl) List(f repository.LoginEventFilter, page, pageSize int) ([]model.LoginEvent, int, error) {
+	return s.repo.LoginEventList(f, page, pageSize)
+}
@@ -2,10 +2,20 @@ package service
 
 import (
 	"errors"
+	"fmt"
 	"gou-pc/internal/api/repository"
 	"gou-pc/internal/crypto"
+	"time"
 )
 
+// ErrOTPLocked trả về khi cấp OTP cho thiết bị/tài khoản đang bị tạm khoá do phát hiện brute-force
+var ErrOTPLocked = errors.New("otp issuance locked")
+
+// OTPGuard cho biết thiết bị (và tài khoản gán cho thiết bị) có đang bị khoá cấp OTP không (detect.Detector thoả interface này)
+type OTPGuard interface {
+	OTPLocked(agentID string, usernames ...string) (time.Time, bool)
+}
+
 type OTPService interface {
 	GetOTPByAgentID(agentID string) (string, error)
 	GetOTPByClientID(clientID string) (string, error)
@@ -14,12 +24,39 @@ type OTPService interface {
 }
 
 type otpServiceImpl struct {
-	repo repository.ClientRepository
+	repo  repository.ClientRepository
+	guard OTPGuard
 	// mu   sync.RWMutex
 }
 
-func NewOTPService(repo repository.ClientRepository) OTPService {
-	return &otpServiceImpl{repo: repo}
+// NewOTPService cấp OTP theo agent/client, guard nil = không kiểm tra khoá OTP
+func NewOTPService(repo repository.ClientRepository, guard OTPGuard) OTPService {
+	return &otpServiceImpl{repo: repo, guard: guard}
+}
+
+// checkLock trả về lỗi bọc ErrOTPLocked nếu thiết bị hoặc user được gán cho thiết bị đang bị khoá cấp OTP
+func (s *otpServiceImpl) checkLock(agentID string) error {
+	if s.guard == nil {
+		return nil
+	}
+	var users []string
+	if c, err := s.repo.ClientFindByAgentID(agentID); err == nil && c != nil && c.UserName != "" {
+		users = append(users, c.UserName)
+	}
+	if until, locked := s.guard.OTPLocked(agentID, users...); locked {
+		return fmt.Errorf("%w until %s", ErrOTPLocked, until.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (s *otpServiceImpl) checkClientLock(clientID string) error {
+	if s.guard == nil {
+		return nil
+	}
+	if c, err := s.repo.ClientFindByID(clientID); err == nil && c != nil {
+		return s.checkLock(c.AgentID)
+	}
+	return nil
 }
 
 func (s *otpServiceImpl) GetOTPByAgentID(agentID string) (string, error) {
@@ -27,10 +64,16 @@ func (s *otpServiceImpl) GetOTPByAgentID(agentID string) (string, error) {
 	if err != nil || clientID == "" {
 		return "", errors.New("agent not found")
 	}
+	if err := s.checkLock(agentID); err != nil {
+		return "", err
+	}
 	return crypto.GetTOTPByClientID(clientID)
 }
 
 func (s *otpServiceImpl) GetOTPByClientID(clientID string) (string, error) {
+	if err := s.checkClientLock(clientID); err != nil {
+		return "", err
+	}
 	return crypto.GetTOTPByClientID(clientID)
 }
 
@@ -39,9 +82,15 @@ func (s *otpServiceImpl) GetOTPByAgentIDWithExpire(agentID string) (string, int,
 	if err != nil || clientID == "" {
 		return "", 0, errors.New("agent not found")
 	}
+	if err := s.checkLock(agentID); err != nil {
+		return "", 0, err
+	}
 	return crypto.GetTOTPWithExpireByClientID(clientID)
 }
 
 func (s *otpServiceImpl) GetOTPByClientIDWithExpire(clientID string) (string, int, error) {
+	if err := s.checkClientLock(clientID); err != nil {
+		return "", 0, err
+	}
 	return crypto.GetTOTPWithExpireByClientID(clientID)
 }
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordCost là cost bcrypt khi băm mật khẩu
+const passwordCost = bcrypt.DefaultCost
+
+// ErrInvalidCredentials trả về khi sai username hoặc mật khẩu
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// HashPassword băm mật khẩu bằng bcrypt (tối đa 72 byte)
+func HashPassword(password string) (string, error) {
+	if password == "" {
+		return "", errors.New("password is required")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", errors.New("password must be at most 72 bytes")
+	}
+	return string(hash), err
+}
+
+// IsPasswordHash cho biết giá trị trong cột password đã là hash bcrypt hay còn là mật khẩu plaintext cũ
+func IsPasswordHash(stored string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(stored, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyPassword so mật khẩu với giá trị đã lưu; giá trị plaintext cũ (trước khi băm) vẫn được chấp nhận
+// để người gọi băm lại ngay sau khi đăng nhập thành công
+func VerifyPassword(stored, password string) bool {
+	if IsPasswordHash(stored) {
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+	}
+	return stored != "" && subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+}
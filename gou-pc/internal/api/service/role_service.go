@@ -0,0 +1,196 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidRole trả về khi tên role hoặc quyền không hợp lệ
+	ErrInvalidRole = errors.New("invalid role")
+	// ErrBuiltInRole trả về khi sửa/xoá role có sẵn hoặc tạo role trùng tên role có sẵn
+	ErrBuiltInRole = errors.New("built-in role cannot be modified")
+	// ErrRoleExists trả về khi tạo role đã tồn tại
+	ErrRoleExists = errors.New("role already exists")
+	// ErrRoleInUse trả về khi xoá role còn user được gán
+	ErrRoleInUse = errors.New("role is assigned to users")
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+type RoleService interface {
+	RoleGetAll() ([]model.Role, error)
+	RoleGetByName(name string) (*model.Role, error)
+	RoleCreate(r *model.Role) error
+	RoleUpdate(r *model.Role) error
+	RoleDelete(name string) error
+	// RolePermissions trả về quyền của role, role không tồn tại thì không có quyền nào
+	RolePermissions(role string) []string
+	RoleExists(name string) bool
+}
+
+type roleServiceImpl struct {
+	repo  repository.RoleRepository
+	users repository.UserRepository
+
+	mu    sync.RWMutex
+	perms map[string][]string // role -> quyền, gồm cả role có sẵn
+}
+
+// NewRoleService nạp role tự tạo từ repository; quyền được giữ trong bộ nhớ và nạp lại sau mỗi thay đổi
+func NewRoleService(repo repository.RoleRepository, users repository.UserRepository) (RoleService, error) {
+	s := &roleServiceImpl{repo: repo, users: users}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *roleServiceImpl) reload() error {
+	custom, err := s.repo.RoleGetAll()
+	if err != nil {
+		return err
+	}
+	perms := map[string][]string{}
+	for _, r := range custom {
+		perms[r.Name] = r.Permissions
+	}
+	for _, r := range model.BuiltInRoles() {
+		perms[r.Name] = r.Permissions
+	}
+	s.mu.Lock()
+	s.perms = perms
+	s.mu.Unlock()
+	return nil
+}
+
+func builtInRole(name string) *model.Role {
+	for _, r := range model.BuiltInRoles() {
+		if r.Name == name {
+			return &r
+		}
+	}
+	return nil
+}
+
+func (s *roleServiceImpl) RoleGetAll() ([]model.Role, error) {
+	custom, err := s.repo.RoleGetAll()
+	if err != nil {
+		return nil, err
+	}
+	return append(model.BuiltInRoles(), custom...), nil
+}
+
+func (s *roleServiceImpl) RoleGetByName(name string) (*model.Role, error) {
+	if r := builtInRole(name); r != nil {
+		return r, nil
+	}
+	return s.repo.RoleFindByName(name)
+}
+
+// validateRole kiểm tra tên và quyền, bỏ quyền trùng; lỗi luôn bọc ErrInvalidRole
+func validateRole(r *model.Role) error {
+	if !roleNamePattern.MatchString(r.Name) {
+		return fmt.Errorf("%w: name must be 2-32 lowercase letters, digits, '-' or '_'", ErrInvalidRole)
+	}
+	seen := map[string]bool{}
+	perms := []string{}
+	for _, p := range r.Permissions {
+		if p != model.PermAll && !containsPermission(model.Permissions, p) {
+			return fmt.Errorf("%w: unknown permission %q", ErrInvalidRole, p)
+		}
+		if !seen[p] {
+			seen[p] = true
+			perms = append(perms, p)
+		}
+	}
+	sort.Strings(perms)
+	r.Permissions = perms
+	return nil
+}
+
+func containsPermission(perms []string, p string) bool {
+	for _, v := range perms {
+		if v == p {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *roleServiceImpl) RoleCreate(r *model.Role) error {
+	if builtInRole(r.Name) != nil || r.Name == model.RoleServiceAccount {
+		return ErrBuiltInRole
+	}
+	if err := validateRole(r); err != nil {
+		return err
+	}
+	if _, err := s.repo.RoleFindByName(r.Name); err == nil {
+		return ErrRoleExists
+	}
+	now := time.Now().Format(time.RFC3339)
+	r.BuiltIn = false
+	r.CreatedAt, r.UpdatedAt = now, now
+	if err := s.repo.RoleCreate(r); err != nil {
+		return err
+	}
+	return s.reload()
+}
+
+func (s *roleServiceImpl) RoleUpdate(r *model.Role) error {
+	if builtInRole(r.Name) != nil {
+		return ErrBuiltInRole
+	}
+	old, err := s.repo.RoleFindByName(r.Name)
+	if err != nil {
+		return err
+	}
+	if err := validateRole(r); err != nil {
+		return err
+	}
+	r.BuiltIn = false
+	r.CreatedAt = old.CreatedAt
+	r.UpdatedAt = time.Now().Format(time.RFC3339)
+	if err := s.repo.RoleUpdate(r); err != nil {
+		return err
+	}
+	return s.reload()
+}
+
+func (s *roleServiceImpl) RoleDelete(name string) error {
+	if builtInRole(name) != nil {
+		return ErrBuiltInRole
+	}
+	users, err := s.users.UserGetAll()
+	if err != nil {
+		return err
+	}
+	for _, u := range users {
+		if u.Role == name {
+			return ErrRoleInUse
+		}
+	}
+	if err := s.repo.RoleDelete(name); err != nil {
+		return err
+	}
+	return s.reload()
+}
+
+func (s *roleServiceImpl) RolePermissions(role string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.perms[role]
+}
+
+func (s *roleServiceImpl) RoleExists(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.perms[name]
+	return ok
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestRoleService(t *testing.T) (RoleService, *memUserRepository, *sql.DB) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "roles.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := repository.CreateRoleTables(db); err != nil {
+		t.Fatal(err)
+	}
+	users := &memUserRepository{users: map[string]*model.User{}}
+	s, err := NewRoleService(repository.NewSQLiteRoleRepository(db), users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, users, db
+}
+
+func TestRoleBuiltInPermissions(t *testing.T) {
+	s, _, _ := newTestRoleService(t)
+	cases := []struct {
+		role, perm string
+		want       bool
+	}{
+		{model.RoleAdmin, model.PermRolesManage, true},
+		{model.RoleOperator, model.PermOTPRead, true},
+		{model.RoleOperator, model.PermDevicesManage, true},
+		{model.RoleOperator, model.PermLogsRead, false},
+		{model.RoleAuditor, model.PermAuditRead, true},
+		{model.RoleAuditor, model.PermDevicesManage, false},
+		{model.RoleUser, model.PermDevicesRead, false},
+		{"ghost", model.PermLogsRead, false},
+	}
+	for _, tc := range cases {
+		if got := model.HasPermission(s.RolePermissions(tc.role), tc.perm); got != tc.want {
+			t.Errorf("%s has %s = %v, want %v", tc.role, tc.perm, got, tc.want)
+		}
+	}
+	if err := s.RoleUpdate(&model.Role{Name: model.RoleOperator}); !errors.Is(err, ErrBuiltInRole) {
+		t.Fatalf("update built-in role: got %v", err)
+	}
+	if err := s.RoleDelete(model.RoleAdmin); !errors.Is(err, ErrBuiltInRole) {
+		t.Fatalf("delete built-in role: got %v", err)
+	}
+}
+
+func TestRoleCustomLifecycle(t *testing.T) {
+	s, users, db := newTestRoleService(t)
+	bad := []model.Role{
+		{Name: "Helpdesk", Permissions: []string{model.PermOTPRead}},
+		{Name: "helpdesk", Permissions: []string{"otp.write"}},
+	}
+	for _, r := range bad {
+		if err := s.RoleCreate(&r); !errors.Is(err, ErrInvalidRole) {
+			t.Fatalf("create %+v: got %v, want ErrInvalidRole", r, err)
+		}
+	}
+
+	r := model.Role{Name: "helpdesk", Permissions: []string{model.PermOTPRead, model.PermDevicesRead, model.PermOTPRead}}
+	if err := s.RoleCreate(&r); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{model.PermDevicesRead, model.PermOTPRead}; !reflect.DeepEqual(r.Permissions, want) {
+		t.Fatalf("permissions = %v, want %v", r.Permissions, want)
+	}
+	if err := s.RoleCreate(&model.Role{Name: "helpdesk"}); !errors.Is(err, ErrRoleExists) {
+		t.Fatalf("duplicate create: got %v", err)
+	}
+	if !s.RoleExists("helpdesk") || !model.HasPermission(s.RolePermissions("helpdesk"), model.PermOTPRead) {
+		t.Fatal("new role should be usable immediately")
+	}
+
+	// Sửa quyền có hiệu lực ngay, không cần khởi động lại
+	if err := s.RoleUpdate(&model.Role{Name: "helpdesk", Permissions: []string{model.PermLogsRead}}); err != nil {
+		t.Fatal(err)
+	}
+	if model.HasPermission(s.RolePermissions("helpdesk"), model.PermOTPRead) {
+		t.Fatal("removed permission still granted")
+	}
+
+	// Role được nạp lại từ DB khi khởi động
+	s2, err := NewRoleService(repository.NewSQLiteRoleRepository(db), users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s2.RolePermissions("helpdesk"); !reflect.DeepEqual(got, []string{model.PermLogsRead}) {
+		t.Fatalf("reloaded permissions = %v", got)
+	}
+
+	users.users["carol"] = &model.User{ID: "u-carol", Username: "carol", Role: "helpdesk"}
+	if err := s.RoleDelete("helpdesk"); !errors.Is(err, ErrRoleInUse) {
+		t.Fatalf("delete assigned role: got %v", err)
+	}
+	delete(users.users, "carol")
+	if err := s.RoleDelete("helpdesk"); err != nil {
+		t.Fatal(err)
+	}
+	if s.RoleExists("helpdesk") {
+		t.Fatal("deleted role still exists")
+	}
+	if _, err := s.RoleGetByName("helpdesk"); !errors.Is(err, repository.ErrRoleNotFound) {
+		t.Fatalf("get deleted role: got %v", err)
+	}
+}
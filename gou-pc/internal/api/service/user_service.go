@@ -5,6 +5,8 @@ import (
 	"gou-pc/internal/api/model"
 	"gou-pc/internal/api/repository"
 	"gou-pc/internal/logutil"
+	"strings"
+	"sync"
 
 	"github.com/google/uuid"
 )
@@ -15,10 +17,17 @@ type UserService interface {
 	UserGetByID(id string) (*model.User, error)
 	UserCreate(user *model.User) error
 	UserUpdate(user *model.User) error
+	// UserAuthenticate kiểm tra mật khẩu, trả ErrInvalidCredentials nếu sai username/mật khẩu
+	UserAuthenticate(username, password string) (*model.User, error)
+	// MigratePasswords băm mọi mật khẩu còn lưu plaintext, trả về số user đã băm
+	MigratePasswords() (int, error)
 	UserDeleteByUsername(username string) error
 	UserDeleteByID(id string) error
 }
 
+// ErrReservedUsername là lỗi khi username chứa ':' (dành cho tiền tố model.ServiceAccountUsernamePrefix)
+var ErrReservedUsername = errors.New("username must not contain ':'")
+
 type userServiceImpl struct {
 	repo repository.UserRepository
 }
@@ -46,6 +55,10 @@ func (s *userServiceImpl) UserCreate(user *model.User) error {
 	if user.Username == "" {
 		return errors.New("username is required")
 	}
+	// ':' dành cho danh tính service account ("svc:<tên>"), user thường không được mạo danh
+	if strings.Contains(user.Username, ":") {
+		return ErrReservedUsername
+	}
 	if user.Email == "" {
 		return errors.New("email is required")
 	}
@@ -55,7 +68,12 @@ func (s *userServiceImpl) UserCreate(user *model.User) error {
 	if user.ID == "" {
 		user.ID = uuid.NewString()
 	}
-	err := s.repo.UserCreate(user)
+	hash, err := HashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+	user.Password = hash
+	err = s.repo.UserCreate(user)
 	if err != nil {
 		logutil.APIDebug("UserService.Create: failed to create user %s: %v", user.Username, err)
 		return err
@@ -77,6 +95,14 @@ func (s *userServiceImpl) UserUpdate(user *model.User) error {
 	if user.FullName == "" {
 		return errors.New("full_name is required")
 	}
+	// Password rỗng = giữ mật khẩu cũ
+	if user.Password != "" {
+		hash, err := HashPassword(user.Password)
+		if err != nil {
+			return err
+		}
+		user.Password = hash
+	}
 	err := s.repo.UserUpdate(user)
 	if err != nil {
 		logutil.APIDebug("UserService.Update: failed to update user %s: %v", user.Username, err)
@@ -86,6 +112,60 @@ func (s *userServiceImpl) UserUpdate(user *model.User) error {
 	return nil
 }
 
+func (s *userServiceImpl) UserAuthenticate(username, password string) (*model.User, error) {
+	user, err := s.repo.UserFindByUsername(username)
+	if err != nil || user == nil {
+		// Vẫn chạy bcrypt để thời gian phản hồi không lộ username có tồn tại hay không
+		VerifyPassword(dummyPasswordHash(), password)
+		return nil, ErrInvalidCredentials
+	}
+	if !VerifyPassword(user.Password, password) {
+		return nil, ErrInvalidCredentials
+	}
+	if !IsPasswordHash(user.Password) {
+		// Mật khẩu plaintext còn sót (migration lúc khởi động lỗi): băm lại sau khi đăng nhập đúng
+		if hash, err := HashPassword(password); err == nil {
+			if err := s.repo.UserSetPassword(user.ID, hash); err != nil {
+				logutil.APIDebug("UserService.Authenticate: failed to rehash password for %s: %v", user.Username, err)
+			} else {
+				user.Password = hash
+			}
+		}
+	}
+	return user, nil
+}
+
+// dummyPasswordHash là hash bcrypt dùng so khi username không tồn tại, tính lần đầu cần
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("gou-pc-dummy-password")
+	return hash
+})
+
+func (s *userServiceImpl) MigratePasswords() (int, error) {
+	users, err := s.repo.UserGetAll()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, u := range users {
+		if u.Password == "" || IsPasswordHash(u.Password) {
+			continue
+		}
+		hash, err := HashPassword(u.Password)
+		if err != nil {
+			return n, err
+		}
+		if err := s.repo.UserSetPassword(u.ID, hash); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if n > 0 {
+		logutil.APIInfo("UserService.MigratePasswords: hashed %d plaintext passwords", n)
+	}
+	return n, nil
+}
+
 func (s *userServiceImpl) UserDeleteByUsername(username string) error {
 	err := s.repo.UserDeleteByUsername(username)
 	if err != nil {
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"errors"
+	"gou-pc/internal/api/model"
+	"testing"
+)
+
+// memUserRepository là UserRepository trong bộ nhớ cho test
+type memUserRepository struct {
+	users map[string]*model.User // username -> user
+}
+
+func (r *memUserRepository) UserGetAll() ([]model.User, error) {
+	var users []model.User
+	for _, u := range r.users {
+		users = append(users, *u)
+	}
+	return users, nil
+}
+
+func (r *memUserRepository) UserFindByUsername(username string) (*model.User, error) {
+	if u, ok := r.users[username]; ok {
+		c := *u
+		return &c, nil
+	}
+	return nil, errors.New("user not found")
+}
+
+func (r *memUserRepository) UserFindByID(id string) (*model.User, error) {
+	for _, u := range r.users {
+		if u.ID == id {
+			c := *u
+			return &c, nil
+		}
+	}
+	return nil, errors.New("user not found")
+}
+
+func (r *memUserRepository) UserCreate(user *model.User) error {
+	c := *user
+	r.users[user.Username] = &c
+	return nil
+}
+
+func (r *memUserRepository) UserUpdate(user *model.User) error {
+	u, ok := r.users[user.Username]
+	if !ok {
+		return errors.New("user not found")
+	}
+	if user.Password != "" {
+		u.Password = user.Password
+	}
+	u.Email, u.FullName = user.Email, user.FullName
+	return nil
+}
+
+func (r *memUserRepository) UserSetPassword(id, password string) error {
+	for _, u := range r.users {
+		if u.ID == id {
+			u.Password = password
+			return nil
+		}
+	}
+	return errors.New("user not found")
+}
+
+func (r *memUserRepository) UserDeleteByUsername(username string) error {
+	delete(r.users, username)
+	return nil
+}
+
+func (r *memUserRepository) UserDeleteByID(id string) error { return nil }
+
+func TestUserPasswordHashing(t *testing.T) {
+	repo := &memUserRepository{users: map[string]*model.User{
+		"legacy": {ID: "1", Username: "legacy", Password: "secret"},
+		"old":    {ID: "2", Username: "old", Password: "1"},
+	}}
+	s := NewUserService(repo)
+
+	if err := s.UserCreate(&model.User{Username: "bob", Password: "pw-bob", Email: "b@x", FullName: "Bob"}); err != nil {
+		t.Fatal(err)
+	}
+	if p := repo.users["bob"].Password; !IsPasswordHash(p) || p == "pw-bob" {
+		t.Fatalf("password should be hashed on create, got %q", p)
+	}
+	if _, err := s.UserAuthenticate("bob", "pw-bob"); err != nil {
+		t.Errorf("correct password rejected: %v", err)
+	}
+	for _, c := range [][2]string{{"bob", "wrong"}, {"nobody", "pw-bob"}, {"bob", ""}} {
+		if _, err := s.UserAuthenticate(c[0], c[1]); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%v should be rejected, got %v", c, err)
+		}
+	}
+
+	// Đổi mật khẩu băm lại, Password rỗng giữ nguyên
+	u, _ := repo.UserFindByUsername("bob")
+	u.Password = "pw-new"
+	if err := s.UserUpdate(u); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UserAuthenticate("bob", "pw-new"); err != nil {
+		t.Errorf("new password rejected: %v", err)
+	}
+	hash := repo.users["bob"].Password
+	u.Password, u.Email = "", "bob@x"
+	s.UserUpdate(u)
+	if repo.users["bob"].Password != hash {
+		t.Error("empty password should keep the stored hash")
+	}
+
+	// Plaintext cũ: đăng nhập đúng thì băm lại, migration băm phần còn lại
+	if _, err := s.UserAuthenticate("legacy", "secret"); err != nil {
+		t.Fatalf("legacy plaintext login rejected: %v", err)
+	}
+	if !IsPasswordHash(repo.users["legacy"].Password) {
+		t.Error("legacy password should be rehashed after login")
+	}
+	if n, err := s.MigratePasswords(); err != nil || n != 1 {
+		t.Fatalf("expected 1 migrated password, got %d, %v", n, err)
+	}
+	if _, err := s.UserAuthenticate("old", "1"); err != nil || !IsPasswordHash(repo.users["old"].Password) {
+		t.Errorf("migrated password should verify: %v", err)
+	}
+	if n, _ := s.MigratePasswords(); n != 0 {
+		t.Errorf("second migration should be a no-op, got %d", n)
+	}
+}
@@ -4,50 +4,189 @@ import "time"
 
 // ClientConfig holds all configurable paths and options for the client
 type ClientConfig struct {
-	LogFile    string        // Đường dẫn file log client
-	EventLog   string        // File log sự kiện cần theo dõi
-	OffsetFile string        // File lưu offset log
-	ConfigFile string        // File lưu client_id, agent_id
-	ServerAddr string        // Địa chỉ server
-	Interval   time.Duration // Chu kỳ kiểm tra log
+	LogFile       string            // Đường dẫn file log client
+	LogSources    []LogSourceConfig // Các nguồn log cần theo dõi
+	StateDir      string            // Thư mục lưu checkpoint (offset) của từng nguồn log
+	ConfigFile    string            // File lưu client_id, agent_id
+	ServerAddr    string            // Địa chỉ server
+	Interval      time.Duration     // Chu kỳ kiểm tra log mặc định
+	IPCSecretFile string            // File shared secret IPC (cấp lúc cài đặt), có file thì IPC bắt buộc secret
+	LogParsers    []LogParserConfig // Parser mặc định tách field từ dòng log, thử lần lượt, parser đầu tiên khớp được dùng
+
+	// Vẫn nhận bản tin "GET_SECRET" trần (credential provider cũ chưa gửi secret) khi đã có IPCSecretFile.
+	// Mặc định tắt: bật thì secret không bảo vệ được đường legacy, chỉ còn kiểm tra danh tính tiến trình gọi.
+	IPCAllowLegacyNoSecret bool
+}
+
+// LogSourceConfig cấu hình một nguồn log phía agent
+type LogSourceConfig struct {
+	Name     string            // Nhãn nguồn, gửi kèm mỗi dòng log và dùng đặt tên file checkpoint
+	Path     string            // Đường dẫn file hoặc glob (vd C:\logs\*.log), file mới khớp glob được theo dõi ngay
+	Interval time.Duration     // Chu kỳ kiểm tra riêng, 0 = ClientConfig.Interval
+	Parsers  []LogParserConfig // Parser riêng, nil = ClientConfig.LogParsers
+
+	Multiline        string        // Regex dòng bắt đầu event, dòng không khớp được nối vào event trước (stack trace)
+	MultilineTimeout time.Duration // Event multi-line không có dòng mới sau khoảng này thì gửi, 0 = 3s
+
+	Encoding         string // "auto" (mặc định, nhận BOM UTF-8/UTF-16), "utf-8", "utf-16le", "utf-16be" hoặc code page (windows-1258, ...)
+	FallbackEncoding string // Code page cho dòng không phải UTF-8 hợp lệ khi Encoding là auto/utf-8 (file ANSI)
+
+	Severity string // Mức độ mặc định khi parser không tách được level (debug, info, notice, warning, error, critical)
+}
+
+// LogParserConfig cấu hình một parser log phía agent
+type LogParserConfig struct {
+	Name    string            // Tên parser (để ghi log)
+	Type    string            // "regex" (named group), "json" (JSON lines) hoặc "kv" (key=value)
+	Pattern string            // Regex cho Type "regex"; với "json"/"kv" là regex lọc dòng (tuỳ chọn)
+	Set     map[string]string // Field cố định thêm vào khi parser khớp, vd result=failed
+}
+
+// credentialProviderTime là định dạng thời gian credential provider (C++) ghi đầu dòng: [2006-01-02 15:04:05]
+const credentialProviderTime = `^\[(?P<time>\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2})\] `
+
+// DefaultLogParsers là parser cho log credential provider (C:\credential_provider_log.txt)
+func DefaultLogParsers() []LogParserConfig {
+	return []LogParserConfig{
+		{Name: "cp-logon", Type: "regex", Pattern: credentialProviderTime + `Logon (?P<result>success|failed) for user '(?P<user>[^']*)'`},
+		{Name: "cp-secret", Type: "regex", Pattern: credentialProviderTime + `Logon attempt failed for user '(?P<user>[^']*)': (?P<reason>.*)$`, Set: map[string]string{"result": "failed"}},
+		{Name: "cp-line", Type: "regex", Pattern: credentialProviderTime + `(?P<text>.*)$`},
+	}
 }
 
 func DefaultClientConfig() *ClientConfig {
 	return &ClientConfig{
 		// LogFile:  "etc/client.log",
-		LogFile:  "C:\\Users\\an\\Desktop\\backup\\client.log",
-		EventLog: "C:\\credential_provider_log.txt",
-		// EventLog:   "etc/event.log",
-		OffsetFile: "C:\\Users\\an\\Desktop\\backup\\event.log.offset",
-		ConfigFile: "C:\\Users\\an\\Desktop\\backup\\client_config.json",
-		ServerAddr: "192.168.15.12:9000",
-		Interval:   2 * time.Second,
+		LogFile: "C:\\Users\\an\\Desktop\\backup\\client.log",
+		LogSources: []LogSourceConfig{
+			// wofstream của credential provider (C++) ghi theo code page ANSI của máy
+			{Name: "credential-provider", Path: "C:\\credential_provider_log.txt", Encoding: "auto", FallbackEncoding: "windows-1258"},
+			// {Name: "event", Path: "etc/*.log", Interval: 5 * time.Second},
+		},
+		StateDir:      "C:\\Users\\an\\Desktop\\backup\\logstate",
+		ConfigFile:    "C:\\Users\\an\\Desktop\\backup\\client_config.json",
+		ServerAddr:    "192.168.15.12:9000",
+		Interval:      2 * time.Second,
+		IPCSecretFile: "C:\\Users\\an\\Desktop\\backup\\ipc.secret",
+		LogParsers:    DefaultLogParsers(),
 	}
 }
 
 // ServerConfig holds all configurable paths and options for the server
 type ServerConfig struct {
-	LogFile      string        // Đường dẫn file log server
-	APILogFile   string        // File log API server
-	ArchiveFile  string        // File lưu log thu thập từ agent
-	ClientDBFile string        // File lưu thông tin client/agent
-	UserDBFile   string        // File lưu thông tin user
-	ListenAddr   string        // Địa chỉ lắng nghe TCP
-	APIPort      string        // Cổng chạy API server
-	JWTSecret    string        // Secret key cho JWT
-	JWTExpire    time.Duration // Thời gian sống của JWT
+	LogFile     string // Đường dẫn file log server
+	APILogFile  string // File log API server
+	ArchiveFile string // File lưu log thu thập từ agent
+	LogStore    string // Nơi lưu log: "sqlite" hoặc "file" (ArchiveFile)
+	LogDBFile   string // File SQLite lưu log khi LogStore = "sqlite"
+	// Xoay vòng/lưu giữ log: file archive được nén thành segment <ArchiveFile>.<thời điểm>.gz,
+	// SQLite chỉ áp dụng ArchiveRetainAge
+	ArchiveMaxSize    int64                // Xoay vòng khi file archive lớn hơn (byte)
+	ArchiveMaxAge     time.Duration        // Xoay vòng khi bản ghi đầu file archive cũ hơn
+	ArchiveRetainAge  time.Duration        // Xoá log/segment cũ hơn
+	ArchiveRetainSize int64                // Tổng dung lượng segment tối đa (byte)
+	ClientDBFile      string               // File lưu thông tin client/agent
+	UserDBFile        string               // File lưu thông tin user
+	ListenAddr        string               // Địa chỉ lắng nghe TCP
+	APIPort           string               // Cổng chạy API server
+	JWTSecret         string               // Secret key cho JWT
+	JWTExpire         time.Duration        // Thời gian sống của JWT
+	AlertChannels     []AlertChannelConfig // Kênh gửi cảnh báo, rule tham chiếu theo Name
+	SyslogOutputs     []SyslogOutputConfig // Chuyển tiếp mọi log nhận từ agent tới SIEM qua syslog RFC 5424
+	// Nhận syslog RFC 3164/5424 từ thiết bị không chạy agent, rỗng = tắt
+	SyslogUDPAddr string // vd ":514"
+	SyslogTCPAddr string // vd ":514", octet-counting hoặc mỗi dòng một bản tin (RFC 6587)
+	// Nguồn được gửi syslog (CIDR hoặc IP), rỗng = mọi nguồn
+	SyslogAllowedSources []string
+	// Tự tạo client agentless cho người gửi chưa biết (mặc định tắt, chỉ nhận từ client đã có), tối đa SyslogMaxAgentless client
+	SyslogAutoRegister bool
+	SyslogMaxAgentless int
+
+	// Chuỗi hash chống sửa log: mỗi log mang hash nối với log trước, mắt xích cuối được ký ed25519 định kỳ
+	ArchiveChainKeyFile       string        // File khoá ký checkpoint (seed hex), chưa có thì tự sinh; rỗng = không ký checkpoint
+	ArchiveChainPublicKey     string        // Public key (hex) kiểm tra checkpoint, rỗng = suy ra từ ArchiveChainKeyFile
+	ArchiveCheckpointInterval time.Duration // Chu kỳ ký checkpoint
+
+	BruteForce BruteForceConfig // Phát hiện brute-force/credential stuffing từ sự kiện đăng nhập
+
+	RefreshTokenExpire time.Duration // Thời gian sống refresh token tính từ lúc đăng nhập (không gia hạn khi refresh)
+
+	APIKeyExpire time.Duration // Thời hạn mặc định của API key service account khi tạo không ghi expires_at
+}
+
+// BruteForceConfig cấu hình ngưỡng phát hiện tấn công đăng nhập trên toàn bộ thiết bị, ngưỡng 0 = tắt phát hiện đó
+type BruteForceConfig struct {
+	UserDevices  int           // Cùng một tài khoản đăng nhập lỗi trên ít nhất chừng này thiết bị khác nhau
+	UserWindow   time.Duration // trong khoảng này
+	DeviceUsers  int           // Ít nhất chừng này tài khoản khác nhau đăng nhập lỗi trên cùng một thiết bị
+	DeviceWindow time.Duration // trong khoảng này
+	OTPFailures  int           // Số lần sai OTP trên một thiết bị
+	OTPWindow    time.Duration // trong khoảng này
+	// Tạm khoá cấp OTP cho thiết bị/tài khoản bị phát hiện, admin mở khoá sớm qua API
+	LockOTP      bool
+	LockDuration time.Duration
+}
+
+// SyslogOutputConfig là một đích syslog nhận log chuyển tiếp
+type SyslogOutputConfig struct {
+	Name      string
+	Network   string // "udp", "tcp" hoặc "tls" (TCP + TLS), TCP/TLS đóng khung octet-counting (RFC 6587)
+	Addr      string // host:port
+	Facility  int    // 1-23, 0 = mặc định 16 (local0)
+	AppName   string // mặc định "gou-pc"
+	QueueSize int    // số log chờ gửi tối đa, đầy thì log mới bị bỏ; mặc định 10000
+	// TLS
+	CAFile             string // CA xác thực server, rỗng = CA hệ thống
+	ServerName         string // rỗng = host trong Addr
+	InsecureSkipVerify bool
+}
+
+// AlertChannelConfig là một kênh gửi thông báo cảnh báo
+type AlertChannelConfig struct {
+	Name string
+	Type string // "webhook" (POST JSON tới URL) hoặc "smtp" (gửi mail qua relay nội bộ, không xác thực)
+	URL  string // webhook
+	// smtp
+	SMTPAddr string // host:port của relay, vd "localhost:25"
+	From     string
+	To       []string
 }
 
 func DefaultServerConfig() *ServerConfig {
 	return &ServerConfig{
-		LogFile:      "etc/server.log",
-		APILogFile:   "etc/server-api.log",
-		ArchiveFile:  "etc/archive.log",
-		ClientDBFile: "etc/manager_client.db",
-		UserDBFile:   "etc/users.db",
-		ListenAddr:   ":9000",
-		APIPort:      "8082",
-		JWTSecret:    "an-pt-2001",
-		JWTExpire:    10 * time.Minute,
+		LogFile:           "etc/server.log",
+		APILogFile:        "etc/server-api.log",
+		ArchiveFile:       "etc/archive.log",
+		LogStore:          "sqlite",
+		LogDBFile:         "etc/logs.db",
+		ArchiveMaxSize:    100 << 20,
+		ArchiveMaxAge:     24 * time.Hour,
+		ArchiveRetainAge:  90 * 24 * time.Hour,
+		ArchiveRetainSize: 2 << 30,
+		ClientDBFile:      "etc/manager_client.db",
+		UserDBFile:        "etc/users.db",
+		ListenAddr:        ":9000",
+		APIPort:           "8082",
+		JWTSecret:         "an-pt-2001",
+		JWTExpire:         10 * time.Minute,
+
+		SyslogMaxAgentless: 256,
+
+		ArchiveChainKeyFile:       "etc/archive_chain.key",
+		ArchiveCheckpointInterval: 5 * time.Minute,
+
+		BruteForce: BruteForceConfig{
+			UserDevices:  5,
+			UserWindow:   10 * time.Minute,
+			DeviceUsers:  5,
+			DeviceWindow: 10 * time.Minute,
+			OTPFailures:  10,
+			OTPWindow:    5 * time.Minute,
+			LockDuration: 15 * time.Minute,
+		},
+
+		RefreshTokenExpire: 7 * 24 * time.Hour,
+
+		APIKeyExpire: 90 * 24 * time.Hour,
 	}
 }
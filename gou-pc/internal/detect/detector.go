@@ -0,0 +1,399 @@
+package detect
+
+import (
+	"errors"
+	"fmt"
+	"gou-pc/internal/agent"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+	"gou-pc/internal/config"
+	"gou-pc/internal/logutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// sweepInterval là chu kỳ dọn bộ đếm không còn hit trong cửa sổ và khoá OTP đã hết hạn
+const sweepInterval = time.Minute
+
+var (
+	// ErrIncidentResolved trả về khi resolve incident đã resolved
+	ErrIncidentResolved = errors.New("incident already resolved")
+	// ErrLockNotFound trả về khi mở khoá OTP không tồn tại hoặc đã hết hạn
+	ErrLockNotFound = errors.New("otp lock not found")
+)
+
+// hit là một lần đăng nhập lỗi trong cửa sổ, key là thiết bị (bộ đếm theo tài khoản) hoặc tài khoản (bộ đếm theo thiết bị)
+type hit struct {
+	key string
+	at  time.Time
+}
+
+// incidentKey là khoá incident đang mở: mỗi (loại, đối tượng) có tối đa một incident
+type incidentKey struct {
+	typ, subject string
+}
+
+type lockKey struct {
+	subjectType, subject string
+}
+
+// Detector tương quan đăng nhập lỗi trên toàn bộ thiết bị: một tài khoản lỗi trên nhiều thiết bị,
+// nhiều tài khoản lỗi trên một thiết bị và sai OTP liên tục. Phát hiện sinh incident, tuỳ cấu hình
+// tạm khoá cấp OTP cho thiết bị/tài khoản liên quan.
+type Detector struct {
+	repo repository.IncidentRepository
+	cfg  config.BruteForceConfig
+	now  func() time.Time
+
+	mu          sync.Mutex
+	userFails   map[string][]hit // tài khoản -> thiết bị đăng nhập lỗi
+	deviceFails map[string][]hit // thiết bị -> tài khoản đăng nhập lỗi
+	otpFails    map[string][]hit // thiết bị -> tài khoản sai OTP (có thể rỗng)
+	open        map[incidentKey]*model.Incident
+	locks       map[lockKey]*model.OTPLock
+	lockUntil   map[lockKey]time.Time
+	lastSweep   time.Time
+}
+
+// NewDetector nạp incident đang mở và khoá OTP từ repository
+func NewDetector(repo repository.IncidentRepository, cfg config.BruteForceConfig) (*Detector, error) {
+	d := &Detector{
+		repo:        repo,
+		cfg:         cfg,
+		now:         time.Now,
+		userFails:   map[string][]hit{},
+		deviceFails: map[string][]hit{},
+		otpFails:    map[string][]hit{},
+		open:        map[incidentKey]*model.Incident{},
+		locks:       map[lockKey]*model.OTPLock{},
+		lockUntil:   map[lockKey]time.Time{},
+	}
+	open, err := repo.IncidentList(repository.IncidentFilter{States: []string{model.IncidentOpen}})
+	if err != nil {
+		return nil, err
+	}
+	for i := range open {
+		inc := open[i]
+		d.open[incidentKey{inc.Type, inc.Subject}] = &inc
+	}
+	locks, err := repo.OTPLockList()
+	if err != nil {
+		return nil, err
+	}
+	// Khoá đã hết hạn được dọn ở lần sweep đầu tiên
+	for i := range locks {
+		l := locks[i]
+		until, err := time.Parse(time.RFC3339, l.Until)
+		if err != nil {
+			continue
+		}
+		key := lockKey{l.SubjectType, l.Subject}
+		d.locks[key] = &l
+		d.lockUntil[key] = until
+	}
+	return d, nil
+}
+
+// NormalizeUsername đưa tài khoản về một dạng để so khớp: chữ thường, bỏ tiền tố DOMAIN\ và hậu tố @domain
+func NormalizeUsername(username string) string {
+	u := strings.ToLower(strings.TrimSpace(username))
+	if i := strings.LastIndex(u, `\`); i >= 0 {
+		u = u[i+1:]
+	}
+	if i := strings.Index(u, "@"); i >= 0 {
+		u = u[:i]
+	}
+	return u
+}
+
+// record thêm hit vào bộ đếm và bỏ hit ngoài cửa sổ (window 0 = không giới hạn)
+func record(hits []hit, h hit, window time.Duration) []hit {
+	hits = append(hits, h)
+	if window > 0 {
+		i := 0
+		for i < len(hits) && h.at.Sub(hits[i].at) > window {
+			i++
+		}
+		hits = hits[i:]
+	}
+	return hits
+}
+
+// distinct trả về các key khác nhau (bỏ rỗng) theo thứ tự chữ cái
+func distinct(hits []hit) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, h := range hits {
+		if h.key != "" && !seen[h.key] {
+			seen[h.key] = true
+			keys = append(keys, h.key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ObserveLoginEvent đánh giá một sự kiện đăng nhập, chỉ đăng nhập lỗi được tính; lỗi với method otp còn được
+// tính vào bộ đếm sai OTP
+func (d *Detector) ObserveLoginEvent(e model.LoginEvent) {
+	if e.Result != agent.LoginResultFailed {
+		return
+	}
+	user := NormalizeUsername(e.Username)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	d.sweepLocked(now)
+	if d.cfg.UserDevices > 0 && user != "" {
+		hits := record(d.userFails[user], hit{e.AgentID, now}, d.cfg.UserWindow)
+		d.userFails[user] = hits
+		if devices := distinct(hits); len(devices) >= d.cfg.UserDevices {
+			msg := fmt.Sprintf("user '%s' failed to log on to %d devices within %s", user, len(devices), d.cfg.UserWindow)
+			d.fire(model.IncidentUserSpray, model.SubjectUser, user, devices, []string{user}, len(hits), msg, now)
+		}
+	}
+	if d.cfg.DeviceUsers > 0 {
+		hits := record(d.deviceFails[e.AgentID], hit{user, now}, d.cfg.DeviceWindow)
+		d.deviceFails[e.AgentID] = hits
+		if users := distinct(hits); len(users) >= d.cfg.DeviceUsers {
+			msg := fmt.Sprintf("%d users failed to log on to device %s within %s", len(users), e.AgentID, d.cfg.DeviceWindow)
+			d.fire(model.IncidentDeviceSpray, model.SubjectDevice, e.AgentID, []string{e.AgentID}, users, len(hits), msg, now)
+		}
+	}
+	if e.Method == agent.LoginMethodOTP {
+		d.observeOTPLocked(e.AgentID, user, now)
+	}
+}
+
+// ObserveOTPFailure ghi một lần sai OTP trên thiết bị (verify_otp không hợp lệ), username rỗng nếu không rõ
+func (d *Detector) ObserveOTPFailure(agentID, username string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	d.sweepLocked(now)
+	d.observeOTPLocked(agentID, NormalizeUsername(username), now)
+}
+
+func (d *Detector) observeOTPLocked(agentID, user string, now time.Time) {
+	if d.cfg.OTPFailures <= 0 {
+		return
+	}
+	hits := record(d.otpFails[agentID], hit{user, now}, d.cfg.OTPWindow)
+	d.otpFails[agentID] = hits
+	if len(hits) >= d.cfg.OTPFailures {
+		msg := fmt.Sprintf("%d OTP failures on device %s within %s", len(hits), agentID, d.cfg.OTPWindow)
+		d.fire(model.IncidentOTPBurst, model.SubjectDevice, agentID, []string{agentID}, distinct(hits), len(hits), msg, now)
+	}
+}
+
+// fire tạo incident mới hoặc cập nhật incident đang mở của (loại, đối tượng), gia hạn khoá OTP nếu bật; gọi khi giữ mu
+func (d *Detector) fire(typ, subjectType, subject string, agentIDs, usernames []string, count int, msg string, now time.Time) {
+	key := incidentKey{typ, subject}
+	ts := now.Format(time.RFC3339)
+	inc, ok := d.open[key]
+	if !ok {
+		inc = &model.Incident{
+			ID:          uuid.NewString(),
+			Type:        typ,
+			SubjectType: subjectType,
+			Subject:     subject,
+			State:       model.IncidentOpen,
+			DetectedAt:  ts,
+		}
+	}
+	inc.Message = msg
+	inc.Count = count
+	inc.AgentIDs = mergeSorted(inc.AgentIDs, agentIDs)
+	inc.Usernames = mergeSorted(inc.Usernames, usernames)
+	inc.LastSeenAt = ts
+	if d.cfg.LockOTP && d.cfg.LockDuration > 0 {
+		until := now.Add(d.cfg.LockDuration)
+		inc.LockedUntil = until.Format(time.RFC3339)
+		d.lockLocked(subjectType, subject, until, inc.ID, msg, now)
+	}
+	if ok {
+		if err := d.repo.IncidentUpdate(inc); err != nil {
+			logutil.CoreError("incident %s: update error: %v", inc.ID, err)
+		}
+		return
+	}
+	if err := d.repo.IncidentCreate(inc); err != nil {
+		logutil.CoreError("incident %s %s: create error: %v", typ, subject, err)
+	}
+	d.open[key] = inc
+	logutil.CoreInfo("Incident detected: type=%s %s=%s: %s", typ, subjectType, subject, msg)
+}
+
+func (d *Detector) lockLocked(subjectType, subject string, until time.Time, incidentID, reason string, now time.Time) {
+	key := lockKey{subjectType, subject}
+	l := &model.OTPLock{
+		SubjectType: subjectType,
+		Subject:     subject,
+		Until:       until.Format(time.RFC3339),
+		IncidentID:  incidentID,
+		Reason:      reason,
+		CreatedAt:   now.Format(time.RFC3339),
+	}
+	if old, ok := d.locks[key]; ok {
+		l.CreatedAt = old.CreatedAt
+	} else {
+		logutil.CoreInfo("OTP issuance locked: %s=%s until %s", subjectType, subject, l.Until)
+	}
+	if err := d.repo.OTPLockSave(l); err != nil {
+		logutil.CoreError("otp lock %s=%s: save error: %v", subjectType, subject, err)
+	}
+	d.locks[key] = l
+	d.lockUntil[key] = until
+}
+
+// mergeSorted gộp hai danh sách đã sắp xếp, bỏ trùng
+func mergeSorted(a, b []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, s := range append(append([]string{}, a...), b...) {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// sweepLocked bỏ bộ đếm không còn hit trong cửa sổ và khoá OTP đã hết hạn, tối đa mỗi sweepInterval một lần
+func (d *Detector) sweepLocked(now time.Time) {
+	if now.Sub(d.lastSweep) < sweepInterval {
+		return
+	}
+	d.lastSweep = now
+	for _, c := range []struct {
+		counters map[string][]hit
+		window   time.Duration
+	}{{d.userFails, d.cfg.UserWindow}, {d.deviceFails, d.cfg.DeviceWindow}, {d.otpFails, d.cfg.OTPWindow}} {
+		if c.window <= 0 {
+			continue
+		}
+		for k, hits := range c.counters {
+			if now.Sub(hits[len(hits)-1].at) > c.window {
+				delete(c.counters, k)
+			}
+		}
+	}
+	for key, until := range d.lockUntil {
+		if !until.After(now) {
+			d.unlockLocked(key)
+		}
+	}
+}
+
+func (d *Detector) unlockLocked(key lockKey) {
+	delete(d.locks, key)
+	delete(d.lockUntil, key)
+	if err := d.repo.OTPLockDelete(key.subjectType, key.subject); err != nil {
+		logutil.CoreError("otp lock %s=%s: delete error: %v", key.subjectType, key.subject, err)
+	}
+}
+
+// OTPLocked cho biết có được cấp OTP cho thiết bị agentID (và các tài khoản đi kèm) không;
+// locked = true kèm thời điểm hết khoá muộn nhất nếu thiết bị hoặc một trong các tài khoản đang bị khoá
+func (d *Detector) OTPLocked(agentID string, usernames ...string) (until time.Time, locked bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	keys := []lockKey{{model.SubjectDevice, agentID}}
+	for _, u := range usernames {
+		if u = NormalizeUsername(u); u != "" {
+			keys = append(keys, lockKey{model.SubjectUser, u})
+		}
+	}
+	for _, k := range keys {
+		if t, ok := d.lockUntil[k]; ok && t.After(now) && t.After(until) {
+			until, locked = t, true
+		}
+	}
+	return until, locked
+}
+
+// Locks trả về các khoá OTP còn hiệu lực, hết hạn muộn nhất trước
+func (d *Detector) Locks() []model.OTPLock {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	locks := []model.OTPLock{}
+	for key, l := range d.locks {
+		if d.lockUntil[key].After(now) {
+			locks = append(locks, *l)
+		}
+	}
+	sort.Slice(locks, func(i, j int) bool {
+		if locks[i].Until != locks[j].Until {
+			return locks[i].Until > locks[j].Until
+		}
+		return locks[i].Subject < locks[j].Subject
+	})
+	return locks
+}
+
+// Unlock mở khoá OTP của thiết bị (subjectType device) hoặc tài khoản (user) trước hạn
+func (d *Detector) Unlock(subjectType, subject string) error {
+	if subjectType == model.SubjectUser {
+		subject = NormalizeUsername(subject)
+	}
+	key := lockKey{subjectType, subject}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if until, ok := d.lockUntil[key]; !ok || !until.After(d.now()) {
+		return ErrLockNotFound
+	}
+	d.unlockLocked(key)
+	logutil.CoreInfo("OTP issuance unlocked: %s=%s", subjectType, subject)
+	return nil
+}
+
+// Resolve đóng incident và mở khoá OTP do incident đó đặt; đăng nhập lỗi sau đó được đếm lại từ đầu
+func (d *Detector) Resolve(id, by string) (*model.Incident, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var inc *model.Incident
+	for _, i := range d.open {
+		if i.ID == id {
+			inc = i
+		}
+	}
+	if inc == nil {
+		found, err := d.repo.IncidentFindByID(id)
+		if err != nil {
+			return nil, err
+		}
+		inc = found
+	}
+	if inc.State == model.IncidentResolved {
+		return nil, ErrIncidentResolved
+	}
+	now := d.now()
+	inc.State = model.IncidentResolved
+	inc.ResolvedBy = by
+	inc.ResolvedAt = now.Format(time.RFC3339)
+	if err := d.repo.IncidentUpdate(inc); err != nil {
+		return nil, err
+	}
+	delete(d.open, incidentKey{inc.Type, inc.Subject})
+	switch inc.Type {
+	case model.IncidentUserSpray:
+		delete(d.userFails, inc.Subject)
+	case model.IncidentDeviceSpray:
+		delete(d.deviceFails, inc.Subject)
+	case model.IncidentOTPBurst:
+		delete(d.otpFails, inc.Subject)
+	}
+	key := lockKey{inc.SubjectType, inc.Subject}
+	if l, ok := d.locks[key]; ok && l.IncidentID == inc.ID {
+		d.unlockLocked(key)
+	}
+	logutil.CoreInfo("Incident resolved: type=%s %s=%s by=%q", inc.Type, inc.SubjectType, inc.Subject, by)
+	return inc, nil
+}
@@ -0,0 +1,180 @@
+package detect
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+	"gou-pc/internal/config"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestDetector(t *testing.T, cfg config.BruteForceConfig) (*Detector, repository.IncidentRepository, *fakeClock) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "incidents.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := repository.CreateIncidentTables(db); err != nil {
+		t.Fatal(err)
+	}
+	repo := repository.NewSQLiteIncidentRepository(db)
+	d, err := NewDetector(repo, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := &fakeClock{t: time.Date(2024, 6, 1, 10, 0, 0, 0, time.Local)}
+	d.now = clock.now
+	return d, repo, clock
+}
+
+func failed(agentID, user, method string) model.LoginEvent {
+	return model.LoginEvent{AgentID: agentID, Username: user, Result: "failed", Method: method}
+}
+
+func TestDetectUserOnManyDevices(t *testing.T) {
+	d, repo, clock := newTestDetector(t, config.BruteForceConfig{
+		UserDevices: 3, UserWindow: 10 * time.Minute, LockOTP: true, LockDuration: 15 * time.Minute,
+	})
+	// Cùng thiết bị lặp lại và đăng nhập thành công không được tính là thiết bị khác
+	d.ObserveLoginEvent(failed("001", `CORP\Bob`, "otp"))
+	d.ObserveLoginEvent(failed("001", "bob", "otp"))
+	d.ObserveLoginEvent(model.LoginEvent{AgentID: "002", Username: "bob", Result: "success"})
+	clock.advance(11 * time.Minute)
+	d.ObserveLoginEvent(failed("002", "bob@corp.local", "otp"))
+	d.ObserveLoginEvent(failed("003", "BOB", "otp"))
+	if incidents, _ := repo.IncidentList(repository.IncidentFilter{}); len(incidents) != 0 {
+		t.Fatalf("device outside window should not count: %+v", incidents)
+	}
+	d.ObserveLoginEvent(failed("004", "bob", "otp"))
+	incidents, _ := repo.IncidentList(repository.IncidentFilter{})
+	if len(incidents) != 1 {
+		t.Fatalf("expected one incident, got %+v", incidents)
+	}
+	inc := incidents[0]
+	if inc.Type != model.IncidentUserSpray || inc.SubjectType != model.SubjectUser || inc.Subject != "bob" ||
+		fmt.Sprint(inc.AgentIDs) != "[002 003 004]" || inc.State != model.IncidentOpen || inc.LockedUntil == "" {
+		t.Errorf("unexpected incident: %+v", inc)
+	}
+	if _, locked := d.OTPLocked("009", `corp\bob`); !locked {
+		t.Error("user should be locked on any device")
+	}
+	if _, locked := d.OTPLocked("002", "alice"); locked {
+		t.Error("device should not be locked by a user incident")
+	}
+
+	// Thêm thiết bị khi incident còn mở: cập nhật incident, không tạo mới
+	d.ObserveLoginEvent(failed("005", "bob", "otp"))
+	if incidents, _ := repo.IncidentList(repository.IncidentFilter{}); len(incidents) != 1 || len(incidents[0].AgentIDs) != 4 {
+		t.Fatalf("open incident should be updated: %+v", incidents)
+	}
+
+	// Resolve mở khoá và đếm lại từ đầu
+	if _, err := d.Resolve(inc.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, locked := d.OTPLocked("009", "bob"); locked {
+		t.Error("resolve should lift the lock")
+	}
+	if _, err := d.Resolve(inc.ID, "admin"); !errors.Is(err, ErrIncidentResolved) {
+		t.Errorf("resolving twice should fail, got %v", err)
+	}
+	d.ObserveLoginEvent(failed("006", "bob", "otp"))
+	if incidents, _ := repo.IncidentList(repository.IncidentFilter{States: []string{model.IncidentOpen}}); len(incidents) != 0 {
+		t.Errorf("counter should restart after resolve: %+v", incidents)
+	}
+}
+
+func TestDetectDeviceManyUsersAndOTPBurst(t *testing.T) {
+	d, repo, clock := newTestDetector(t, config.BruteForceConfig{
+		DeviceUsers: 3, DeviceWindow: 10 * time.Minute, OTPFailures: 4, OTPWindow: time.Minute,
+		LockOTP: true, LockDuration: 15 * time.Minute,
+	})
+	for _, u := range []string{"alice", "bob", "carol"} {
+		d.ObserveLoginEvent(failed("001", u, ""))
+	}
+	incidents, _ := repo.IncidentList(repository.IncidentFilter{Types: []string{model.IncidentDeviceSpray}})
+	if len(incidents) != 1 || incidents[0].Subject != "001" || fmt.Sprint(incidents[0].Usernames) != "[alice bob carol]" {
+		t.Fatalf("expected device incident: %+v", incidents)
+	}
+	if _, locked := d.OTPLocked("001"); !locked {
+		t.Error("device should be locked")
+	}
+	if err := d.Unlock(model.SubjectDevice, "001"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Unlock(model.SubjectDevice, "001"); !errors.Is(err, ErrLockNotFound) {
+		t.Errorf("second unlock should fail, got %v", err)
+	}
+
+	// Sai OTP: login event method otp và verify_otp không hợp lệ cùng được đếm
+	d.ObserveLoginEvent(failed("002", "dave", "otp"))
+	d.ObserveOTPFailure("002", "")
+	d.ObserveOTPFailure("002", "")
+	clock.advance(2 * time.Minute)
+	d.ObserveOTPFailure("002", "")
+	d.ObserveOTPFailure("002", "")
+	if incidents, _ := repo.IncidentList(repository.IncidentFilter{Types: []string{model.IncidentOTPBurst}}); len(incidents) != 0 {
+		t.Fatalf("failures outside window should not count: %+v", incidents)
+	}
+	d.ObserveOTPFailure("002", "")
+	d.ObserveOTPFailure("002", "")
+	incidents, _ = repo.IncidentList(repository.IncidentFilter{Types: []string{model.IncidentOTPBurst}})
+	if len(incidents) != 1 || incidents[0].Subject != "002" || incidents[0].Count != 4 {
+		t.Fatalf("expected OTP burst incident: %+v", incidents)
+	}
+	if locks := d.Locks(); len(locks) != 1 || locks[0].Subject != "002" || locks[0].IncidentID != incidents[0].ID {
+		t.Errorf("unexpected locks: %+v", locks)
+	}
+
+	// Khoá hết hạn tự mở, khoá còn hạn được nạp lại khi khởi động
+	d2, err := NewDetector(repo, d.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2.now = clock.now
+	if _, locked := d2.OTPLocked("002"); !locked {
+		t.Error("lock should survive restart")
+	}
+	clock.advance(16 * time.Minute)
+	if _, locked := d.OTPLocked("002"); locked {
+		t.Error("lock should expire")
+	}
+}
+
+func TestDetectDisabledAndNoLock(t *testing.T) {
+	d, repo, _ := newTestDetector(t, config.BruteForceConfig{UserDevices: 2, UserWindow: time.Minute})
+	for i := 0; i < 20; i++ {
+		d.ObserveLoginEvent(failed("001", fmt.Sprintf("user%d", i), "otp"))
+	}
+	if incidents, _ := repo.IncidentList(repository.IncidentFilter{}); len(incidents) != 0 {
+		t.Fatalf("disabled detections should not fire: %+v", incidents)
+	}
+	d.ObserveLoginEvent(failed("002", "user1", ""))
+	incidents, _ := repo.IncidentList(repository.IncidentFilter{})
+	if len(incidents) != 1 || incidents[0].LockedUntil != "" {
+		t.Fatalf("expected one incident without lock: %+v", incidents)
+	}
+	if _, locked := d.OTPLocked("002", "user1"); locked {
+		t.Error("LockOTP off should not lock")
+	}
+}
+
+func TestNormalizeUsername(t *testing.T) {
+	for in, want := range map[string]string{`CORP\Bob`: "bob", "Bob@corp.local": "bob", " alice ": "alice", "": ""} {
+		if got := NormalizeUsername(in); got != want {
+			t.Errorf("NormalizeUsername(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
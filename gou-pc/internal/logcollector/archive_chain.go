@@ -0,0 +1,220 @@
+package logcollector
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+// chainHeads nhớ mắt xích cuối của từng file archive trong tiến trình, được bảo vệ bởi archiveMu
+var chainHeads = map[string]ChainLink{}
+
+// chainFloors nhớ seq sớm nhất còn trong archive (kể cả segment), được bảo vệ bởi archiveMu; retention xoá segment thì xoá cache
+var chainFloors = map[string]int64{}
+
+// errFloorFound dừng archiveFloor khi đã gặp log có hash đầu tiên
+var errFloorFound = errors.New("floor found")
+
+// CheckpointFile là file JSONL lưu checkpoint đã ký của archive
+func CheckpointFile(archiveFile string) string {
+	return archiveFile + ".checkpoints"
+}
+
+// archiveHead trả về mắt xích cuối của archive (gọi khi giữ archiveMu): lần đầu đọc log cuối của file hiện tại,
+// file rỗng (vừa xoay vòng) thì của segment mới nhất. Log cuối là log cũ chưa có hash hoặc không đọc được
+// thì bắt đầu chuỗi mới, chỗ nối sẽ bị VerifyArchive báo đứt nếu trước đó đã có chuỗi.
+func archiveHead(archiveFile string) (ChainLink, error) {
+	if head, ok := chainHeads[archiveFile]; ok {
+		return head, nil
+	}
+	line, err := lastLine(archiveFile)
+	if err != nil {
+		return ChainLink{}, err
+	}
+	var last ArchiveLogEntry
+	if len(line) > 0 {
+		json.Unmarshal(line, &last)
+	} else {
+		segs, err := Segments(archiveFile)
+		if err != nil {
+			return ChainLink{}, err
+		}
+		for i := len(segs) - 1; i >= 0; i-- {
+			found := false
+			if err := scanFile(segs[i], -1, func(e ArchiveLogEntry) error {
+				last, found = e, true
+				return nil
+			}); err != nil {
+				return ChainLink{}, err
+			}
+			if found {
+				break
+			}
+		}
+	}
+	head := ChainLink{}
+	if last.Hash != "" {
+		head = ChainLink{Seq: last.Seq, Hash: last.Hash}
+	}
+	chainHeads[archiveFile] = head
+	return head, nil
+}
+
+// ArchiveFloor trả seq của log có hash sớm nhất còn trong archive (kể cả segment), 0 nếu chưa có
+func ArchiveFloor(archiveFile string) (int64, error) {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+	return archiveFloor(archiveFile)
+}
+
+// archiveFloor trả seq của log có hash sớm nhất còn trong archive (gọi khi giữ archiveMu), 0 nếu chưa có
+func archiveFloor(archiveFile string) (int64, error) {
+	if floor, ok := chainFloors[archiveFile]; ok {
+		return floor, nil
+	}
+	segs, err := Segments(archiveFile)
+	if err != nil {
+		return 0, err
+	}
+	var floor int64
+	find := func(e ArchiveLogEntry) error {
+		if e.Hash == "" {
+			return nil
+		}
+		floor = e.Seq
+		return errFloorFound
+	}
+	for _, path := range append(segs, archiveFile) {
+		err := scanFile(path, -1, find)
+		if errors.Is(err, errFloorFound) {
+			chainFloors[archiveFile] = floor
+			return floor, nil
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+// lastLine đọc dòng cuối (bỏ qua xuống dòng ở cuối) của file, file không tồn tại thì trả nil
+func lastLine(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	const chunk = 64 << 10
+	var buf []byte
+	for end := info.Size(); end > 0; {
+		start := end - chunk
+		if start < 0 {
+			start = 0
+		}
+		b := make([]byte, end-start)
+		if _, err := f.ReadAt(b, start); err != nil {
+			return nil, err
+		}
+		buf = append(b, buf...)
+		trimmed := bytes.TrimRight(buf, "\r\n")
+		if i := bytes.LastIndexByte(trimmed, '\n'); i >= 0 {
+			return trimmed[i+1:], nil
+		}
+		end = start
+	}
+	return bytes.TrimRight(buf, "\r\n"), nil
+}
+
+// AppendCheckpoint ký mắt xích cuối và floor của archive rồi ghi vào CheckpointFile, trả nil nếu chuỗi chưa có log mới
+// và retention chưa xoá gì kể từ checkpoint trước
+func AppendCheckpoint(archiveFile string, key ed25519.PrivateKey, now time.Time) (*ChainCheckpoint, error) {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+	head, err := archiveHead(archiveFile)
+	if err != nil || head.Seq == 0 {
+		return nil, err
+	}
+	floor, err := archiveFloor(archiveFile)
+	if err != nil {
+		return nil, err
+	}
+	line, err := lastLine(CheckpointFile(archiveFile))
+	if err != nil {
+		return nil, err
+	}
+	var prev ChainCheckpoint
+	if len(line) > 0 && json.Unmarshal(line, &prev) == nil && prev.Seq == head.Seq && prev.Floor == floor {
+		return nil, nil
+	}
+	cp := SignCheckpoint(head, floor, key, now)
+	f, err := os.OpenFile(CheckpointFile(archiveFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := json.NewEncoder(f).Encode(cp); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
+
+// LoadCheckpoints đọc toàn bộ checkpoint của archive, chưa có file thì trả rỗng
+func LoadCheckpoints(archiveFile string) ([]ChainCheckpoint, error) {
+	f, err := os.Open(CheckpointFile(archiveFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var cps []ChainCheckpoint
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		var c ChainCheckpoint
+		if err := dec.Decode(&c); err != nil {
+			return nil, err
+		}
+		cps = append(cps, c)
+	}
+	return cps, nil
+}
+
+// VerifyArchive duyệt các segment rồi file archive hiện tại, kiểm tra chuỗi hash và đối chiếu checkpoint đã ký bằng pub
+// (nil = không đối chiếu). ID trong ChainBreak là số dòng tính từ segment cũ nhất.
+func VerifyArchive(archiveFile string, pub ed25519.PublicKey) (*ChainReport, error) {
+	cps, err := LoadCheckpoints(archiveFile)
+	if err != nil {
+		return nil, err
+	}
+	v := NewChainVerifier(cps, pub)
+	var line int64
+	err = ScanArchive(archiveFile, func(e ArchiveLogEntry) error {
+		line++
+		e.ID = line
+		return v.Add(e)
+	})
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		seq := int64(1)
+		if v.prev != nil {
+			seq = v.prev.Seq + 1
+		}
+		v.fail(ChainBreak{Seq: seq, ID: line + 1, Reason: "unreadable entry: " + err.Error()})
+	case err != nil && !errors.Is(err, ErrChainBroken):
+		return nil, err
+	}
+	return v.Report(), nil
+}
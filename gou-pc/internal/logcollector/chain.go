@@ -0,0 +1,226 @@
+package logcollector
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ChainLink là mắt xích cuối của chuỗi hash: số thứ tự và hash của log ghi sau cùng
+type ChainLink struct {
+	Seq  int64  `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+// ChainCheckpoint là mắt xích được ký (ed25519) định kỳ, giúp phát hiện việc sửa rồi tính lại toàn bộ chuỗi
+// hoặc cắt bỏ log ở đầu (Floor) và ở cuối
+type ChainCheckpoint struct {
+	Seq       int64  `json:"seq"`
+	Hash      string `json:"hash"`
+	Floor     int64  `json:"floor,omitempty"` // seq sớm nhất retention còn giữ lúc ký, 0 = checkpoint cũ không có floor
+	Time      string `json:"time"`
+	Signature string `json:"signature"` // hex
+}
+
+// ChainBreak là vị trí đầu tiên chuỗi bị đứt
+type ChainBreak struct {
+	Seq    int64  `json:"seq"`
+	ID     int64  `json:"id,omitempty"` // id trong log store (SQLite) hoặc số dòng (file), 0 nếu lỗi nằm ở checkpoint
+	Time   string `json:"time,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// ChainReport là kết quả kiểm tra chuỗi hash của log store
+type ChainReport struct {
+	OK          bool             `json:"ok"`
+	Entries     int64            `json:"entries"`   // số log có hash đã kiểm tra
+	Unchained   int64            `json:"unchained"` // log ghi trước khi có chuỗi hash
+	FirstSeq    int64            `json:"first_seq"`
+	LastSeq     int64            `json:"last_seq"`
+	Checkpoints int              `json:"checkpoints"` // số checkpoint đã đối chiếu với log
+	Last        *ChainCheckpoint `json:"last_checkpoint,omitempty"`
+	PublicKey   string           `json:"public_key,omitempty"` // khoá dùng kiểm tra chữ ký checkpoint (hex)
+	Break       *ChainBreak      `json:"break,omitempty"`
+}
+
+// ErrChainBroken được ChainVerifier.Add trả về để dừng duyệt khi đã gặp chỗ đứt
+var ErrChainBroken = errors.New("log chain broken")
+
+// chainHash là sha256(prevHash + "\n" + JSON của entry không gồm ID/PrevHash/Hash), Seq nằm trong phần được hash
+func chainHash(prevHash string, e ArchiveLogEntry) string {
+	e.ID, e.PrevHash, e.Hash = 0, "", ""
+	b, _ := json.Marshal(e)
+	h := sha256.New()
+	h.Write([]byte(prevHash))
+	h.Write([]byte{'\n'})
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Link gắn entry vào sau prev (đặt Seq, PrevHash, Hash) và trả về mắt xích mới.
+// Entry phải ở đúng dạng sẽ đọc lại từ log store, nếu không hash sẽ không khớp khi kiểm tra.
+func Link(prev ChainLink, e *ArchiveLogEntry) ChainLink {
+	e.Seq = prev.Seq + 1
+	e.PrevHash = prev.Hash
+	e.Hash = chainHash(e.PrevHash, *e)
+	return ChainLink{Seq: e.Seq, Hash: e.Hash}
+}
+
+func checkpointMessage(seq, floor int64, hash, t string) []byte {
+	msg := fmt.Sprintf("gou-pc log checkpoint|%d|%s|%s", seq, hash, t)
+	if floor > 0 {
+		msg += fmt.Sprintf("|floor=%d", floor)
+	}
+	return []byte(msg)
+}
+
+// SignCheckpoint ký mắt xích link cùng floor (seq sớm nhất còn trong log store) tại thời điểm now
+func SignCheckpoint(link ChainLink, floor int64, key ed25519.PrivateKey, now time.Time) ChainCheckpoint {
+	t := now.Format(time.RFC3339)
+	return ChainCheckpoint{
+		Seq:       link.Seq,
+		Hash:      link.Hash,
+		Floor:     floor,
+		Time:      t,
+		Signature: hex.EncodeToString(ed25519.Sign(key, checkpointMessage(link.Seq, floor, link.Hash, t))),
+	}
+}
+
+// Valid kiểm tra chữ ký checkpoint bằng public key
+func (c ChainCheckpoint) Valid(pub ed25519.PublicKey) bool {
+	sig, err := hex.DecodeString(c.Signature)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return false
+	}
+	return ed25519.Verify(pub, checkpointMessage(c.Seq, c.Floor, c.Hash, c.Time), sig)
+}
+
+// LoadOrCreateChainKey đọc khoá ký checkpoint (seed ed25519 dạng hex) từ path, chưa có thì sinh mới với quyền 0600
+func LoadOrCreateChainKey(path string) (ed25519.PrivateKey, error) {
+	b, err := os.ReadFile(path)
+	if err == nil {
+		seed, err := hex.DecodeString(strings.TrimSpace(string(b)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("invalid chain key file %s", path)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(seed)+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// ChainVerifier kiểm tra lần lượt các log theo thứ tự ghi. Có checkpoint mang floor thì log có hash đầu tiên phải
+// đúng seq floor của checkpoint mới nhất (phần trước đã bị retention xoá), không thì log đầu tiên có Seq > 1 được
+// chấp nhận làm điểm bắt đầu; checkpoint trước điểm bắt đầu được bỏ qua.
+// Log chưa có hash chỉ được chấp nhận khi chưa có checkpoint nào và nằm trước chuỗi.
+type ChainVerifier struct {
+	pub         ed25519.PublicKey
+	checkpoints map[int64]ChainCheckpoint
+	floor       int64
+	report      ChainReport
+	prev        *ChainLink
+}
+
+// NewChainVerifier tạo verifier; pub nil thì không đối chiếu checkpoint.
+// Checkpoint sai chữ ký được báo đứt ngay tại seq của checkpoint đó.
+func NewChainVerifier(checkpoints []ChainCheckpoint, pub ed25519.PublicKey) *ChainVerifier {
+	v := &ChainVerifier{pub: pub, checkpoints: map[int64]ChainCheckpoint{}, report: ChainReport{OK: true}}
+	if pub == nil {
+		return v
+	}
+	v.report.PublicKey = hex.EncodeToString(pub)
+	// Cùng seq (ký lại sau retention) thì checkpoint ghi sau thắng
+	sort.SliceStable(checkpoints, func(i, j int) bool { return checkpoints[i].Seq < checkpoints[j].Seq })
+	for _, c := range checkpoints {
+		if !c.Valid(pub) {
+			v.fail(ChainBreak{Seq: c.Seq, Time: c.Time, Reason: "checkpoint signature invalid"})
+			return v
+		}
+		v.checkpoints[c.Seq] = c
+		last := c
+		v.report.Last = &last
+		v.floor = c.Floor
+	}
+	return v
+}
+
+func (v *ChainVerifier) fail(b ChainBreak) error {
+	v.report.OK = false
+	v.report.Break = &b
+	return ErrChainBroken
+}
+
+// Add kiểm tra entry tiếp theo, trả ErrChainBroken khi đã gặp chỗ đứt (các lần gọi sau cũng vậy)
+func (v *ChainVerifier) Add(e ArchiveLogEntry) error {
+	if v.report.Break != nil {
+		return ErrChainBroken
+	}
+	at := func(reason string) error {
+		return v.fail(ChainBreak{Seq: e.Seq, ID: e.ID, Time: e.Time, Reason: reason})
+	}
+	if e.Hash == "" {
+		if v.prev != nil {
+			return at("entry without hash after chain start")
+		}
+		if len(v.checkpoints) > 0 {
+			return at("entry without hash, chain has signed checkpoints")
+		}
+		v.report.Unchained++
+		return nil
+	}
+	if chainHash(e.PrevHash, e) != e.Hash {
+		return at("hash mismatch, entry modified")
+	}
+	switch {
+	case v.prev != nil && e.Seq != v.prev.Seq+1:
+		return at(fmt.Sprintf("sequence gap after %d, entries removed or reordered", v.prev.Seq))
+	case v.prev != nil && e.PrevHash != v.prev.Hash:
+		return at("prev_hash mismatch, entries removed or replaced")
+	case v.prev == nil && e.Seq == 1 && e.PrevHash != "":
+		return at("first entry has prev_hash")
+	case v.prev == nil && v.floor > 0 && e.Seq != v.floor:
+		return at(fmt.Sprintf("chain starts at seq %d but signed retention floor is %d, entries removed or replaced", e.Seq, v.floor))
+	case e.Seq < 1:
+		return at("invalid sequence")
+	}
+	if c, ok := v.checkpoints[e.Seq]; ok {
+		if c.Hash != e.Hash {
+			return at("hash differs from signed checkpoint, chain rewritten")
+		}
+		v.report.Checkpoints++
+	}
+	if v.prev == nil {
+		v.report.FirstSeq = e.Seq
+	}
+	v.prev = &ChainLink{Seq: e.Seq, Hash: e.Hash}
+	v.report.LastSeq = e.Seq
+	v.report.Entries++
+	return nil
+}
+
+// Report kết thúc kiểm tra: checkpoint nằm sau log cuối cùng nghĩa là log ở cuối đã bị cắt bỏ
+func (v *ChainVerifier) Report() *ChainReport {
+	if v.report.Break == nil && v.report.Last != nil && v.report.Last.Seq > v.report.LastSeq {
+		v.fail(ChainBreak{Seq: v.report.LastSeq + 1, Time: v.report.Last.Time,
+			Reason: fmt.Sprintf("entries missing, signed checkpoint at seq %d but log ends at seq %d", v.report.Last.Seq, v.report.LastSeq)})
+	}
+	r := v.report
+	return &r
+}
@@ -0,0 +1,208 @@
+package logcollector
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeChainedArchive ghi n log vào archive, xoay vòng sau log thứ rotateAt (0 = không xoay vòng)
+func writeChainedArchive(t *testing.T, archive string, n, rotateAt int) {
+	t.Helper()
+	for i := 1; i <= n; i++ {
+		e := ArchiveLogEntry{Time: "2024-06-01T10:00:00+07:00", AgentID: "001", Message: fmt.Sprintf("msg%d", i),
+			Fields: map[string]string{"i": fmt.Sprint(i)}}
+		if err := AppendArchive(archive, []ArchiveLogEntry{e}); err != nil {
+			t.Fatal(err)
+		}
+		if i == rotateAt {
+			if err := RotateLog(archive); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestVerifyArchiveChain(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "archive.log")
+	key, err := LoadOrCreateChainKey(filepath.Join(dir, "chain.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := key.Public().(ed25519.PublicKey)
+	writeChainedArchive(t, archive, 3, 2)
+	if cp, err := AppendCheckpoint(archive, key, time.Now()); err != nil || cp == nil || cp.Seq != 3 || cp.Floor != 1 {
+		t.Fatalf("AppendCheckpoint: %+v, %v", cp, err)
+	}
+	if cp, _ := AppendCheckpoint(archive, key, time.Now()); cp != nil {
+		t.Errorf("no new log, checkpoint should be skipped: %+v", cp)
+	}
+	// Khởi động lại tiến trình: mắt xích cuối đọc lại từ file
+	delete(chainHeads, archive)
+	writeChainedArchive(t, archive, 2, 0)
+
+	r, err := VerifyArchive(archive, pub)
+	if err != nil || !r.OK || r.Entries != 5 || r.Unchained != 0 || r.FirstSeq != 1 || r.LastSeq != 5 || r.Checkpoints != 1 {
+		t.Fatalf("untouched archive should verify: %+v, %v", r, err)
+	}
+	logs, _ := LoadArchiveLogs(archive)
+	if logs[3].PrevHash != logs[2].Hash || logs[4].Seq != 5 {
+		t.Errorf("chain not continued after restart: %+v", logs[2:])
+	}
+
+	// Sửa message của log seq 4 (dòng 5) trong file hiện tại
+	data, _ := os.ReadFile(archive)
+	if err := os.WriteFile(archive, []byte(strings.Replace(string(data), `"msg1"`, `"msgX"`, 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, _ = VerifyArchive(archive, pub)
+	if r.OK || r.Break == nil || r.Break.Seq != 4 || r.Break.ID != 4 || !strings.Contains(r.Break.Reason, "hash mismatch") {
+		t.Errorf("modified entry should break chain: %+v", r.Break)
+	}
+
+	// File hiện tại chứa seq 3..5; xoá log seq 4 thì log seq 5 không nối tiếp
+	lines := strings.SplitAfter(string(data), "\n")
+	if err := os.WriteFile(archive, []byte(lines[0]+lines[2]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, _ = VerifyArchive(archive, pub)
+	if r.OK || r.Break.Seq != 5 || !strings.Contains(r.Break.Reason, "sequence gap") {
+		t.Errorf("removed entry should break chain: %+v", r.Break)
+	}
+
+	// Cắt bỏ toàn bộ file hiện tại: chỉ còn seq 1..2 trong segment, checkpoint seq 3 cho thấy log cuối bị mất
+	os.WriteFile(archive, nil, 0644)
+	r, _ = VerifyArchive(archive, pub)
+	if r.OK || r.LastSeq != 2 || !strings.Contains(r.Break.Reason, "entries missing") {
+		t.Errorf("truncated archive should be reported: %+v", r)
+	}
+
+	// Checkpoint giả mạo (ký bằng khoá khác)
+	os.WriteFile(archive, data, 0644)
+	_, other, _ := ed25519.GenerateKey(nil)
+	forged := SignCheckpoint(ChainLink{Seq: 5, Hash: logs[4].Hash}, 1, other, time.Now())
+	f, _ := os.OpenFile(CheckpointFile(archive), os.O_APPEND|os.O_WRONLY, 0644)
+	fmt.Fprintf(f, `{"seq":%d,"hash":%q,"time":%q,"signature":%q}`+"\n", forged.Seq, forged.Hash, forged.Time, forged.Signature)
+	f.Close()
+	r, _ = VerifyArchive(archive, pub)
+	if r.OK || r.Break.Seq != 5 || r.Break.Reason != "checkpoint signature invalid" {
+		t.Errorf("forged checkpoint should be reported: %+v", r.Break)
+	}
+	if r, _ := VerifyArchive(archive, nil); !r.OK {
+		t.Errorf("without public key checkpoints are not checked: %+v", r.Break)
+	}
+}
+
+// TestVerifyArchiveRetentionFloor: retention xoá segment thì checkpoint ký lại floor mới; xoá hoặc bỏ hash phần đầu
+// mà không có floor đã ký tương ứng thì bị báo đứt
+func TestVerifyArchiveRetentionFloor(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "archive.log")
+	_, key, _ := ed25519.GenerateKey(nil)
+	pub := key.Public().(ed25519.PublicKey)
+	writeChainedArchive(t, archive, 4, 2)
+	if cp, err := AppendCheckpoint(archive, key, time.Now()); err != nil || cp == nil || cp.Floor != 1 {
+		t.Fatalf("AppendCheckpoint: %+v, %v", cp, err)
+	}
+	if err := ApplyRetention(archive, RotationPolicy{RetainSize: 1}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := VerifyArchive(archive, pub)
+	if r.OK || r.Break.Seq != 3 || !strings.Contains(r.Break.Reason, "retention floor") {
+		t.Errorf("pruned head without new checkpoint should be reported: %+v", r.Break)
+	}
+	if cp, err := AppendCheckpoint(archive, key, time.Now()); err != nil || cp == nil || cp.Seq != 4 || cp.Floor != 3 {
+		t.Fatalf("floor changed, checkpoint should be signed again: %+v, %v", cp, err)
+	}
+	if r, _ := VerifyArchive(archive, pub); !r.OK || r.FirstSeq != 3 || r.Entries != 2 {
+		t.Fatalf("pruned head with signed floor should verify: %+v", r)
+	}
+
+	data, _ := os.ReadFile(archive)
+	lines := strings.SplitAfter(string(data), "\n")
+	// Bỏ hash của log đầu để nó thành log "cũ" nằm trước chuỗi
+	var first ArchiveLogEntry
+	json.Unmarshal([]byte(lines[0]), &first)
+	first.Seq, first.PrevHash, first.Hash = 0, "", ""
+	stripped, _ := json.Marshal(first)
+	os.WriteFile(archive, []byte(string(stripped)+"\n"+lines[1]), 0644)
+	r, _ = VerifyArchive(archive, pub)
+	if r.OK || !strings.Contains(r.Break.Reason, "entry without hash") {
+		t.Errorf("stripped prefix should break chain: %+v", r.Break)
+	}
+	// Xoá log đầu
+	os.WriteFile(archive, []byte(lines[1]), 0644)
+	r, _ = VerifyArchive(archive, pub)
+	if r.OK || r.Break.Seq != 4 || !strings.Contains(r.Break.Reason, "retention floor") {
+		t.Errorf("deleted prefix should break chain: %+v", r.Break)
+	}
+}
+
+func TestChainVerifierPrunedHead(t *testing.T) {
+	var entries []ArchiveLogEntry
+	head := ChainLink{}
+	for i := 0; i < 4; i++ {
+		e := ArchiveLogEntry{Time: "t", AgentID: "001", Message: fmt.Sprint(i)}
+		head = Link(head, &e)
+		entries = append(entries, e)
+	}
+	_, key, _ := ed25519.GenerateKey(nil)
+	pub := key.Public().(ed25519.PublicKey)
+	cp1 := SignCheckpoint(ChainLink{Seq: 1, Hash: entries[0].Hash}, 1, key, time.Now())
+	verify := func(cps []ChainCheckpoint, entries []ArchiveLogEntry) *ChainReport {
+		v := NewChainVerifier(cps, pub)
+		for _, e := range entries {
+			if v.Add(e) != nil {
+				break
+			}
+		}
+		return v.Report()
+	}
+
+	// Hai log đầu đã bị retention xoá và checkpoint sau đó ký floor 3: bắt đầu kiểm tra từ seq 3, checkpoint seq 1 bỏ qua
+	pruned := []ChainCheckpoint{cp1, SignCheckpoint(ChainLink{Seq: 3, Hash: entries[2].Hash}, 3, key, time.Now())}
+	if r := verify(pruned, entries[2:]); !r.OK || r.FirstSeq != 3 || r.Entries != 2 || r.Checkpoints != 1 {
+		t.Errorf("pruned head should verify: %+v", r)
+	}
+
+	// Xoá phần đầu khi floor đã ký vẫn là 1
+	signed := []ChainCheckpoint{cp1, SignCheckpoint(ChainLink{Seq: 3, Hash: entries[2].Hash}, 1, key, time.Now())}
+	if r := verify(signed, entries[2:]); r.OK || r.Break.Seq != 3 || !strings.Contains(r.Break.Reason, "retention floor") {
+		t.Errorf("deleted prefix should break chain: %+v", r.Break)
+	}
+	// Còn log dưới floor đã ký
+	if r := verify(pruned, entries); r.OK || r.Break.Seq != 1 || !strings.Contains(r.Break.Reason, "retention floor") {
+		t.Errorf("start below signed floor should break chain: %+v", r.Break)
+	}
+
+	// Bỏ hash/prev_hash của hai log đầu để chúng thành log "cũ" trước chuỗi
+	stripped := append([]ArchiveLogEntry{}, entries...)
+	for i := range stripped[:2] {
+		stripped[i].Seq, stripped[i].PrevHash, stripped[i].Hash = 0, "", ""
+	}
+	if r := verify(signed, stripped); r.OK || !strings.Contains(r.Break.Reason, "entry without hash") {
+		t.Errorf("stripped prefix should break chain: %+v", r.Break)
+	}
+	// Checkpoint cũ không có floor vẫn không chấp nhận log không hash
+	legacy := []ChainCheckpoint{SignCheckpoint(ChainLink{Seq: 3, Hash: entries[2].Hash}, 0, key, time.Now())}
+	if r := verify(legacy, stripped); r.OK || !strings.Contains(r.Break.Reason, "entry without hash") {
+		t.Errorf("stripped prefix should break chain with legacy checkpoint: %+v", r.Break)
+	}
+	// Chưa có checkpoint: log cũ chưa có hash trước chuỗi được chấp nhận
+	if r := verify(nil, append([]ArchiveLogEntry{{Time: "t", AgentID: "001", Message: "legacy"}}, entries...)); !r.OK || r.Unchained != 1 {
+		t.Errorf("legacy entries before chain should verify without checkpoints: %+v", r)
+	}
+
+	v := NewChainVerifier(nil, nil)
+	v.Add(entries[0])
+	legacyEntry := ArchiveLogEntry{Time: "t", AgentID: "001", Message: "inserted"}
+	if err := v.Add(legacyEntry); err != ErrChainBroken || v.Report().Break.Reason != "entry without hash after chain start" {
+		t.Errorf("unchained entry after chain start should break: %+v", v.Report().Break)
+	}
+}
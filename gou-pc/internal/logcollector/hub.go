@@ -0,0 +1,85 @@
+package logcollector
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultSubscriberBuffer là số log mỗi subscriber được giữ chờ gửi, đầy thì log mới bị bỏ cho subscriber đó
+const DefaultSubscriberBuffer = 256
+
+// Hub phát log mới nhận cho các subscriber (tail realtime) trong cùng tiến trình.
+// Publish không bao giờ chặn: subscriber chậm chỉ mất log của chính nó, không làm chậm việc nhận log.
+type Hub struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscription nhận log khớp bộ lọc qua C cho tới khi Close
+type Subscription struct {
+	C <-chan ArchiveLogEntry
+
+	ch      chan ArchiveLogEntry
+	match   func(ArchiveLogEntry) bool
+	dropped atomic.Int64
+	hub     *Hub
+	once    sync.Once
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: map[*Subscription]struct{}{}}
+}
+
+// Subscribe đăng ký nhận log, match = nil thì nhận mọi log, buffer <= 0 thì dùng DefaultSubscriberBuffer
+func (h *Hub) Subscribe(match func(ArchiveLogEntry) bool, buffer int) *Subscription {
+	if buffer <= 0 {
+		buffer = DefaultSubscriberBuffer
+	}
+	ch := make(chan ArchiveLogEntry, buffer)
+	s := &Subscription{C: ch, ch: ch, match: match, hub: h}
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+	return s
+}
+
+// Publish gửi log cho mọi subscriber có bộ lọc khớp, subscriber có buffer đầy thì bị bỏ log này
+func (h *Hub) Publish(entry ArchiveLogEntry) {
+	if h == nil {
+		return
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for s := range h.subs {
+		if s.match != nil && !s.match(entry) {
+			continue
+		}
+		select {
+		case s.ch <- entry:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribers trả về số subscriber đang đăng ký
+func (h *Hub) Subscribers() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs)
+}
+
+// Dropped là tổng số log bị bỏ vì subscriber đọc không kịp
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close huỷ đăng ký và đóng C, gọi nhiều lần không sao
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.hub.mu.Lock()
+		delete(s.hub.subs, s)
+		s.hub.mu.Unlock()
+		close(s.ch)
+	})
+}
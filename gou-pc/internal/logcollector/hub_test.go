@@ -0,0 +1,46 @@
+package logcollector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHubFilterAndSlowSubscriber(t *testing.T) {
+	hub := NewHub()
+	fast := hub.Subscribe(func(e ArchiveLogEntry) bool { return e.AgentID == "001" }, 10)
+	defer fast.Close()
+	slow := hub.Subscribe(nil, 1)
+	defer slow.Close()
+
+	done := make(chan struct{})
+	go func() {
+		for _, id := range []string{"001", "002", "001"} {
+			hub.Publish(ArchiveLogEntry{AgentID: id, Message: "msg"})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on slow subscriber")
+	}
+
+	if n := len(fast.C); n != 2 {
+		t.Errorf("filtered subscriber should get 2 logs, got %d", n)
+	}
+	if len(slow.C) != 1 || slow.Dropped() != 2 {
+		t.Errorf("slow subscriber: buffered=%d dropped=%d", len(slow.C), slow.Dropped())
+	}
+
+	slow.Close()
+	slow.Close()
+	if _, ok := <-slow.C; !ok {
+		t.Error("buffered log should still be readable after Close")
+	}
+	if _, ok := <-slow.C; ok {
+		t.Error("C should be closed after Close")
+	}
+	if hub.Subscribers() != 1 {
+		t.Errorf("closed subscriber should be removed, got %d", hub.Subscribers())
+	}
+}
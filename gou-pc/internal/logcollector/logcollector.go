@@ -7,31 +7,139 @@ import (
 )
 
 type ArchiveLogEntry struct {
-	Time    string `json:"time"`
-	AgentID string `json:"agent_id"`
-	Message string `json:"message"`
+	ID         int64             `json:"id,omitempty"`          // khoá trong log store (SQLite) hoặc số dòng (file), không lưu trong file archive
+	Time       string            `json:"time"`                  // thời điểm xảy ra do agent gửi (RFC3339), agent không gửi thì bằng ReceivedAt
+	ReceivedAt string            `json:"received_at,omitempty"` // thời điểm server nhận, rỗng với log cũ (coi như bằng Time)
+	AgentID    string            `json:"agent_id"`
+	Message    string            `json:"message"`
+	Fields     map[string]string `json:"fields,omitempty"`      // field do parser phía agent tách ra (user, result, ...)
+	Source     string            `json:"source,omitempty"`      // nhãn nguồn log phía agent
+	Severity   string            `json:"severity,omitempty"`    // một trong Severities, rỗng = không rõ
+	SourceFile string            `json:"source_file,omitempty"` // file log phía agent chứa dòng này
+
+	// Chuỗi hash chống sửa (xem Link): số thứ tự, hash của log trước và hash của log này, rỗng với log cũ
+	Seq      int64  `json:"seq,omitempty"`
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// Received trả về thời điểm server nhận log, log cũ chưa có ReceivedAt thì lấy Time
+func (e ArchiveLogEntry) Received() string {
+	if e.ReceivedAt != "" {
+		return e.ReceivedAt
+	}
+	return e.Time
 }
 
-// LoadArchiveLogs đọc toàn bộ log từ file archive.log
+// LoadArchiveLogs đọc toàn bộ log: các segment đã xoay vòng (cũ nhất trước) rồi tới file archive hiện tại
 func LoadArchiveLogs(archiveFile string) ([]ArchiveLogEntry, error) {
-	f, err := os.Open(archiveFile)
+	var logs []ArchiveLogEntry
+	err := ScanArchive(archiveFile, func(entry ArchiveLogEntry) error {
+		logs = append(logs, entry)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return logs, nil
+}
+
+// ScanArchive đọc lần lượt từng log của các segment rồi file archive hiện tại mà không giữ cả archive trong bộ nhớ.
+// fn trả lỗi thì dừng và trả lỗi đó. Danh sách file và kích thước file hiện tại được chụp và mở dưới khoá rồi mới đọc,
+// nên xoay vòng/retention không phải chờ lượt đọc mà cũng không làm mất hoặc lặp log; log ghi thêm trong lúc đọc không được tính.
+func ScanArchive(archiveFile string, fn func(ArchiveLogEntry) error) error {
+	files, size, err := openArchiveSnapshot(archiveFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for i, f := range files {
+		var r io.Reader = f
+		if i == len(files)-1 && size >= 0 {
+			r = io.LimitReader(f, size)
+		}
+		if err := decodeEntries(r, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openArchiveSnapshot mở các segment (cũ nhất trước) và file archive hiện tại (nếu có, ở cuối) dưới khoá,
+// trả kèm kích thước file hiện tại lúc mở, -1 nếu không có file hiện tại
+func openArchiveSnapshot(archiveFile string) ([]io.ReadCloser, int64, error) {
+	rotateMu.RLock()
+	defer rotateMu.RUnlock()
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+	segs, err := Segments(archiveFile)
+	if err != nil {
+		return nil, -1, err
+	}
+	var files []io.ReadCloser
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	for _, seg := range segs {
+		f, err := openSegment(seg)
+		if err != nil {
+			closeAll()
+			return nil, -1, err
+		}
+		files = append(files, f)
+	}
+	f, err := openShared(archiveFile)
+	if err != nil {
+		if os.IsNotExist(err) && len(segs) > 0 {
+			return files, -1, nil
+		}
+		closeAll()
+		return nil, -1, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		closeAll()
+		return nil, -1, err
+	}
+	return append(files, f), info.Size(), nil
+}
+
+// scanFile giải mã từng dòng JSONL của path, limit >= 0 thì chỉ đọc limit byte đầu
+func scanFile(path string, limit int64, fn func(ArchiveLogEntry) error) error {
+	f, err := openSegment(path)
+	if err != nil {
+		return err
+	}
 	defer f.Close()
-	var logs []ArchiveLogEntry
-	dec := json.NewDecoder(f)
+	var r io.Reader = f
+	if limit >= 0 {
+		r = io.LimitReader(f, limit)
+	}
+	return decodeEntries(r, fn)
+}
+
+// decodeEntries giải mã từng dòng JSONL của r và gọi fn
+func decodeEntries(r io.Reader, fn func(ArchiveLogEntry) error) error {
+	dec := json.NewDecoder(r)
 	for {
 		var entry ArchiveLogEntry
 		if err := dec.Decode(&entry); err != nil {
 			if err == io.EOF {
-				break
+				return nil
 			}
-			return nil, err
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
 		}
-		logs = append(logs, entry)
 	}
-	return logs, nil
 }
 
 // GetLogsPaged phân trang log từ file archive.log, đảo ngược thứ tự (mới nhất lên đầu)
@@ -55,17 +163,3 @@ func GetLogsPaged(archiveFile string, page, pageSize int) ([]ArchiveLogEntry, in
 	}
 	return logs[start:end], total, nil
 }
-
-// RotateLog đổi tên file log hiện tại sang <log>.old, tạo file mới
-func RotateLog(archiveFile string) error {
-	oldPath := archiveFile + ".old"
-	_ = os.Remove(oldPath)
-	if err := os.Rename(archiveFile, oldPath); err != nil {
-		return err
-	}
-	f, err := os.Create(archiveFile)
-	if err != nil {
-		return err
-	}
-	return f.Close()
-}
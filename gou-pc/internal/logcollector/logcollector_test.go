@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -41,10 +43,7 @@ func TestGetLogsPaged(t *testing.T) {
 }
 
 func TestRotateLog(t *testing.T) {
-	tmp := "test_archive.log"
-	old := tmp + ".old"
-	defer os.Remove(tmp)
-	defer os.Remove(old)
+	tmp := filepath.Join(t.TempDir(), "archive.log")
 	entries := []ArchiveLogEntry{
 		{Time: "1", AgentID: "a", Message: "msg1"},
 	}
@@ -53,14 +52,19 @@ func TestRotateLog(t *testing.T) {
 	if err := RotateLog(tmp); err != nil {
 		t.Fatalf("RotateLog error: %v", err)
 	}
-	// Check old file exists and new file is empty
-	if _, err := os.Stat(old); err != nil {
-		t.Errorf("old log file not found after rotate")
+	// Check compressed segment exists and new file is empty
+	segs, err := Segments(tmp)
+	if err != nil || len(segs) != 1 || !strings.HasSuffix(segs[0], ".gz") {
+		t.Fatalf("expected one .gz segment after rotate, got %v (%v)", segs, err)
 	}
 	info, err := os.Stat(tmp)
 	if err != nil || info.Size() != 0 {
 		t.Errorf("new log file not empty after rotate")
 	}
+	logs, err := LoadArchiveLogs(tmp)
+	if err != nil || len(logs) != 1 || logs[0].Message != "msg1" {
+		t.Errorf("rotated log should still be readable: %+v (%v)", logs, err)
+	}
 }
 
 func TestGetLogsPaged_RealFileCopy(t *testing.T) {
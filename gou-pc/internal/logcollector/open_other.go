@@ -0,0 +1,10 @@
+//go:build !windows
+
+package logcollector
+
+import "os"
+
+// openShared mở file để đọc; trên POSIX file đang mở vẫn đọc được sau khi bị đổi tên/xoá
+func openShared(path string) (*os.File, error) {
+	return os.Open(path)
+}
@@ -0,0 +1,24 @@
+//go:build windows
+
+package logcollector
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// openShared mở file để đọc với FILE_SHARE_DELETE, xoay vòng/retention vẫn đổi tên/xoá được file khi ScanArchive đang đọc
+func openShared(path string) (*os.File, error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := windows.CreateFile(p, windows.GENERIC_READ,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil, windows.OPEN_EXISTING, windows.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(h), path), nil
+}
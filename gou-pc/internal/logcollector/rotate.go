@@ -0,0 +1,315 @@
+package logcollector
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotationPolicy cấu hình xoay vòng và lưu giữ file archive, trường bằng 0 thì bỏ qua điều kiện đó
+type RotationPolicy struct {
+	MaxSize    int64         // Xoay vòng khi file archive hiện tại lớn hơn (byte)
+	MaxAge     time.Duration // Xoay vòng khi bản ghi đầu tiên của file hiện tại cũ hơn
+	RetainAge  time.Duration // Xoá segment đã xoay vòng cũ hơn
+	RetainSize int64         // Tổng dung lượng segment tối đa (byte), vượt thì xoá segment cũ nhất
+}
+
+// segmentTimeFormat là thời điểm xoay vòng trong tên segment: <archive>.20060102T150405[-n].gz
+const segmentTimeFormat = "20060102T150405"
+
+var (
+	// archiveMu tuần tự hoá ghi và xoay vòng file archive trong cùng tiến trình
+	archiveMu sync.Mutex
+	// rotateMu: xoay vòng/retention chờ ScanArchive chụp danh sách file và mở xong, việc đọc sau đó chạy song song
+	rotateMu sync.RWMutex
+)
+
+// segment là một file archive đã xoay vòng
+type segment struct {
+	path    string
+	rotated time.Time
+	seq     int
+	size    int64
+}
+
+// AppendArchive ghi thêm log vào cuối file archive (JSONL), mỗi log được nối vào chuỗi hash (xem Link),
+// không chạy song song với RotateLog
+func AppendArchive(archiveFile string, entries []ArchiveLogEntry) error {
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+	head, err := archiveHead(archiveFile)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(archiveFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, e := range entries {
+		e.ID = 0
+		next := Link(head, &e)
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+		head = next
+		chainHeads[archiveFile] = head
+	}
+	return nil
+}
+
+// Segments trả về đường dẫn các segment đã xoay vòng, cũ nhất trước.
+// File <archive>.old của phiên bản trước (không nén) được tính là segment cũ nhất.
+func Segments(archiveFile string) ([]string, error) {
+	segs, err := listSegments(archiveFile)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(segs))
+	for i, s := range segs {
+		paths[i] = s.path
+	}
+	return paths, nil
+}
+
+func listSegments(archiveFile string) ([]segment, error) {
+	matches, err := filepath.Glob(globEscape(archiveFile) + ".*.gz")
+	if err != nil {
+		return nil, err
+	}
+	var segs []segment
+	for _, m := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(m, archiveFile+"."), ".gz")
+		seq := 0
+		if i := strings.IndexByte(stamp, '-'); i >= 0 {
+			n, err := strconv.Atoi(stamp[i+1:])
+			if err != nil {
+				continue
+			}
+			stamp, seq = stamp[:i], n
+		}
+		t, err := time.ParseInLocation(segmentTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := os.Stat(m)
+		if err != nil {
+			continue
+		}
+		segs = append(segs, segment{path: m, rotated: t, seq: seq, size: info.Size()})
+	}
+	sort.Slice(segs, func(i, j int) bool {
+		if !segs[i].rotated.Equal(segs[j].rotated) {
+			return segs[i].rotated.Before(segs[j].rotated)
+		}
+		return segs[i].seq < segs[j].seq
+	})
+	if info, err := os.Stat(archiveFile + ".old"); err == nil {
+		segs = append([]segment{{path: archiveFile + ".old", rotated: info.ModTime(), size: info.Size()}}, segs...)
+	}
+	return segs, nil
+}
+
+func globEscape(path string) string {
+	r := strings.NewReplacer("*", `\*`, "?", `\?`, "[", `\[`)
+	if os.PathSeparator == '\\' {
+		r = strings.NewReplacer("*", "[*]", "?", "[?]", "[", "[[]")
+	}
+	return r.Replace(path)
+}
+
+// openSegment mở segment hoặc file archive, tự giải nén nếu là .gz
+func openSegment(path string) (io.ReadCloser, error) {
+	f, err := openShared(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{zr, f}, nil
+}
+
+// OpenArchive mở file archive JSONL (thường hoặc .gz) để đọc theo luồng
+func OpenArchive(path string) (io.ReadCloser, error) {
+	return openSegment(path)
+}
+
+// RotateLog nén file archive hiện tại thành segment <archive>.<thời điểm>.gz rồi làm rỗng file hiện tại
+func RotateLog(archiveFile string) error {
+	rotateMu.Lock()
+	defer rotateMu.Unlock()
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+	return rotateLocked(archiveFile, time.Now())
+}
+
+func rotateLocked(archiveFile string, now time.Time) error {
+	info, err := os.Stat(archiveFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.Size() == 0 {
+		return nil
+	}
+	stamp := now.Format(segmentTimeFormat)
+	dst := fmt.Sprintf("%s.%s.gz", archiveFile, stamp)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(dst); os.IsNotExist(err) {
+			break
+		}
+		dst = fmt.Sprintf("%s.%s-%d.gz", archiveFile, stamp, i)
+	}
+	if err := compressFile(archiveFile, dst); err != nil {
+		return err
+	}
+	// Đổi tên rồi xoá thay vì truncate: ScanArchive đang đọc giữ handle tới file cũ nên không mất log
+	old := dst + ".rotated"
+	if err := os.Rename(archiveFile, old); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(archiveFile, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(old)
+}
+
+// compressFile ghi bản gzip của src ra file tạm rồi đổi tên, không để lại segment dở dang khi lỗi
+func compressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if serr := out.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// RotateIfNeeded xoay vòng theo MaxSize/MaxAge rồi áp dụng retention, trả true nếu đã xoay vòng
+func RotateIfNeeded(archiveFile string, p RotationPolicy, now time.Time) (bool, error) {
+	rotateMu.Lock()
+	defer rotateMu.Unlock()
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+	rotated := false
+	if needsRotation(archiveFile, p, now) {
+		if err := rotateLocked(archiveFile, now); err != nil {
+			return false, err
+		}
+		rotated = true
+	}
+	return rotated, applyRetention(archiveFile, p, now)
+}
+
+func needsRotation(archiveFile string, p RotationPolicy, now time.Time) bool {
+	info, err := os.Stat(archiveFile)
+	if err != nil || info.Size() == 0 {
+		return false
+	}
+	if p.MaxSize > 0 && info.Size() >= p.MaxSize {
+		return true
+	}
+	if p.MaxAge > 0 {
+		if first, ok := firstEntryTime(archiveFile); ok && now.Sub(first) >= p.MaxAge {
+			return true
+		}
+	}
+	return false
+}
+
+// firstEntryTime đọc thời điểm server nhận bản ghi đầu tiên trong file archive
+func firstEntryTime(archiveFile string) (time.Time, bool) {
+	f, err := os.Open(archiveFile)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return time.Time{}, false
+	}
+	var entry ArchiveLogEntry
+	if json.Unmarshal(line, &entry) != nil {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, entry.Received())
+	return t, err == nil
+}
+
+// ApplyRetention xoá segment cũ hơn RetainAge, sau đó xoá segment cũ nhất cho tới khi tổng dung lượng không vượt RetainSize
+func ApplyRetention(archiveFile string, p RotationPolicy, now time.Time) error {
+	rotateMu.Lock()
+	defer rotateMu.Unlock()
+	archiveMu.Lock()
+	defer archiveMu.Unlock()
+	return applyRetention(archiveFile, p, now)
+}
+
+func applyRetention(archiveFile string, p RotationPolicy, now time.Time) error {
+	if p.RetainAge <= 0 && p.RetainSize <= 0 {
+		return nil
+	}
+	segs, err := listSegments(archiveFile)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, s := range segs {
+		total += s.size
+	}
+	for _, s := range segs {
+		expired := p.RetainAge > 0 && now.Sub(s.rotated) > p.RetainAge
+		oversize := p.RetainSize > 0 && total > p.RetainSize
+		if !expired && !oversize {
+			break
+		}
+		if err := os.Remove(s.path); err != nil {
+			return err
+		}
+		delete(chainFloors, archiveFile)
+		total -= s.size
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package logcollector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotateIfNeededBySizeAndAge(t *testing.T) {
+	tmp := filepath.Join(t.TempDir(), "archive.log")
+	now := time.Date(2024, 6, 2, 12, 0, 0, 0, time.Local)
+	entry := ArchiveLogEntry{Time: now.Add(-time.Hour).Format(time.RFC3339), AgentID: "a", Message: "msg1"}
+	if err := AppendArchive(tmp, []ArchiveLogEntry{entry}); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := RotateIfNeeded(tmp, RotationPolicy{MaxSize: 1 << 20, MaxAge: 2 * time.Hour}, now)
+	if err != nil || rotated {
+		t.Fatalf("small, recent archive should not rotate: rotated=%v err=%v", rotated, err)
+	}
+	rotated, err = RotateIfNeeded(tmp, RotationPolicy{MaxAge: 30 * time.Minute}, now)
+	if err != nil || !rotated {
+		t.Fatalf("archive older than MaxAge should rotate: rotated=%v err=%v", rotated, err)
+	}
+
+	entry.Message = "msg2"
+	if err := AppendArchive(tmp, []ArchiveLogEntry{entry}); err != nil {
+		t.Fatal(err)
+	}
+	// Cùng thời điểm xoay vòng: segment thứ hai được đánh số, không ghi đè
+	rotated, err = RotateIfNeeded(tmp, RotationPolicy{MaxSize: 10}, now)
+	if err != nil || !rotated {
+		t.Fatalf("archive larger than MaxSize should rotate: rotated=%v err=%v", rotated, err)
+	}
+	segs, _ := Segments(tmp)
+	if len(segs) != 2 {
+		t.Fatalf("expected 2 segments, got %v", segs)
+	}
+
+	entry.Message = "msg3"
+	if err := AppendArchive(tmp, []ArchiveLogEntry{entry}); err != nil {
+		t.Fatal(err)
+	}
+	logs, err := LoadArchiveLogs(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgs []string
+	for _, l := range logs {
+		msgs = append(msgs, l.Message)
+	}
+	if len(msgs) != 3 || msgs[0] != "msg1" || msgs[1] != "msg2" || msgs[2] != "msg3" {
+		t.Errorf("logs across segments out of order: %v", msgs)
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	tmp := filepath.Join(t.TempDir(), "archive.log")
+	now := time.Date(2024, 6, 10, 0, 0, 0, 0, time.Local)
+	for i, age := range []time.Duration{9 * 24 * time.Hour, 5 * 24 * time.Hour, 2 * 24 * time.Hour, time.Hour} {
+		entry := ArchiveLogEntry{Time: now.Format(time.RFC3339), AgentID: "a", Message: string(rune('a' + i))}
+		if err := AppendArchive(tmp, []ArchiveLogEntry{entry}); err != nil {
+			t.Fatal(err)
+		}
+		archiveMu.Lock()
+		err := rotateLocked(tmp, now.Add(-age))
+		archiveMu.Unlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ApplyRetention(tmp, RotationPolicy{RetainAge: 7 * 24 * time.Hour}, now); err != nil {
+		t.Fatal(err)
+	}
+	segs, _ := Segments(tmp)
+	if len(segs) != 3 {
+		t.Fatalf("segment older than RetainAge should be removed, got %v", segs)
+	}
+
+	info, err := os.Stat(segs[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyRetention(tmp, RotationPolicy{RetainSize: info.Size()}, now); err != nil {
+		t.Fatal(err)
+	}
+	remain, _ := Segments(tmp)
+	if len(remain) != 1 || remain[0] != segs[2] {
+		t.Errorf("oldest segments should be removed to fit RetainSize: %v", remain)
+	}
+}
+
+func TestScanArchiveDoesNotBlockRotation(t *testing.T) {
+	tmp := filepath.Join(t.TempDir(), "archive.log")
+	now := time.Now()
+	for _, msg := range []string{"msg1", "msg2"} {
+		if err := AppendArchive(tmp, []ArchiveLogEntry{{Time: now.Format(time.RFC3339), AgentID: "a", Message: msg}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := RotateLog(tmp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := AppendArchive(tmp, []ArchiveLogEntry{{Time: now.Format(time.RFC3339), AgentID: "a", Message: "msg3"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Xoay vòng rồi xoá mọi segment giữa lúc đọc: không bị chặn và lượt đọc vẫn thấy đúng ảnh chụp lúc bắt đầu
+	var msgs []string
+	err := ScanArchive(tmp, func(e ArchiveLogEntry) error {
+		if len(msgs) == 0 {
+			done := make(chan error, 1)
+			go func() {
+				if err := RotateLog(tmp); err != nil {
+					done <- err
+					return
+				}
+				done <- ApplyRetention(tmp, RotationPolicy{RetainSize: 1}, now)
+			}()
+			select {
+			case err := <-done:
+				if err != nil {
+					return err
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("rotation blocked by ScanArchive")
+			}
+		}
+		msgs = append(msgs, e.Message)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 || msgs[0] != "msg1" || msgs[1] != "msg2" || msgs[2] != "msg3" {
+		t.Errorf("scan during rotation = %v, want [msg1 msg2 msg3]", msgs)
+	}
+	if segs, _ := Segments(tmp); len(segs) != 0 {
+		t.Errorf("retention should have removed segments, got %v", segs)
+	}
+}
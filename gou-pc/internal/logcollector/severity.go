@@ -0,0 +1,45 @@
+package logcollector
+
+import "strings"
+
+// Severities là các mức độ log theo thứ tự tăng dần
+var Severities = []string{"debug", "info", "notice", "warning", "error", "critical"}
+
+// severityAliases đổi cách viết thường gặp (log ứng dụng, syslog) về mức chuẩn
+var severityAliases = map[string]string{
+	"trace": "debug", "verbose": "debug",
+	"information": "info", "informational": "info",
+	"warn": "warning",
+	"err":  "error", "fail": "error", "failure": "error",
+	"crit": "critical", "fatal": "critical", "alert": "critical", "emerg": "critical", "emergency": "critical", "panic": "critical",
+}
+
+// NormalizeSeverity đổi mức độ (không phân biệt hoa thường, chấp nhận alias) về một trong Severities, rỗng nếu không nhận ra
+func NormalizeSeverity(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if alias, ok := severityAliases[s]; ok {
+		return alias
+	}
+	if SeverityRank(s) > 0 {
+		return s
+	}
+	return ""
+}
+
+// SeverityRank trả về thứ hạng 1 (debug) .. 6 (critical) của mức chuẩn, 0 nếu rỗng/không hợp lệ
+func SeverityRank(s string) int {
+	for i, v := range Severities {
+		if v == s {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// SeverityName là chiều ngược của SeverityRank
+func SeverityName(rank int) string {
+	if rank < 1 || rank > len(Severities) {
+		return ""
+	}
+	return Severities[rank-1]
+}
@@ -0,0 +1,304 @@
+package logforward
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"gou-pc/internal/config"
+	"gou-pc/internal/logcollector"
+	"gou-pc/internal/logutil"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultQueueSize = 10000
+	defaultFacility  = 16 // local0
+	defaultAppName   = "gou-pc"
+	dialTimeout      = 5 * time.Second
+	writeTimeout     = 10 * time.Second
+	metaCacheTTL     = time.Minute
+)
+
+// Khoảng chờ giữa hai lần gửi lại, tăng gấp đôi sau mỗi lần lỗi (biến để test rút ngắn)
+var (
+	retryMin = 500 * time.Millisecond
+	retryMax = 30 * time.Second
+)
+
+// LookupFunc trả về thông tin thiết bị của agent (hostname, user được gán)
+type LookupFunc func(agentID string) Meta
+
+// Forwarder chuyển tiếp log tới các đích syslog. Mỗi đích có hàng đợi riêng có giới hạn và goroutine gửi riêng,
+// đích chậm hoặc mất kết nối không ảnh hưởng đích khác và không chặn việc nhận log.
+type Forwarder struct {
+	outputs []*output
+	meta    *metaCache
+}
+
+// OutputStats là thống kê gửi của một đích syslog
+type OutputStats struct {
+	Name        string `json:"name"`
+	Network     string `json:"network"`
+	Addr        string `json:"addr"`
+	Connected   bool   `json:"connected"`
+	Queued      int    `json:"queued"`     // số log đang chờ gửi
+	QueueSize   int    `json:"queue_size"` // sức chứa hàng đợi
+	Sent        uint64 `json:"sent"`
+	Dropped     uint64 `json:"dropped"` // bỏ vì hàng đợi đầy
+	Failures    uint64 `json:"failures"`
+	LastSentAt  string `json:"last_sent_at,omitempty"`
+	LastError   string `json:"last_error,omitempty"`
+	LastErrorAt string `json:"last_error_at,omitempty"`
+}
+
+// New tạo forwarder cho các đích trong cấu hình, đích cấu hình sai được bỏ qua và trả về trong errs
+func New(cfgs []config.SyslogOutputConfig, lookup LookupFunc) (*Forwarder, []error) {
+	f := &Forwarder{meta: &metaCache{lookup: lookup, entries: map[string]metaEntry{}}}
+	var errs []error
+	for _, cfg := range cfgs {
+		o, err := newOutput(cfg, f.meta)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("syslog output %s: %v", cfg.Name, err))
+			continue
+		}
+		f.outputs = append(f.outputs, o)
+		go o.run()
+	}
+	return f, errs
+}
+
+// Forward đưa log vào hàng đợi của mọi đích, không chặn
+func (f *Forwarder) Forward(entry logcollector.ArchiveLogEntry) {
+	for _, o := range f.outputs {
+		o.enqueue(entry)
+	}
+}
+
+// Stats trả về thống kê của từng đích theo thứ tự cấu hình
+func (f *Forwarder) Stats() []OutputStats {
+	stats := make([]OutputStats, 0, len(f.outputs))
+	for _, o := range f.outputs {
+		stats = append(stats, o.snapshot())
+	}
+	return stats
+}
+
+// Close dừng các goroutine gửi và đóng kết nối, log còn trong hàng đợi bị bỏ
+func (f *Forwarder) Close() {
+	for _, o := range f.outputs {
+		close(o.stop)
+		<-o.done
+	}
+}
+
+type output struct {
+	cfg   config.SyslogOutputConfig
+	dial  func() (net.Conn, error)
+	meta  *metaCache
+	queue chan logcollector.ArchiveLogEntry
+	stop  chan struct{}
+	done  chan struct{}
+	conn  net.Conn // chỉ goroutine run dùng
+
+	mu    sync.Mutex
+	stats OutputStats
+}
+
+func newOutput(cfg config.SyslogOutputConfig, meta *metaCache) (*output, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	if _, _, err := net.SplitHostPort(cfg.Addr); err != nil {
+		return nil, fmt.Errorf("invalid addr: %v", err)
+	}
+	if cfg.Facility == 0 {
+		cfg.Facility = defaultFacility
+	}
+	if cfg.Facility < 0 || cfg.Facility > 23 {
+		return nil, errors.New("facility must be 0-23")
+	}
+	if cfg.AppName == "" {
+		cfg.AppName = defaultAppName
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	o := &output{
+		cfg:   cfg,
+		meta:  meta,
+		queue: make(chan logcollector.ArchiveLogEntry, cfg.QueueSize),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+		stats: OutputStats{Name: cfg.Name, Network: cfg.Network, Addr: cfg.Addr, QueueSize: cfg.QueueSize},
+	}
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	switch cfg.Network {
+	case "udp", "tcp":
+		o.dial = func() (net.Conn, error) { return dialer.Dial(cfg.Network, cfg.Addr) }
+	case "tls":
+		tlsCfg, err := tlsConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		o.dial = func() (net.Conn, error) { return tls.DialWithDialer(dialer, "tcp", cfg.Addr, tlsCfg) }
+	default:
+		return nil, fmt.Errorf("unknown network %q (udp, tcp, tls)", cfg.Network)
+	}
+	return o, nil
+}
+
+func tlsConfig(cfg config.SyslogOutputConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{ServerName: cfg.ServerName, InsecureSkipVerify: cfg.InsecureSkipVerify, MinVersion: tls.VersionTLS12}
+	if tlsCfg.ServerName == "" {
+		tlsCfg.ServerName, _, _ = net.SplitHostPort(cfg.Addr)
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	return tlsCfg, nil
+}
+
+func (o *output) enqueue(entry logcollector.ArchiveLogEntry) {
+	select {
+	case o.queue <- entry:
+	default:
+		o.mu.Lock()
+		o.stats.Dropped++
+		o.mu.Unlock()
+	}
+}
+
+func (o *output) snapshot() OutputStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	s := o.stats
+	s.Queued = len(o.queue)
+	return s
+}
+
+// run gửi lần lượt từng log; gửi lỗi thì chờ (tăng dần) rồi gửi lại đúng log đó để giữ thứ tự
+func (o *output) run() {
+	defer close(o.done)
+	defer o.closeConn()
+	for {
+		var entry logcollector.ArchiveLogEntry
+		select {
+		case <-o.stop:
+			return
+		case entry = <-o.queue:
+		}
+		msg := formatRFC5424(o.cfg.Facility, o.cfg.AppName, entry, o.meta.get(entry.AgentID), time.Now())
+		backoff := retryMin
+		for {
+			err := o.send(msg)
+			if err == nil {
+				break
+			}
+			o.recordError(err)
+			select {
+			case <-o.stop:
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > retryMax {
+				backoff = retryMax
+			}
+		}
+	}
+}
+
+func (o *output) send(msg []byte) error {
+	if o.conn == nil {
+		conn, err := o.dial()
+		if err != nil {
+			return err
+		}
+		o.conn = conn
+		o.mu.Lock()
+		o.stats.Connected = true
+		o.mu.Unlock()
+		logutil.CoreInfo("syslog output %s: connected to %s", o.cfg.Name, o.cfg.Addr)
+	}
+	frame := msg
+	if o.cfg.Network != "udp" {
+		// RFC 6587 octet-counting: "<độ dài> <bản tin>"
+		frame = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+	o.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := o.conn.Write(frame); err != nil {
+		o.closeConn()
+		return err
+	}
+	o.mu.Lock()
+	o.stats.Sent++
+	o.stats.LastSentAt = time.Now().Format(time.RFC3339)
+	o.mu.Unlock()
+	return nil
+}
+
+func (o *output) closeConn() {
+	if o.conn == nil {
+		return
+	}
+	o.conn.Close()
+	o.conn = nil
+	o.mu.Lock()
+	o.stats.Connected = false
+	o.mu.Unlock()
+}
+
+func (o *output) recordError(err error) {
+	o.mu.Lock()
+	o.stats.Failures++
+	o.stats.LastError = err.Error()
+	o.stats.LastErrorAt = time.Now().Format(time.RFC3339)
+	n := o.stats.Failures
+	o.mu.Unlock()
+	// Tránh ghi log mỗi lần thử lại khi đích mất kết nối lâu
+	if n == 1 || n%100 == 0 {
+		logutil.CoreError("syslog output %s: send error (%d failures): %v", o.cfg.Name, n, err)
+	}
+}
+
+// metaCache giữ thông tin thiết bị theo agent trong metaCacheTTL để không truy vấn DB cho mỗi log
+type metaCache struct {
+	lookup  LookupFunc
+	mu      sync.Mutex
+	entries map[string]metaEntry
+}
+
+type metaEntry struct {
+	meta    Meta
+	expires time.Time
+}
+
+func (c *metaCache) get(agentID string) Meta {
+	if c.lookup == nil {
+		return Meta{}
+	}
+	now := time.Now()
+	c.mu.Lock()
+	e, ok := c.entries[agentID]
+	c.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.meta
+	}
+	meta := c.lookup(agentID)
+	c.mu.Lock()
+	c.entries[agentID] = metaEntry{meta: meta, expires: now.Add(metaCacheTTL)}
+	c.mu.Unlock()
+	return meta
+}
@@ -0,0 +1,170 @@
+package logforward
+
+import (
+	"bufio"
+	"gou-pc/internal/config"
+	"gou-pc/internal/logcollector"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatRFC5424(t *testing.T) {
+	entry := logcollector.ArchiveLogEntry{
+		Time:       "2024-06-01T10:00:00+07:00",
+		AgentID:    "001",
+		Source:     "Security Log",
+		SourceFile: `C:\logs\sec.log`,
+		Severity:   "error",
+		Message:    "Logon failed",
+		Fields:     map[string]string{"user": `a"b]c\d`, "result": "failed"},
+	}
+	got := string(formatRFC5424(16, "gou-pc", entry, Meta{Hostname: "PC 01", User: "alice"}, time.Now()))
+	want := `<131>1 2024-06-01T10:00:00.000000+07:00 PC_01 gou-pc - Security_Log ` +
+		`[gou@32473 agent_id="001" hostname="PC 01" user="alice" source="Security Log" source_file="C:\\logs\\sec.log"]` +
+		`[fields@32473 result="failed" user="a\"b\]c\\d"]` +
+		" \xef\xbb\xbfLogon failed"
+	if got != want {
+		t.Errorf("format mismatch\n got: %q\nwant: %q", got, want)
+	}
+
+	got = string(formatRFC5424(1, "", logcollector.ArchiveLogEntry{AgentID: "002"}, Meta{}, time.Now()))
+	if !strings.HasPrefix(got, "<14>1 ") || !strings.HasSuffix(got, ` - - - - [gou@32473 agent_id="002"]`) {
+		t.Errorf("empty fields should be NILVALUE: %q", got)
+	}
+}
+
+func waitStats(t *testing.T, f *Forwarder, cond func(OutputStats) bool) OutputStats {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		s := f.Stats()[0]
+		if cond(s) {
+			return s
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for stats, last: %+v", s)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestForwarderUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	lookups := 0
+	f, errs := New([]config.SyslogOutputConfig{{Name: "siem", Network: "udp", Addr: pc.LocalAddr().String()}},
+		func(agentID string) Meta { lookups++; return Meta{Hostname: "pc-" + agentID, User: "bob"} })
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer f.Close()
+	f.Forward(logcollector.ArchiveLogEntry{AgentID: "001", Message: "one"})
+	f.Forward(logcollector.ArchiveLogEntry{AgentID: "001", Message: "two"})
+
+	buf := make([]byte, 2048)
+	pc.SetReadDeadline(time.Now().Add(3 * time.Second))
+	for _, want := range []string{"one", "two"} {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := string(buf[:n])
+		if !strings.Contains(msg, `hostname="pc-001" user="bob"`) || !strings.HasSuffix(msg, want) {
+			t.Errorf("unexpected datagram: %q", msg)
+		}
+	}
+	s := waitStats(t, f, func(s OutputStats) bool { return s.Sent == 2 })
+	if !s.Connected || s.Failures != 0 || lookups != 1 {
+		t.Errorf("unexpected stats %+v, lookups %d", s, lookups)
+	}
+}
+
+// readFrame đọc một bản tin đóng khung octet-counting
+func readFrame(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+	lenStr, err := r.ReadString(' ')
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(lenStr, " "))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
+
+func TestForwarderTCPRetry(t *testing.T) {
+	retryMin, retryMax = 10*time.Millisecond, 50*time.Millisecond
+	defer func() { retryMin, retryMax = 500*time.Millisecond, 30*time.Second }()
+
+	// Lấy một cổng trống rồi đóng lại: đích chưa sẵn sàng, log phải nằm trong hàng đợi và được gửi lại
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	f, errs := New([]config.SyslogOutputConfig{{Name: "siem", Network: "tcp", Addr: addr, QueueSize: 2}}, nil)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer f.Close()
+	f.Forward(logcollector.ArchiveLogEntry{AgentID: "001", Message: "first"})
+	waitStats(t, f, func(s OutputStats) bool { return s.Failures >= 1 })
+	// "first" đang được gửi lại, "second"/"third" trong hàng đợi, "fourth" bị bỏ
+	for _, m := range []string{"second", "third", "fourth"} {
+		f.Forward(logcollector.ArchiveLogEntry{AgentID: "001", Message: m})
+	}
+	s := waitStats(t, f, func(s OutputStats) bool { return s.Failures >= 2 })
+	if s.Dropped != 1 || s.Queued != 2 || s.Connected || s.LastError == "" {
+		t.Errorf("unexpected stats while down: %+v", s)
+	}
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("cannot re-listen on %s: %v", addr, err)
+	}
+	defer ln.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	r := bufio.NewReader(conn)
+	for _, want := range []string{"first", "second", "third"} {
+		if msg := readFrame(t, r); !strings.HasSuffix(msg, want) {
+			t.Errorf("expected %q in order, got %q", want, msg)
+		}
+	}
+	s = waitStats(t, f, func(s OutputStats) bool { return s.Sent == 3 })
+	if !s.Connected || s.Queued != 0 {
+		t.Errorf("unexpected stats after reconnect: %+v", s)
+	}
+}
+
+func TestNewInvalidOutputs(t *testing.T) {
+	f, errs := New([]config.SyslogOutputConfig{
+		{Name: "a", Network: "udp", Addr: "no-port"},
+		{Name: "b", Network: "http", Addr: "127.0.0.1:514"},
+		{Name: "c", Network: "tls", Addr: "127.0.0.1:6514", CAFile: "/nonexistent/ca.pem"},
+		{Name: "d", Network: "udp", Addr: "127.0.0.1:514", Facility: 24},
+		{Name: "ok", Network: "udp", Addr: "127.0.0.1:514"},
+	}, nil)
+	defer f.Close()
+	if len(errs) != 4 || len(f.Stats()) != 1 || f.Stats()[0].Name != "ok" {
+		t.Errorf("expected 4 errors and one output, got %v, %+v", errs, f.Stats())
+	}
+}
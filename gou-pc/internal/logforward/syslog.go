@@ -0,0 +1,119 @@
+package logforward
+
+import (
+	"fmt"
+	"gou-pc/internal/logcollector"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// sdEnterpriseID là Private Enterprise Number dùng trong SD-ID (32473 dành cho tài liệu/ví dụ theo RFC 5612)
+	sdEnterpriseID = "32473"
+	// severityInfo là mức informational, dùng cho log không có mức độ
+	severityInfo = 6
+	// timestampFormat là TIMESTAMP RFC 5424 với phần lẻ giây tối đa 6 chữ số
+	timestampFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// syslogSeverity đổi mức độ chuẩn của log sang severity code syslog
+var syslogSeverity = map[string]int{
+	"debug": 7, "info": 6, "notice": 5, "warning": 4, "error": 3, "critical": 2,
+}
+
+// Meta là thông tin thiết bị của agent gắn vào structured data
+type Meta struct {
+	Hostname string
+	User     string // user được gán cho thiết bị
+}
+
+// formatRFC5424 tạo một bản tin syslog RFC 5424:
+// <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [gou@32473 agent_id=.. hostname=.. user=.. source=.. source_file=..][fields@32473 ..] BOM MSG
+func formatRFC5424(facility int, appName string, entry logcollector.ArchiveLogEntry, meta Meta, now time.Time) []byte {
+	ts := now
+	if t, err := time.Parse(time.RFC3339, entry.Time); err == nil {
+		ts = t
+	}
+	severity, ok := syslogSeverity[entry.Severity]
+	if !ok {
+		severity = severityInfo
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s - %s ",
+		facility*8+severity,
+		ts.Format(timestampFormat),
+		headerField(meta.Hostname, 255),
+		headerField(appName, 48),
+		headerField(entry.Source, 32))
+
+	b.WriteString("[gou@" + sdEnterpriseID)
+	writeParam(&b, "agent_id", entry.AgentID)
+	if meta.Hostname != "" {
+		writeParam(&b, "hostname", meta.Hostname)
+	}
+	if meta.User != "" {
+		writeParam(&b, "user", meta.User)
+	}
+	if entry.Source != "" {
+		writeParam(&b, "source", entry.Source)
+	}
+	if entry.SourceFile != "" {
+		writeParam(&b, "source_file", entry.SourceFile)
+	}
+	b.WriteString("]")
+	if len(entry.Fields) > 0 {
+		keys := make([]string, 0, len(entry.Fields))
+		for k := range entry.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b.WriteString("[fields@" + sdEnterpriseID)
+		for _, k := range keys {
+			if name := sdName(k); name != "" {
+				writeParam(&b, name, entry.Fields[k])
+			}
+		}
+		b.WriteString("]")
+	}
+	if entry.Message != "" {
+		b.WriteString(" \xef\xbb\xbf") // BOM: MSG là UTF-8
+		b.WriteString(entry.Message)
+	}
+	return []byte(b.String())
+}
+
+// headerField chỉ giữ ký tự ASCII in được, không dấu cách, tối đa max ký tự; rỗng thành NILVALUE "-"
+func headerField(s string, max int) string {
+	var b strings.Builder
+	for i := 0; i < len(s) && b.Len() < max; i++ {
+		c := s[i]
+		if c < 33 || c > 126 {
+			c = '_'
+		}
+		b.WriteByte(c)
+	}
+	if b.Len() == 0 {
+		return "-"
+	}
+	return b.String()
+}
+
+// sdName là PARAM-NAME hợp lệ: ASCII in được trừ '=', ' ', ']', '"', tối đa 32 ký tự
+func sdName(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s) && b.Len() < 32; i++ {
+		c := s[i]
+		if c < 33 || c > 126 || c == '=' || c == ']' || c == '"' {
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+var sdValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func writeParam(b *strings.Builder, name, value string) {
+	b.WriteString(" " + name + `="` + sdValueEscaper.Replace(value) + `"`)
+}
@@ -0,0 +1,90 @@
+package tcpserver
+
+import (
+	"gou-pc/internal/logcollector"
+	"gou-pc/internal/logutil"
+	"time"
+)
+
+const (
+	ingestQueueSize  = 4096
+	ingestBatchSize  = 500
+	ingestFlushEvery = 500 * time.Millisecond
+)
+
+// LogSink là nơi lưu log nhận từ agent (repository.LogRepository thoả interface này)
+type LogSink interface {
+	AppendLogs(entries []ArchiveLogEntry) error
+}
+
+// logIngestor gom log thành từng lô rồi ghi vào sink, tránh mở file/transaction cho mỗi dòng
+type logIngestor struct {
+	sink  LogSink
+	queue chan ArchiveLogEntry
+}
+
+var ingestor *logIngestor
+
+// logHub phát log vừa nhận cho các client đang tail, nil = không phát
+var logHub *logcollector.Hub
+
+// InjectLogHub đặt hub phát log realtime, gọi trước Start
+func InjectLogHub(h *logcollector.Hub) { logHub = h }
+
+// AlertObserver đánh giá rule cảnh báo trên log vừa nhận và trạng thái online của agent (alert.Engine thoả interface này)
+type AlertObserver interface {
+	ObserveLog(entry ArchiveLogEntry)
+	ObserveAgentStatus(agentID string, online bool, lastSeen time.Time)
+}
+
+var alertObserver AlertObserver
+
+// InjectAlertObserver đặt engine cảnh báo, gọi trước Start
+func InjectAlertObserver(o AlertObserver) { alertObserver = o }
+
+// LogForwarder chuyển tiếp log vừa nhận ra hệ thống ngoài (logforward.Forwarder thoả interface này), không được chặn
+type LogForwarder interface {
+	Forward(entry ArchiveLogEntry)
+}
+
+var logForwarder LogForwarder
+
+// InjectLogForwarder đặt bộ chuyển tiếp syslog, gọi trước Start
+func InjectLogForwarder(f LogForwarder) { logForwarder = f }
+
+// InjectLogSink đặt nơi lưu log và khởi động goroutine ghi theo lô, gọi trước Start
+func InjectLogSink(sink LogSink) {
+	ingestor = &logIngestor{sink: sink, queue: make(chan ArchiveLogEntry, ingestQueueSize)}
+	go ingestor.run()
+}
+
+// Ingest đưa log vào hàng đợi, chặn khi hàng đợi đầy để agent tự giảm tốc
+func (in *logIngestor) Ingest(entry ArchiveLogEntry) {
+	in.queue <- entry
+}
+
+func (in *logIngestor) run() {
+	ticker := time.NewTicker(ingestFlushEvery)
+	defer ticker.Stop()
+	batch := make([]ArchiveLogEntry, 0, ingestBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := in.sink.AppendLogs(batch); err != nil {
+			logutil.CoreError("ingest: append %d logs failed: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case entry := <-in.queue:
+			batch = append(batch, entry)
+			if len(batch) >= ingestBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
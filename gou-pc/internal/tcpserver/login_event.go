@@ -0,0 +1,124 @@
+package tcpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"gou-pc/internal/agent"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/config"
+	"gou-pc/internal/logutil"
+	"time"
+)
+
+// LoginEventSink lưu sự kiện đăng nhập nhận từ agent (repository.LoginEventRepository thoả interface này)
+type LoginEventSink interface {
+	LoginEventCreate(e *model.LoginEvent) error
+}
+
+var loginEventSink LoginEventSink
+
+// InjectLoginEventSink đặt nơi lưu sự kiện đăng nhập, gọi trước Start
+func InjectLoginEventSink(s LoginEventSink) { loginEventSink = s }
+
+// LoginDetector tương quan đăng nhập lỗi/sai OTP và quyết định khoá cấp OTP (detect.Detector thoả interface này)
+type LoginDetector interface {
+	ObserveLoginEvent(e model.LoginEvent)
+	ObserveOTPFailure(agentID, username string)
+	OTPLocked(agentID string, usernames ...string) (time.Time, bool)
+}
+
+var loginDetector LoginDetector
+
+// InjectLoginDetector đặt bộ phát hiện brute-force, gọi trước Start
+func InjectLoginDetector(d LoginDetector) { loginDetector = d }
+
+// otpLockResponse trả về lỗi gửi agent nếu thiết bị hoặc user được gán cho thiết bị đang bị khoá cấp OTP
+func otpLockResponse(agentID, userName string) (agent.Message, bool) {
+	if loginDetector == nil {
+		return agent.Message{}, false
+	}
+	var users []string
+	if userName != "" {
+		users = append(users, userName)
+	}
+	until, locked := loginDetector.OTPLocked(agentID, users...)
+	if !locked {
+		return agent.Message{}, false
+	}
+	logutil.CoreInfo("[REQUEST OTP] agent_id=%s denied: OTP issuance locked until %s", agentID, until.Format(time.RFC3339))
+	return agent.Message{Type: agent.TypeError, Data: "OTP issuance locked until " + until.Format(time.RFC3339)}, true
+}
+
+// loginEventLogSource là nhãn nguồn của dòng log sinh từ sự kiện đăng nhập
+const loginEventLogSource = "login_event"
+
+// handleLoginEvent lưu sự kiện đăng nhập vào bảng riêng và ghi thêm một dòng log (field user/result/method/reason)
+// để tìm kiếm, cảnh báo và chuyển tiếp syslog vẫn thấy như log của credential provider
+func handleLoginEvent(cfg *config.ServerConfig, data interface{}, now time.Time) agent.Message {
+	var in struct {
+		AgentID string               `json:"agent_id"`
+		Payload agent.LoginEventData `json:"payload"`
+	}
+	b, _ := json.Marshal(data)
+	if err := json.Unmarshal(b, &in); err != nil || in.AgentID == "" {
+		return agent.Message{Type: agent.TypeError, Data: "Invalid login event"}
+	}
+	if err := in.Payload.Validate(); err != nil {
+		return agent.Message{Type: agent.TypeError, Data: "Invalid login event: " + err.Error()}
+	}
+	if exists, err := agent.AgentExists(in.AgentID); err != nil || !exists {
+		return agent.Message{Type: agent.TypeError, Data: "Agent not registered. Please register again."}
+	}
+	ev := in.Payload
+	e := model.LoginEvent{
+		AgentID:    in.AgentID,
+		Username:   ev.Username,
+		Result:     ev.Result,
+		Method:     ev.Method,
+		Reason:     ev.Reason,
+		Time:       logEventTime(ev.Time, now),
+		ReceivedAt: now.Format(time.RFC3339),
+	}
+	if loginEventSink != nil {
+		if err := loginEventSink.LoginEventCreate(&e); err != nil {
+			logutil.CoreError("store login event agent_id=%s user=%s failed: %v", e.AgentID, e.Username, err)
+			return agent.Message{Type: agent.TypeError, Data: "Failed to store login event"}
+		}
+	}
+	if loginDetector != nil {
+		loginDetector.ObserveLoginEvent(e)
+	}
+	appendArchiveLog(cfg, loginEventLog(e))
+	logutil.CoreInfo("[LOGIN EVENT] agent_id=%s user=%s result=%s method=%s", e.AgentID, e.Username, e.Result, e.Method)
+	return agent.Message{
+		Type: agent.TypeLoginEvent,
+		Data: map[string]interface{}{"agent_id": e.AgentID, "result": "login event received"},
+	}
+}
+
+// loginEventLog là dòng log tương ứng sự kiện đăng nhập, đăng nhập lỗi có mức warning
+func loginEventLog(e model.LoginEvent) ArchiveLogEntry {
+	msg := fmt.Sprintf("Logon %s for user '%s'", e.Result, e.Username)
+	fields := map[string]string{"user": e.Username, "result": e.Result}
+	if e.Method != "" {
+		msg += " (" + e.Method + ")"
+		fields["method"] = e.Method
+	}
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+		fields["reason"] = e.Reason
+	}
+	severity := "info"
+	if e.Result == agent.LoginResultFailed {
+		severity = "warning"
+	}
+	return ArchiveLogEntry{
+		Time:       e.Time,
+		ReceivedAt: e.ReceivedAt,
+		AgentID:    e.AgentID,
+		Message:    msg,
+		Fields:     fields,
+		Source:     loginEventLogSource,
+		Severity:   severity,
+	}
+}
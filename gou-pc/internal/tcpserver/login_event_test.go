@@ -0,0 +1,108 @@
+package tcpserver
+
+import (
+	"database/sql"
+	"gou-pc/internal/agent"
+	"gou-pc/internal/api/model"
+	"gou-pc/internal/api/repository"
+	"gou-pc/internal/config"
+	"gou-pc/internal/logcollector"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHandleLoginEvent(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "clients.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE managed_clients (client_id TEXT PRIMARY KEY, agent_id TEXT UNIQUE, hardware_id TEXT,
+		host_name TEXT, ip_address TEXT, mac_address TEXT, user_name TEXT, last_seen TEXT, online INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	agent.SetDB(db)
+	if err := agent.SaveClient(agent.ManagedClient{ClientID: "c1", AgentID: "001", DeviceInfo: agent.DeviceInfo{HardwareID: "hw1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.CreateLoginEventTables(db); err != nil {
+		t.Fatal(err)
+	}
+	repo := repository.NewSQLiteLoginEventRepository(db)
+	InjectLoginEventSink(repo)
+	defer InjectLoginEventSink(nil)
+	cfg := &config.ServerConfig{ArchiveFile: filepath.Join(dir, "archive.log")}
+	now := time.Date(2024, 6, 1, 10, 0, 5, 0, time.Local)
+
+	resp := handleLoginEvent(cfg, map[string]interface{}{"agent_id": "001", "payload": map[string]interface{}{
+		"username": `CORP\bob`, "result": "failed", "method": "otp", "reason": "incorrect secret code", "time": "2024-06-01T03:00:00Z",
+	}}, now)
+	if resp.Type != agent.TypeLoginEvent {
+		t.Fatalf("login event rejected: %+v", resp)
+	}
+	for _, data := range []map[string]interface{}{
+		{"agent_id": "002", "payload": map[string]interface{}{"username": "bob", "result": "success"}},
+		{"agent_id": "001", "payload": map[string]interface{}{"username": "bob", "result": "maybe"}},
+		{"agent_id": "001"},
+	} {
+		if resp := handleLoginEvent(cfg, data, now); resp.Type != agent.TypeError {
+			t.Errorf("expected error for %v, got %+v", data, resp)
+		}
+	}
+
+	events, total, err := repo.LoginEventList(repository.LoginEventFilter{Usernames: []string{`corp\BOB`}}, 1, 10)
+	if err != nil || total != 1 || len(events) != 1 {
+		t.Fatalf("expected 1 stored event, got %d, %v", total, err)
+	}
+	e := events[0]
+	if e.AgentID != "001" || e.Method != "otp" || e.Reason != "incorrect secret code" ||
+		e.Time != time.Date(2024, 6, 1, 3, 0, 0, 0, time.UTC).In(time.Local).Format(time.RFC3339) || e.ReceivedAt != now.Format(time.RFC3339) {
+		t.Errorf("unexpected event: %+v", e)
+	}
+	logs, err := logcollector.LoadArchiveLogs(cfg.ArchiveFile)
+	if err != nil || len(logs) != 1 {
+		t.Fatalf("expected 1 log, got %d, %v", len(logs), err)
+	}
+	l := logs[0]
+	if l.Source != loginEventLogSource || l.Severity != "warning" || l.Message != `Logon failed for user 'CORP\bob' (otp): incorrect secret code` ||
+		l.Fields["user"] != `CORP\bob` || l.Fields["result"] != "failed" || l.Fields["method"] != "otp" || l.Time != e.Time {
+		t.Errorf("unexpected log: %+v", l)
+	}
+}
+
+type fakeLoginDetector struct {
+	events  []model.LoginEvent
+	otpFail []string
+	locked  map[string]time.Time
+}
+
+func (f *fakeLoginDetector) ObserveLoginEvent(e model.LoginEvent) { f.events = append(f.events, e) }
+func (f *fakeLoginDetector) ObserveOTPFailure(agentID, username string) {
+	f.otpFail = append(f.otpFail, agentID)
+}
+func (f *fakeLoginDetector) OTPLocked(agentID string, usernames ...string) (time.Time, bool) {
+	for _, k := range append([]string{agentID}, usernames...) {
+		if t, ok := f.locked[k]; ok {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func TestOTPLockResponse(t *testing.T) {
+	if _, locked := otpLockResponse("001", "bob"); locked {
+		t.Error("no detector should never lock")
+	}
+	until := time.Date(2024, 6, 1, 10, 15, 0, 0, time.Local)
+	InjectLoginDetector(&fakeLoginDetector{locked: map[string]time.Time{"bob": until}})
+	defer InjectLoginDetector(nil)
+	resp, locked := otpLockResponse("001", "bob")
+	if !locked || resp.Type != agent.TypeError || resp.Data != "OTP issuance locked until "+until.Format(time.RFC3339) {
+		t.Errorf("assigned user lock should deny OTP: %+v", resp)
+	}
+	if _, locked := otpLockResponse("001", ""); locked {
+		t.Error("unlocked device without user should get OTP")
+	}
+}
@@ -0,0 +1,253 @@
+package tcpserver
+
+import (
+	"bufio"
+	"errors"
+	"gou-pc/internal/agent"
+	"gou-pc/internal/config"
+	"gou-pc/internal/logcollector"
+	"gou-pc/internal/logutil"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// syslogIdleTimeout đóng kết nối TCP syslog không gửi gì trong khoảng này
+	syslogIdleTimeout = 10 * time.Minute
+	// syslogDeviceTTL là thời gian nhớ ánh xạ người gửi -> agent_id (kể cả "không có") trước khi tra lại DB
+	syslogDeviceTTL = 5 * time.Minute
+	// syslogMaxCachedDevices giới hạn số người gửi được nhớ, đầy thì tra DB mỗi bản tin thay vì nhớ thêm
+	syslogMaxCachedDevices = 4096
+)
+
+// syslogDevices ánh xạ người gửi syslog (IP + hostname tự báo) sang agent_id của ManagedClient,
+// tự tạo thiết bị agentless khi chưa có nếu bật SyslogAutoRegister
+type syslogDevices struct {
+	mu        sync.Mutex
+	entries   map[string]syslogDevice
+	lastSweep time.Time
+}
+
+type syslogDevice struct {
+	agentID   string // rỗng = người gửi không được nhận
+	agentless bool
+	expires   time.Time
+}
+
+var devices = &syslogDevices{entries: map[string]syslogDevice{}}
+
+// resolve tìm client theo IP nguồn rồi tới hostname (chỉ client agentless); không có thì tạo client agentless mới
+// khi cfg.SyslogAutoRegister bật và chưa vượt cfg.SyslogMaxAgentless, agentID rỗng nghĩa là bỏ bản tin.
+// Giữ mutex trong lúc tra/tạo để hai bản tin đầu tiên của cùng thiết bị không tạo hai client.
+func (d *syslogDevices) resolve(cfg *config.ServerConfig, ip, hostName string) (syslogDevice, error) {
+	key := ip + "|" + strings.ToLower(hostName)
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.entries[key]; ok && now.Before(e.expires) {
+		return e, nil
+	}
+	found, err := agent.FindClientByAddress(ip, hostName)
+	if err != nil {
+		return syslogDevice{}, err
+	}
+	dev := syslogDevice{expires: now.Add(syslogDeviceTTL)}
+	switch {
+	case found != nil:
+		dev.agentID, dev.agentless = found.AgentID, found.IsAgentless()
+	case cfg.SyslogAutoRegister:
+		n, err := agent.CountAgentlessClients()
+		if err != nil {
+			return syslogDevice{}, err
+		}
+		if n >= cfg.SyslogMaxAgentless {
+			logutil.CoreError("[SYSLOG] agentless device limit %d reached, dropping ip=%s hostname=%s", cfg.SyslogMaxAgentless, ip, hostName)
+			break
+		}
+		c := agent.ManagedClient{
+			ClientID: agent.GenClientID(),
+			AgentID:  agent.GenAgentID(),
+			DeviceInfo: agent.DeviceInfo{
+				HostName:   hostName,
+				IPAddress:  ip,
+				HardwareID: agent.AgentlessHardwarePrefix + ip,
+			},
+		}
+		if err := agent.SaveClient(c); err != nil {
+			return syslogDevice{}, err
+		}
+		logutil.CoreInfo("[SYSLOG] registered agentless device agent_id=%s ip=%s hostname=%s", c.AgentID, ip, hostName)
+		dev.agentID, dev.agentless = c.AgentID, true
+	}
+	d.sweep(now)
+	if len(d.entries) < syslogMaxCachedDevices {
+		d.entries[key] = dev
+	}
+	return dev, nil
+}
+
+// sweep xoá các ánh xạ đã hết hạn, tối đa một lần mỗi syslogDeviceTTL (gọi khi giữ mu)
+func (d *syslogDevices) sweep(now time.Time) {
+	if now.Sub(d.lastSweep) < syslogDeviceTTL {
+		return
+	}
+	d.lastSweep = now
+	for k, e := range d.entries {
+		if !now.Before(e.expires) {
+			delete(d.entries, k)
+		}
+	}
+}
+
+// syslogSourceAllowed kiểm tra IP người gửi nằm trong SyslogAllowedSources (CIDR hoặc IP), danh sách rỗng = mọi nguồn
+func syslogSourceAllowed(allowed []string, ip string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, a := range allowed {
+		if _, n, err := net.ParseCIDR(a); err == nil {
+			if n.Contains(addr) {
+				return true
+			}
+		} else if other := net.ParseIP(a); other != nil && other.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// StartSyslog lắng nghe syslog (RFC 3164/5424) từ thiết bị không chạy agent trên cfg.SyslogUDPAddr
+// và/hoặc cfg.SyslogTCPAddr, chặn cho tới khi listener lỗi
+func StartSyslog(cfg *config.ServerConfig) error {
+	errc := make(chan error, 2)
+	started := 0
+	if cfg.SyslogUDPAddr != "" {
+		pc, err := net.ListenPacket("udp", cfg.SyslogUDPAddr)
+		if err != nil {
+			return err
+		}
+		defer pc.Close()
+		logutil.CoreInfo("Syslog receiver listening on udp %s", cfg.SyslogUDPAddr)
+		go func() { errc <- serveSyslogUDP(pc, cfg) }()
+		started++
+	}
+	if cfg.SyslogTCPAddr != "" {
+		ln, err := net.Listen("tcp", cfg.SyslogTCPAddr)
+		if err != nil {
+			return err
+		}
+		defer ln.Close()
+		logutil.CoreInfo("Syslog receiver listening on tcp %s", cfg.SyslogTCPAddr)
+		go func() { errc <- serveSyslogTCP(ln, cfg) }()
+		started++
+	}
+	if started == 0 {
+		return errors.New("no syslog listen address configured")
+	}
+	return <-errc
+}
+
+func serveSyslogUDP(pc net.PacketConn, cfg *config.ServerConfig) error {
+	buf := make([]byte, maxSyslogMessage)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		handleSyslogMessage(cfg, hostOf(addr), string(buf[:n]))
+	}
+}
+
+func serveSyslogTCP(ln net.Listener, cfg *config.ServerConfig) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+		go handleSyslogConn(conn, cfg)
+	}
+}
+
+func handleSyslogConn(conn net.Conn, cfg *config.ServerConfig) {
+	defer conn.Close()
+	ip := hostOf(conn.RemoteAddr())
+	r := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(syslogIdleTimeout))
+		raw, err := readSyslogFrame(r)
+		if err != nil {
+			if err != io.EOF {
+				logutil.CoreError("[SYSLOG] read from %s: %v", ip, err)
+			}
+			return
+		}
+		if raw != "" {
+			handleSyslogMessage(cfg, ip, raw)
+		}
+	}
+}
+
+// handleSyslogMessage bỏ bản tin từ nguồn ngoài SyslogAllowedSources, tách bản tin, gắn vào thiết bị theo IP/hostname rồi lưu như log từ agent (Source = "syslog").
+// Time là timestamp trong bản tin (không có thì giờ nhận), Severity lấy từ PRI.
+func handleSyslogMessage(cfg *config.ServerConfig, ip, raw string) {
+	if !syslogSourceAllowed(cfg.SyslogAllowedSources, ip) {
+		logutil.CoreDebug("[SYSLOG] dropped message from %s: source not allowed", ip)
+		return
+	}
+	now := time.Now()
+	msg, err := parseSyslog(raw, now)
+	if err != nil {
+		logutil.CoreError("[SYSLOG] invalid message from %s: %v", ip, err)
+		return
+	}
+	dev, err := devices.resolve(cfg, ip, msg.Hostname)
+	if err != nil {
+		logutil.CoreError("[SYSLOG] resolve device ip=%s hostname=%s: %v", ip, msg.Hostname, err)
+		return
+	}
+	if dev.agentID == "" {
+		logutil.CoreDebug("[SYSLOG] dropped message from unknown device ip=%s hostname=%s", ip, msg.Hostname)
+		return
+	}
+	agentID := dev.agentID
+	// Bản tin syslog là tín hiệu còn sống của thiết bị agentless; agent thật chỉ được tính online qua hello,
+	// không thì người gửi UDP giả IP che được cảnh báo agent offline
+	if dev.agentless {
+		helloLastSeenMu.Lock()
+		helloLastSeen[agentID] = now
+		helloLastSeenMu.Unlock()
+	}
+
+	eventTime := now
+	if !msg.Timestamp.IsZero() {
+		eventTime = msg.Timestamp.In(time.Local)
+	}
+	appendArchiveLog(cfg, ArchiveLogEntry{
+		Time:       eventTime.Format(time.RFC3339),
+		ReceivedAt: now.Format(time.RFC3339),
+		AgentID:    agentID,
+		Message:    msg.Message,
+		Fields:     msg.fields(),
+		Source:     "syslog",
+		Severity:   logcollector.NormalizeSeverity(syslogSeverities[msg.Severity]),
+	})
+}
+
+func hostOf(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
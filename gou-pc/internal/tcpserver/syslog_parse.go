@@ -0,0 +1,260 @@
+package tcpserver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSyslogMessage giới hạn kích thước một bản tin syslog (UDP datagram hoặc một frame TCP)
+const maxSyslogMessage = 64 << 10
+
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var syslogSeverities = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// syslogMessage là bản tin syslog đã tách theo RFC 5424 hoặc RFC 3164 (BSD)
+type syslogMessage struct {
+	Facility  int
+	Severity  int
+	Timestamp time.Time // zero nếu bản tin không có hoặc không đọc được
+	Hostname  string
+	AppName   string
+	ProcID    string
+	MsgID     string
+	SD        map[string]map[string]string // SD-ID -> PARAM-NAME -> giá trị (chỉ RFC 5424)
+	Message   string
+}
+
+// fields đổi phần header/structured data thành Fields của log: facility, app, procid, msgid,
+// hostname (như thiết bị tự báo) và "<SD-ID>.<PARAM>" cho từng tham số structured data.
+// Timestamp và severity được lưu vào Time/Severity của log nên không lặp lại ở đây.
+func (m *syslogMessage) fields() map[string]string {
+	f := map[string]string{
+		"facility": syslogFacilities[m.Facility],
+	}
+	set := func(k, v string) {
+		if v != "" {
+			f[k] = v
+		}
+	}
+	set("app", m.AppName)
+	set("procid", m.ProcID)
+	set("msgid", m.MsgID)
+	set("hostname", m.Hostname)
+	for id, params := range m.SD {
+		for name, v := range params {
+			f[id+"."+name] = v
+		}
+	}
+	return f
+}
+
+// parseSyslog tách một bản tin syslog. Bản tin RFC 5424 ("<PRI>1 ...") được tách chặt,
+// còn lại coi là RFC 3164 và tách dễ dãi: thiếu PRI thì dùng user.notice, thiếu timestamp/hostname thì bỏ qua.
+func parseSyslog(raw string, now time.Time) (*syslogMessage, error) {
+	raw = strings.TrimRight(raw, "\r\n\x00")
+	m := &syslogMessage{Facility: 1, Severity: 5}
+	rest := raw
+	if strings.HasPrefix(rest, "<") {
+		end := strings.IndexByte(rest, '>')
+		if end < 2 || end > 4 {
+			return nil, errors.New("invalid PRI")
+		}
+		pri, err := strconv.Atoi(rest[1:end])
+		if err != nil || pri < 0 || pri > 191 {
+			return nil, errors.New("invalid PRI")
+		}
+		m.Facility, m.Severity = pri/8, pri%8
+		rest = rest[end+1:]
+		if strings.HasPrefix(rest, "1 ") {
+			return m, parse5424(m, rest[2:])
+		}
+	}
+	parse3164(m, rest, now)
+	return m, nil
+}
+
+func parse5424(m *syslogMessage, s string) error {
+	header := make([]string, 0, 5)
+	for i := 0; i < 5; i++ {
+		sp := strings.IndexByte(s, ' ')
+		if sp < 0 {
+			return errors.New("truncated RFC 5424 header")
+		}
+		header = append(header, s[:sp])
+		s = s[sp+1:]
+	}
+	nil5424 := func(v string) string {
+		if v == "-" {
+			return ""
+		}
+		return v
+	}
+	if ts := header[0]; ts != "-" {
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q", ts)
+		}
+		m.Timestamp = t
+	}
+	m.Hostname, m.AppName, m.ProcID, m.MsgID = nil5424(header[1]), nil5424(header[2]), nil5424(header[3]), nil5424(header[4])
+
+	if strings.HasPrefix(s, "-") {
+		s = s[1:]
+	} else {
+		var err error
+		if m.SD, s, err = parseStructuredData(s); err != nil {
+			return err
+		}
+	}
+	if s != "" {
+		if s[0] != ' ' {
+			return errors.New("missing space before MSG")
+		}
+		m.Message = strings.TrimPrefix(s[1:], "\ufeff")
+	}
+	return nil
+}
+
+// parseStructuredData đọc các SD-ELEMENT liên tiếp "[id name="value" ...]", trả về phần còn lại của bản tin
+func parseStructuredData(s string) (map[string]map[string]string, string, error) {
+	sd := map[string]map[string]string{}
+	for strings.HasPrefix(s, "[") {
+		s = s[1:]
+		end := strings.IndexAny(s, " ]")
+		if end <= 0 {
+			return nil, "", errors.New("invalid SD-ID")
+		}
+		params := map[string]string{}
+		sd[s[:end]] = params
+		s = s[end:]
+		for strings.HasPrefix(s, " ") {
+			s = s[1:]
+			eq := strings.Index(s, `="`)
+			if eq <= 0 {
+				return nil, "", errors.New("invalid SD-PARAM")
+			}
+			name := s[:eq]
+			s = s[eq+2:]
+			var v strings.Builder
+			closed := false
+			for i := 0; i < len(s); i++ {
+				c := s[i]
+				if c == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\' || s[i+1] == ']') {
+					v.WriteByte(s[i+1])
+					i++
+					continue
+				}
+				if c == '"' {
+					s = s[i+1:]
+					closed = true
+					break
+				}
+				v.WriteByte(c)
+			}
+			if !closed {
+				return nil, "", errors.New("unterminated SD-PARAM value")
+			}
+			params[name] = v.String()
+		}
+		if !strings.HasPrefix(s, "]") {
+			return nil, "", errors.New("unterminated SD-ELEMENT")
+		}
+		s = s[1:]
+	}
+	if len(sd) == 0 {
+		return nil, "", errors.New("invalid STRUCTURED-DATA")
+	}
+	return sd, s, nil
+}
+
+// parse3164 tách "Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG". Timestamp BSD không có năm/múi giờ:
+// lấy năm hiện tại theo giờ local, nếu ra thời điểm quá một ngày trong tương lai thì là năm trước.
+func parse3164(m *syslogMessage, s string, now time.Time) {
+	if len(s) >= 16 && s[15] == ' ' {
+		if t, err := time.ParseInLocation(time.Stamp, s[:15], time.Local); err == nil {
+			t = t.AddDate(now.Year(), 0, 0)
+			if t.After(now.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			m.Timestamp = t
+			s = s[16:]
+			// Sau timestamp là HOSTNAME; một từ kết thúc bằng ':' hoặc có '[' là TAG chứ không phải hostname
+			if sp := strings.IndexByte(s, ' '); sp > 0 && !strings.ContainsAny(s[:sp], ":[") {
+				m.Hostname = s[:sp]
+				s = s[sp+1:]
+			}
+		}
+	}
+	// TAG: tối đa 32 ký tự chữ số/chữ cái (cho phép thêm -_./), tuỳ chọn [PID], kết thúc bằng ':'
+	tagEnd := 0
+	for tagEnd < len(s) && tagEnd < 32 && isTagChar(s[tagEnd]) {
+		tagEnd++
+	}
+	if tagEnd > 0 && tagEnd < len(s) {
+		rest := s[tagEnd:]
+		procID := ""
+		if rest[0] == '[' {
+			if end := strings.IndexByte(rest, ']'); end > 1 {
+				procID = rest[1:end]
+				rest = rest[end+1:]
+			}
+		}
+		if strings.HasPrefix(rest, ":") {
+			m.AppName, m.ProcID = s[:tagEnd], procID
+			s = strings.TrimPrefix(rest[1:], " ")
+		}
+	}
+	m.Message = s
+}
+
+func isTagChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == '/'
+}
+
+// readSyslogFrame đọc một bản tin từ luồng TCP theo RFC 6587: octet-counting ("<độ dài> <bản tin>")
+// nếu frame bắt đầu bằng chữ số, ngược lại mỗi dòng (kết thúc bằng LF) là một bản tin
+func readSyslogFrame(r *bufio.Reader) (string, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return "", err
+	}
+	if b[0] >= '1' && b[0] <= '9' {
+		lenStr, err := r.ReadString(' ')
+		if err != nil {
+			return "", err
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(lenStr, " "))
+		if err != nil || n <= 0 || n > maxSyslogMessage {
+			return "", fmt.Errorf("invalid frame length %q", lenStr)
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+		return string(buf), nil
+	}
+	var line []byte
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		line = append(line, chunk...)
+		if len(line) > maxSyslogMessage {
+			return "", errors.New("message too long")
+		}
+		if !isPrefix {
+			return string(line), nil
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package tcpserver
+
+import (
+	"bufio"
+	"database/sql"
+	"gou-pc/internal/agent"
+	"gou-pc/internal/config"
+	"gou-pc/internal/logcollector"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestParseSyslog5424(t *testing.T) {
+	raw := `<165>1 2024-06-01T10:00:00.123+07:00 fw01 sshd 4321 ID47 [origin ip="10.0.0.9"][exampleSDID@32473 iut="3" eventSource="App\"lic\]ation"] ` + "\ufeff" + "Failed password for root\n"
+	m, err := parseSyslog(raw, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Facility != 20 || m.Severity != 5 || m.Hostname != "fw01" || m.AppName != "sshd" || m.ProcID != "4321" || m.MsgID != "ID47" {
+		t.Errorf("unexpected header: %+v", m)
+	}
+	if m.Message != "Failed password for root" {
+		t.Errorf("unexpected message %q", m.Message)
+	}
+	f := m.fields()
+	want := map[string]string{
+		"facility": "local4", "app": "sshd", "procid": "4321", "msgid": "ID47", "hostname": "fw01",
+		"origin.ip": "10.0.0.9", "exampleSDID@32473.iut": "3", "exampleSDID@32473.eventSource": `App"lic]ation`,
+	}
+	for k, v := range want {
+		if f[k] != v {
+			t.Errorf("field %s = %q, want %q", k, f[k], v)
+		}
+	}
+	if !m.Timestamp.Equal(time.Date(2024, 6, 1, 3, 0, 0, 123e6, time.UTC)) {
+		t.Errorf("unexpected timestamp %v", m.Timestamp)
+	}
+
+	m, err = parseSyslog("<14>1 - - - - - -", time.Now())
+	if err != nil || m.Hostname != "" || m.Message != "" || !m.Timestamp.IsZero() {
+		t.Errorf("all-nil message: %+v, %v", m, err)
+	}
+	for _, bad := range []string{"<14>1 2024-06-01T10:00:00Z host", "<14>1 yesterday h a p m -", "<14>1 - h a p m [x a=\"1\"", "<999>hello"} {
+		if _, err := parseSyslog(bad, time.Now()); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestParseSyslog3164(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.Local)
+	m, err := parseSyslog("<34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed for lonvick on /dev/pts/8", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Tháng 10 sau thời điểm hiện tại (tháng 1) nên thuộc năm trước
+	if !m.Timestamp.Equal(time.Date(2023, 10, 11, 22, 14, 15, 0, time.Local)) {
+		t.Errorf("unexpected timestamp %v", m.Timestamp)
+	}
+	if m.Facility != 4 || m.Severity != 2 || m.Hostname != "mymachine" || m.AppName != "su" || m.ProcID != "230" ||
+		m.Message != "'su root' failed for lonvick on /dev/pts/8" {
+		t.Errorf("unexpected message: %+v", m)
+	}
+
+	// Không có hostname sau timestamp, không có PRI
+	m, _ = parseSyslog("Jan  2 11:59:00 kernel: link up", now)
+	if m.Facility != 1 || m.Severity != 5 || m.Hostname != "" || m.AppName != "kernel" || m.Message != "link up" {
+		t.Errorf("unexpected message: %+v", m)
+	}
+	// Không đúng định dạng nào: giữ nguyên làm message
+	m, _ = parseSyslog("<13>just some text", now)
+	if m.Message != "just some text" || m.AppName != "" || !m.Timestamp.IsZero() {
+		t.Errorf("unexpected message: %+v", m)
+	}
+}
+
+func TestReadSyslogFrame(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("11 <14>1 - - -<13>line one\n16 <14>with\nnewline<13>line two"))
+	want := []string{"<14>1 - - -", "<13>line one", "<14>with\nnewline", "<13>line two"}
+	for _, w := range want {
+		got, err := readSyslogFrame(r)
+		if err != nil || got != w {
+			t.Fatalf("got %q, %v; want %q", got, err, w)
+		}
+	}
+	if _, err := readSyslogFrame(r); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestHandleSyslogMessageMapsDevices(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "clients.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE managed_clients (client_id TEXT PRIMARY KEY, agent_id TEXT UNIQUE, hardware_id TEXT,
+		host_name TEXT, ip_address TEXT, mac_address TEXT, user_name TEXT, last_seen TEXT, online INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	agent.SetDB(db)
+	if err := agent.SaveClient(agent.ManagedClient{ClientID: "c1", AgentID: "900", UserName: "alice",
+		DeviceInfo: agent.DeviceInfo{HostName: "SRV-DB", IPAddress: "10.0.0.5", HardwareID: "hw1"}}); err != nil {
+		t.Fatal(err)
+	}
+	devices = &syslogDevices{entries: map[string]syslogDevice{}}
+	helloLastSeenMu.Lock()
+	helloLastSeen = map[string]time.Time{}
+	helloLastSeenMu.Unlock()
+	cfg := &config.ServerConfig{ArchiveFile: filepath.Join(dir, "archive.log"), SyslogAutoRegister: true, SyslogMaxAgentless: 2}
+
+	handleSyslogMessage(cfg, "10.0.0.5", "<38>Jun  1 10:00:00 other-name sshd[1]: by ip")
+	handleSyslogMessage(cfg, "10.0.0.77", "<38>1 2024-06-01T10:00:00Z srv-db sshd - - - spoofed hostname")
+	handleSyslogMessage(cfg, "10.0.0.99", "<38>1 2024-06-01T10:00:00Z sw-core - - - - new device")
+	handleSyslogMessage(cfg, "10.0.0.99", "<38>Jun  1 10:00:01 sw-core lldp: same device")
+	handleSyslogMessage(cfg, "10.0.0.100", "<38>Jun  1 10:00:02 sw-core lldp: new ip")
+	handleSyslogMessage(cfg, "10.0.0.101", "<38>Jun  1 10:00:03 sw-edge lldp: over limit")
+
+	logs, err := logcollector.LoadArchiveLogs(cfg.ArchiveFile)
+	if err != nil || len(logs) != 5 {
+		t.Fatalf("expected 5 logs, got %d, %v", len(logs), err)
+	}
+	if logs[0].AgentID != "900" {
+		t.Errorf("existing device should match by ip: %+v", logs[0])
+	}
+	if logs[1].AgentID == "900" {
+		t.Errorf("hostname must not map a syslog sender to a real agent: %+v", logs[1])
+	}
+	newID := logs[2].AgentID
+	if newID == "" || newID == "900" || newID == logs[1].AgentID || logs[3].AgentID != newID || logs[4].AgentID != newID {
+		t.Errorf("new device should be created once and matched by hostname: %+v", logs[2:])
+	}
+	if n, _ := agent.CountAgentlessClients(); n != 2 {
+		t.Errorf("agentless devices over SyslogMaxAgentless: %d", n)
+	}
+	helloLastSeenMu.RLock()
+	_, realSeen := helloLastSeen["900"]
+	_, agentlessSeen := helloLastSeen[newID]
+	helloLastSeenMu.RUnlock()
+	if realSeen || !agentlessSeen {
+		t.Errorf("syslog must only refresh agentless liveness: real=%v agentless=%v", realSeen, agentlessSeen)
+	}
+	if logs[2].Source != "syslog" || logs[2].Message != "new device" || logs[2].Severity != "info" ||
+		logs[2].Time != time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC).In(time.Local).Format(time.RFC3339) || logs[2].ReceivedAt == "" {
+		t.Errorf("unexpected entry: %+v", logs[2])
+	}
+	c, err := agent.FindClientByAgentID(newID)
+	if err != nil || c == nil || c.DeviceInfo.HardwareID != agent.AgentlessHardwarePrefix+"10.0.0.99" {
+		t.Errorf("agentless client not saved: %+v, %v", c, err)
+	}
+	if c, err := agent.FindClientByAddress("", ""); err != nil || c != nil {
+		t.Errorf("empty ip/hostname should not match: %+v, %v", c, err)
+	}
+}
+
+func TestHandleSyslogMessageSourcePolicy(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "clients.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE managed_clients (client_id TEXT PRIMARY KEY, agent_id TEXT UNIQUE, hardware_id TEXT,
+		host_name TEXT, ip_address TEXT, mac_address TEXT, user_name TEXT, last_seen TEXT, online INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	agent.SetDB(db)
+	if err := agent.SaveClient(agent.ManagedClient{ClientID: "c1", AgentID: "901",
+		DeviceInfo: agent.DeviceInfo{HostName: "fw", IPAddress: "192.168.1.1", HardwareID: agent.AgentlessHardwarePrefix + "192.168.1.1"}}); err != nil {
+		t.Fatal(err)
+	}
+	devices = &syslogDevices{entries: map[string]syslogDevice{}}
+	cfg := &config.ServerConfig{ArchiveFile: filepath.Join(dir, "archive.log"), SyslogAllowedSources: []string{"192.168.1.0/24", "10.1.1.1"}}
+
+	handleSyslogMessage(cfg, "192.168.1.1", "<38>Jun  1 10:00:00 fw kernel: known")
+	handleSyslogMessage(cfg, "192.168.1.2", "<38>Jun  1 10:00:00 sw kernel: auto register off")
+	handleSyslogMessage(cfg, "10.9.9.9", "<38>Jun  1 10:00:00 fw kernel: outside allowlist")
+	logs, _ := logcollector.LoadArchiveLogs(cfg.ArchiveFile)
+	if len(logs) != 1 || logs[0].AgentID != "901" {
+		t.Fatalf("only the known device inside the allowlist should be logged: %+v", logs)
+	}
+	if n, _ := agent.CountAgentlessClients(); n != 1 {
+		t.Errorf("unknown sender must not be registered without SyslogAutoRegister: %d", n)
+	}
+	if !syslogSourceAllowed(cfg.SyslogAllowedSources, "10.1.1.1") || syslogSourceAllowed(cfg.SyslogAllowedSources, "10.1.1.2") {
+		t.Error("single IP allowlist entry not matched exactly")
+	}
+
+	now := time.Now()
+	devices.entries["stale|x"] = syslogDevice{expires: now.Add(-time.Second)}
+	devices.lastSweep = time.Time{}
+	devices.sweep(now)
+	if _, ok := devices.entries["stale|x"]; ok {
+		t.Error("expired cache entries should be evicted")
+	}
+}
@@ -11,7 +11,6 @@ import (
 	"gou-pc/internal/logutil"
 	"io"
 	"net"
-	"os"
 	"sync"
 	"time"
 )
@@ -53,6 +52,13 @@ func UpdateAgentStatusAndLog(cfg *config.ServerConfig) {
 				logutil.CoreError("UpdateClientStatus error: %v", err)
 			}
 		}
+		// Đánh giá rule cảnh báo agent_offline, last_seen trong DB dùng khi server vừa khởi động chưa nhận hello
+		if alertObserver != nil {
+			for _, c := range clients {
+				lastSeen, _ := time.ParseInLocation("02-01-2006 15:04:05", c.LastSeen, time.Local)
+				alertObserver.ObserveAgentStatus(c.AgentID, c.Online, lastSeen)
+			}
+		}
 		// logutil.CoreInfo("Agent offline (quá 30s không gửi hello): %v", offline)
 		time.Sleep(30 * time.Second)
 	}
@@ -112,7 +118,7 @@ func handleConn(conn net.Conn, cfg *config.ServerConfig) {
 			logutil.CoreError("invalid message format: %v", err)
 			return
 		}
-		logutil.CoreInfo("Received: {type:%s, agent_id:%s, data:%v}", req.Type, getAgentIDFromMsg(req), req.Data)
+		logutil.CoreInfo("Received: {type:%s, agent_id:%s, data:%v}", req.Type, getAgentIDFromMsg(req), logData(req))
 
 		var resp agent.Message
 		switch req.Type {
@@ -148,13 +154,17 @@ func handleConn(conn net.Conn, cfg *config.ServerConfig) {
 			logutil.CoreInfo("[REQUEST OTP] from agent_id=%s, data=%v", agentID, req.Data)
 			// Tìm clientID theo agentID
 			clients, _ := agent.LoadClients()
-			var clientID string
+			var clientID, userName string
 			for _, c := range clients {
 				if c.AgentID == agentID {
-					clientID = c.ClientID
+					clientID, userName = c.ClientID, c.UserName
 					break
 				}
 			}
+			if msg, locked := otpLockResponse(agentID, userName); locked {
+				resp = msg
+				break
+			}
 			var otp string
 			if clientID != "" {
 				otp, _ = crypto.GetTOTPByClientID(clientID)
@@ -165,6 +175,35 @@ func handleConn(conn net.Conn, cfg *config.ServerConfig) {
 				Type: agent.TypeRequestOTP,
 				Data: map[string]interface{}{"agent_id": agentID, "otp": otp},
 			}
+		case agent.TypeVerifyOTP:
+			var agentID, otp string
+			if m, ok := req.Data.(map[string]interface{}); ok {
+				if v, ok := m["agent_id"].(string); ok {
+					agentID = v
+				}
+				if payload, ok := m["payload"].(map[string]interface{}); ok {
+					if v, ok := payload["otp"].(string); ok {
+						otp = v
+					}
+				}
+			}
+			logutil.CoreInfo("[VERIFY OTP] from agent_id=%s", agentID)
+			found, _ := agent.FindClientByAgentID(agentID)
+			if found == nil {
+				resp = agent.Message{
+					Type: agent.TypeError,
+					Data: "Agent not registered. Please register again.",
+				}
+				break
+			}
+			valid := crypto.VerifyTOTPByClientID(found.ClientID, otp)
+			if !valid && loginDetector != nil {
+				loginDetector.ObserveOTPFailure(agentID, "")
+			}
+			resp = agent.Message{
+				Type: agent.TypeVerifyOTP,
+				Data: map[string]interface{}{"agent_id": agentID, "valid": valid},
+			}
 		case agent.TypeHello:
 			var agentID string
 			if m, ok := req.Data.(map[string]interface{}); ok {
@@ -191,7 +230,8 @@ func handleConn(conn net.Conn, cfg *config.ServerConfig) {
 				Data: map[string]interface{}{"agent_id": agentID, "payload": req.Data},
 			}
 		case agent.TypeLog:
-			var agentID, message string
+			var agentID, message, source, eventTime, severity, sourceFile string
+			var fields map[string]string
 			if m, ok := req.Data.(map[string]interface{}); ok {
 				if v, ok := m["agent_id"].(string); ok {
 					agentID = v
@@ -200,6 +240,11 @@ func handleConn(conn net.Conn, cfg *config.ServerConfig) {
 					if msg, ok := payload["message"].(string); ok {
 						message = msg
 					}
+					fields = stringFields(payload["fields"])
+					source, _ = payload["source"].(string)
+					eventTime, _ = payload["time"].(string)
+					severity, _ = payload["severity"].(string)
+					sourceFile, _ = payload["source_file"].(string)
 				}
 			}
 			if agentID != "" {
@@ -212,24 +257,27 @@ func handleConn(conn net.Conn, cfg *config.ServerConfig) {
 					break
 				}
 			}
+			now := time.Now()
 			logEntry := ArchiveLogEntry{
-				Time:    time.Now().Format(time.RFC3339),
-				AgentID: agentID,
-				Message: message,
-			}
-			if b, err := json.Marshal(logEntry); err == nil {
-				f, err := os.OpenFile(cfg.ArchiveFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-				if err == nil {
-					f.Write(b)
-					f.Write([]byte("\n"))
-					f.Close()
-				}
+				Time:       logEventTime(eventTime, now),
+				ReceivedAt: now.Format(time.RFC3339),
+				AgentID:    agentID,
+				Message:    message,
+				Fields:     fields,
+				Source:     source,
+				Severity:   logcollector.NormalizeSeverity(severity),
+				SourceFile: sourceFile,
 			}
+			appendArchiveLog(cfg, logEntry)
 			logutil.CoreInfo("[CLIENT LOG] %v", logEntry)
 			resp = agent.Message{
 				Type: agent.TypeLog,
 				Data: map[string]interface{}{"agent_id": agentID, "result": "log received"},
 			}
+		case agent.TypeSecurityEvent:
+			resp = handleSecurityEvent(cfg, req.Data, time.Now())
+		case agent.TypeLoginEvent:
+			resp = handleLoginEvent(cfg, req.Data, time.Now())
 		default:
 			resp = agent.Message{
 				Type: agent.TypeError,
@@ -255,8 +303,96 @@ func handleConn(conn net.Conn, cfg *config.ServerConfig) {
 			logutil.CoreError("write response error: %v", err)
 			return
 		}
-		logutil.CoreInfo("Sent: {type:%s, agent_id:%v, data:%v}", resp.Type, getAgentIDFromResp(resp), resp.Data)
+		logutil.CoreInfo("Sent: {type:%s, agent_id:%v, data:%v}", resp.Type, getAgentIDFromResp(resp), logData(resp))
+	}
+}
+
+// logEventTime chuẩn hoá thời điểm sự kiện agent gửi về RFC3339 giờ local, thiếu hoặc sai định dạng thì dùng giờ nhận
+func logEventTime(s string, received time.Time) string {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t.In(time.Local).Format(time.RFC3339)
+	}
+	return received.Format(time.RFC3339)
+}
+
+// handleSecurityEvent ghi sự kiện bảo mật của agent (ví dụ IPC bị từ chối) thành một dòng log mức warning;
+// agent chưa đăng ký thì trả TypeError như log thường
+func handleSecurityEvent(cfg *config.ServerConfig, data interface{}, now time.Time) agent.Message {
+	var agentID, event, message string
+	if m, ok := data.(map[string]interface{}); ok {
+		if v, ok := m["agent_id"].(string); ok {
+			agentID = v
+		}
+		if payload, ok := m["payload"].(map[string]interface{}); ok {
+			event, _ = payload["event"].(string)
+			message, _ = payload["message"].(string)
+		}
+	}
+	if agentID == "" {
+		return agent.Message{Type: agent.TypeError, Data: "Agent not registered. Please register again."}
+	}
+	if exists, err := agent.AgentExists(agentID); err != nil || !exists {
+		logutil.CoreInfo("[SECURITY EVENT] rejected from unregistered agent_id=%q", agentID)
+		return agent.Message{Type: agent.TypeError, Data: "Agent not registered. Please register again."}
+	}
+	ts := now.Format(time.RFC3339)
+	logEntry := ArchiveLogEntry{
+		Time:       ts,
+		ReceivedAt: ts,
+		AgentID:    agentID,
+		Message:    fmt.Sprintf("[SECURITY] %s: %s", event, message),
+		Severity:   "warning",
+	}
+	appendArchiveLog(cfg, logEntry)
+	logutil.CoreError("[SECURITY EVENT] agent_id=%s event=%s message=%s", agentID, event, message)
+	return agent.Message{
+		Type: agent.TypeSecurityEvent,
+		Data: map[string]interface{}{"agent_id": agentID, "result": "event received"},
+	}
+}
+
+// appendArchiveLog phát log cho client đang tail, cảnh báo, chuyển tiếp syslog rồi lưu qua LogSink đã inject,
+// nếu chưa inject thì ghi thêm một dòng JSON vào file archive
+func appendArchiveLog(cfg *config.ServerConfig, entry ArchiveLogEntry) {
+	logHub.Publish(entry)
+	if alertObserver != nil {
+		alertObserver.ObserveLog(entry)
+	}
+	if logForwarder != nil {
+		logForwarder.Forward(entry)
+	}
+	if ingestor != nil {
+		ingestor.Ingest(entry)
+		return
+	}
+	if err := logcollector.AppendArchive(cfg.ArchiveFile, []ArchiveLogEntry{entry}); err != nil {
+		logutil.CoreError("append archive error: %v", err)
+	}
+}
+
+// stringFields đổi payload.fields (JSON object) thành map[string]string, bỏ qua giá trị không phải chuỗi
+func stringFields(v interface{}) map[string]string {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) == 0 {
+		return nil
+	}
+	fields := make(map[string]string, len(m))
+	for k, val := range m {
+		if s, ok := val.(string); ok {
+			fields[k] = s
+		}
+	}
+	return fields
+}
+
+// logData là phần data của bản tin được phép ghi log: bản tin OTP (mã OTP), sự kiện đăng nhập/bảo mật
+// (username, lý do) không ghi nội dung
+func logData(msg agent.Message) interface{} {
+	switch msg.Type {
+	case agent.TypeRequestOTP, agent.TypeVerifyOTP, agent.TypeLoginEvent, agent.TypeSecurityEvent:
+		return "[redacted]"
 	}
+	return msg.Data
 }
 
 func getAgentIDFromResp(resp agent.Message) interface{} {
@@ -0,0 +1,69 @@
+package tcpserver
+
+import (
+	"database/sql"
+	"fmt"
+	"gou-pc/internal/agent"
+	"gou-pc/internal/config"
+	"gou-pc/internal/logcollector"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleSecurityEvent(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "clients.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE managed_clients (client_id TEXT PRIMARY KEY, agent_id TEXT UNIQUE, hardware_id TEXT,
+		host_name TEXT, ip_address TEXT, mac_address TEXT, user_name TEXT, last_seen TEXT, online INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	agent.SetDB(db)
+	if err := agent.SaveClient(agent.ManagedClient{ClientID: "c1", AgentID: "001", DeviceInfo: agent.DeviceInfo{HardwareID: "hw1"}}); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.ServerConfig{ArchiveFile: filepath.Join(dir, "archive.log")}
+	now := time.Date(2024, 6, 1, 10, 0, 5, 0, time.Local)
+	payload := map[string]interface{}{"event": agent.IPCEventAuthDenied, "message": "legacy GET_SECRET: invalid or missing ipc secret"}
+
+	if resp := handleSecurityEvent(cfg, map[string]interface{}{"agent_id": "001", "payload": payload}, now); resp.Type != agent.TypeSecurityEvent {
+		t.Fatalf("security event rejected: %+v", resp)
+	}
+	for _, data := range []map[string]interface{}{
+		{"agent_id": "999", "payload": payload},
+		{"payload": payload},
+	} {
+		if resp := handleSecurityEvent(cfg, data, now); resp.Type != agent.TypeError {
+			t.Errorf("expected error for %v, got %+v", data, resp)
+		}
+	}
+	logs, err := logcollector.LoadArchiveLogs(cfg.ArchiveFile)
+	if err != nil || len(logs) != 1 || logs[0].AgentID != "001" || logs[0].Severity != "warning" {
+		t.Fatalf("only the registered agent's event should be logged: %+v, %v", logs, err)
+	}
+}
+
+func TestLogDataRedactsSecrets(t *testing.T) {
+	for _, msg := range []agent.Message{
+		{Type: agent.TypeVerifyOTP, Data: map[string]interface{}{"agent_id": "001", "payload": map[string]interface{}{"otp": "123456"}}},
+		{Type: agent.TypeRequestOTP, Data: map[string]interface{}{"agent_id": "001", "otp": "123456"}},
+		{Type: agent.TypeLoginEvent, Data: map[string]interface{}{"agent_id": "001", "payload": map[string]interface{}{"username": "bob"}}},
+		{Type: agent.TypeSecurityEvent, Data: map[string]interface{}{"agent_id": "001", "payload": map[string]interface{}{"message": "x"}}},
+	} {
+		if got := fmt.Sprint(logData(msg)); strings.Contains(got, "123456") || strings.Contains(got, "bob") || got != "[redacted]" {
+			t.Errorf("%s data logged: %s", msg.Type, got)
+		}
+		if id := getAgentIDFromMsg(msg); id != "001" {
+			t.Errorf("%s agent_id = %v", msg.Type, id)
+		}
+	}
+	hello := agent.Message{Type: agent.TypeHello, Data: map[string]interface{}{"agent_id": "001"}}
+	if got := fmt.Sprint(logData(hello)); !strings.Contains(got, "001") {
+		t.Errorf("hello data should be logged, got %s", got)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"io"
+	"net"
+)
+
+const ipcPath = "/run/gou-pc/agent.sock"
+
+func dialIPC() (io.ReadWriteCloser, error) {
+	return net.Dial("unix", ipcPath)
+}
@@ -0,0 +1,16 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"io"
+
+	"github.com/Microsoft/go-winio"
+)
+
+const ipcPath = `\\.\pipe\MySecretServicePipe`
+
+func dialIPC() (io.ReadWriteCloser, error) {
+	return winio.DialPipe(ipcPath, nil)
+}
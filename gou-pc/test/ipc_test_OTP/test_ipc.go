@@ -1,17 +1,17 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"gou-pc/internal/agent"
 	"io"
 	"log"
+	"os"
 	"time"
-
-	"github.com/Microsoft/go-winio"
 )
 
 func main() {
-	pipePath := `\\.\pipe\MySecretServicePipe`
-	log.Println("Đang kết nối đến IPC pipe:", pipePath)
+	log.Println("Đang kết nối đến IPC:", ipcPath)
 
 	var conn io.ReadWriteCloser
 	var err error
@@ -27,7 +27,7 @@ Loop:
 		case <-timeout:
 			log.Fatalf("Không thể kết nối đến pipe sau 5 giây. Đảm bảo client chính đang chạy và đã khởi tạo pipe. Lỗi: %v", err)
 		case <-ticker.C:
-			conn, err = winio.DialPipe(pipePath, nil)
+			conn, err = dialIPC()
 			if err == nil {
 				// Kết nối thành công
 				break Loop
@@ -36,10 +36,45 @@ Loop:
 	}
 
 	defer conn.Close()
+
+	// Shared secret IPC (nếu agent đã được cấp) lấy từ biến môi trường GOU_IPC_SECRET
+	secret := os.Getenv("GOU_IPC_SECRET")
+
+	// Tham số "legacy": gửi bản tin text GET_SECRET như credential provider (C++)
+	if len(os.Args) > 1 && os.Args[1] == "legacy" {
+		legacyGetSecret(conn, secret)
+		return
+	}
+
+	// Giao thức mới: lần lượt gọi các lệnh IPC
+	commands := []agent.IPCRequest{
+		{Version: agent.IPCProtocolVersion, ID: "1", Command: agent.IPCCmdAgentStatus, Auth: secret},
+		{Version: agent.IPCProtocolVersion, ID: "2", Command: agent.IPCCmdDeviceInfo, Auth: secret},
+		{Version: agent.IPCProtocolVersion, ID: "3", Command: agent.IPCCmdGetOTP, Auth: secret},
+	}
+	for _, req := range commands {
+		log.Printf("Kết nối thành công. Đang gửi lệnh '%s'...", req.Command)
+		if err := agent.WriteIPCFrame(conn, req); err != nil {
+			log.Fatalf("Gửi yêu cầu thất bại: %v", err)
+		}
+		var resp agent.IPCResponse
+		if err := agent.ReadIPCFrame(conn, &resp); err != nil {
+			log.Fatalf("Đọc phản hồi thất bại: %v", err)
+		}
+		b, _ := json.MarshalIndent(resp, "", "  ")
+		fmt.Printf("--- PHẢN HỒI '%s' ---\n%s\n", req.Command, b)
+	}
+}
+
+func legacyGetSecret(conn io.ReadWriter, secret string) {
 	log.Println("Kết nối thành công. Đang gửi yêu cầu 'GET_SECRET'...")
 
 	// Gửi yêu cầu
-	_, err = conn.Write([]byte("GET_SECRET"))
+	request := "GET_SECRET"
+	if secret != "" {
+		request += " " + secret
+	}
+	_, err := conn.Write([]byte(request))
 	if err != nil {
 		log.Fatalf("Gửi yêu cầu thất bại: %v", err)
 	}